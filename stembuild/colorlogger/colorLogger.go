@@ -35,7 +35,7 @@ func New(logLevel int, color bool, writer io.Writer) Logger {
 
 func (cl *colorLogger) Printf(format string, a ...interface{}) {
 	if cl.logLevel >= DEBUG && cl.logLevel != NONE {
-		cl.logger.Printf("%s %s", cl.prefix(), fmt.Sprintf(format, a...))
+		cl.logger.Printf("%s %s", cl.prefix(), Redact(fmt.Sprintf(format, a...)))
 	}
 }
 
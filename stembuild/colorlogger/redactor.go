@@ -0,0 +1,116 @@
+package colorlogger
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces every registered secret in redacted output.
+const Redacted = "[REDACTED]"
+
+// Redactor masks registered secrets, including their URL-encoded forms, in
+// any text passed through it.
+type Redactor struct {
+	mutex   sync.RWMutex
+	secrets []string
+}
+
+func NewRedactor() *Redactor {
+	return &Redactor{}
+}
+
+func (r *Redactor) Register(secret string) {
+	if secret == "" {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, s := range []string{secret, url.QueryEscape(secret), url.PathEscape(secret), url.UserPassword("", secret).String()[1:]} {
+		if s != "" && !slices.Contains(r.secrets, s) {
+			r.secrets = append(r.secrets, s)
+		}
+	}
+
+	// Replace longer secrets first so that a secret containing another one is
+	// masked as a whole.
+	sort.SliceStable(r.secrets, func(i, j int) bool {
+		return len(r.secrets[i]) > len(r.secrets[j])
+	})
+}
+
+func (r *Redactor) Redact(s string) string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+
+	return s
+}
+
+var defaultRedactor = NewRedactor()
+
+// RegisterSecret adds a secret to the redactor used by every logger,
+// messenger and Errorf in stembuild.
+func RegisterSecret(secret string) {
+	defaultRedactor.Register(secret)
+}
+
+// Redact masks every registered secret in s.
+func Redact(s string) string {
+	return defaultRedactor.Redact(s)
+}
+
+type redactedError struct {
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return Redact(e.err.Error())
+}
+
+func (e *redactedError) Unwrap() []error {
+	switch err := e.err.(type) {
+	case interface{ Unwrap() []error }:
+		return err.Unwrap()
+	default:
+		if wrapped := errors.Unwrap(e.err); wrapped != nil {
+			return []error{wrapped}
+		}
+		return nil
+	}
+}
+
+// Errorf is fmt.Errorf with every registered secret masked in the message.
+// Errors wrapped with %w can still be matched with errors.Is and errors.As.
+func Errorf(format string, a ...interface{}) error {
+	return &redactedError{fmt.Errorf(format, a...)}
+}
+
+type redactingWriter struct {
+	w io.Writer
+}
+
+// NewRedactingWriter returns a writer that masks every registered secret
+// before writing to w. Secrets are only masked within a single Write.
+func NewRedactingWriter(w io.Writer) io.Writer {
+	return &redactingWriter{w}
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	_, err := io.WriteString(w.w, Redact(string(p)))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
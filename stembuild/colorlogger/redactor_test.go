@@ -0,0 +1,85 @@
+package colorlogger_test
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
+)
+
+var _ = Describe("Redactor", func() {
+	var redactor *colorlogger.Redactor
+
+	BeforeEach(func() {
+		redactor = colorlogger.NewRedactor()
+	})
+
+	It("masks a registered secret", func() {
+		redactor.Register("hunter2")
+
+		Expect(redactor.Redact("password is hunter2, again hunter2")).To(Equal("password is [REDACTED], again [REDACTED]"))
+	})
+
+	It("masks the URL-encoded forms of a registered secret", func() {
+		secret := "p@ss word/with:specials"
+		redactor.Register(secret)
+
+		Expect(redactor.Redact(url.QueryEscape(secret))).To(Equal(colorlogger.Redacted))
+		Expect(redactor.Redact(url.PathEscape(secret))).To(Equal(colorlogger.Redacted))
+		Expect(redactor.Redact(url.UserPassword("user", secret).String())).To(Equal("user:" + colorlogger.Redacted))
+	})
+
+	It("masks the longest secret first", func() {
+		redactor.Register("pass")
+		redactor.Register("password123")
+
+		Expect(redactor.Redact("password123")).To(Equal(colorlogger.Redacted))
+	})
+
+	It("ignores empty secrets", func() {
+		redactor.Register("")
+
+		Expect(redactor.Redact("nothing to hide")).To(Equal("nothing to hide"))
+	})
+})
+
+var _ = Describe("Errorf", func() {
+	It("masks registered secrets in the message and keeps the wrapped error", func() {
+		colorlogger.RegisterSecret("errorf-secret")
+		cause := errors.New("cause")
+
+		err := colorlogger.Errorf("login with errorf-secret failed: %w", cause)
+
+		Expect(err.Error()).To(Equal("login with [REDACTED] failed: cause"))
+		Expect(errors.Is(err, cause)).To(BeTrue())
+	})
+})
+
+var _ = Describe("NewRedactingWriter", func() {
+	It("masks registered secrets before writing", func() {
+		colorlogger.RegisterSecret("writer-secret")
+		buf := bytes.Buffer{}
+
+		n, err := colorlogger.NewRedactingWriter(&buf).Write([]byte("token=writer-secret"))
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(len("token=writer-secret")))
+		Expect(buf.String()).To(Equal("token=[REDACTED]"))
+	})
+})
+
+var _ = Describe("Logger", func() {
+	It("masks registered secrets in debug output", func() {
+		colorlogger.RegisterSecret("logger-secret")
+		buf := bytes.Buffer{}
+
+		logger := colorlogger.New(colorlogger.DEBUG, false, &buf)
+		logger.Printf("connecting with %s", "logger-secret")
+
+		Expect(buf.String()).To(Equal("debug: connecting with [REDACTED]\n"))
+	})
+})
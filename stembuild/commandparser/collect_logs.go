@@ -0,0 +1,156 @@
+package commandparser
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/google/subcommands"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct/config"
+)
+
+//counterfeiter:generate . DiagnosticsCollector
+type DiagnosticsCollector interface {
+	Collect() (string, error)
+}
+
+//counterfeiter:generate . DiagnosticsCollectorFactory
+type DiagnosticsCollectorFactory interface {
+	NewDiagnosticsCollector(ctx context.Context, config config.SourceConfig, vCenterManager VCenterManager) (DiagnosticsCollector, error)
+}
+
+type CollectLogsCmd struct {
+	ctx                 context.Context
+	sourceConfig        config.SourceConfig
+	collectorFactory    DiagnosticsCollectorFactory
+	managerFactory      ManagerFactory
+	validator           ConstructCmdValidator
+	GlobalFlags         *GlobalFlags
+	Stdin               io.Reader
+	output              io.Writer
+	errOutput           io.Writer
+	configFile          string
+	vmPasswordFile      string
+	vCenterPasswordFile string
+}
+
+func NewCollectLogsCmd(ctx context.Context, collectorFactory DiagnosticsCollectorFactory, managerFactory ManagerFactory, validator ConstructCmdValidator, output, errOutput io.Writer) *CollectLogsCmd {
+	return &CollectLogsCmd{
+		ctx:              ctx,
+		collectorFactory: collectorFactory,
+		managerFactory:   managerFactory,
+		validator:        validator,
+		output:           output,
+		errOutput:        errOutput,
+	}
+}
+
+func (*CollectLogsCmd) Name() string { return "collect-logs" }
+func (*CollectLogsCmd) Synopsis() string {
+	return "Downloads the stemcell automation, sysprep and Windows Update logs from a VM on vCenter into a diagnostics zip"
+}
+
+func (*CollectLogsCmd) Usage() string {
+	return fmt.Sprintf(`%[1]s collect-logs -vm-ip <IP of VM> -vm-username <vm username> -vm-password <vm password>  -vcenter-url <vCenter URL> -vcenter-username <vCenter username> -vcenter-password <vCenter password> -vm-inventory-path <vCenter VM inventory path>
+
+Downloads the files construct collects when it fails into diagnostics-<time>.zip, for a VM that
+construct left behind or that is still being provisioned. Each file is downloaded over WinRM, or
+through VMware Tools when WinRM cannot reach the VM. Files which cannot be downloaded are listed
+in errors.txt in the zip.
+
+Requirements:
+	The [vm-username], [vm-password], [vcenter-url], [vcenter-username], [vcenter-password], [vm-inventory-path] must be specified,
+	as well as [vm-ip] unless '-transport guestops' is used, either as flags or in the 'construct' section of a [config] file.
+	Passwords can also be read from a file with [vm-password-file]/[vcenter-password-file], from stdin with '-',
+	or from the %[2]s/%[3]s environment variables.
+
+Example:
+	%[1]s collect-logs -vm-ip '10.0.0.5' -vm-username Admin -vm-password 'password' -vcenter-url vcenter.example.com -vcenter-username root -vcenter-password 'password' -vm-inventory-path '/datacenter/vm/folder/vm-name'
+
+Flags:
+`, filepath.Base(os.Args[0]), VMPasswordEnvVar, VCenterPasswordEnvVar)
+}
+
+func (p *CollectLogsCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&p.configFile, "config", "", "YAML or JSON file with the 'construct' settings; values may reference environment variables as ${NAME}")
+	setVMFlags(f, &p.sourceConfig, &p.vmPasswordFile, &p.vCenterPasswordFile)
+	f.StringVar(&p.sourceConfig.LogDir, "log-dir", "", "directory to save the diagnostics zip to, defaults to the working directory")
+}
+
+func (p *CollectLogsCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	output := p.output
+	if p.GlobalFlags != nil && p.GlobalFlags.Events != nil {
+		// stdout holds the event stream.
+		output = p.errOutput
+	}
+
+	setFlags := explicitFlags(f)
+	if p.configFile != "" {
+		configFile, err := LoadConfigFile(p.configFile)
+		if err != nil {
+			p.printError(fmt.Sprintf("Invalid config file: %s", err))
+			return subcommands.ExitFailure
+		}
+		p.sourceConfig = mergeConstructConfig(configFile.Construct, p.sourceConfig, setFlags)
+	}
+
+	err := resolveSecrets(vmSecrets(&p.sourceConfig, p.vmPasswordFile, p.vCenterPasswordFile), setFlags, p.stdin())
+	if err != nil {
+		p.printError(err.Error())
+		return subcommands.ExitFailure
+	}
+	registerSecrets(p.sourceConfig)
+
+	if !p.validator.PopulatedArgs(requiredVMArgs(p.sourceConfig)...) {
+		p.printError("Not all required parameters were provided. See stembuild --help for more details")
+		return subcommands.ExitFailure
+	}
+	err = p.sourceConfig.Validate()
+	if err != nil {
+		p.printError(fmt.Sprintf("Invalid arguments: %s", err))
+		return subcommands.ExitFailure
+	}
+
+	p.managerFactory.SetConfig(vCenterFactoryConfig(p.sourceConfig))
+
+	ctx, _, stop := notifyOnInterrupt(p.ctx, p.errOutput)
+	defer stop()
+
+	vCenterManager, err := p.managerFactory.VCenterManager(ctx)
+	if err != nil {
+		p.printError(fmt.Sprintf("Could not collect logs: %s", err))
+		return subcommands.ExitFailure
+	}
+
+	collector, err := p.collectorFactory.NewDiagnosticsCollector(ctx, p.sourceConfig, vCenterManager)
+	if err != nil {
+		p.printError(fmt.Sprintf("Could not collect logs: %s", err))
+		return subcommands.ExitFailure
+	}
+
+	path, err := collector.Collect()
+	if err != nil {
+		p.printError(fmt.Sprintf("Could not collect logs: %s", err))
+		return subcommands.ExitFailure
+	}
+
+	fmt.Fprintf(output, "Diagnostics saved to %s\n", path) //nolint:errcheck
+	return subcommands.ExitSuccess
+}
+
+func (p *CollectLogsCmd) printError(message string) {
+	fmt.Fprintln(p.errOutput, colorlogger.Redact(message)) //nolint:errcheck
+}
+
+func (p *CollectLogsCmd) stdin() io.Reader {
+	if p.Stdin == nil {
+		return os.Stdin
+	}
+
+	return p.Stdin
+}
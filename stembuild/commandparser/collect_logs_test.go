@@ -0,0 +1,108 @@
+package commandparser_test
+
+import (
+	"context"
+	"errors"
+	"flag"
+
+	"github.com/google/subcommands"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/commandparser"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/commandparser/commandparserfakes"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/events"
+)
+
+var _ = Describe("collect-logs", func() {
+	var (
+		f                  *flag.FlagSet
+		cmd                *commandparser.CollectLogsCmd
+		fakeFactory        *commandparserfakes.FakeDiagnosticsCollectorFactory
+		fakeCollector      *commandparserfakes.FakeDiagnosticsCollector
+		fakeManagerFactory *commandparserfakes.FakeManagerFactory
+		fakeValidator      *commandparserfakes.FakeConstructCmdValidator
+		stdout, stderr     *Buffer
+	)
+
+	BeforeEach(func() {
+		f = flag.NewFlagSet("test", flag.ContinueOnError)
+		fakeFactory = &commandparserfakes.FakeDiagnosticsCollectorFactory{}
+		fakeCollector = &commandparserfakes.FakeDiagnosticsCollector{}
+		fakeCollector.CollectReturns("logs/diagnostics-20240101T000000.zip", nil)
+		fakeFactory.NewDiagnosticsCollectorReturns(fakeCollector, nil)
+		fakeManagerFactory = &commandparserfakes.FakeManagerFactory{}
+		fakeValidator = &commandparserfakes.FakeConstructCmdValidator{}
+		fakeValidator.PopulatedArgsReturns(true)
+		stdout, stderr = NewBuffer(), NewBuffer()
+
+		cmd = commandparser.NewCollectLogsCmd(context.Background(), fakeFactory, fakeManagerFactory, fakeValidator, stdout, stderr)
+		cmd.SetFlags(f)
+		cmd.GlobalFlags = &commandparser.GlobalFlags{}
+	})
+
+	It("collects the diagnostics from the VM and prints where they are saved", func() {
+		Expect(f.Parse([]string{
+			"-vm-ip", "10.0.0.5",
+			"-vm-username", "Admin",
+			"-vm-password", "some_password",
+			"-vcenter-url", "vcenter.example.com",
+			"-vcenter-username", "root",
+			"-vcenter-password", "vcenter_password",
+			"-vm-inventory-path", "/dc/vm/folder/vm",
+			"-diagnostics-path", `C:\provision\log.log`,
+			"-log-dir", "logs",
+		})).To(Succeed())
+
+		exitStatus := cmd.Execute(context.Background(), f)
+
+		Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+		Expect(fakeManagerFactory.SetConfigArgsForCall(0).VCenterServer).To(Equal("vcenter.example.com"))
+		_, sourceConfig, _ := fakeFactory.NewDiagnosticsCollectorArgsForCall(0)
+		Expect(sourceConfig.GuestVmIp).To(Equal("10.0.0.5"))
+		Expect(sourceConfig.VmInventoryPath).To(Equal("/dc/vm/folder/vm"))
+		Expect(sourceConfig.DiagnosticsPaths).To(Equal([]string{`C:\provision\log.log`}))
+		Expect(sourceConfig.LogDir).To(Equal("logs"))
+		Expect(fakeCollector.CollectCallCount()).To(Equal(1))
+		Expect(stdout).To(Say("Diagnostics saved to logs/diagnostics-20240101T000000.zip\n"))
+	})
+
+	It("prints where the diagnostics are saved to stderr when stdout holds the event stream", func() {
+		cmd.GlobalFlags.Events = events.NewEmitter(NewBuffer())
+
+		Expect(cmd.Execute(context.Background(), f)).To(Equal(subcommands.ExitSuccess))
+
+		Expect(stdout.Contents()).To(BeEmpty())
+		Expect(stderr).To(Say("Diagnostics saved to"))
+	})
+
+	It("fails when not all required parameters are given", func() {
+		fakeValidator.PopulatedArgsReturns(false)
+
+		exitStatus := cmd.Execute(context.Background(), f)
+
+		Expect(exitStatus).To(Equal(subcommands.ExitFailure))
+		Expect(stderr).To(Say("Not all required parameters were provided"))
+		Expect(fakeFactory.NewDiagnosticsCollectorCallCount()).To(Equal(0))
+	})
+
+	It("fails when vCenter cannot be reached", func() {
+		fakeManagerFactory.VCenterManagerReturns(nil, errors.New("no such host"))
+
+		exitStatus := cmd.Execute(context.Background(), f)
+
+		Expect(exitStatus).To(Equal(subcommands.ExitFailure))
+		Expect(stderr).To(Say("Could not collect logs: no such host"))
+	})
+
+	It("fails when the diagnostics cannot be collected", func() {
+		fakeCollector.CollectReturns("", errors.New("the VM cannot be reached"))
+
+		exitStatus := cmd.Execute(context.Background(), f)
+
+		Expect(exitStatus).To(Equal(subcommands.ExitFailure))
+		Expect(stderr).To(Say("Could not collect logs: the VM cannot be reached"))
+		Expect(stdout.Contents()).To(BeEmpty())
+	})
+})
@@ -22,6 +22,21 @@ type FakeConstructMessenger struct {
 	cannotPrepareVMArgsForCall []struct {
 		arg1 error
 	}
+	InvalidConfigFileStub        func(error)
+	invalidConfigFileMutex       sync.RWMutex
+	invalidConfigFileArgsForCall []struct {
+		arg1 error
+	}
+	InvalidSecretStub        func(error)
+	invalidSecretMutex       sync.RWMutex
+	invalidSecretArgsForCall []struct {
+		arg1 error
+	}
+	InvalidSourceConfigStub        func(error)
+	invalidSourceConfigMutex       sync.RWMutex
+	invalidSourceConfigArgsForCall []struct {
+		arg1 error
+	}
 	LGPONotFoundStub        func()
 	lGPONotFoundMutex       sync.RWMutex
 	lGPONotFoundArgsForCall []struct {
@@ -118,6 +133,102 @@ func (fake *FakeConstructMessenger) CannotPrepareVMArgsForCall(i int) error {
 	return argsForCall.arg1
 }
 
+func (fake *FakeConstructMessenger) InvalidConfigFile(arg1 error) {
+	fake.invalidConfigFileMutex.Lock()
+	fake.invalidConfigFileArgsForCall = append(fake.invalidConfigFileArgsForCall, struct {
+		arg1 error
+	}{arg1})
+	stub := fake.InvalidConfigFileStub
+	fake.recordInvocation("InvalidConfigFile", []interface{}{arg1})
+	fake.invalidConfigFileMutex.Unlock()
+	if stub != nil {
+		fake.InvalidConfigFileStub(arg1)
+	}
+}
+
+func (fake *FakeConstructMessenger) InvalidConfigFileCallCount() int {
+	fake.invalidConfigFileMutex.RLock()
+	defer fake.invalidConfigFileMutex.RUnlock()
+	return len(fake.invalidConfigFileArgsForCall)
+}
+
+func (fake *FakeConstructMessenger) InvalidConfigFileCalls(stub func(error)) {
+	fake.invalidConfigFileMutex.Lock()
+	defer fake.invalidConfigFileMutex.Unlock()
+	fake.InvalidConfigFileStub = stub
+}
+
+func (fake *FakeConstructMessenger) InvalidConfigFileArgsForCall(i int) error {
+	fake.invalidConfigFileMutex.RLock()
+	defer fake.invalidConfigFileMutex.RUnlock()
+	argsForCall := fake.invalidConfigFileArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeConstructMessenger) InvalidSecret(arg1 error) {
+	fake.invalidSecretMutex.Lock()
+	fake.invalidSecretArgsForCall = append(fake.invalidSecretArgsForCall, struct {
+		arg1 error
+	}{arg1})
+	stub := fake.InvalidSecretStub
+	fake.recordInvocation("InvalidSecret", []interface{}{arg1})
+	fake.invalidSecretMutex.Unlock()
+	if stub != nil {
+		fake.InvalidSecretStub(arg1)
+	}
+}
+
+func (fake *FakeConstructMessenger) InvalidSecretCallCount() int {
+	fake.invalidSecretMutex.RLock()
+	defer fake.invalidSecretMutex.RUnlock()
+	return len(fake.invalidSecretArgsForCall)
+}
+
+func (fake *FakeConstructMessenger) InvalidSecretCalls(stub func(error)) {
+	fake.invalidSecretMutex.Lock()
+	defer fake.invalidSecretMutex.Unlock()
+	fake.InvalidSecretStub = stub
+}
+
+func (fake *FakeConstructMessenger) InvalidSecretArgsForCall(i int) error {
+	fake.invalidSecretMutex.RLock()
+	defer fake.invalidSecretMutex.RUnlock()
+	argsForCall := fake.invalidSecretArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeConstructMessenger) InvalidSourceConfig(arg1 error) {
+	fake.invalidSourceConfigMutex.Lock()
+	fake.invalidSourceConfigArgsForCall = append(fake.invalidSourceConfigArgsForCall, struct {
+		arg1 error
+	}{arg1})
+	stub := fake.InvalidSourceConfigStub
+	fake.recordInvocation("InvalidSourceConfig", []interface{}{arg1})
+	fake.invalidSourceConfigMutex.Unlock()
+	if stub != nil {
+		fake.InvalidSourceConfigStub(arg1)
+	}
+}
+
+func (fake *FakeConstructMessenger) InvalidSourceConfigCallCount() int {
+	fake.invalidSourceConfigMutex.RLock()
+	defer fake.invalidSourceConfigMutex.RUnlock()
+	return len(fake.invalidSourceConfigArgsForCall)
+}
+
+func (fake *FakeConstructMessenger) InvalidSourceConfigCalls(stub func(error)) {
+	fake.invalidSourceConfigMutex.Lock()
+	defer fake.invalidSourceConfigMutex.Unlock()
+	fake.InvalidSourceConfigStub = stub
+}
+
+func (fake *FakeConstructMessenger) InvalidSourceConfigArgsForCall(i int) error {
+	fake.invalidSourceConfigMutex.RLock()
+	defer fake.invalidSourceConfigMutex.RUnlock()
+	argsForCall := fake.invalidSourceConfigArgsForCall[i]
+	return argsForCall.arg1
+}
+
 func (fake *FakeConstructMessenger) LGPONotFound() {
 	fake.lGPONotFoundMutex.Lock()
 	fake.lGPONotFoundArgsForCall = append(fake.lGPONotFoundArgsForCall, struct {
@@ -151,6 +262,12 @@ func (fake *FakeConstructMessenger) Invocations() map[string][][]interface{} {
 	defer fake.cannotConnectToVMMutex.RUnlock()
 	fake.cannotPrepareVMMutex.RLock()
 	defer fake.cannotPrepareVMMutex.RUnlock()
+	fake.invalidConfigFileMutex.RLock()
+	defer fake.invalidConfigFileMutex.RUnlock()
+	fake.invalidSecretMutex.RLock()
+	defer fake.invalidSecretMutex.RUnlock()
+	fake.invalidSourceConfigMutex.RLock()
+	defer fake.invalidSourceConfigMutex.RUnlock()
 	fake.lGPONotFoundMutex.RLock()
 	defer fake.lGPONotFoundMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
@@ -0,0 +1,122 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package commandparserfakes
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/commandparser"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct/config"
+)
+
+type FakeDiagnosticsCollectorFactory struct {
+	NewDiagnosticsCollectorStub        func(context.Context, config.SourceConfig, commandparser.VCenterManager) (commandparser.DiagnosticsCollector, error)
+	newDiagnosticsCollectorMutex       sync.RWMutex
+	newDiagnosticsCollectorArgsForCall []struct {
+		arg1 context.Context
+		arg2 config.SourceConfig
+		arg3 commandparser.VCenterManager
+	}
+	newDiagnosticsCollectorReturns struct {
+		result1 commandparser.DiagnosticsCollector
+		result2 error
+	}
+	newDiagnosticsCollectorReturnsOnCall map[int]struct {
+		result1 commandparser.DiagnosticsCollector
+		result2 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeDiagnosticsCollectorFactory) NewDiagnosticsCollector(arg1 context.Context, arg2 config.SourceConfig, arg3 commandparser.VCenterManager) (commandparser.DiagnosticsCollector, error) {
+	fake.newDiagnosticsCollectorMutex.Lock()
+	ret, specificReturn := fake.newDiagnosticsCollectorReturnsOnCall[len(fake.newDiagnosticsCollectorArgsForCall)]
+	fake.newDiagnosticsCollectorArgsForCall = append(fake.newDiagnosticsCollectorArgsForCall, struct {
+		arg1 context.Context
+		arg2 config.SourceConfig
+		arg3 commandparser.VCenterManager
+	}{arg1, arg2, arg3})
+	stub := fake.NewDiagnosticsCollectorStub
+	fakeReturns := fake.newDiagnosticsCollectorReturns
+	fake.recordInvocation("NewDiagnosticsCollector", []interface{}{arg1, arg2, arg3})
+	fake.newDiagnosticsCollectorMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeDiagnosticsCollectorFactory) NewDiagnosticsCollectorCallCount() int {
+	fake.newDiagnosticsCollectorMutex.RLock()
+	defer fake.newDiagnosticsCollectorMutex.RUnlock()
+	return len(fake.newDiagnosticsCollectorArgsForCall)
+}
+
+func (fake *FakeDiagnosticsCollectorFactory) NewDiagnosticsCollectorCalls(stub func(context.Context, config.SourceConfig, commandparser.VCenterManager) (commandparser.DiagnosticsCollector, error)) {
+	fake.newDiagnosticsCollectorMutex.Lock()
+	defer fake.newDiagnosticsCollectorMutex.Unlock()
+	fake.NewDiagnosticsCollectorStub = stub
+}
+
+func (fake *FakeDiagnosticsCollectorFactory) NewDiagnosticsCollectorArgsForCall(i int) (context.Context, config.SourceConfig, commandparser.VCenterManager) {
+	fake.newDiagnosticsCollectorMutex.RLock()
+	defer fake.newDiagnosticsCollectorMutex.RUnlock()
+	argsForCall := fake.newDiagnosticsCollectorArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeDiagnosticsCollectorFactory) NewDiagnosticsCollectorReturns(result1 commandparser.DiagnosticsCollector, result2 error) {
+	fake.newDiagnosticsCollectorMutex.Lock()
+	defer fake.newDiagnosticsCollectorMutex.Unlock()
+	fake.NewDiagnosticsCollectorStub = nil
+	fake.newDiagnosticsCollectorReturns = struct {
+		result1 commandparser.DiagnosticsCollector
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDiagnosticsCollectorFactory) NewDiagnosticsCollectorReturnsOnCall(i int, result1 commandparser.DiagnosticsCollector, result2 error) {
+	fake.newDiagnosticsCollectorMutex.Lock()
+	defer fake.newDiagnosticsCollectorMutex.Unlock()
+	fake.NewDiagnosticsCollectorStub = nil
+	if fake.newDiagnosticsCollectorReturnsOnCall == nil {
+		fake.newDiagnosticsCollectorReturnsOnCall = make(map[int]struct {
+			result1 commandparser.DiagnosticsCollector
+			result2 error
+		})
+	}
+	fake.newDiagnosticsCollectorReturnsOnCall[i] = struct {
+		result1 commandparser.DiagnosticsCollector
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeDiagnosticsCollectorFactory) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.newDiagnosticsCollectorMutex.RLock()
+	defer fake.newDiagnosticsCollectorMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeDiagnosticsCollectorFactory) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ commandparser.DiagnosticsCollectorFactory = new(FakeDiagnosticsCollectorFactory)
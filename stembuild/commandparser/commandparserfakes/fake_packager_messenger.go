@@ -18,16 +18,34 @@ type FakePackagerMessenger struct {
 	doesNotHaveEnoughSpaceArgsForCall []struct {
 		arg1 error
 	}
+	InvalidConfigFileStub        func(error)
+	invalidConfigFileMutex       sync.RWMutex
+	invalidConfigFileArgsForCall []struct {
+		arg1 error
+	}
 	InvalidOutputConfigStub        func(error)
 	invalidOutputConfigMutex       sync.RWMutex
 	invalidOutputConfigArgsForCall []struct {
 		arg1 error
 	}
+	InvalidSecretStub        func(error)
+	invalidSecretMutex       sync.RWMutex
+	invalidSecretArgsForCall []struct {
+		arg1 error
+	}
 	PackageFailedStub        func(error)
 	packageFailedMutex       sync.RWMutex
 	packageFailedArgsForCall []struct {
 		arg1 error
 	}
+	PackageStartedStub        func()
+	packageStartedMutex       sync.RWMutex
+	packageStartedArgsForCall []struct {
+	}
+	PackageSucceededStub        func()
+	packageSucceededMutex       sync.RWMutex
+	packageSucceededArgsForCall []struct {
+	}
 	SourceParametersAreInvalidStub        func(error)
 	sourceParametersAreInvalidMutex       sync.RWMutex
 	sourceParametersAreInvalidArgsForCall []struct {
@@ -101,6 +119,38 @@ func (fake *FakePackagerMessenger) DoesNotHaveEnoughSpaceArgsForCall(i int) erro
 	return argsForCall.arg1
 }
 
+func (fake *FakePackagerMessenger) InvalidConfigFile(arg1 error) {
+	fake.invalidConfigFileMutex.Lock()
+	fake.invalidConfigFileArgsForCall = append(fake.invalidConfigFileArgsForCall, struct {
+		arg1 error
+	}{arg1})
+	stub := fake.InvalidConfigFileStub
+	fake.recordInvocation("InvalidConfigFile", []interface{}{arg1})
+	fake.invalidConfigFileMutex.Unlock()
+	if stub != nil {
+		fake.InvalidConfigFileStub(arg1)
+	}
+}
+
+func (fake *FakePackagerMessenger) InvalidConfigFileCallCount() int {
+	fake.invalidConfigFileMutex.RLock()
+	defer fake.invalidConfigFileMutex.RUnlock()
+	return len(fake.invalidConfigFileArgsForCall)
+}
+
+func (fake *FakePackagerMessenger) InvalidConfigFileCalls(stub func(error)) {
+	fake.invalidConfigFileMutex.Lock()
+	defer fake.invalidConfigFileMutex.Unlock()
+	fake.InvalidConfigFileStub = stub
+}
+
+func (fake *FakePackagerMessenger) InvalidConfigFileArgsForCall(i int) error {
+	fake.invalidConfigFileMutex.RLock()
+	defer fake.invalidConfigFileMutex.RUnlock()
+	argsForCall := fake.invalidConfigFileArgsForCall[i]
+	return argsForCall.arg1
+}
+
 func (fake *FakePackagerMessenger) InvalidOutputConfig(arg1 error) {
 	fake.invalidOutputConfigMutex.Lock()
 	fake.invalidOutputConfigArgsForCall = append(fake.invalidOutputConfigArgsForCall, struct {
@@ -133,6 +183,38 @@ func (fake *FakePackagerMessenger) InvalidOutputConfigArgsForCall(i int) error {
 	return argsForCall.arg1
 }
 
+func (fake *FakePackagerMessenger) InvalidSecret(arg1 error) {
+	fake.invalidSecretMutex.Lock()
+	fake.invalidSecretArgsForCall = append(fake.invalidSecretArgsForCall, struct {
+		arg1 error
+	}{arg1})
+	stub := fake.InvalidSecretStub
+	fake.recordInvocation("InvalidSecret", []interface{}{arg1})
+	fake.invalidSecretMutex.Unlock()
+	if stub != nil {
+		fake.InvalidSecretStub(arg1)
+	}
+}
+
+func (fake *FakePackagerMessenger) InvalidSecretCallCount() int {
+	fake.invalidSecretMutex.RLock()
+	defer fake.invalidSecretMutex.RUnlock()
+	return len(fake.invalidSecretArgsForCall)
+}
+
+func (fake *FakePackagerMessenger) InvalidSecretCalls(stub func(error)) {
+	fake.invalidSecretMutex.Lock()
+	defer fake.invalidSecretMutex.Unlock()
+	fake.InvalidSecretStub = stub
+}
+
+func (fake *FakePackagerMessenger) InvalidSecretArgsForCall(i int) error {
+	fake.invalidSecretMutex.RLock()
+	defer fake.invalidSecretMutex.RUnlock()
+	argsForCall := fake.invalidSecretArgsForCall[i]
+	return argsForCall.arg1
+}
+
 func (fake *FakePackagerMessenger) PackageFailed(arg1 error) {
 	fake.packageFailedMutex.Lock()
 	fake.packageFailedArgsForCall = append(fake.packageFailedArgsForCall, struct {
@@ -165,6 +247,54 @@ func (fake *FakePackagerMessenger) PackageFailedArgsForCall(i int) error {
 	return argsForCall.arg1
 }
 
+func (fake *FakePackagerMessenger) PackageStarted() {
+	fake.packageStartedMutex.Lock()
+	fake.packageStartedArgsForCall = append(fake.packageStartedArgsForCall, struct {
+	}{})
+	stub := fake.PackageStartedStub
+	fake.recordInvocation("PackageStarted", []interface{}{})
+	fake.packageStartedMutex.Unlock()
+	if stub != nil {
+		fake.PackageStartedStub()
+	}
+}
+
+func (fake *FakePackagerMessenger) PackageStartedCallCount() int {
+	fake.packageStartedMutex.RLock()
+	defer fake.packageStartedMutex.RUnlock()
+	return len(fake.packageStartedArgsForCall)
+}
+
+func (fake *FakePackagerMessenger) PackageStartedCalls(stub func()) {
+	fake.packageStartedMutex.Lock()
+	defer fake.packageStartedMutex.Unlock()
+	fake.PackageStartedStub = stub
+}
+
+func (fake *FakePackagerMessenger) PackageSucceeded() {
+	fake.packageSucceededMutex.Lock()
+	fake.packageSucceededArgsForCall = append(fake.packageSucceededArgsForCall, struct {
+	}{})
+	stub := fake.PackageSucceededStub
+	fake.recordInvocation("PackageSucceeded", []interface{}{})
+	fake.packageSucceededMutex.Unlock()
+	if stub != nil {
+		fake.PackageSucceededStub()
+	}
+}
+
+func (fake *FakePackagerMessenger) PackageSucceededCallCount() int {
+	fake.packageSucceededMutex.RLock()
+	defer fake.packageSucceededMutex.RUnlock()
+	return len(fake.packageSucceededArgsForCall)
+}
+
+func (fake *FakePackagerMessenger) PackageSucceededCalls(stub func()) {
+	fake.packageSucceededMutex.Lock()
+	defer fake.packageSucceededMutex.Unlock()
+	fake.PackageSucceededStub = stub
+}
+
 func (fake *FakePackagerMessenger) SourceParametersAreInvalid(arg1 error) {
 	fake.sourceParametersAreInvalidMutex.Lock()
 	fake.sourceParametersAreInvalidArgsForCall = append(fake.sourceParametersAreInvalidArgsForCall, struct {
@@ -204,10 +334,18 @@ func (fake *FakePackagerMessenger) Invocations() map[string][][]interface{} {
 	defer fake.cannotCreatePackagerMutex.RUnlock()
 	fake.doesNotHaveEnoughSpaceMutex.RLock()
 	defer fake.doesNotHaveEnoughSpaceMutex.RUnlock()
+	fake.invalidConfigFileMutex.RLock()
+	defer fake.invalidConfigFileMutex.RUnlock()
 	fake.invalidOutputConfigMutex.RLock()
 	defer fake.invalidOutputConfigMutex.RUnlock()
+	fake.invalidSecretMutex.RLock()
+	defer fake.invalidSecretMutex.RUnlock()
 	fake.packageFailedMutex.RLock()
 	defer fake.packageFailedMutex.RUnlock()
+	fake.packageStartedMutex.RLock()
+	defer fake.packageStartedMutex.RUnlock()
+	fake.packageSucceededMutex.RLock()
+	defer fake.packageSucceededMutex.RUnlock()
 	fake.sourceParametersAreInvalidMutex.RLock()
 	defer fake.sourceParametersAreInvalidMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
@@ -0,0 +1,117 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package commandparserfakes
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/commandparser"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/inspector"
+)
+
+type FakeStemcellInspector struct {
+	InspectStub        func(string) (inspector.Report, error)
+	inspectMutex       sync.RWMutex
+	inspectArgsForCall []struct {
+		arg1 string
+	}
+	inspectReturns struct {
+		result1 inspector.Report
+		result2 error
+	}
+	inspectReturnsOnCall map[int]struct {
+		result1 inspector.Report
+		result2 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeStemcellInspector) Inspect(arg1 string) (inspector.Report, error) {
+	fake.inspectMutex.Lock()
+	ret, specificReturn := fake.inspectReturnsOnCall[len(fake.inspectArgsForCall)]
+	fake.inspectArgsForCall = append(fake.inspectArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.InspectStub
+	fakeReturns := fake.inspectReturns
+	fake.recordInvocation("Inspect", []interface{}{arg1})
+	fake.inspectMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeStemcellInspector) InspectCallCount() int {
+	fake.inspectMutex.RLock()
+	defer fake.inspectMutex.RUnlock()
+	return len(fake.inspectArgsForCall)
+}
+
+func (fake *FakeStemcellInspector) InspectCalls(stub func(string) (inspector.Report, error)) {
+	fake.inspectMutex.Lock()
+	defer fake.inspectMutex.Unlock()
+	fake.InspectStub = stub
+}
+
+func (fake *FakeStemcellInspector) InspectArgsForCall(i int) string {
+	fake.inspectMutex.RLock()
+	defer fake.inspectMutex.RUnlock()
+	argsForCall := fake.inspectArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeStemcellInspector) InspectReturns(result1 inspector.Report, result2 error) {
+	fake.inspectMutex.Lock()
+	defer fake.inspectMutex.Unlock()
+	fake.InspectStub = nil
+	fake.inspectReturns = struct {
+		result1 inspector.Report
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeStemcellInspector) InspectReturnsOnCall(i int, result1 inspector.Report, result2 error) {
+	fake.inspectMutex.Lock()
+	defer fake.inspectMutex.Unlock()
+	fake.InspectStub = nil
+	if fake.inspectReturnsOnCall == nil {
+		fake.inspectReturnsOnCall = make(map[int]struct {
+			result1 inspector.Report
+			result2 error
+		})
+	}
+	fake.inspectReturnsOnCall[i] = struct {
+		result1 inspector.Report
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeStemcellInspector) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.inspectMutex.RLock()
+	defer fake.inspectMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeStemcellInspector) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ commandparser.StemcellInspector = new(FakeStemcellInspector)
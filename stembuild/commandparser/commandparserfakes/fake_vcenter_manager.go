@@ -10,6 +10,7 @@ import (
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli/iaas_clients/vcenter_manager"
 	"github.com/vmware/govmomi/guest"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25"
 )
 
 type FakeVCenterManager struct {
@@ -66,6 +67,16 @@ type FakeVCenterManager struct {
 	operationsManagerReturnsOnCall map[int]struct {
 		result1 *guest.OperationsManager
 	}
+	VimClientStub        func() *vim25.Client
+	vimClientMutex       sync.RWMutex
+	vimClientArgsForCall []struct {
+	}
+	vimClientReturns struct {
+		result1 *vim25.Client
+	}
+	vimClientReturnsOnCall map[int]struct {
+		result1 *vim25.Client
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
@@ -325,6 +336,59 @@ func (fake *FakeVCenterManager) OperationsManagerReturnsOnCall(i int, result1 *g
 	}{result1}
 }
 
+func (fake *FakeVCenterManager) VimClient() *vim25.Client {
+	fake.vimClientMutex.Lock()
+	ret, specificReturn := fake.vimClientReturnsOnCall[len(fake.vimClientArgsForCall)]
+	fake.vimClientArgsForCall = append(fake.vimClientArgsForCall, struct {
+	}{})
+	stub := fake.VimClientStub
+	fakeReturns := fake.vimClientReturns
+	fake.recordInvocation("VimClient", []interface{}{})
+	fake.vimClientMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeVCenterManager) VimClientCallCount() int {
+	fake.vimClientMutex.RLock()
+	defer fake.vimClientMutex.RUnlock()
+	return len(fake.vimClientArgsForCall)
+}
+
+func (fake *FakeVCenterManager) VimClientCalls(stub func() *vim25.Client) {
+	fake.vimClientMutex.Lock()
+	defer fake.vimClientMutex.Unlock()
+	fake.VimClientStub = stub
+}
+
+func (fake *FakeVCenterManager) VimClientReturns(result1 *vim25.Client) {
+	fake.vimClientMutex.Lock()
+	defer fake.vimClientMutex.Unlock()
+	fake.VimClientStub = nil
+	fake.vimClientReturns = struct {
+		result1 *vim25.Client
+	}{result1}
+}
+
+func (fake *FakeVCenterManager) VimClientReturnsOnCall(i int, result1 *vim25.Client) {
+	fake.vimClientMutex.Lock()
+	defer fake.vimClientMutex.Unlock()
+	fake.VimClientStub = nil
+	if fake.vimClientReturnsOnCall == nil {
+		fake.vimClientReturnsOnCall = make(map[int]struct {
+			result1 *vim25.Client
+		})
+	}
+	fake.vimClientReturnsOnCall[i] = struct {
+		result1 *vim25.Client
+	}{result1}
+}
+
 func (fake *FakeVCenterManager) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
@@ -336,6 +400,8 @@ func (fake *FakeVCenterManager) Invocations() map[string][][]interface{} {
 	defer fake.loginMutex.RUnlock()
 	fake.operationsManagerMutex.RLock()
 	defer fake.operationsManagerMutex.RUnlock()
+	fake.vimClientMutex.RLock()
+	defer fake.vimClientMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
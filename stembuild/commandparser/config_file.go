@@ -0,0 +1,219 @@
+package commandparser
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+
+	constructconfig "github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct/config"
+	packageconfig "github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/config"
+)
+
+// ConfigFile is the build definition loaded with -config. It is parsed as
+// YAML, which also accepts JSON. Every value may reference environment
+// variables as ${NAME}, so secrets do not have to be committed with the file.
+// An unquoted value is read as if the variables had been written in the file,
+// so that winrm_port: ${PORT} is a number; a quoted one is always a string.
+type ConfigFile struct {
+	Construct constructconfig.SourceConfig `yaml:"construct"`
+	Package   PackageConfigFile            `yaml:"package"`
+}
+
+type PackageConfigFile struct {
+	packageconfig.SourceConfig `yaml:",inline"`
+	packageconfig.OutputConfig `yaml:",inline"`
+	PatchVersion               string `yaml:"patch_version"`
+}
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+func LoadConfigFile(path string) (ConfigFile, error) {
+	configFile := ConfigFile{
+		Construct: constructconfig.SourceConfig{
+			RebootTimeout:   constructconfig.DefaultRebootTimeout,
+			ShutdownTimeout: constructconfig.DefaultShutdownTimeout,
+		},
+		Package: PackageConfigFile{
+			OutputConfig: packageconfig.OutputConfig{CompressionLevel: packageconfig.DefaultCompressionLevel},
+		},
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return configFile, fmt.Errorf("unable to read config file %s: %s", path, err)
+	}
+
+	var root yaml.Node
+	err = yaml.Unmarshal(contents, &root)
+	if err != nil {
+		return configFile, fmt.Errorf("unable to parse config file %s: %s", path, err)
+	}
+	if len(root.Content) == 0 {
+		return configFile, nil
+	}
+
+	err = interpolateEnv(&root)
+	if err != nil {
+		return configFile, fmt.Errorf("unable to interpolate config file %s: %s", path, err)
+	}
+
+	// Re-encode the interpolated document so that unknown keys can be rejected.
+	var interpolated bytes.Buffer
+	err = yaml.NewEncoder(&interpolated).Encode(&root)
+	if err != nil {
+		return configFile, fmt.Errorf("unable to parse config file %s: %s", path, err)
+	}
+
+	decoder := yaml.NewDecoder(&interpolated)
+	decoder.KnownFields(true)
+	err = decoder.Decode(&configFile)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return configFile, fmt.Errorf("unable to parse config file %s: %s", path, err)
+	}
+
+	return configFile, nil
+}
+
+func interpolateEnv(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" && envReference.MatchString(node.Value) {
+		var missing []string
+		node.Value = envReference.ReplaceAllStringFunc(node.Value, func(reference string) string {
+			name := envReference.FindStringSubmatch(reference)[1]
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				missing = append(missing, name)
+			}
+			return value
+		})
+		if len(missing) > 0 {
+			return fmt.Errorf("environment variable %s is not set", missing[0])
+		}
+
+		if node.Style == 0 {
+			// Resolve the tag from the new value, but keep an empty value a
+			// string rather than null.
+			node.Tag = ""
+			if node.ShortTag() == "!!null" {
+				node.Tag = "!!str"
+			}
+		}
+	}
+
+	for _, child := range node.Content {
+		err := interpolateEnv(child)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// explicitFlags returns the names of the flags that were set on the command
+// line, which take precedence over values from the config file.
+func explicitFlags(f *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	f.Visit(func(fl *flag.Flag) {
+		set[fl.Name] = true
+	})
+
+	return set
+}
+
+var constructConfigFlags = map[string]func(dst, src *constructconfig.SourceConfig){
+	"vm-ip":             func(dst, src *constructconfig.SourceConfig) { dst.GuestVmIp = src.GuestVmIp },
+	"vm-username":       func(dst, src *constructconfig.SourceConfig) { dst.GuestVMUsername = src.GuestVMUsername },
+	"vm-password":       func(dst, src *constructconfig.SourceConfig) { dst.GuestVMPassword = src.GuestVMPassword },
+	"vcenter-url":       func(dst, src *constructconfig.SourceConfig) { dst.VCenterUrl = src.VCenterUrl },
+	"vcenter-username":  func(dst, src *constructconfig.SourceConfig) { dst.VCenterUsername = src.VCenterUsername },
+	"vcenter-password":  func(dst, src *constructconfig.SourceConfig) { dst.VCenterPassword = src.VCenterPassword },
+	"vm-inventory-path": func(dst, src *constructconfig.SourceConfig) { dst.VmInventoryPath = src.VmInventoryPath },
+	"vcenter-ca-certs":  func(dst, src *constructconfig.SourceConfig) { dst.CaCertFile = src.CaCertFile },
+	"setup-arg":         func(dst, src *constructconfig.SourceConfig) { dst.SetupFlags = src.SetupFlags },
+	"secret-setup-arg":  func(dst, src *constructconfig.SourceConfig) { dst.SecretSetupFlags = src.SecretSetupFlags },
+	"resume":            func(dst, src *constructconfig.SourceConfig) { dst.Resume = src.Resume },
+	"force-resume":      func(dst, src *constructconfig.SourceConfig) { dst.ForceResume = src.ForceResume },
+	"reboot-timeout":    func(dst, src *constructconfig.SourceConfig) { dst.RebootTimeout = src.RebootTimeout },
+	"shutdown-timeout":  func(dst, src *constructconfig.SourceConfig) { dst.ShutdownTimeout = src.ShutdownTimeout },
+	"log-dir":           func(dst, src *constructconfig.SourceConfig) { dst.LogDir = src.LogDir },
+	"diagnostics-path":  func(dst, src *constructconfig.SourceConfig) { dst.DiagnosticsPaths = src.DiagnosticsPaths },
+	"transport":         func(dst, src *constructconfig.SourceConfig) { dst.Transport = src.Transport },
+	"vcenter-client":    func(dst, src *constructconfig.SourceConfig) { dst.VCenterClient = src.VCenterClient },
+	"winrm-https":       func(dst, src *constructconfig.SourceConfig) { dst.WinRMHTTPS = src.WinRMHTTPS },
+	"winrm-port":        func(dst, src *constructconfig.SourceConfig) { dst.WinRMPort = src.WinRMPort },
+	"winrm-ca-cert":     func(dst, src *constructconfig.SourceConfig) { dst.WinRMCACertFile = src.WinRMCACertFile },
+	"winrm-insecure-skip-verify": func(dst, src *constructconfig.SourceConfig) {
+		dst.WinRMInsecureSkipVerify = src.WinRMInsecureSkipVerify
+	},
+	"winrm-auth":            func(dst, src *constructconfig.SourceConfig) { dst.WinRMAuth = src.WinRMAuth },
+	"winrm-kerberos-config": func(dst, src *constructconfig.SourceConfig) { dst.WinRMKerberosConfig = src.WinRMKerberosConfig },
+	"winrm-kerberos-keytab": func(dst, src *constructconfig.SourceConfig) { dst.WinRMKerberosKeytab = src.WinRMKerberosKeytab },
+	"winrm-kerberos-ccache": func(dst, src *constructconfig.SourceConfig) { dst.WinRMKerberosCCache = src.WinRMKerberosCCache },
+	"winrm-kerberos-spn":    func(dst, src *constructconfig.SourceConfig) { dst.WinRMKerberosSPN = src.WinRMKerberosSPN },
+}
+
+// mergeConstructConfig returns fromFile with the values of every explicitly
+// set flag taken from fromFlags.
+func mergeConstructConfig(fromFile, fromFlags constructconfig.SourceConfig, setFlags map[string]bool) constructconfig.SourceConfig {
+	merged := fromFile
+	for name, apply := range constructConfigFlags {
+		if setFlags[name] {
+			apply(&merged, &fromFlags)
+		}
+	}
+
+	return merged
+}
+
+var packageConfigFlags = map[string]func(dst, src *PackageConfigFile){
+	"vmdk":                func(dst, src *PackageConfigFile) { dst.Vmdk = src.Vmdk },
+	"vm-inventory-path":   func(dst, src *PackageConfigFile) { dst.VmInventoryPath = src.VmInventoryPath },
+	"vcenter-username":    func(dst, src *PackageConfigFile) { dst.Username = src.Username },
+	"vcenter-password":    func(dst, src *PackageConfigFile) { dst.Password = src.Password },
+	"vcenter-url":         func(dst, src *PackageConfigFile) { dst.URL = src.URL },
+	"vcenter-ca-certs":    func(dst, src *PackageConfigFile) { dst.CaCertFile = src.CaCertFile },
+	"vcenter-client":      func(dst, src *PackageConfigFile) { dst.VCenterClient = src.VCenterClient },
+	"outputDir":           func(dst, src *PackageConfigFile) { dst.OutputDir = src.OutputDir },
+	"o":                   func(dst, src *PackageConfigFile) { dst.OutputDir = src.OutputDir },
+	"patch-version":       func(dst, src *PackageConfigFile) { dst.PatchVersion = src.PatchVersion },
+	"compression-level":   func(dst, src *PackageConfigFile) { dst.CompressionLevel = src.CompressionLevel },
+	"compression-threads": func(dst, src *PackageConfigFile) { dst.CompressionThreads = src.CompressionThreads },
+	"digest-algorithms":   func(dst, src *PackageConfigFile) { dst.DigestAlgorithms = src.DigestAlgorithms },
+	"reproducible":        func(dst, src *PackageConfigFile) { dst.Reproducible = src.Reproducible },
+	"ova-builder":         func(dst, src *PackageConfigFile) { dst.OVABuilder = src.OVABuilder },
+	"light":               func(dst, src *PackageConfigFile) { dst.Light = src.Light },
+	"iaas":                func(dst, src *PackageConfigFile) { dst.IaaS = src.IaaS },
+	"image-ref":           func(dst, src *PackageConfigFile) { dst.ImageRef = src.ImageRef },
+	"cloud-property": func(dst, src *PackageConfigFile) {
+		dst.CloudProperties = mergeCloudProperties(dst.CloudProperties, src.CloudProperties)
+	},
+}
+
+// mergeCloudProperties returns the cloud properties of the config file with
+// those given as flags added, as flags add to them rather than replace them.
+func mergeCloudProperties(fromFile, fromFlags packageconfig.CloudProperties) packageconfig.CloudProperties {
+	merged := packageconfig.CloudProperties{}
+	maps.Copy(merged, fromFile)
+	maps.Copy(merged, fromFlags)
+	return merged
+}
+
+// mergePackageConfig returns fromFile with the values of every explicitly set
+// flag taken from fromFlags.
+func mergePackageConfig(fromFile, fromFlags PackageConfigFile, setFlags map[string]bool) PackageConfigFile {
+	merged := fromFile
+	for name, apply := range packageConfigFlags {
+		if setFlags[name] {
+			apply(&merged, &fromFlags)
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,474 @@
+package commandparser_test
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/google/subcommands"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/commandparser"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/commandparser/commandparserfakes"
+	constructconfig "github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct/config"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/digest"
+	packageconfig "github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/config"
+)
+
+var _ = Describe("ConfigFile", func() {
+	var configDir string
+
+	writeConfig := func(name, contents string) string {
+		path := filepath.Join(configDir, name)
+		Expect(os.WriteFile(path, []byte(contents), 0600)).To(Succeed())
+		return path
+	}
+
+	BeforeEach(func() {
+		configDir = GinkgoT().TempDir()
+	})
+
+	Describe("LoadConfigFile", func() {
+		It("loads construct and package settings from YAML", func() {
+			path := writeConfig("build.yml", `---
+construct:
+  vm_ip: 10.0.0.5
+  vm_username: Administrator
+  vcenter_url: vcenter.example.com
+  vm_inventory_path: /dc/vm/folder/vm
+  vcenter_ca_certs: /certs/ca.pem
+  setup_args:
+  - SomeFlag SomeValue
+  - OtherSwitchFlag
+  resume: true
+package:
+  vcenter_url: vcenter.example.com
+  vcenter_username: packager
+  vm_inventory_path: /dc/vm/folder/vm
+  output_dir: /stemcells
+  patch_version: "3"
+  compression_level: 9
+  compression_threads: 4
+  digest_algorithms: [sha1, sha256]
+  reproducible: true
+  ova_builder: native
+`)
+
+			configFile, err := commandparser.LoadConfigFile(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(configFile.Construct.GuestVmIp).To(Equal("10.0.0.5"))
+			Expect(configFile.Construct.GuestVMUsername).To(Equal("Administrator"))
+			Expect(configFile.Construct.VCenterUrl).To(Equal("vcenter.example.com"))
+			Expect(configFile.Construct.VmInventoryPath).To(Equal("/dc/vm/folder/vm"))
+			Expect(configFile.Construct.CaCertFile).To(Equal("/certs/ca.pem"))
+			Expect(configFile.Construct.SetupFlags).To(Equal([]string{"SomeFlag SomeValue", "OtherSwitchFlag"}))
+			Expect(configFile.Construct.Resume).To(BeTrue())
+
+			Expect(configFile.Package.URL).To(Equal("vcenter.example.com"))
+			Expect(configFile.Package.Username).To(Equal("packager"))
+			Expect(configFile.Package.VmInventoryPath).To(Equal("/dc/vm/folder/vm"))
+			Expect(configFile.Package.OutputDir).To(Equal("/stemcells"))
+			Expect(configFile.Package.PatchVersion).To(Equal("3"))
+			Expect(configFile.Package.CompressionLevel).To(Equal(9))
+			Expect(configFile.Package.CompressionThreads).To(Equal(4))
+			Expect(configFile.Package.DigestAlgorithms).To(Equal(digest.Algorithms{digest.SHA1, digest.SHA256}))
+			Expect(configFile.Package.Reproducible).To(BeTrue())
+			Expect(configFile.Package.OVABuilder).To(Equal("native"))
+		})
+
+		It("loads settings from JSON", func() {
+			path := writeConfig("build.json", `{"package": {"vmdk": "disk.vmdk", "output_dir": "out"}}`)
+
+			configFile, err := commandparser.LoadConfigFile(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(configFile.Package.Vmdk).To(Equal("disk.vmdk"))
+			Expect(configFile.Package.OutputDir).To(Equal("out"))
+			Expect(configFile.Package.CompressionLevel).To(Equal(packageconfig.DefaultCompressionLevel))
+		})
+
+		It("interpolates environment variables", func() {
+			GinkgoT().Setenv("STEMBUILD_TEST_VCENTER_PASSWORD", "s3cr3t: 'with' \"quotes\"")
+			GinkgoT().Setenv("STEMBUILD_TEST_VM_PASSWORD", "12345")
+			path := writeConfig("build.yml", `---
+construct:
+  vcenter_password: ${STEMBUILD_TEST_VCENTER_PASSWORD}
+  vm_password: "${STEMBUILD_TEST_VM_PASSWORD}"
+  vm_username: admin-${STEMBUILD_TEST_VM_PASSWORD}-$literal
+`)
+
+			configFile, err := commandparser.LoadConfigFile(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(configFile.Construct.VCenterPassword).To(Equal("s3cr3t: 'with' \"quotes\""))
+			Expect(configFile.Construct.GuestVMPassword).To(Equal("12345"))
+			Expect(configFile.Construct.GuestVMUsername).To(Equal("admin-12345-$literal"))
+		})
+
+		It("interpolates environment variables into numbers, booleans and durations", func() {
+			GinkgoT().Setenv("STEMBUILD_TEST_PORT", "5986")
+			GinkgoT().Setenv("STEMBUILD_TEST_HTTPS", "true")
+			GinkgoT().Setenv("STEMBUILD_TEST_TIMEOUT", "45m")
+			GinkgoT().Setenv("STEMBUILD_TEST_LEVEL", "9")
+			GinkgoT().Setenv("STEMBUILD_TEST_VM_PASSWORD", "12345")
+			GinkgoT().Setenv("STEMBUILD_TEST_EMPTY", "")
+			path := writeConfig("build.yml", `---
+construct:
+  winrm_port: ${STEMBUILD_TEST_PORT}
+  winrm_https: ${STEMBUILD_TEST_HTTPS}
+  reboot_timeout: ${STEMBUILD_TEST_TIMEOUT}
+  vm_password: ${STEMBUILD_TEST_VM_PASSWORD}
+  vm_username: ${STEMBUILD_TEST_EMPTY}
+package:
+  compression_level: ${STEMBUILD_TEST_LEVEL}
+  patch_version: ${STEMBUILD_TEST_LEVEL}
+`)
+
+			configFile, err := commandparser.LoadConfigFile(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(configFile.Construct.WinRMPort).To(Equal(5986))
+			Expect(configFile.Construct.WinRMHTTPS).To(BeTrue())
+			Expect(configFile.Construct.RebootTimeout).To(Equal(45 * time.Minute))
+			Expect(configFile.Construct.GuestVMPassword).To(Equal("12345"))
+			Expect(configFile.Construct.GuestVMUsername).To(BeEmpty())
+			Expect(configFile.Package.CompressionLevel).To(Equal(9))
+			Expect(configFile.Package.PatchVersion).To(Equal("9"))
+		})
+
+		It("keeps quoted references strings", func() {
+			GinkgoT().Setenv("STEMBUILD_TEST_PORT", "5986")
+			path := writeConfig("build.yml", `construct: {winrm_port: "${STEMBUILD_TEST_PORT}"}`)
+
+			_, err := commandparser.LoadConfigFile(path)
+			Expect(err).To(MatchError(ContainSubstring("cannot unmarshal !!str `5986` into int")))
+		})
+
+		It("loads the construct timeouts as durations and defaults them when absent", func() {
+			path := writeConfig("build.yml", `construct: {reboot_timeout: 30m}`)
+
+			configFile, err := commandparser.LoadConfigFile(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(configFile.Construct.RebootTimeout).To(Equal(30 * time.Minute))
+			Expect(configFile.Construct.ShutdownTimeout).To(Equal(constructconfig.DefaultShutdownTimeout))
+		})
+
+		It("returns an error when a referenced environment variable is not set", func() {
+			path := writeConfig("build.yml", `construct: {vm_password: "${STEMBUILD_TEST_NOT_SET}"}`)
+
+			_, err := commandparser.LoadConfigFile(path)
+			Expect(err).To(MatchError(ContainSubstring("environment variable STEMBUILD_TEST_NOT_SET is not set")))
+		})
+
+		It("returns an error for unknown settings", func() {
+			path := writeConfig("build.yml", `construct: {vm_pasword: typo}`)
+
+			_, err := commandparser.LoadConfigFile(path)
+			Expect(err).To(MatchError(ContainSubstring("field vm_pasword not found")))
+		})
+
+		It("returns an error when the file cannot be read", func() {
+			_, err := commandparser.LoadConfigFile(filepath.Join(configDir, "missing.yml"))
+			Expect(err).To(MatchError(ContainSubstring("unable to read config file")))
+		})
+
+		It("accepts an empty file", func() {
+			path := writeConfig("build.yml", "")
+
+			_, err := commandparser.LoadConfigFile(path)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Describe("flags", func() {
+		// Flags that are not settings of the config file.
+		notInConfigFile := []string{"config", "vm-password-file", "vcenter-password-file"}
+
+		flagNames := func(cmd subcommands.Command) []string {
+			f := flag.NewFlagSet(cmd.Name(), flag.ContinueOnError)
+			cmd.SetFlags(f)
+
+			var names []string
+			f.VisitAll(func(fl *flag.Flag) {
+				if !slices.Contains(notInConfigFile, fl.Name) {
+					names = append(names, fl.Name)
+				}
+			})
+			return names
+		}
+
+		It("can override every construct and collect-logs setting from the config file", func() {
+			constructFlags, _ := commandparser.ConfigFileFlags()
+
+			Expect(constructFlags).To(ContainElements(flagNames(&commandparser.ConstructCmd{})))
+			Expect(constructFlags).To(ContainElements(flagNames(&commandparser.CollectLogsCmd{})))
+		})
+
+		It("can override every package setting from the config file", func() {
+			_, packageFlags := commandparser.ConfigFileFlags()
+
+			Expect(packageFlags).To(ContainElements(flagNames(&commandparser.PackageCmd{})))
+		})
+	})
+
+	Describe("construct -config", func() {
+		var (
+			f             *flag.FlagSet
+			constructCmd  *commandparser.ConstructCmd
+			fakeFactory   *commandparserfakes.FakeVMPreparerFactory
+			fakeValidator *commandparserfakes.FakeConstructCmdValidator
+			fakeMessenger *commandparserfakes.FakeConstructMessenger
+			configPath    string
+		)
+
+		BeforeEach(func() {
+			f = flag.NewFlagSet("test", flag.ContinueOnError)
+			fakeFactory = &commandparserfakes.FakeVMPreparerFactory{}
+			fakeFactory.NewReturns(&commandparserfakes.FakeVmConstruct{}, nil)
+			fakeValidator = &commandparserfakes.FakeConstructCmdValidator{}
+			fakeValidator.PopulatedArgsReturns(true)
+			fakeValidator.LGPOInDirectoryReturns(true)
+			fakeMessenger = &commandparserfakes.FakeConstructMessenger{}
+
+			constructCmd = commandparser.NewConstructCmd(context.Background(), fakeFactory, &commandparserfakes.FakeManagerFactory{}, fakeValidator, fakeMessenger)
+			constructCmd.SetFlags(f)
+			constructCmd.GlobalFlags = &commandparser.GlobalFlags{}
+
+			configPath = writeConfig("build.yml", `---
+construct:
+  vm_ip: 10.0.0.5
+  vm_username: Administrator
+  vm_password: from-file
+  vcenter_url: vcenter.example.com
+  vcenter_username: root
+  vcenter_password: from-file
+  vm_inventory_path: /dc/vm/folder/vm
+  setup_args: [SomeFlag SomeValue]
+`)
+		})
+
+		It("uses the values from the config file", func() {
+			Expect(f.Parse([]string{"-config", configPath})).To(Succeed())
+
+			exitStatus := constructCmd.Execute(context.Background(), f)
+			Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+
+			_, sourceConfig, _ := fakeFactory.NewArgsForCall(0)
+			Expect(sourceConfig.GuestVmIp).To(Equal("10.0.0.5"))
+			Expect(sourceConfig.GuestVMPassword).To(Equal("from-file"))
+			Expect(sourceConfig.VCenterUrl).To(Equal("vcenter.example.com"))
+			Expect(sourceConfig.VmInventoryPath).To(Equal("/dc/vm/folder/vm"))
+			Expect(sourceConfig.SetupFlags).To(Equal([]string{"SomeFlag SomeValue"}))
+		})
+
+		It("lets explicit flags override the config file", func() {
+			Expect(f.Parse([]string{"-config", configPath, "-vm-password", "from-flag", "-setup-arg", "OtherSwitchFlag"})).To(Succeed())
+
+			exitStatus := constructCmd.Execute(context.Background(), f)
+			Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+
+			_, sourceConfig, _ := fakeFactory.NewArgsForCall(0)
+			Expect(sourceConfig.GuestVMPassword).To(Equal("from-flag"))
+			Expect(sourceConfig.VCenterPassword).To(Equal("from-file"))
+			Expect(sourceConfig.SetupFlags).To(Equal([]string{"OtherSwitchFlag"}))
+		})
+
+		It("takes the WinRM settings from the config file unless given as flags", func() {
+			configPath = writeConfig("winrm.yml", `---
+construct:
+  winrm_https: true
+  winrm_port: 443
+  winrm_ca_cert: /etc/stembuild/winrm-ca.pem
+  winrm_auth: kerberos
+  winrm_kerberos_keytab: /etc/stembuild/stembuild.keytab
+  winrm_kerberos_spn: HTTP/vm.example.com
+`)
+			Expect(f.Parse([]string{"-config", configPath, "-winrm-port", "5986"})).To(Succeed())
+
+			exitStatus := constructCmd.Execute(context.Background(), f)
+			Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+
+			_, sourceConfig, _ := fakeFactory.NewArgsForCall(0)
+			Expect(sourceConfig.WinRMHTTPS).To(BeTrue())
+			Expect(sourceConfig.WinRMPort).To(Equal(5986))
+			Expect(sourceConfig.WinRMCACertFile).To(Equal("/etc/stembuild/winrm-ca.pem"))
+			Expect(sourceConfig.WinRMInsecureSkipVerify).To(BeFalse())
+			Expect(sourceConfig.WinRMAuth).To(Equal("kerberos"))
+			Expect(sourceConfig.WinRMKerberosKeytab).To(Equal("/etc/stembuild/stembuild.keytab"))
+			Expect(sourceConfig.WinRMKerberosSPN).To(Equal("HTTP/vm.example.com"))
+		})
+
+		It("takes the diagnostics paths from the config file unless given as flags", func() {
+			configPath = writeConfig("diagnostics.yml", `---
+construct:
+  log_dir: /var/log/stembuild
+  diagnostics_paths:
+  - C:\provision\log.log
+  - C:\Windows\Panther\setupact.log
+`)
+			Expect(f.Parse([]string{"-config", configPath, "-diagnostics-path", `C:\Windows\Logs\CBS\CBS.log`})).To(Succeed())
+
+			exitStatus := constructCmd.Execute(context.Background(), f)
+			Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+
+			_, sourceConfig, _ := fakeFactory.NewArgsForCall(0)
+			Expect(sourceConfig.LogDir).To(Equal("/var/log/stembuild"))
+			Expect(sourceConfig.DiagnosticsPaths).To(Equal([]string{`C:\Windows\Logs\CBS\CBS.log`}))
+		})
+
+		It("fails when the config file is invalid", func() {
+			Expect(f.Parse([]string{"-config", filepath.Join(configDir, "missing.yml")})).To(Succeed())
+
+			exitStatus := constructCmd.Execute(context.Background(), f)
+
+			Expect(exitStatus).To(Equal(subcommands.ExitFailure))
+			Expect(fakeMessenger.InvalidConfigFileCallCount()).To(Equal(1))
+			Expect(fakeFactory.NewCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("package -config", func() {
+		var (
+			f                 *flag.FlagSet
+			packageCmd        *commandparser.PackageCmd
+			packagerFactory   *commandparserfakes.FakePackagerFactory
+			packagerMessenger *commandparserfakes.FakePackagerMessenger
+			configPath        string
+		)
+
+		BeforeEach(func() {
+			f = flag.NewFlagSet("test", flag.ContinueOnError)
+			oSAndVersionGetter := &commandparserfakes.FakeOSAndVersionGetter{}
+			oSAndVersionGetter.GetVersionReturns("2019.2")
+			oSAndVersionGetter.GetOsReturns("2019")
+			packagerFactory = &commandparserfakes.FakePackagerFactory{}
+			packagerFactory.NewPackagerReturns(&commandparserfakes.FakePackager{}, nil)
+			packagerMessenger = &commandparserfakes.FakePackagerMessenger{}
+
+			packageCmd = commandparser.NewPackageCommand(oSAndVersionGetter, packagerFactory, packagerMessenger)
+			packageCmd.SetFlags(f)
+			packageCmd.GlobalFlags = &commandparser.GlobalFlags{}
+
+			configPath = writeConfig("build.yml", `---
+package:
+  vcenter_url: vcenter.example.com
+  vcenter_username: root
+  vcenter_password: from-file
+  vm_inventory_path: /dc/vm/folder/vm
+  output_dir: `+configDir+`
+`)
+		})
+
+		It("uses the values from the config file", func() {
+			Expect(f.Parse([]string{"-config", configPath})).To(Succeed())
+
+			exitStatus := packageCmd.Execute(context.Background(), f)
+			Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+
+			_, sourceConfig, outputConfig, _ := packagerFactory.NewPackagerArgsForCall(0)
+			Expect(sourceConfig.URL).To(Equal("vcenter.example.com"))
+			Expect(sourceConfig.Username).To(Equal("root"))
+			Expect(sourceConfig.Password).To(Equal("from-file"))
+			Expect(sourceConfig.VmInventoryPath).To(Equal("/dc/vm/folder/vm"))
+			Expect(outputConfig.OutputDir).To(Equal(configDir))
+		})
+
+		It("lets explicit flags override the config file", func() {
+			Expect(f.Parse([]string{"-config", configPath, "-vcenter-password", "from-flag"})).To(Succeed())
+
+			exitStatus := packageCmd.Execute(context.Background(), f)
+			Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+
+			_, sourceConfig, _, _ := packagerFactory.NewPackagerArgsForCall(0)
+			Expect(sourceConfig.Password).To(Equal("from-flag"))
+			Expect(sourceConfig.Username).To(Equal("root"))
+		})
+
+		It("takes the compression settings from the config file unless they are given as flags", func() {
+			configPath = writeConfig("build.yml", `---
+package:
+  vmdk: disk.vmdk
+  output_dir: `+configDir+`
+  compression_level: 1
+  compression_threads: 2
+`)
+			Expect(f.Parse([]string{"-config", configPath, "-compression-threads", "8"})).To(Succeed())
+
+			exitStatus := packageCmd.Execute(context.Background(), f)
+			Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+
+			_, _, outputConfig, _ := packagerFactory.NewPackagerArgsForCall(0)
+			Expect(outputConfig.CompressionLevel).To(Equal(1))
+			Expect(outputConfig.CompressionThreads).To(Equal(8))
+		})
+
+		It("takes the OVA builder from the config file unless it is given as a flag", func() {
+			configPath = writeConfig("build.yml", `---
+package:
+  vmdk: disk.vmdk
+  output_dir: `+configDir+`
+  ova_builder: native
+`)
+			Expect(f.Parse([]string{"-config", configPath})).To(Succeed())
+
+			exitStatus := packageCmd.Execute(context.Background(), f)
+			Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+
+			_, _, outputConfig, _ := packagerFactory.NewPackagerArgsForCall(0)
+			Expect(outputConfig.OVABuilder).To(Equal("native"))
+		})
+
+		It("takes the light stemcell settings from the config file", func() {
+			configPath = writeConfig("build.yml", `---
+package:
+  light: true
+  iaas: azure
+  image_ref: pivotal:bosh-windows-server-2019:2019-SKU:2019.12.0
+  output_dir: `+configDir+`
+`)
+			Expect(f.Parse([]string{"-config", configPath})).To(Succeed())
+
+			exitStatus := packageCmd.Execute(context.Background(), f)
+			Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+
+			_, sourceConfig, outputConfig, _ := packagerFactory.NewPackagerArgsForCall(0)
+			Expect(sourceConfig.ImageRef).To(Equal("pivotal:bosh-windows-server-2019:2019-SKU:2019.12.0"))
+			Expect(outputConfig.Light).To(BeTrue())
+			Expect(outputConfig.IaaS).To(Equal("azure"))
+		})
+
+		It("adds the cloud properties given as flags to those in the config file", func() {
+			configPath = writeConfig("build.yml", `---
+package:
+  vmdk: disk.vmdk
+  output_dir: `+configDir+`
+  cloud_properties:
+    boot_mode: bios
+    encrypted: false
+`)
+			Expect(f.Parse([]string{"-config", configPath, "-cloud-property", "boot_mode=uefi"})).To(Succeed())
+
+			exitStatus := packageCmd.Execute(context.Background(), f)
+			Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+
+			_, _, outputConfig, _ := packagerFactory.NewPackagerArgsForCall(0)
+			Expect(outputConfig.CloudProperties).To(Equal(packageconfig.CloudProperties{"boot_mode": "uefi", "encrypted": false}))
+		})
+
+		It("fails when the config file is invalid", func() {
+			Expect(f.Parse([]string{"-config", writeConfig("bad.yml", "package: [")})).To(Succeed())
+
+			exitStatus := packageCmd.Execute(context.Background(), f)
+
+			Expect(exitStatus).To(Equal(subcommands.ExitFailure))
+			Expect(packagerMessenger.InvalidConfigFileCallCount()).To(Equal(1))
+			Expect(packagerFactory.NewPackagerCallCount()).To(Equal(0))
+		})
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,10 +12,14 @@ import (
 	"github.com/google/subcommands"
 	"github.com/vmware/govmomi/guest"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25"
 
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct/config"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli/iaas_clients"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli/iaas_clients/guest_manager"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli/iaas_clients/vcenter_manager"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/remotemanager"
 )
 
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 -generate
@@ -30,11 +35,12 @@ type VCenterManager interface {
 	GuestManager(ctx context.Context, opsManager vcenter_manager.OpsManager, username, password string) (*guest_manager.GuestManager, error)
 	FindVM(ctx context.Context, inventoryPath string) (*object.VirtualMachine, error)
 	Login(ctx context.Context) error
+	VimClient() *vim25.Client
 }
 
 //counterfeiter:generate . VMPreparerFactory
 type VMPreparerFactory interface {
-	New(config config.SourceConfig, vCenterManager VCenterManager) (VmConstruct, error)
+	New(ctx context.Context, config config.SourceConfig, vCenterManager VCenterManager) (VmConstruct, error)
 }
 
 //counterfeiter:generate . ManagerFactory
@@ -55,16 +61,23 @@ type ConstructMessenger interface {
 	LGPONotFound()
 	CannotConnectToVM(err error)
 	CannotPrepareVM(err error)
+	InvalidConfigFile(err error)
+	InvalidSecret(err error)
+	InvalidSourceConfig(err error)
 }
 
 type ConstructCmd struct {
-	ctx            context.Context
-	sourceConfig   config.SourceConfig
-	prepFactory    VMPreparerFactory
-	managerFactory ManagerFactory
-	validator      ConstructCmdValidator
-	messenger      ConstructMessenger
-	GlobalFlags    *GlobalFlags
+	ctx                 context.Context
+	sourceConfig        config.SourceConfig
+	prepFactory         VMPreparerFactory
+	managerFactory      ManagerFactory
+	validator           ConstructCmdValidator
+	messenger           ConstructMessenger
+	GlobalFlags         *GlobalFlags
+	Stdin               io.Reader
+	configFile          string
+	vmPasswordFile      string
+	vCenterPasswordFile string
 }
 
 type setupFlagsValue struct {
@@ -84,6 +97,37 @@ func (v setupFlagsValue) Set(s string) error {
 	return nil
 }
 
+type secretSetupFlagsValue struct {
+	sourceConfig *config.SourceConfig
+}
+
+func (v secretSetupFlagsValue) String() string {
+	if v.sourceConfig == nil || len(v.sourceConfig.SecretSetupFlags) == 0 {
+		return ""
+	}
+
+	return colorlogger.Redacted
+}
+
+func (v secretSetupFlagsValue) Set(s string) error {
+	v.sourceConfig.SecretSetupFlags = append(v.sourceConfig.SecretSetupFlags, s)
+	return nil
+}
+
+// registerSecrets masks the passwords and the values of secret setup args in
+// all further output.
+func registerSecrets(c config.SourceConfig) {
+	colorlogger.RegisterSecret(c.GuestVMPassword)
+	colorlogger.RegisterSecret(c.VCenterPassword)
+	for _, arg := range c.SecretSetupFlags {
+		_, value, found := strings.Cut(arg, " ")
+		if !found {
+			value = arg
+		}
+		colorlogger.RegisterSecret(strings.TrimSpace(value))
+	}
+}
+
 func NewConstructCmd(ctx context.Context, prepFactory VMPreparerFactory, managerFactory ManagerFactory, validator ConstructCmdValidator, messenger ConstructMessenger) *ConstructCmd {
 	return &ConstructCmd{ctx: ctx, prepFactory: prepFactory, managerFactory: managerFactory, validator: validator, messenger: messenger}
 }
@@ -106,54 +150,153 @@ Requirements:
 		- Username and password with Administrator privileges
 		- vCenter URL, username and password
 		- vCenter Inventory Path
-	The [vm-ip], [vm-username], [vm-password], [vcenter-url], [vcenter-username], [vcenter-password], [vm-inventory-path] must be specified
+	The [vm-ip], [vm-username], [vm-password], [vcenter-url], [vcenter-username], [vcenter-password], [vm-inventory-path] must be specified,
+	either as flags or in the 'construct' section of a [config] file. Flags override values from the config file.
+	[vm-ip] is not needed with '-transport guestops'.
+	Passwords can also be read from a file with [vm-password-file]/[vcenter-password-file], from stdin with '-',
+	or from the %[2]s/%[3]s environment variables.
 
 Example:
 	%[1]s construct -vm-ip '10.0.0.5' -vm-username Admin -vm-password 'password' -vcenter-url vcenter.example.com -vcenter-username root -vcenter-password 'password' -vm-inventory-path '/datacenter/vm/folder/vm-name'
 
 Flags:
-`, filepath.Base(os.Args[0]))
+`, filepath.Base(os.Args[0]), VMPasswordEnvVar, VCenterPasswordEnvVar)
 }
 
 func (p *ConstructCmd) SetFlags(f *flag.FlagSet) {
-	f.StringVar(&p.sourceConfig.GuestVmIp, "vm-ip", "", "IP of target machine")
-	f.StringVar(&p.sourceConfig.GuestVMUsername, "vm-username", "", "Username of target machine")
-	f.StringVar(&p.sourceConfig.GuestVMPassword, "vm-password", "", "Password of target machine. Needs to be wrapped in single quotations.")
-	f.StringVar(&p.sourceConfig.VCenterUrl, "vcenter-url", "", "vCenter url")
-	f.StringVar(&p.sourceConfig.VCenterUsername, "vcenter-username", "", "vCenter username")
-	f.StringVar(&p.sourceConfig.VCenterPassword, "vcenter-password", "", "vCenter password")
-	f.StringVar(&p.sourceConfig.VmInventoryPath, "vm-inventory-path", "", "vCenter VM inventory path. (e.g: <datacenter>/vm/<vm-folder>/<vm-name>)")
-	f.StringVar(&p.sourceConfig.CaCertFile, "vcenter-ca-certs", "", "filepath for custom ca certs")
+	f.StringVar(&p.configFile, "config", "", "YAML or JSON file with the 'construct' settings; values may reference environment variables as ${NAME}")
+	setVMFlags(f, &p.sourceConfig, &p.vmPasswordFile, &p.vCenterPasswordFile)
 	f.Var(newSetupFlagsValue(&p.sourceConfig), "setup-arg", "a 'flag value' combination to be passed to Setup.ps1 - can be set multiple times")
+	f.Var(secretSetupFlagsValue{sourceConfig: &p.sourceConfig}, "secret-setup-arg", "like setup-arg, but the value is redacted from all output - can be set multiple times")
+	f.DurationVar(&p.sourceConfig.RebootTimeout, "reboot-timeout", config.DefaultRebootTimeout, "how long to wait for the VM to come back after the setup script reboots it, 0 waits forever")
+	f.DurationVar(&p.sourceConfig.ShutdownTimeout, "shutdown-timeout", config.DefaultShutdownTimeout, "how long to wait for the VM to shut down after the post-reboot script, 0 waits forever")
+	f.StringVar(&p.sourceConfig.LogDir, "log-dir", "", "directory to save the output of the commands each step runs on the VM to, in a stdout and a stderr file per step, and the diagnostics collected if construct fails; defaults to the working directory for the diagnostics")
+	f.BoolVar(&p.sourceConfig.Resume, "resume", false, "skip the steps completed by a previous failed run against the same VM and carry on from the first incomplete step")
+	f.BoolVar(&p.sourceConfig.ForceResume, "force-resume", false, "with -resume, carry on even if the first incomplete step, such as the setup script, is not safe to run twice")
+	f.StringVar(&p.sourceConfig.VCenterClient, "vcenter-client", iaas_clients.VCenterClientGovc, "how to talk to vCenter: "+iaas_clients.VCenterClientGovc+" commands, or "+iaas_clients.VCenterClientGovmomi+" directly")
+}
+
+// setVMFlags registers the flags for finding and reaching the VM, which
+// construct and collect-logs share.
+func setVMFlags(f *flag.FlagSet, c *config.SourceConfig, vmPasswordFile, vCenterPasswordFile *string) {
+	f.StringVar(&c.GuestVmIp, "vm-ip", "", "IP of target machine")
+	f.StringVar(&c.GuestVMUsername, "vm-username", "", "Username of target machine")
+	f.StringVar(&c.GuestVMPassword, "vm-password", "", "Password of target machine. Needs to be wrapped in single quotations. Use '-' to read it from stdin, defaults to $"+VMPasswordEnvVar)
+	passwordFileFlag(f, vmPasswordFile, "vm-password")
+	f.StringVar(&c.VCenterUrl, "vcenter-url", "", "vCenter url")
+	f.StringVar(&c.VCenterUsername, "vcenter-username", "", "vCenter username")
+	f.StringVar(&c.VCenterPassword, "vcenter-password", "", "vCenter password. Use '-' to read it from stdin, defaults to $"+VCenterPasswordEnvVar)
+	passwordFileFlag(f, vCenterPasswordFile, "vcenter-password")
+	f.StringVar(&c.VmInventoryPath, "vm-inventory-path", "", "vCenter VM inventory path. (e.g: <datacenter>/vm/<vm-folder>/<vm-name>)")
+	f.StringVar(&c.CaCertFile, "vcenter-ca-certs", "", "filepath for custom ca certs")
+	f.StringVar(&c.Transport, "transport", remotemanager.TransportWinRM, "how to run commands on the VM: "+remotemanager.TransportWinRM+" over the network, or "+remotemanager.TransportGuestOps+" with VMware Tools through vCenter, which needs no vm-ip")
+	f.BoolVar(&c.WinRMHTTPS, "winrm-https", false, "connect to WinRM on the VM over HTTPS instead of unencrypted HTTP")
+	f.IntVar(&c.WinRMPort, "winrm-port", 0, fmt.Sprintf("port of WinRM on the VM, defaults to %d, or %d with -winrm-https", remotemanager.WinRmPort, remotemanager.WinRmHTTPSPort))
+	f.StringVar(&c.WinRMCACertFile, "winrm-ca-cert", "", "PEM file with the CA certificates the WinRM certificate of the VM must be signed by, defaults to the system roots")
+	f.BoolVar(&c.WinRMInsecureSkipVerify, "winrm-insecure-skip-verify", false, "do not verify the WinRM certificate of the VM; only for testing")
+	f.StringVar(&c.WinRMAuth, "winrm-auth", remotemanager.WinRMAuthBasic, "how to authenticate to WinRM on the VM: "+strings.Join(remotemanager.WinRMAuths, ", "))
+	f.StringVar(&c.WinRMKerberosConfig, "winrm-kerberos-config", "", "krb5.conf for -winrm-auth kerberos, defaults to "+remotemanager.DefaultKerberosConfig)
+	f.StringVar(&c.WinRMKerberosKeytab, "winrm-kerberos-keytab", "", "keytab to log in to Kerberos with instead of the VM password")
+	f.StringVar(&c.WinRMKerberosCCache, "winrm-kerberos-ccache", "", "Kerberos credential cache to use instead of logging in with the VM password")
+	f.StringVar(&c.WinRMKerberosSPN, "winrm-kerberos-spn", "", "service principal name of WinRM on the VM, such as HTTP/vm.example.com, defaults to HTTP/<vm-ip>")
+	f.Var(diagnosticsPathsValue{sourceConfig: c}, "diagnostics-path", "a file on the VM to collect if construct fails, or with collect-logs, instead of the stemcell automation, sysprep and Windows Update logs - can be set multiple times")
+}
+
+type diagnosticsPathsValue struct {
+	sourceConfig *config.SourceConfig
+}
+
+func (v diagnosticsPathsValue) String() string {
+	if v.sourceConfig == nil {
+		return ""
+	}
+
+	return strings.Join(v.sourceConfig.DiagnosticsPaths, ", ")
+}
+
+func (v diagnosticsPathsValue) Set(s string) error {
+	v.sourceConfig.DiagnosticsPaths = append(v.sourceConfig.DiagnosticsPaths, s)
+	return nil
+}
+
+// vmSecrets are the passwords of the VM and vCenter, and where else they
+// may come from than their flags.
+func vmSecrets(c *config.SourceConfig, vmPasswordFile, vCenterPasswordFile string) []secret {
+	return []secret{
+		{flagName: "vm-password", envVar: VMPasswordEnvVar, value: &c.GuestVMPassword, file: vmPasswordFile},
+		{flagName: "vcenter-password", envVar: VCenterPasswordEnvVar, value: &c.VCenterPassword, file: vCenterPasswordFile},
+	}
+}
+
+// requiredVMArgs are the settings that must be given to reach the VM.
+func requiredVMArgs(c config.SourceConfig) []string {
+	required := []string{c.GuestVMUsername, c.GuestVMPassword, c.VCenterUrl, c.VCenterUsername, c.VCenterPassword, c.VmInventoryPath}
+	if !c.UsesGuestOps() {
+		required = append(required, c.GuestVmIp)
+	}
+
+	return required
+}
+
+func vCenterFactoryConfig(c config.SourceConfig) vcenter_manager.FactoryConfig {
+	return vcenter_manager.FactoryConfig{
+		VCenterServer:  c.VCenterUrl,
+		Username:       c.VCenterUsername,
+		Password:       c.VCenterPassword,
+		ClientCreator:  &vcenter_manager.ClientCreator{},
+		FinderCreator:  &vcenter_manager.GovmomiFinderCreator{},
+		RootCACertPath: c.CaCertFile,
+	}
 }
 
 func (p *ConstructCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
-	c := p.sourceConfig
-	if !p.validator.PopulatedArgs(c.GuestVmIp, c.GuestVMUsername, c.GuestVMPassword, c.VCenterUrl, c.VCenterUsername, c.VCenterPassword, c.VmInventoryPath) {
+	if p.GlobalFlags != nil && p.GlobalFlags.Events != nil {
+		p.messenger = &JSONConstructCmdMessenger{Events: p.GlobalFlags.Events}
+	}
+
+	setFlags := explicitFlags(f)
+	if p.configFile != "" {
+		configFile, err := LoadConfigFile(p.configFile)
+		if err != nil {
+			p.messenger.InvalidConfigFile(err)
+			return subcommands.ExitFailure
+		}
+		p.sourceConfig = mergeConstructConfig(configFile.Construct, p.sourceConfig, setFlags)
+	}
+
+	err := resolveSecrets(vmSecrets(&p.sourceConfig, p.vmPasswordFile, p.vCenterPasswordFile), setFlags, p.stdin())
+	if err != nil {
+		p.messenger.InvalidSecret(err)
+		return subcommands.ExitFailure
+	}
+	registerSecrets(p.sourceConfig)
+
+	if !p.validator.PopulatedArgs(requiredVMArgs(p.sourceConfig)...) {
 		p.messenger.ArgumentsNotProvided()
 		return subcommands.ExitFailure
 	}
+	err = p.sourceConfig.Validate()
+	if err != nil {
+		p.messenger.InvalidSourceConfig(err)
+		return subcommands.ExitFailure
+	}
 	if !p.validator.LGPOInDirectory() {
 		p.messenger.LGPONotFound()
 		return subcommands.ExitFailure
 	}
 
-	p.managerFactory.SetConfig(vcenter_manager.FactoryConfig{
-		VCenterServer:  p.sourceConfig.VCenterUrl,
-		Username:       p.sourceConfig.VCenterUsername,
-		Password:       p.sourceConfig.VCenterPassword,
-		ClientCreator:  &vcenter_manager.ClientCreator{},
-		FinderCreator:  &vcenter_manager.GovmomiFinderCreator{},
-		RootCACertPath: p.sourceConfig.CaCertFile,
-	})
+	p.managerFactory.SetConfig(vCenterFactoryConfig(p.sourceConfig))
+
+	ctx, _, stop := notifyOnInterrupt(p.ctx, os.Stderr)
+	defer stop()
 
-	vCenterManager, err := p.managerFactory.VCenterManager(p.ctx)
+	vCenterManager, err := p.managerFactory.VCenterManager(ctx)
 	if err != nil {
 		p.messenger.CannotPrepareVM(err)
 		return subcommands.ExitFailure
 	}
 
-	vmConstruct, err := p.prepFactory.New(p.sourceConfig, vCenterManager)
+	vmConstruct, err := p.prepFactory.New(ctx, p.sourceConfig, vCenterManager)
 	if err != nil {
 		p.messenger.CannotPrepareVM(err)
 		return subcommands.ExitFailure
@@ -167,3 +310,11 @@ func (p *ConstructCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interfac
 
 	return subcommands.ExitSuccess
 }
+
+func (p *ConstructCmd) stdin() io.Reader {
+	if p.Stdin == nil {
+		return os.Stdin
+	}
+
+	return p.Stdin
+}
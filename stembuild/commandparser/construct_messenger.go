@@ -3,6 +3,8 @@ package commandparser
 import (
 	"fmt"
 	"io"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
 )
 
 type ConstructCmdMessenger struct {
@@ -10,7 +12,7 @@ type ConstructCmdMessenger struct {
 }
 
 func (m *ConstructCmdMessenger) printMessage(message string) {
-	fmt.Fprintln(m.OutputChannel, message) //nolint:errcheck
+	fmt.Fprintln(m.OutputChannel, colorlogger.Redact(message)) //nolint:errcheck
 }
 
 func (m *ConstructCmdMessenger) ArgumentsNotProvided() {
@@ -28,3 +30,15 @@ func (m *ConstructCmdMessenger) CannotConnectToVM(err error) {
 func (m *ConstructCmdMessenger) CannotPrepareVM(err error) {
 	m.printMessage(fmt.Sprintf("Could not prepare VM: %s", err))
 }
+
+func (m *ConstructCmdMessenger) InvalidConfigFile(err error) {
+	m.printMessage(fmt.Sprintf("Invalid config file: %s", err))
+}
+
+func (m *ConstructCmdMessenger) InvalidSecret(err error) {
+	m.printMessage(err.Error())
+}
+
+func (m *ConstructCmdMessenger) InvalidSourceConfig(err error) {
+	m.printMessage(fmt.Sprintf("Invalid arguments: %s", err))
+}
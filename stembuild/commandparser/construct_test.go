@@ -4,13 +4,17 @@ import (
 	"context"
 	"errors"
 	"flag"
+	"os"
+	"time"
 
 	"github.com/google/subcommands"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/commandparser"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/commandparser/commandparserfakes"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct/config"
 )
 
 var _ = Describe("construct", func() {
@@ -93,6 +97,95 @@ var _ = Describe("construct", func() {
 			Expect(ConstrCmd.GetSourceConfig().CaCertFile).To(Equal("somecerts.txt"))
 		})
 
+		It("does not resume by default", func() {
+			err := f.Parse(args)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ConstrCmd.GetSourceConfig().Resume).To(BeFalse())
+		})
+
+		It("waits for the default timeouts for reboot and shutdown", func() {
+			err := f.Parse(args)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ConstrCmd.GetSourceConfig().RebootTimeout).To(Equal(time.Hour))
+			Expect(ConstrCmd.GetSourceConfig().ShutdownTimeout).To(Equal(2 * time.Hour))
+		})
+
+		It("stores the values of the reboot and shutdown timeouts", func() {
+			err := f.Parse(append(args, "-reboot-timeout", "20m", "-shutdown-timeout", "0"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ConstrCmd.GetSourceConfig().RebootTimeout).To(Equal(20 * time.Minute))
+			Expect(ConstrCmd.GetSourceConfig().ShutdownTimeout).To(BeZero())
+		})
+
+		It("stores the value of the resume flag", func() {
+			err := f.Parse(append(args, "-resume"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ConstrCmd.GetSourceConfig().Resume).To(BeTrue())
+			Expect(ConstrCmd.GetSourceConfig().ForceResume).To(BeFalse())
+		})
+
+		It("stores the value of the force-resume flag", func() {
+			err := f.Parse(append(args, "-resume", "-force-resume"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ConstrCmd.GetSourceConfig().ForceResume).To(BeTrue())
+		})
+
+		It("uses WinRM over HTTP on the default port by default", func() {
+			err := f.Parse(args)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ConstrCmd.GetSourceConfig().Transport).To(Equal("winrm"))
+			Expect(ConstrCmd.GetSourceConfig().WinRMHTTPS).To(BeFalse())
+			Expect(ConstrCmd.GetSourceConfig().WinRMPort).To(BeZero())
+			Expect(ConstrCmd.GetSourceConfig().WinRMAuth).To(Equal("basic"))
+		})
+
+		It("stores the values of the WinRM authentication flags", func() {
+			err := f.Parse(append(args, "-winrm-auth", "kerberos", "-winrm-kerberos-config", "krb5.conf", "-winrm-kerberos-keytab", "stembuild.keytab", "-winrm-kerberos-ccache", "krb5cc", "-winrm-kerberos-spn", "HTTP/vm.example.com"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ConstrCmd.GetSourceConfig().WinRMAuth).To(Equal("kerberos"))
+			Expect(ConstrCmd.GetSourceConfig().WinRMKerberosConfig).To(Equal("krb5.conf"))
+			Expect(ConstrCmd.GetSourceConfig().WinRMKerberosKeytab).To(Equal("stembuild.keytab"))
+			Expect(ConstrCmd.GetSourceConfig().WinRMKerberosCCache).To(Equal("krb5cc"))
+			Expect(ConstrCmd.GetSourceConfig().WinRMKerberosSPN).To(Equal("HTTP/vm.example.com"))
+		})
+
+		It("stores the value of the log-dir flag", func() {
+			err := f.Parse(append(args, "-log-dir", "construct-logs"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ConstrCmd.GetSourceConfig().LogDir).To(Equal("construct-logs"))
+		})
+
+		It("stores each diagnostics-path flag", func() {
+			err := f.Parse(append(args, "-diagnostics-path", `C:\provision\log.log`, "-diagnostics-path", `C:\Windows\Logs\CBS\CBS.log`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ConstrCmd.GetSourceConfig().DiagnosticsPaths).To(Equal([]string{`C:\provision\log.log`, `C:\Windows\Logs\CBS\CBS.log`}))
+		})
+
+		It("stores the value of the transport flag", func() {
+			err := f.Parse(append(args, "-transport", "guestops"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ConstrCmd.GetSourceConfig().Transport).To(Equal("guestops"))
+		})
+
+		It("stores the value of the vcenter-client flag, which defaults to govc", func() {
+			err := f.Parse(args)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ConstrCmd.GetSourceConfig().VCenterClient).To(Equal("govc"))
+
+			err = f.Parse(append(args, "-vcenter-client", "govmomi"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ConstrCmd.GetSourceConfig().VCenterClient).To(Equal("govmomi"))
+		})
+
+		It("stores the values of the WinRM flags", func() {
+			err := f.Parse(append(args, "-winrm-https", "-winrm-port", "443", "-winrm-ca-cert", "winrm-ca.pem", "-winrm-insecure-skip-verify"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ConstrCmd.GetSourceConfig().WinRMHTTPS).To(BeTrue())
+			Expect(ConstrCmd.GetSourceConfig().WinRMPort).To(Equal(443))
+			Expect(ConstrCmd.GetSourceConfig().WinRMCACertFile).To(Equal("winrm-ca.pem"))
+			Expect(ConstrCmd.GetSourceConfig().WinRMInsecureSkipVerify).To(BeTrue())
+		})
+
 		Describe("setup-arg flag", func() {
 			var args = []string{
 				"-vm-ip", "10.0.0.5",
@@ -133,6 +226,19 @@ var _ = Describe("construct", func() {
 				})
 			})
 		})
+
+		Describe("secret-setup-arg flag", func() {
+			It("stores the value of each secret setup arg separately from the setup args", func() {
+				err := f.Parse(append(args,
+					"-setup-arg", "SomeFlag SomeValue",
+					"-secret-setup-arg", "ProductKey XXXXX-XXXXX",
+					"-secret-setup-arg", "OtherSecret OtherValue",
+				))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ConstrCmd.GetSourceConfig().SetupFlags).To(Equal([]string{"SomeFlag SomeValue"}))
+				Expect(ConstrCmd.GetSourceConfig().SecretSetupFlags).To(Equal([]string{"ProductKey XXXXX-XXXXX", "OtherSecret OtherValue"}))
+			})
+		})
 	})
 
 	Describe("Execute", func() {
@@ -178,6 +284,22 @@ var _ = Describe("construct", func() {
 			Expect(fakeVmConstruct.PrepareVMCallCount()).To(Equal(1))
 		})
 
+		It("redacts the passwords and secret setup arg values from further output", func() {
+			fakeValidator.PopulatedArgsReturns(true)
+			fakeValidator.LGPOInDirectoryReturns(true)
+			Expect(f.Parse([]string{
+				"-vm-password", "construct-vm-secret",
+				"-vcenter-password", "construct-vcenter-secret",
+				"-secret-setup-arg", "ProductKey construct-product-key",
+			})).To(Succeed())
+
+			exitStatus := ConstrCmd.Execute(emptyContext, f)
+
+			Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+			Expect(colorlogger.Redact("construct-vm-secret construct-vcenter-secret construct-product-key")).
+				To(Equal("[REDACTED] [REDACTED] [REDACTED]"))
+		})
+
 		Context("with missing arguments", func() {
 			It("should return an error", func() {
 				fakeValidator.PopulatedArgsReturns(false)
@@ -189,6 +311,46 @@ var _ = Describe("construct", func() {
 			})
 		})
 
+		Context("with the guest operations transport", func() {
+			It("does not require the VM IP", func() {
+				fakeValidator.PopulatedArgsReturns(true)
+				fakeValidator.LGPOInDirectoryReturns(true)
+				Expect(f.Parse([]string{"-transport", "guestops", "-vm-username", "Admin"})).To(Succeed())
+
+				exitStatus := ConstrCmd.Execute(emptyContext, f)
+
+				Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+				Expect(fakeValidator.PopulatedArgsArgsForCall(0)).To(HaveLen(6))
+				Expect(fakeValidator.PopulatedArgsArgsForCall(0)).To(ContainElement("Admin"))
+			})
+
+			It("requires the VM IP with WinRM", func() {
+				fakeValidator.PopulatedArgsReturns(true)
+				fakeValidator.LGPOInDirectoryReturns(true)
+				Expect(f.Parse([]string{"-vm-ip", "10.0.0.5"})).To(Succeed())
+
+				ConstrCmd.Execute(emptyContext, f)
+
+				Expect(fakeValidator.PopulatedArgsArgsForCall(0)).To(HaveLen(7))
+				Expect(fakeValidator.PopulatedArgsArgsForCall(0)).To(ContainElement("10.0.0.5"))
+			})
+		})
+
+		Context("with inconsistent WinRM flags", func() {
+			It("should return an error before preparing the VM", func() {
+				fakeValidator.PopulatedArgsReturns(true)
+				fakeValidator.LGPOInDirectoryReturns(true)
+				Expect(f.Parse([]string{"-winrm-ca-cert", "winrm-ca.pem"})).To(Succeed())
+
+				exitStatus := ConstrCmd.Execute(emptyContext, f)
+
+				Expect(exitStatus).To(Equal(subcommands.ExitFailure))
+				Expect(fakeMessenger.InvalidSourceConfigCallCount()).To(Equal(1))
+				Expect(fakeMessenger.InvalidSourceConfigArgsForCall(0)).To(MatchError(ContainSubstring("need winrm-https")))
+				Expect(fakeFactory.NewCallCount()).To(Equal(0))
+			})
+		})
+
 		Context("with LGPO.zip not in current directory", func() {
 			It("should return an error", func() {
 				fakeValidator.PopulatedArgsReturns(true)
@@ -213,5 +375,68 @@ var _ = Describe("construct", func() {
 				Expect(fakeMessenger.CannotPrepareVMCallCount()).To(Equal(1))
 			})
 		})
+
+		Context("when interrupted", func() {
+			var signals chan<- os.Signal
+			var exitCodes chan int
+			var constructCtx context.Context
+
+			BeforeEach(func() {
+				fakeValidator.PopulatedArgsReturns(true)
+				fakeValidator.LGPOInDirectoryReturns(true)
+
+				exitCodes = make(chan int, 1)
+				restore := commandparser.SetInterruptNotifier(
+					func(c chan<- os.Signal) func() {
+						signals = c
+						return func() {}
+					},
+					func(code int) { exitCodes <- code },
+				)
+				DeferCleanup(restore)
+
+				fakeFactory.NewCalls(func(ctx context.Context, _ config.SourceConfig, _ commandparser.VCenterManager) (commandparser.VmConstruct, error) {
+					constructCtx = ctx
+					return fakeVmConstruct, nil
+				})
+			})
+
+			It("cancels the construct with ErrInterrupted and reports the error", func() {
+				fakeVmConstruct.PrepareVMCalls(func() error {
+					signals <- os.Interrupt
+					<-constructCtx.Done()
+					return context.Cause(constructCtx)
+				})
+
+				exitStatus := ConstrCmd.Execute(emptyContext, f)
+
+				Expect(exitStatus).To(Equal(subcommands.ExitFailure))
+				Expect(context.Cause(constructCtx)).To(MatchError(commandparser.ErrInterrupted))
+				Expect(fakeMessenger.CannotPrepareVMArgsForCall(0)).To(MatchError(commandparser.ErrInterrupted))
+				Expect(exitCodes).NotTo(Receive())
+			})
+
+			It("exits straight away on a second interrupt", func() {
+				fakeVmConstruct.PrepareVMCalls(func() error {
+					signals <- os.Interrupt
+					<-constructCtx.Done()
+					signals <- os.Interrupt
+					Eventually(exitCodes).Should(Receive(Equal(1)))
+					return context.Cause(constructCtx)
+				})
+
+				ConstrCmd.Execute(emptyContext, f)
+
+				Expect(fakeVmConstruct.PrepareVMCallCount()).To(Equal(1))
+			})
+
+			It("stops listening for interrupts once the command is done", func() {
+				exitStatus := ConstrCmd.Execute(emptyContext, f)
+
+				Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+				Expect(constructCtx.Err()).To(HaveOccurred())
+				Expect(context.Cause(constructCtx)).NotTo(MatchError(commandparser.ErrInterrupted))
+			})
+		})
 	})
 })
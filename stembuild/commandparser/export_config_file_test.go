@@ -0,0 +1,16 @@
+package commandparser
+
+import (
+	"maps"
+	"slices"
+)
+
+// ConfigFileFlags returns the names of the flags that override a value from
+// the config file, for construct and collect-logs and for package.
+func ConfigFileFlags() (construct, pkg []string) {
+	return sortedKeys(constructConfigFlags), sortedKeys(packageConfigFlags)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	return slices.Sorted(maps.Keys(m))
+}
@@ -1,7 +1,22 @@
 package commandparser
 
-import "github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct/config"
+import (
+	"os"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct/config"
+)
 
 func (p *ConstructCmd) GetSourceConfig() config.SourceConfig {
 	return p.sourceConfig
 }
+
+// SetInterruptNotifier replaces the source of interrupt signals and the exit
+// function used on a second interrupt, and returns a function that restores
+// them.
+func SetInterruptNotifier(notify func(c chan<- os.Signal) func(), exitFunc func(int)) func() {
+	oldNotify, oldExit := notifyInterrupt, exit
+	notifyInterrupt, exit = notify, exitFunc
+	return func() {
+		notifyInterrupt, exit = oldNotify, oldExit
+	}
+}
@@ -1,7 +1,41 @@
 package commandparser
 
+import (
+	"fmt"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/events"
+)
+
 type GlobalFlags struct {
-	Debug       bool
-	Color       bool
-	ShowVersion bool
+	Debug        bool
+	Color        bool
+	ShowVersion  bool
+	OutputFormat OutputFormat
+	// Events is set when OutputFormat is json, and receives the progress of
+	// every command.
+	Events *events.Emitter
+}
+
+type OutputFormat string
+
+const (
+	OutputFormatText OutputFormat = "text"
+	OutputFormatJSON OutputFormat = "json"
+)
+
+func (o *OutputFormat) String() string {
+	if o == nil || *o == "" {
+		return string(OutputFormatText)
+	}
+	return string(*o)
+}
+
+func (o *OutputFormat) Set(s string) error {
+	switch OutputFormat(s) {
+	case OutputFormatText, OutputFormatJSON:
+		*o = OutputFormat(s)
+		return nil
+	default:
+		return fmt.Errorf("must be %s or %s", OutputFormatText, OutputFormatJSON)
+	}
 }
@@ -0,0 +1,142 @@
+package commandparser
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/subcommands"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/oscatalog"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/inspector"
+)
+
+//counterfeiter:generate . StemcellInspector
+type StemcellInspector interface {
+	Inspect(stemcellPath string) (inspector.Report, error)
+}
+
+type InspectCmd struct {
+	GlobalFlags *GlobalFlags
+	inspector   StemcellInspector
+	output      io.Writer
+	errOutput   io.Writer
+	format      string
+}
+
+func NewInspectCmd(i StemcellInspector, output, errOutput io.Writer) *InspectCmd {
+	return &InspectCmd{
+		inspector: i,
+		output:    output,
+		errOutput: errOutput,
+	}
+}
+
+func (*InspectCmd) Name() string { return "inspect" }
+func (*InspectCmd) Synopsis() string {
+	return "Show the manifest and contents of an existing stemcell tarball"
+}
+
+func (*InspectCmd) Usage() string {
+	return fmt.Sprintf(`%[1]s inspect [-format text|json] <path to stemcell tgz>
+
+Opens a stemcell tarball created by stembuild package, prints its stemcell.MF,
+verifies that the manifest sha1 matches the embedded image and lists the
+OVF/VMDK files inside the image. The sha1 field may also be a multi-digest
+such as "sha1:<sum>;sha256:<sum>", in which case each sha1 and sha256 in it
+is verified.
+
+Exits with a non-zero status when a digest does not match.
+
+Example:
+	%[1]s inspect bosh-stemcell-2019.2-vsphere-esxi-windows2019-go_agent.tgz
+
+Flags:
+`, filepath.Base(os.Args[0]))
+}
+
+func (p *InspectCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&p.format, "format", "text", "Output format, either 'text' or 'json'")
+}
+
+func (p *InspectCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		fmt.Fprintln(p.errOutput, "exactly one stemcell tarball must be specified") //nolint:errcheck
+		return subcommands.ExitUsageError
+	}
+	if p.format != "text" && p.format != "json" {
+		fmt.Fprintf(p.errOutput, "invalid format '%s', must be 'text' or 'json'\n", p.format) //nolint:errcheck
+		return subcommands.ExitUsageError
+	}
+
+	report, err := p.inspector.Inspect(f.Arg(0))
+	if err != nil {
+		fmt.Fprintln(p.errOutput, err) //nolint:errcheck
+		return subcommands.ExitFailure
+	}
+
+	if p.format == "json" {
+		err = writeReportJSON(p.output, report)
+	} else {
+		err = writeReportText(p.output, report)
+	}
+	if err != nil {
+		fmt.Fprintln(p.errOutput, err) //nolint:errcheck
+		return subcommands.ExitFailure
+	}
+
+	if !report.Sha1Verified {
+		fmt.Fprintf(p.errOutput, "sha1 in stemcell.MF (%s) does not match the image (%s)\n", report.Manifest.SHA1, report.ImageDigest()) //nolint:errcheck
+		return subcommands.ExitFailure
+	}
+
+	return subcommands.ExitSuccess
+}
+
+func writeReportJSON(w io.Writer, report inspector.Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(report)
+}
+
+func writeReportText(w io.Writer, report inspector.Report) error {
+	verified := "verified"
+	if !report.Sha1Verified {
+		verified = "MISMATCH"
+	}
+
+	operatingSystem := report.Manifest.OperatingSystem
+	if windows, ok := oscatalog.ByStemcellSuffix(operatingSystem); ok {
+		operatingSystem = fmt.Sprintf("%s (%s)", operatingSystem, windows.DisplayName)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Stemcell:\t%s\n", report.Path)                                                 //nolint:errcheck
+	fmt.Fprintf(tw, "Name:\t%s\n", report.Manifest.Name)                                            //nolint:errcheck
+	fmt.Fprintf(tw, "Version:\t%s\n", report.Manifest.Version)                                      //nolint:errcheck
+	fmt.Fprintf(tw, "Operating system:\t%s\n", operatingSystem)                                     //nolint:errcheck
+	fmt.Fprintf(tw, "API version:\t%d\n", report.Manifest.APIVersion)                               //nolint:errcheck
+	fmt.Fprintf(tw, "Stemcell formats:\t%s\n", strings.Join(report.Manifest.StemcellFormats, ", ")) //nolint:errcheck
+	fmt.Fprintf(tw, "Manifest sha1:\t%s\n", report.Manifest.SHA1)                                   //nolint:errcheck
+	fmt.Fprintf(tw, "Image sha1:\t%s (%s)\n", report.ImageSha1, verified)                           //nolint:errcheck
+	fmt.Fprintf(tw, "Image sha256:\t%s\n", report.ImageSha256)                                      //nolint:errcheck
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "Image members:") //nolint:errcheck
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, member := range report.ImageMembers {
+		fmt.Fprintf(tw, "  %s\t%s\t%d bytes\n", member.Name, member.Type, member.Size) //nolint:errcheck
+	}
+
+	return tw.Flush()
+}
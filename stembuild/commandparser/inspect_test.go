@@ -0,0 +1,149 @@
+package commandparser_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+
+	"github.com/google/subcommands"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/commandparser"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/commandparser/commandparserfakes"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/inspector"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/manifest"
+)
+
+var _ = Describe("inspect", func() {
+	var (
+		f             *flag.FlagSet
+		inspectCmd    *commandparser.InspectCmd
+		fakeInspector *commandparserfakes.FakeStemcellInspector
+		output        *gbytes.Buffer
+		errOutput     *gbytes.Buffer
+		report        inspector.Report
+	)
+
+	BeforeEach(func() {
+		f = flag.NewFlagSet("test", flag.ContinueOnError)
+		fakeInspector = &commandparserfakes.FakeStemcellInspector{}
+		output = gbytes.NewBuffer()
+		errOutput = gbytes.NewBuffer()
+
+		inspectCmd = commandparser.NewInspectCmd(fakeInspector, output, errOutput)
+		inspectCmd.SetFlags(f)
+		inspectCmd.GlobalFlags = &commandparser.GlobalFlags{}
+
+		report = inspector.Report{
+			Path: "stemcell.tgz",
+			Manifest: manifest.StemcellManifest{
+				Name:            "bosh-vsphere-esxi-windows2019-go_agent",
+				Version:         "2019.7",
+				APIVersion:      3,
+				SHA1:            "abc123",
+				OperatingSystem: "windows2019",
+				StemcellFormats: []string{"vsphere-ovf", "vsphere-ova"},
+			},
+			ImageSha1:    "abc123",
+			Sha1Verified: true,
+			ImageMembers: []inspector.Member{
+				{Name: "vm.ovf", Type: "ovf", Size: 10},
+				{Name: "vm-disk1.vmdk", Type: "vmdk", Size: 2048},
+			},
+		}
+		fakeInspector.InspectReturns(report, nil)
+	})
+
+	It("inspects the given stemcell", func() {
+		Expect(f.Parse([]string{"stemcell.tgz"})).To(Succeed())
+
+		exitStatus := inspectCmd.Execute(context.Background(), f)
+
+		Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+		Expect(fakeInspector.InspectCallCount()).To(Equal(1))
+		Expect(fakeInspector.InspectArgsForCall(0)).To(Equal("stemcell.tgz"))
+	})
+
+	It("prints the report as text by default", func() {
+		Expect(f.Parse([]string{"stemcell.tgz"})).To(Succeed())
+
+		inspectCmd.Execute(context.Background(), f)
+
+		Expect(output).To(gbytes.Say(`Name:\s+bosh-vsphere-esxi-windows2019-go_agent`))
+		Expect(output).To(gbytes.Say(`Version:\s+2019.7`))
+		Expect(output).To(gbytes.Say(`Operating system:\s+windows2019 \(Windows Server 2019\)`))
+		Expect(output).To(gbytes.Say(`Stemcell formats:\s+vsphere-ovf, vsphere-ova`))
+		Expect(output).To(gbytes.Say(`Image sha1:\s+abc123 \(verified\)`))
+		Expect(output).To(gbytes.Say(`vm.ovf\s+ovf\s+10 bytes`))
+		Expect(output).To(gbytes.Say(`vm-disk1.vmdk\s+vmdk\s+2048 bytes`))
+	})
+
+	It("prints the report as json", func() {
+		Expect(f.Parse([]string{"-format", "json", "stemcell.tgz"})).To(Succeed())
+
+		exitStatus := inspectCmd.Execute(context.Background(), f)
+		Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+
+		var printed inspector.Report
+		Expect(json.Unmarshal(output.Contents(), &printed)).To(Succeed())
+		Expect(printed).To(Equal(report))
+	})
+
+	It("fails when the sha1 does not match the image", func() {
+		report.ImageSha1 = "def456"
+		report.Sha1Verified = false
+		fakeInspector.InspectReturns(report, nil)
+		Expect(f.Parse([]string{"stemcell.tgz"})).To(Succeed())
+
+		exitStatus := inspectCmd.Execute(context.Background(), f)
+
+		Expect(exitStatus).To(Equal(subcommands.ExitFailure))
+		Expect(output).To(gbytes.Say(`Image sha1:\s+def456 \(MISMATCH\)`))
+		Expect(errOutput).To(gbytes.Say(`sha1 in stemcell.MF \(abc123\) does not match the image \(def456\)`))
+	})
+
+	It("shows the image digests in the format of the manifest when a multi-digest does not match", func() {
+		report.Manifest.SHA1 = "sha1:abc123;sha256:fed789"
+		report.ImageSha256 = "987def"
+		report.Sha1Verified = false
+		fakeInspector.InspectReturns(report, nil)
+		Expect(f.Parse([]string{"stemcell.tgz"})).To(Succeed())
+
+		exitStatus := inspectCmd.Execute(context.Background(), f)
+
+		Expect(exitStatus).To(Equal(subcommands.ExitFailure))
+		Expect(output).To(gbytes.Say(`Image sha256:\s+987def`))
+		Expect(errOutput).To(gbytes.Say(`sha1 in stemcell.MF \(sha1:abc123;sha256:fed789\) does not match the image \(sha1:abc123;sha256:987def\)`))
+	})
+
+	It("fails when the stemcell cannot be inspected", func() {
+		fakeInspector.InspectReturns(inspector.Report{}, errors.New("bad stemcell"))
+		Expect(f.Parse([]string{"stemcell.tgz"})).To(Succeed())
+
+		exitStatus := inspectCmd.Execute(context.Background(), f)
+
+		Expect(exitStatus).To(Equal(subcommands.ExitFailure))
+		Expect(errOutput).To(gbytes.Say("bad stemcell"))
+	})
+
+	It("requires exactly one stemcell", func() {
+		Expect(f.Parse([]string{})).To(Succeed())
+
+		exitStatus := inspectCmd.Execute(context.Background(), f)
+
+		Expect(exitStatus).To(Equal(subcommands.ExitUsageError))
+		Expect(fakeInspector.InspectCallCount()).To(Equal(0))
+	})
+
+	It("rejects unknown formats", func() {
+		Expect(f.Parse([]string{"-format", "xml", "stemcell.tgz"})).To(Succeed())
+
+		exitStatus := inspectCmd.Execute(context.Background(), f)
+
+		Expect(exitStatus).To(Equal(subcommands.ExitUsageError))
+		Expect(errOutput).To(gbytes.Say("invalid format 'xml'"))
+	})
+})
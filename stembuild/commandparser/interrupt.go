@@ -0,0 +1,73 @@
+package commandparser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// ErrInterrupted is the cause of a command's context being cancelled by
+// Ctrl-C.
+var ErrInterrupted = errors.New("received interrupt signal")
+
+// notifyInterrupt delivers interrupt signals to c until stop is called. It is
+// a variable so that tests can send signals without signalling the process.
+var notifyInterrupt = func(c chan<- os.Signal) (stop func()) {
+	signal.Notify(c, os.Interrupt)
+	return func() { signal.Stop(c) }
+}
+
+// exit is called on a second interrupt.
+var exit = os.Exit
+
+// notifyOnInterrupt returns a context that is cancelled with ErrInterrupted on
+// the first Ctrl-C, so that the running step can stop and clean up. A second
+// Ctrl-C exits straight away, after running the cleanup functions registered
+// with onExit. The returned stop function must be called once the command is
+// done.
+func notifyOnInterrupt(parent context.Context, errOut io.Writer) (ctx context.Context, onExit func(cleanup func()), stop func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	signals := make(chan os.Signal, 2)
+	stopNotify := notifyInterrupt(signals)
+	done := make(chan struct{})
+
+	var mutex sync.Mutex
+	var cleanups []func()
+	onExit = func(cleanup func()) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		cleanups = append(cleanups, cleanup)
+	}
+
+	go func() {
+		select {
+		case sig := <-signals:
+			fmt.Fprintf(errOut, "received (%s) signal - stopping and cleaning up, interrupt again to exit now\n", sig) //nolint:errcheck
+			cancel(ErrInterrupted)
+		case <-done:
+			return
+		}
+
+		select {
+		case sig := <-signals:
+			fmt.Fprintf(errOut, "received second (%s) signal - exiting now\n", sig) //nolint:errcheck
+			mutex.Lock()
+			for _, cleanup := range cleanups {
+				cleanup()
+			}
+			mutex.Unlock()
+			exit(1)
+		case <-done:
+		}
+	}()
+
+	return ctx, onExit, func() {
+		stopNotify()
+		close(done)
+		cancel(nil)
+	}
+}
@@ -0,0 +1,88 @@
+package commandparser
+
+import (
+	"errors"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/events"
+)
+
+const (
+	constructStep = "construct"
+	packageStep   = "package"
+)
+
+// JSONConstructCmdMessenger reports construct command failures as
+// `-output-format json` events.
+type JSONConstructCmdMessenger struct {
+	Events *events.Emitter
+}
+
+func (m *JSONConstructCmdMessenger) ArgumentsNotProvided() {
+	m.Events.Failed(constructStep, errors.New("not all required parameters were provided"))
+}
+
+func (m *JSONConstructCmdMessenger) LGPONotFound() {
+	m.Events.Failed(constructStep, errors.New("could not find LGPO.zip in the current directory"))
+}
+
+func (m *JSONConstructCmdMessenger) CannotConnectToVM(err error) {
+	m.Events.Failed(constructStep, err)
+}
+
+func (m *JSONConstructCmdMessenger) CannotPrepareVM(err error) {
+	m.Events.Failed(constructStep, err)
+}
+
+func (m *JSONConstructCmdMessenger) InvalidConfigFile(err error) {
+	m.Events.Failed(constructStep, err)
+}
+
+func (m *JSONConstructCmdMessenger) InvalidSecret(err error) {
+	m.Events.Failed(constructStep, err)
+}
+
+func (m *JSONConstructCmdMessenger) InvalidSourceConfig(err error) {
+	m.Events.Failed(constructStep, err)
+}
+
+// JSONPackageMessenger reports package progress and failures as
+// `-output-format json` events.
+type JSONPackageMessenger struct {
+	Events *events.Emitter
+}
+
+func (m *JSONPackageMessenger) PackageStarted() {
+	m.Events.Started(packageStep, "")
+}
+
+func (m *JSONPackageMessenger) PackageSucceeded() {
+	m.Events.Succeeded(packageStep, "")
+}
+
+func (m *JSONPackageMessenger) InvalidOutputConfig(e error) {
+	m.Events.Failed(packageStep, e)
+}
+
+func (m *JSONPackageMessenger) CannotCreatePackager(e error) {
+	m.Events.Failed(packageStep, e)
+}
+
+func (m *JSONPackageMessenger) DoesNotHaveEnoughSpace(e error) {
+	m.Events.Failed(packageStep, e)
+}
+
+func (m *JSONPackageMessenger) SourceParametersAreInvalid(e error) {
+	m.Events.Failed(packageStep, e)
+}
+
+func (m *JSONPackageMessenger) PackageFailed(e error) {
+	m.Events.Failed(packageStep, e)
+}
+
+func (m *JSONPackageMessenger) InvalidConfigFile(e error) {
+	m.Events.Failed(packageStep, e)
+}
+
+func (m *JSONPackageMessenger) InvalidSecret(e error) {
+	m.Events.Failed(packageStep, e)
+}
@@ -0,0 +1,139 @@
+package commandparser_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+
+	"github.com/google/subcommands"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/commandparser"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/commandparser/commandparserfakes"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/events"
+)
+
+func readEvents(buf *bytes.Buffer) []events.Event {
+	var result []events.Event
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var event events.Event
+		Expect(json.Unmarshal(scanner.Bytes(), &event)).To(Succeed())
+		result = append(result, event)
+	}
+	return result
+}
+
+var _ = Describe("OutputFormat", func() {
+	It("defaults to text", func() {
+		var format commandparser.OutputFormat
+		Expect(format.String()).To(Equal("text"))
+	})
+
+	It("accepts text and json", func() {
+		var format commandparser.OutputFormat
+		Expect(format.Set("json")).To(Succeed())
+		Expect(format).To(Equal(commandparser.OutputFormatJSON))
+		Expect(format.Set("text")).To(Succeed())
+		Expect(format).To(Equal(commandparser.OutputFormatText))
+	})
+
+	It("rejects other formats", func() {
+		var format commandparser.OutputFormat
+		Expect(format.Set("yaml")).To(MatchError("must be text or json"))
+	})
+})
+
+var _ = Describe("JSON messengers", func() {
+	var buf *bytes.Buffer
+
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+	})
+
+	It("reports construct command failures as failed construct events", func() {
+		m := &commandparser.JSONConstructCmdMessenger{Events: events.NewEmitter(buf)}
+
+		m.ArgumentsNotProvided()
+		m.CannotPrepareVM(errors.New("some error"))
+
+		result := readEvents(buf)
+		Expect(result).To(HaveLen(2))
+		Expect(result[0].Step).To(Equal("construct"))
+		Expect(result[0].Phase).To(Equal(events.PhaseFailed))
+		Expect(result[0].Error).To(Equal("not all required parameters were provided"))
+		Expect(result[1].Error).To(Equal("some error"))
+	})
+
+	It("reports package progress and failures as package events", func() {
+		m := &commandparser.JSONPackageMessenger{Events: events.NewEmitter(buf)}
+
+		m.PackageStarted()
+		m.PackageFailed(errors.New("export failed"))
+
+		result := readEvents(buf)
+		Expect(result).To(HaveLen(2))
+		Expect(result[0].Step).To(Equal("package"))
+		Expect(result[0].Phase).To(Equal(events.PhaseStarted))
+		Expect(result[1].Phase).To(Equal(events.PhaseFailed))
+		Expect(result[1].Error).To(Equal("export failed"))
+		Expect(result[1].Duration).NotTo(BeNil())
+	})
+
+	Describe("commands", func() {
+		var (
+			f  *flag.FlagSet
+			gf *commandparser.GlobalFlags
+		)
+
+		BeforeEach(func() {
+			f = flag.NewFlagSet("test", flag.ContinueOnError)
+			gf = &commandparser.GlobalFlags{OutputFormat: commandparser.OutputFormatJSON, Events: events.NewEmitter(buf)}
+		})
+
+		It("package emits events instead of calling the text messenger", func() {
+			packagerFactory := &commandparserfakes.FakePackagerFactory{}
+			packagerFactory.NewPackagerReturns(&commandparserfakes.FakePackager{}, nil)
+			osAndVersionGetter := &commandparserfakes.FakeOSAndVersionGetter{}
+			osAndVersionGetter.GetVersionReturns("2019.2")
+			osAndVersionGetter.GetOsReturns("2019")
+			textMessenger := &commandparserfakes.FakePackagerMessenger{}
+
+			packageCmd := commandparser.NewPackageCommand(osAndVersionGetter, packagerFactory, textMessenger)
+			packageCmd.SetFlags(f)
+			packageCmd.GlobalFlags = gf
+			Expect(f.Parse([]string{"-vmdk", "some.vmdk"})).To(Succeed())
+
+			Expect(packageCmd.Execute(context.Background(), f)).To(Equal(subcommands.ExitSuccess))
+
+			Expect(textMessenger.PackageStartedCallCount()).To(Equal(0))
+			result := readEvents(buf)
+			Expect(result).To(HaveLen(2))
+			Expect(result[0].Phase).To(Equal(events.PhaseStarted))
+			Expect(result[1].Phase).To(Equal(events.PhaseSucceeded))
+		})
+
+		It("construct emits failures as events instead of calling the text messenger", func() {
+			validator := &commandparserfakes.FakeConstructCmdValidator{}
+			validator.PopulatedArgsReturns(false)
+			textMessenger := &commandparserfakes.FakeConstructMessenger{}
+
+			constructCmd := commandparser.NewConstructCmd(context.Background(), &commandparserfakes.FakeVMPreparerFactory{}, &commandparserfakes.FakeManagerFactory{}, validator, textMessenger)
+			constructCmd.SetFlags(f)
+			constructCmd.GlobalFlags = gf
+			Expect(f.Parse([]string{})).To(Succeed())
+
+			Expect(constructCmd.Execute(context.Background(), f)).To(Equal(subcommands.ExitFailure))
+
+			Expect(textMessenger.ArgumentsNotProvidedCallCount()).To(Equal(0))
+			result := readEvents(buf)
+			Expect(result).To(HaveLen(1))
+			Expect(result[0].Step).To(Equal("construct"))
+			Expect(result[0].Phase).To(Equal(events.PhaseFailed))
+		})
+	})
+})
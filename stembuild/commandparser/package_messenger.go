@@ -3,29 +3,49 @@ package commandparser
 import (
 	"fmt"
 	"io"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
 )
 
 type PackageMessenger struct {
 	Output io.Writer
 }
 
+func (m *PackageMessenger) printError(e error) {
+	fmt.Fprintln(m.Output, colorlogger.Redact(e.Error())) //nolint:errcheck
+}
+
+// PackageStarted and PackageSucceeded write nothing; the packagers print
+// their own progress.
+func (m *PackageMessenger) PackageStarted() {}
+
+func (m *PackageMessenger) PackageSucceeded() {}
+
 func (m *PackageMessenger) InvalidOutputConfig(e error) {
-	fmt.Fprintln(m.Output, e) //nolint:errcheck
+	m.printError(e)
 }
 
 func (m *PackageMessenger) CannotCreatePackager(e error) {
-	fmt.Fprintln(m.Output, e) //nolint:errcheck
+	m.printError(e)
 }
 
 func (m *PackageMessenger) DoesNotHaveEnoughSpace(e error) {
-	fmt.Fprintln(m.Output, e) //nolint:errcheck
+	m.printError(e)
 }
 
 func (m *PackageMessenger) SourceParametersAreInvalid(e error) {
-	fmt.Fprintln(m.Output, e) //nolint:errcheck
+	m.printError(e)
 }
 
 func (m *PackageMessenger) PackageFailed(e error) {
-	fmt.Fprintln(m.Output, e)                                                              //nolint:errcheck
+	m.printError(e)
 	fmt.Fprintln(m.Output, "Please provide the error logs to bosh-windows-eng@pivotal.io") //nolint:errcheck
 }
+
+func (m *PackageMessenger) InvalidConfigFile(e error) {
+	m.printError(e)
+}
+
+func (m *PackageMessenger) InvalidSecret(e error) {
+	m.printError(e)
+}
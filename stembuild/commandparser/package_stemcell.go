@@ -4,13 +4,16 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
 	"github.com/google/subcommands"
 
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/digest"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/filesystem"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli/iaas_clients"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/config"
 )
 
@@ -23,7 +26,7 @@ type OSAndVersionGetter interface {
 
 //counterfeiter:generate . PackagerFactory
 type PackagerFactory interface {
-	NewPackager(sourceConfig config.SourceConfig, outputConfig config.OutputConfig, logger colorlogger.Logger) (Packager, error)
+	NewPackager(ctx context.Context, sourceConfig config.SourceConfig, outputConfig config.OutputConfig, logger colorlogger.Logger) (Packager, error)
 }
 
 //counterfeiter:generate . Packager
@@ -35,11 +38,15 @@ type Packager interface {
 
 //counterfeiter:generate . PackagerMessenger
 type PackagerMessenger interface {
+	PackageStarted()
+	PackageSucceeded()
 	InvalidOutputConfig(error)
 	CannotCreatePackager(error)
 	DoesNotHaveEnoughSpace(error)
 	SourceParametersAreInvalid(error)
 	PackageFailed(error)
+	InvalidConfigFile(error)
+	InvalidSecret(error)
 }
 
 type PackageCmd struct {
@@ -49,6 +56,9 @@ type PackageCmd struct {
 	osAndVersionGetter OSAndVersionGetter
 	packagerFactory    PackagerFactory
 	packagerMessenger  PackagerMessenger
+	Stdin              io.Reader
+	configFile         string
+	passwordFile       string
 }
 
 func NewPackageCommand(o OSAndVersionGetter, p PackagerFactory, m PackagerMessenger) *PackageCmd {
@@ -77,6 +87,8 @@ VM on vCenter:
     - VM provisioned using the stembuild construct command
     - Access to vCenter environment
     - The [vcenter-url], [vcenter-username], [vcenter-password], and [vm-inventory-path] flags must be specified.
+      The password can also be read from a file with [vcenter-password-file], from stdin with '-',
+      or from the %[2]s environment variable.
     - NOTE: The 'vm' keyword must be included between the datacenter name and folder name for the vm-inventory-path (e.g: <datacenter>/vm/<vm-folder>/<vm-name>) 
   Example:
     %[1]s package -vcenter-url vcenter.example.com -vcenter-username root -vcenter-password 'password' -vm-inventory-path '/my-datacenter/vm/my-folder/my-vm' 
@@ -87,7 +99,7 @@ VMDK:
 
   Requirements:
     - The VMware 'ovftool' binary must be on your path or Fusion/Workstation
-    must be installed (both include the 'ovftool').
+    must be installed (both include the 'ovftool'), unless [ova-builder] is 'native'.
     - The [vmdk] flag must be specified.  If the [output] flag is
     not specified the stemcell will be created in the current working directory.
 
@@ -97,30 +109,98 @@ VMDK:
     Will create an Windows 1803 stemcell using [vmdk] 'my-1803-vmdk.vmdk'
     The final stemcell will be found in the current working directory.
 
+Light stemcell:
+
+  %[1]s package -light -iaas <aws|azure|gcp> -image-ref <image>
+
+  Creates a light stemcell, which references an image already published to
+  the IaaS instead of holding one. The [image-ref] is:
+    - aws: comma separated region:ami-id pairs, e.g. us-east-1:ami-0123456789abcdef0
+    - azure: a publisher:offer:sku:version URN
+    - gcp: the image URL, or projects/<project>/global/images/<image>
+
+Config file:
+
+  %[1]s package -config <path-to-config-file>
+
+  Reads the 'package' section of a YAML or JSON file. Flags override values from the config file.
+
 Flags:
-`, filepath.Base(os.Args[0]))
+`, filepath.Base(os.Args[0]), VCenterPasswordEnvVar)
 }
 
 func (p *PackageCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&p.configFile, "config", "", "YAML or JSON file with the 'package' settings; values may reference environment variables as ${NAME}")
 	f.StringVar(&p.sourceConfig.Vmdk, "vmdk", "", "VMDK file to create stemcell from")
 	f.StringVar(&p.sourceConfig.VmInventoryPath, "vm-inventory-path", "", "vCenter VM inventory path. (e.g: <datacenter>/vm/<vm-folder>/<vm-name>)")
 	f.StringVar(&p.sourceConfig.Username, "vcenter-username", "", "vCenter username")
-	f.StringVar(&p.sourceConfig.Password, "vcenter-password", "", "vCenter password")
+	f.StringVar(&p.sourceConfig.Password, "vcenter-password", "", "vCenter password. Use '-' to read it from stdin, defaults to $"+VCenterPasswordEnvVar)
+	passwordFileFlag(f, &p.passwordFile, "vcenter-password")
 	f.StringVar(&p.sourceConfig.URL, "vcenter-url", "", "vCenter url")
 	f.StringVar(&p.sourceConfig.CaCertFile, "vcenter-ca-certs", "", "filepath for custom ca certs")
+	f.StringVar(&p.sourceConfig.VCenterClient, "vcenter-client", iaas_clients.VCenterClientGovc, "how to talk to vCenter: "+iaas_clients.VCenterClientGovc+" commands, or "+iaas_clients.VCenterClientGovmomi+" directly")
 
 	f.StringVar(&p.outputConfig.OutputDir, "outputDir", "", "Output directory, default is the current working directory.")
 	f.StringVar(&p.outputConfig.OutputDir, "o", "", "Output directory (shorthand)")
+	f.IntVar(&p.outputConfig.CompressionLevel, "compression-level", config.DefaultCompressionLevel, "gzip level for the stemcell, from 1 (fastest) to 9 (smallest); 0 stores without compression, -1 is the default level and -2 Huffman only")
+	f.IntVar(&p.outputConfig.CompressionThreads, "compression-threads", 0, "number of blocks to compress in parallel, 0 uses one per CPU")
+	p.outputConfig.DigestAlgorithms = digest.Default
+	f.Var(&p.outputConfig.DigestAlgorithms, "digest-algorithms", "comma separated checksums of the image to record in stemcell.MF, sha1 and/or sha256; the OVF manifest uses the strongest")
+	f.BoolVar(&p.outputConfig.Reproducible, "reproducible", false, "create a byte-identical stemcell from identical inputs, with every file dated $"+config.SourceDateEpochEnvVar+" (default 1970-01-01)")
+	f.StringVar(&p.outputConfig.OVABuilder, "ova-builder", config.OVABuilderOvftool, "how to build the OVA from a VMDK: "+config.OVABuilderOvftool+", with VMware's ovftool, or "+config.OVABuilderNative+", without it")
+	f.BoolVar(&p.outputConfig.Light, "light", false, "create a light stemcell for the image given by -image-ref")
+	f.StringVar(&p.outputConfig.IaaS, "iaas", "", "IaaS of a light stemcell: "+config.IaaSAWS+", "+config.IaaSAzure+" or "+config.IaaSGCP)
+	f.StringVar(&p.sourceConfig.ImageRef, "image-ref", "", "image a light stemcell references: region:ami-id pairs for aws, a URN for azure, an image URL for gcp")
+	f.Var(&p.outputConfig.CloudProperties, "cloud-property", "key=value to add to the cloud_properties of stemcell.MF, replacing stembuild's own; may be repeated")
 	f.StringVar(&patchVersion, "patch-version", "", "Number or name of the patch version for the stemcell being built (e.g: for 2019.12.3 the string would be \"3\")")
 }
 
-func (p *PackageCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+func (p *PackageCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if p.GlobalFlags.Events != nil {
+		p.packagerMessenger = &JSONPackageMessenger{Events: p.GlobalFlags.Events}
+	}
 
 	logLevel := colorlogger.NONE
 	if p.GlobalFlags.Debug {
 		logLevel = colorlogger.DEBUG
 	}
 
+	setFlags := explicitFlags(f)
+	if p.configFile != "" {
+		configFile, err := LoadConfigFile(p.configFile)
+		if err != nil {
+			p.packagerMessenger.InvalidConfigFile(err)
+			return subcommands.ExitFailure
+		}
+
+		fromFlags := PackageConfigFile{SourceConfig: p.sourceConfig, OutputConfig: p.outputConfig, PatchVersion: patchVersion}
+		merged := mergePackageConfig(configFile.Package, fromFlags, setFlags)
+		p.sourceConfig = merged.SourceConfig
+		p.outputConfig.OutputDir = merged.OutputDir
+		p.outputConfig.CompressionLevel = merged.CompressionLevel
+		p.outputConfig.CompressionThreads = merged.CompressionThreads
+		p.outputConfig.DigestAlgorithms = merged.DigestAlgorithms
+		p.outputConfig.Reproducible = merged.Reproducible
+		p.outputConfig.OVABuilder = merged.OVABuilder
+		p.outputConfig.Light = merged.Light
+		p.outputConfig.IaaS = merged.IaaS
+		p.outputConfig.CloudProperties = merged.CloudProperties
+		patchVersion = merged.PatchVersion
+	}
+
+	// The password is only looked up for vCenter sources, so that building from
+	// a VMDK or an image does not pick up a password from the environment.
+	if p.sourceConfig.Vmdk == "" && p.sourceConfig.ImageRef == "" {
+		err := resolveSecrets([]secret{
+			{flagName: "vcenter-password", envVar: VCenterPasswordEnvVar, value: &p.sourceConfig.Password, file: p.passwordFile},
+		}, setFlags, p.stdin())
+		if err != nil {
+			p.packagerMessenger.InvalidSecret(err)
+			return subcommands.ExitFailure
+		}
+	}
+	colorlogger.RegisterSecret(p.sourceConfig.Password)
+
 	p.setOSandStemcellVersions()
 
 	err := p.outputConfig.ValidateConfig()
@@ -129,29 +209,39 @@ func (p *PackageCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{
 		return subcommands.ExitFailure
 	}
 
+	ctx, onExit, stop := notifyOnInterrupt(ctx, os.Stderr)
+	defer stop()
+
 	logger := colorlogger.New(logLevel, p.GlobalFlags.Color, os.Stderr)
-	packager, err := p.packagerFactory.NewPackager(p.sourceConfig, p.outputConfig, logger)
+	packager, err := p.packagerFactory.NewPackager(ctx, p.sourceConfig, p.outputConfig, logger)
 	if err != nil {
 		p.packagerMessenger.CannotCreatePackager(err)
 		return subcommands.ExitFailure
 	}
+	// Packagers that keep temporary files remove them even when a second
+	// Ctrl-C exits without waiting for packaging to stop.
+	if cleaner, ok := packager.(interface{ Cleanup() }); ok {
+		onExit(cleaner.Cleanup)
+	}
 
-	err = packager.ValidateFreeSpaceForPackage(&filesystem.OSFileSystem{})
+	err = packager.ValidateSourceParameters()
 	if err != nil {
-		p.packagerMessenger.DoesNotHaveEnoughSpace(err)
+		p.packagerMessenger.SourceParametersAreInvalid(err)
 		return subcommands.ExitFailure
 	}
 
-	err = packager.ValidateSourceParameters()
+	err = packager.ValidateFreeSpaceForPackage(&filesystem.OSFileSystem{})
 	if err != nil {
-		p.packagerMessenger.SourceParametersAreInvalid(err)
+		p.packagerMessenger.DoesNotHaveEnoughSpace(err)
 		return subcommands.ExitFailure
 	}
 
+	p.packagerMessenger.PackageStarted()
 	if err := packager.Package(); err != nil {
 		p.packagerMessenger.PackageFailed(err)
 		return subcommands.ExitFailure
 	}
+	p.packagerMessenger.PackageSucceeded()
 
 	return subcommands.ExitSuccess
 }
@@ -165,3 +255,11 @@ func (p *PackageCmd) setOSandStemcellVersions() {
 		p.outputConfig.StemcellVersion = p.osAndVersionGetter.GetVersionWithPatchNumber(patchVersion)
 	}
 }
+
+func (p *PackageCmd) stdin() io.Reader {
+	if p.Stdin == nil {
+		return os.Stdin
+	}
+
+	return p.Stdin
+}
@@ -4,13 +4,17 @@ import (
 	"context"
 	"errors"
 	"flag"
+	"os"
 
 	"github.com/google/subcommands"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/commandparser"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/commandparser/commandparserfakes"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/digest"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/config"
 )
 
 var _ = Describe("package_stemcell", func() {
@@ -62,7 +66,7 @@ var _ = Describe("package_stemcell", func() {
 				Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
 
 				Expect(packagerFactory.NewPackagerCallCount()).To(Equal(1))
-				actualSourceConfig, _, _ := packagerFactory.NewPackagerArgsForCall(0)
+				_, actualSourceConfig, _, _ := packagerFactory.NewPackagerArgsForCall(0)
 				Expect(actualSourceConfig.Vmdk).To(Equal("some_vmdk_file"))
 			})
 
@@ -82,7 +86,7 @@ var _ = Describe("package_stemcell", func() {
 				Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
 
 				Expect(packagerFactory.NewPackagerCallCount()).To(Equal(1))
-				actualSourceConfig, _, _ := packagerFactory.NewPackagerArgsForCall(0)
+				_, actualSourceConfig, _, _ := packagerFactory.NewPackagerArgsForCall(0)
 				Expect(actualSourceConfig.URL).To(Equal("https://vcenter.test"))
 				Expect(actualSourceConfig.Username).To(Equal("test-user"))
 				Expect(actualSourceConfig.Password).To(Equal("verysecure"))
@@ -100,10 +104,21 @@ var _ = Describe("package_stemcell", func() {
 				Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
 
 				Expect(packagerFactory.NewPackagerCallCount()).To(Equal(1))
-				_, actualOutputConfig, _ := packagerFactory.NewPackagerArgsForCall(0)
+				_, _, actualOutputConfig, _ := packagerFactory.NewPackagerArgsForCall(0)
 				Expect(actualOutputConfig.OutputDir).To(Equal("some_output_dir"))
 			})
 
+			It("tells the messenger when packaging starts and succeeds", func() {
+				err := f.Parse([]string{"-vmdk", "some_vmdk_file"})
+				Expect(err).ToNot(HaveOccurred())
+
+				exitStatus := PkgCmd.Execute(context.Background(), f)
+				Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+
+				Expect(packagerMessenger.PackageStartedCallCount()).To(Equal(1))
+				Expect(packagerMessenger.PackageSucceededCallCount()).To(Equal(1))
+			})
+
 			It("packager is instantiated with expected output config when using short form -o", func() {
 				shortformOutputDirArgs := []string{"-o", "some_output_dir"}
 
@@ -114,12 +129,125 @@ var _ = Describe("package_stemcell", func() {
 				Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
 
 				Expect(packagerFactory.NewPackagerCallCount()).To(Equal(1))
-				_, actualOutputConfig, _ := packagerFactory.NewPackagerArgsForCall(0)
+				_, _, actualOutputConfig, _ := packagerFactory.NewPackagerArgsForCall(0)
 				Expect(actualOutputConfig.OutputDir).To(Equal("some_output_dir"))
 				Expect(actualOutputConfig.StemcellVersion).To(Equal("2019.2"))
 				Expect(actualOutputConfig.Os).To(Equal("2019"))
 			})
 
+			It("packager is instantiated with the default compression unless it is given", func() {
+				err := f.Parse([]string{"-vmdk", "some_vmdk_file"})
+				Expect(err).ToNot(HaveOccurred())
+
+				exitStatus := PkgCmd.Execute(context.Background(), f)
+				Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+
+				_, _, actualOutputConfig, _ := packagerFactory.NewPackagerArgsForCall(0)
+				Expect(actualOutputConfig.CompressionLevel).To(Equal(-1))
+				Expect(actualOutputConfig.CompressionThreads).To(Equal(0))
+			})
+
+			It("packager is instantiated with the given compression level and threads", func() {
+				err := f.Parse([]string{"-vmdk", "some_vmdk_file", "-compression-level", "1", "-compression-threads", "4"})
+				Expect(err).ToNot(HaveOccurred())
+
+				exitStatus := PkgCmd.Execute(context.Background(), f)
+				Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+
+				_, _, actualOutputConfig, _ := packagerFactory.NewPackagerArgsForCall(0)
+				Expect(actualOutputConfig.CompressionLevel).To(Equal(1))
+				Expect(actualOutputConfig.CompressionThreads).To(Equal(4))
+			})
+
+			It("packager is instantiated with sha1 as the digest algorithm unless others are given", func() {
+				err := f.Parse([]string{"-vmdk", "some_vmdk_file"})
+				Expect(err).ToNot(HaveOccurred())
+
+				exitStatus := PkgCmd.Execute(context.Background(), f)
+				Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+
+				_, _, actualOutputConfig, _ := packagerFactory.NewPackagerArgsForCall(0)
+				Expect(actualOutputConfig.Digests()).To(Equal(digest.Algorithms{digest.SHA1}))
+			})
+
+			It("packager is instantiated with the given digest algorithms", func() {
+				err := f.Parse([]string{"-vmdk", "some_vmdk_file", "-digest-algorithms", "sha1,sha256"})
+				Expect(err).ToNot(HaveOccurred())
+
+				exitStatus := PkgCmd.Execute(context.Background(), f)
+				Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+
+				_, _, actualOutputConfig, _ := packagerFactory.NewPackagerArgsForCall(0)
+				Expect(actualOutputConfig.DigestAlgorithms).To(Equal(digest.Algorithms{digest.SHA1, digest.SHA256}))
+			})
+
+			It("packager is instantiated for a reproducible stemcell when asked", func() {
+				err := f.Parse([]string{"-vmdk", "some_vmdk_file", "-reproducible"})
+				Expect(err).ToNot(HaveOccurred())
+
+				exitStatus := PkgCmd.Execute(context.Background(), f)
+				Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+
+				_, _, actualOutputConfig, _ := packagerFactory.NewPackagerArgsForCall(0)
+				Expect(actualOutputConfig.Reproducible).To(BeTrue())
+			})
+
+			It("packager is instantiated to build the OVA with ovftool unless another builder is given", func() {
+				err := f.Parse([]string{"-vmdk", "some_vmdk_file"})
+				Expect(err).ToNot(HaveOccurred())
+
+				exitStatus := PkgCmd.Execute(context.Background(), f)
+				Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+
+				_, _, actualOutputConfig, _ := packagerFactory.NewPackagerArgsForCall(0)
+				Expect(actualOutputConfig.OVABuilder).To(Equal("ovftool"))
+			})
+
+			It("packager is instantiated with the given OVA builder", func() {
+				err := f.Parse([]string{"-vmdk", "some_vmdk_file", "-ova-builder", "native"})
+				Expect(err).ToNot(HaveOccurred())
+
+				exitStatus := PkgCmd.Execute(context.Background(), f)
+				Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+
+				_, _, actualOutputConfig, _ := packagerFactory.NewPackagerArgsForCall(0)
+				Expect(actualOutputConfig.OVABuilder).To(Equal("native"))
+			})
+
+			It("packager is instantiated for a light stemcell of the given image", func() {
+				err := f.Parse([]string{"-light", "-iaas", "gcp", "-image-ref", "projects/p/global/images/windows2019"})
+				Expect(err).ToNot(HaveOccurred())
+
+				exitStatus := PkgCmd.Execute(context.Background(), f)
+				Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+
+				_, actualSourceConfig, actualOutputConfig, _ := packagerFactory.NewPackagerArgsForCall(0)
+				Expect(actualSourceConfig.ImageRef).To(Equal("projects/p/global/images/windows2019"))
+				Expect(actualOutputConfig.Light).To(BeTrue())
+				Expect(actualOutputConfig.IaaS).To(Equal("gcp"))
+			})
+
+			It("packager is instantiated with the given cloud properties", func() {
+				err := f.Parse([]string{"-vmdk", "some_vmdk_file", "-cloud-property", "boot_mode=uefi", "-cloud-property", "encrypted=false"})
+				Expect(err).ToNot(HaveOccurred())
+
+				exitStatus := PkgCmd.Execute(context.Background(), f)
+				Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
+
+				_, _, actualOutputConfig, _ := packagerFactory.NewPackagerArgsForCall(0)
+				Expect(actualOutputConfig.CloudProperties).To(Equal(config.CloudProperties{"boot_mode": "uefi", "encrypted": false}))
+			})
+
+			It("rejects a cloud property that is not key=value", func() {
+				err := f.Parse([]string{"-vmdk", "some_vmdk_file", "-cloud-property", "uefi"})
+				Expect(err).To(MatchError(ContainSubstring("cloud property must be key=value")))
+			})
+
+			It("rejects an unsupported digest algorithm", func() {
+				err := f.Parse([]string{"-vmdk", "some_vmdk_file", "-digest-algorithms", "md5"})
+				Expect(err).To(MatchError(ContainSubstring(`unsupported digest algorithm "md5"`)))
+			})
+
 			It("creates packager with correct stemcell patch version number when argument provided", func() {
 				oSAndVersionGetter.GetVersionWithPatchNumberReturns("1803.27.36")
 
@@ -132,7 +260,7 @@ var _ = Describe("package_stemcell", func() {
 				Expect(exitStatus).To(Equal(subcommands.ExitSuccess))
 
 				Expect(packagerFactory.NewPackagerCallCount()).To(Equal(1))
-				_, actualOutputConfig, _ := packagerFactory.NewPackagerArgsForCall(0)
+				_, _, actualOutputConfig, _ := packagerFactory.NewPackagerArgsForCall(0)
 				Expect(actualOutputConfig.StemcellVersion).To(Equal("1803.27.36"))
 
 				Expect(oSAndVersionGetter.GetVersionWithPatchNumberCallCount()).To(Equal(1))
@@ -200,6 +328,7 @@ var _ = Describe("package_stemcell", func() {
 				Expect(exitStatus).To(Equal(subcommands.ExitFailure))
 
 				Expect(packager.ValidateSourceParametersCallCount()).To(Equal(1))
+				Expect(packager.ValidateFreeSpaceForPackageCallCount()).To(Equal(0))
 				Expect(packager.PackageCallCount()).To(Equal(0))
 
 				Expect(packagerMessenger.SourceParametersAreInvalidCallCount()).To(Equal(1))
@@ -222,6 +351,53 @@ var _ = Describe("package_stemcell", func() {
 				receivedError := packagerMessenger.PackageFailedArgsForCall(0)
 				Expect(receivedError).To(MatchError("Didn't make it"))
 			})
+
+			It("cleans up the packager before exiting on a second interrupt", func() {
+				var signals chan<- os.Signal
+				var packageCtx context.Context
+				var events []string
+				exitCodes := make(chan int, 1)
+				restore := commandparser.SetInterruptNotifier(
+					func(c chan<- os.Signal) func() {
+						signals = c
+						return func() {}
+					},
+					func(code int) {
+						events = append(events, "exit")
+						exitCodes <- code
+					},
+				)
+				DeferCleanup(restore)
+
+				cleaningPackager := &cleanupPackager{FakePackager: packager, cleanup: func() {
+					events = append(events, "cleanup")
+				}}
+				packagerFactory.NewPackagerCalls(func(ctx context.Context, _ config.SourceConfig, _ config.OutputConfig, _ colorlogger.Logger) (commandparser.Packager, error) {
+					packageCtx = ctx
+					return cleaningPackager, nil
+				})
+				packager.PackageCalls(func() error {
+					signals <- os.Interrupt
+					<-packageCtx.Done()
+					signals <- os.Interrupt
+					Eventually(exitCodes).Should(Receive(Equal(1)))
+					return context.Cause(packageCtx)
+				})
+
+				Expect(f.Parse(defaultArgs)).To(Succeed())
+				PkgCmd.Execute(context.Background(), f)
+
+				Expect(events).To(Equal([]string{"cleanup", "exit"}))
+			})
 		})
 	})
 })
+
+type cleanupPackager struct {
+	*commandparserfakes.FakePackager
+	cleanup func()
+}
+
+func (p *cleanupPackager) Cleanup() {
+	p.cleanup()
+}
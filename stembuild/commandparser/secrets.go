@@ -0,0 +1,97 @@
+package commandparser
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	VCenterPasswordEnvVar = "STEMBUILD_VCENTER_PASSWORD"
+	VMPasswordEnvVar      = "STEMBUILD_VM_PASSWORD"
+
+	stdinSecret = "-"
+)
+
+// secret is a password that can be given as a flag, as a -<flag>-file, as
+// '-' to read it from stdin or through an environment variable.
+type secret struct {
+	flagName string
+	envVar   string
+	value    *string
+	file     string
+}
+
+func passwordFileFlag(f *flag.FlagSet, file *string, passwordFlag string) {
+	f.StringVar(file, passwordFlag+"-file", "", fmt.Sprintf("File to read the %s from, or '-' to read it from stdin", strings.ReplaceAll(passwordFlag, "-", " ")))
+}
+
+// resolveSecrets fills in every secret that was not given as a value. An
+// explicit flag wins over a file, which wins over the config file, which wins
+// over the environment variable.
+func resolveSecrets(secrets []secret, setFlags map[string]bool, stdin io.Reader) error {
+	readFromStdin := ""
+	readStdin := func(flagName string) (string, error) {
+		if readFromStdin != "" {
+			return "", fmt.Errorf("-%s and -%s cannot both be read from stdin", readFromStdin, flagName)
+		}
+		readFromStdin = flagName
+
+		return readSecret(stdin)
+	}
+
+	for _, s := range secrets {
+		fileFlag := s.flagName + "-file"
+		if setFlags[s.flagName] && setFlags[fileFlag] {
+			return fmt.Errorf("only one of -%s and -%s may be specified", s.flagName, fileFlag)
+		}
+
+		var err error
+		switch {
+		case s.file == stdinSecret:
+			*s.value, err = readStdin(s.flagName)
+		case s.file != "":
+			*s.value, err = readSecretFile(s.file)
+		case *s.value == stdinSecret:
+			*s.value, err = readStdin(s.flagName)
+		case *s.value == "":
+			*s.value = os.Getenv(s.envVar)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read -%s: %s", s.flagName, err)
+		}
+	}
+
+	return nil
+}
+
+func readSecretFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close() //nolint:errcheck
+
+	return readSecret(f)
+}
+
+// readSecret reads a secret up to the end of its first line, so that
+// `echo password |`, typing it at a prompt and files with a trailing newline
+// all work.
+func readSecret(r io.Reader) (string, error) {
+	value, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	value = strings.TrimRight(value, "\r\n")
+	if value == "" {
+		return "", errors.New("secret is empty")
+	}
+
+	return value, nil
+}
@@ -0,0 +1,222 @@
+package commandparser_test
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/subcommands"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/commandparser"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/commandparser/commandparserfakes"
+)
+
+var _ = Describe("secrets", func() {
+	var secretsDir string
+
+	writeSecret := func(name, contents string) string {
+		path := filepath.Join(secretsDir, name)
+		Expect(os.WriteFile(path, []byte(contents), 0600)).To(Succeed())
+		return path
+	}
+
+	BeforeEach(func() {
+		secretsDir = GinkgoT().TempDir()
+		GinkgoT().Setenv(commandparser.VCenterPasswordEnvVar, "")
+		GinkgoT().Setenv(commandparser.VMPasswordEnvVar, "")
+	})
+
+	Describe("construct", func() {
+		var (
+			f             *flag.FlagSet
+			constructCmd  *commandparser.ConstructCmd
+			fakeFactory   *commandparserfakes.FakeVMPreparerFactory
+			fakeValidator *commandparserfakes.FakeConstructCmdValidator
+			fakeMessenger *commandparserfakes.FakeConstructMessenger
+			requiredArgs  []string
+		)
+
+		BeforeEach(func() {
+			f = flag.NewFlagSet("test", flag.ContinueOnError)
+			fakeFactory = &commandparserfakes.FakeVMPreparerFactory{}
+			fakeFactory.NewReturns(&commandparserfakes.FakeVmConstruct{}, nil)
+			fakeValidator = &commandparserfakes.FakeConstructCmdValidator{}
+			fakeValidator.PopulatedArgsReturns(true)
+			fakeValidator.LGPOInDirectoryReturns(true)
+			fakeMessenger = &commandparserfakes.FakeConstructMessenger{}
+
+			constructCmd = commandparser.NewConstructCmd(context.Background(), fakeFactory, &commandparserfakes.FakeManagerFactory{}, fakeValidator, fakeMessenger)
+			constructCmd.SetFlags(f)
+			constructCmd.GlobalFlags = &commandparser.GlobalFlags{}
+			constructCmd.Stdin = strings.NewReader("")
+
+			requiredArgs = []string{
+				"-vm-ip", "10.0.0.5",
+				"-vm-username", "Admin",
+				"-vcenter-url", "vcenter.example.com",
+				"-vcenter-username", "root",
+				"-vm-inventory-path", "/dc/vm/folder/vm",
+			}
+		})
+
+		execute := func(args ...string) subcommands.ExitStatus {
+			Expect(f.Parse(append(requiredArgs, args...))).To(Succeed())
+			return constructCmd.Execute(context.Background(), f)
+		}
+
+		It("reads the passwords from the environment", func() {
+			GinkgoT().Setenv(commandparser.VMPasswordEnvVar, "vm-from-env")
+			GinkgoT().Setenv(commandparser.VCenterPasswordEnvVar, "vcenter-from-env")
+
+			Expect(execute()).To(Equal(subcommands.ExitSuccess))
+
+			_, sourceConfig, _ := fakeFactory.NewArgsForCall(0)
+			Expect(sourceConfig.GuestVMPassword).To(Equal("vm-from-env"))
+			Expect(sourceConfig.VCenterPassword).To(Equal("vcenter-from-env"))
+		})
+
+		It("treats passwords from the environment as populated arguments", func() {
+			GinkgoT().Setenv(commandparser.VMPasswordEnvVar, "vm-from-env")
+			GinkgoT().Setenv(commandparser.VCenterPasswordEnvVar, "vcenter-from-env")
+
+			execute()
+
+			Expect(fakeValidator.PopulatedArgsArgsForCall(0)).To(ContainElements("vm-from-env", "vcenter-from-env"))
+		})
+
+		It("prefers the flag over the environment", func() {
+			GinkgoT().Setenv(commandparser.VCenterPasswordEnvVar, "vcenter-from-env")
+
+			Expect(execute("-vcenter-password", "vcenter-from-flag")).To(Equal(subcommands.ExitSuccess))
+
+			_, sourceConfig, _ := fakeFactory.NewArgsForCall(0)
+			Expect(sourceConfig.VCenterPassword).To(Equal("vcenter-from-flag"))
+		})
+
+		It("reads the passwords from files", func() {
+			GinkgoT().Setenv(commandparser.VCenterPasswordEnvVar, "vcenter-from-env")
+			vmPasswordFile := writeSecret("vm-password", "vm-from-file\n")
+			vCenterPasswordFile := writeSecret("vcenter-password", "vcenter-from-file\r\n")
+
+			Expect(execute("-vm-password-file", vmPasswordFile, "-vcenter-password-file", vCenterPasswordFile)).To(Equal(subcommands.ExitSuccess))
+
+			_, sourceConfig, _ := fakeFactory.NewArgsForCall(0)
+			Expect(sourceConfig.GuestVMPassword).To(Equal("vm-from-file"))
+			Expect(sourceConfig.VCenterPassword).To(Equal("vcenter-from-file"))
+		})
+
+		It("reads a password from stdin", func() {
+			constructCmd.Stdin = strings.NewReader("vm-from-stdin\n")
+
+			Expect(execute("-vm-password", "-", "-vcenter-password", "secret")).To(Equal(subcommands.ExitSuccess))
+
+			_, sourceConfig, _ := fakeFactory.NewArgsForCall(0)
+			Expect(sourceConfig.GuestVMPassword).To(Equal("vm-from-stdin"))
+		})
+
+		It("reads a password file from stdin", func() {
+			constructCmd.Stdin = strings.NewReader("vcenter-from-stdin")
+
+			Expect(execute("-vcenter-password-file", "-", "-vm-password", "secret")).To(Equal(subcommands.ExitSuccess))
+
+			_, sourceConfig, _ := fakeFactory.NewArgsForCall(0)
+			Expect(sourceConfig.VCenterPassword).To(Equal("vcenter-from-stdin"))
+		})
+
+		It("fails when both passwords are read from stdin", func() {
+			constructCmd.Stdin = strings.NewReader("secret\n")
+
+			Expect(execute("-vm-password", "-", "-vcenter-password", "-")).To(Equal(subcommands.ExitFailure))
+
+			Expect(fakeMessenger.InvalidSecretCallCount()).To(Equal(1))
+			Expect(fakeMessenger.InvalidSecretArgsForCall(0)).To(MatchError(ContainSubstring("cannot both be read from stdin")))
+			Expect(fakeFactory.NewCallCount()).To(Equal(0))
+		})
+
+		It("fails when both a password and a password file are given", func() {
+			passwordFile := writeSecret("vm-password", "vm-from-file")
+
+			Expect(execute("-vm-password", "secret", "-vm-password-file", passwordFile)).To(Equal(subcommands.ExitFailure))
+
+			Expect(fakeMessenger.InvalidSecretArgsForCall(0)).To(MatchError("only one of -vm-password and -vm-password-file may be specified"))
+		})
+
+		It("fails when the password file cannot be read", func() {
+			Expect(execute("-vm-password-file", filepath.Join(secretsDir, "missing"))).To(Equal(subcommands.ExitFailure))
+
+			Expect(fakeMessenger.InvalidSecretArgsForCall(0)).To(MatchError(ContainSubstring("unable to read -vm-password")))
+		})
+
+		It("fails when the password file is empty", func() {
+			Expect(execute("-vm-password-file", writeSecret("vm-password", "\n"))).To(Equal(subcommands.ExitFailure))
+
+			Expect(fakeMessenger.InvalidSecretArgsForCall(0)).To(MatchError(ContainSubstring("secret is empty")))
+		})
+	})
+
+	Describe("package", func() {
+		var (
+			f               *flag.FlagSet
+			packageCmd      *commandparser.PackageCmd
+			packagerFactory *commandparserfakes.FakePackagerFactory
+		)
+
+		BeforeEach(func() {
+			f = flag.NewFlagSet("test", flag.ContinueOnError)
+			oSAndVersionGetter := &commandparserfakes.FakeOSAndVersionGetter{}
+			oSAndVersionGetter.GetVersionReturns("2019.2")
+			oSAndVersionGetter.GetOsReturns("2019")
+			packagerFactory = &commandparserfakes.FakePackagerFactory{}
+			packagerFactory.NewPackagerReturns(&commandparserfakes.FakePackager{}, nil)
+
+			packageCmd = commandparser.NewPackageCommand(oSAndVersionGetter, packagerFactory, &commandparserfakes.FakePackagerMessenger{})
+			packageCmd.SetFlags(f)
+			packageCmd.GlobalFlags = &commandparser.GlobalFlags{}
+			packageCmd.Stdin = strings.NewReader("")
+		})
+
+		It("reads the vCenter password from the environment", func() {
+			GinkgoT().Setenv(commandparser.VCenterPasswordEnvVar, "vcenter-from-env")
+			Expect(f.Parse([]string{"-vcenter-url", "vcenter.example.com", "-vcenter-username", "root", "-vm-inventory-path", "/dc/vm/vm", "-o", secretsDir})).To(Succeed())
+
+			Expect(packageCmd.Execute(context.Background(), f)).To(Equal(subcommands.ExitSuccess))
+
+			_, sourceConfig, _, _ := packagerFactory.NewPackagerArgsForCall(0)
+			Expect(sourceConfig.Password).To(Equal("vcenter-from-env"))
+		})
+
+		It("reads the vCenter password from a file", func() {
+			passwordFile := writeSecret("vcenter-password", "vcenter-from-file\n")
+			Expect(f.Parse([]string{"-vcenter-url", "vcenter.example.com", "-vcenter-username", "root", "-vm-inventory-path", "/dc/vm/vm", "-vcenter-password-file", passwordFile, "-o", secretsDir})).To(Succeed())
+
+			Expect(packageCmd.Execute(context.Background(), f)).To(Equal(subcommands.ExitSuccess))
+
+			_, sourceConfig, _, _ := packagerFactory.NewPackagerArgsForCall(0)
+			Expect(sourceConfig.Password).To(Equal("vcenter-from-file"))
+		})
+
+		It("does not use the environment when packaging a VMDK", func() {
+			GinkgoT().Setenv(commandparser.VCenterPasswordEnvVar, "vcenter-from-env")
+			Expect(f.Parse([]string{"-vmdk", "disk.vmdk", "-o", secretsDir})).To(Succeed())
+
+			Expect(packageCmd.Execute(context.Background(), f)).To(Equal(subcommands.ExitSuccess))
+
+			_, sourceConfig, _, _ := packagerFactory.NewPackagerArgsForCall(0)
+			Expect(sourceConfig.Password).To(BeEmpty())
+		})
+
+		It("does not use the environment when packaging a light stemcell", func() {
+			GinkgoT().Setenv(commandparser.VCenterPasswordEnvVar, "vcenter-from-env")
+			Expect(f.Parse([]string{"-light", "-iaas", "aws", "-image-ref", "us-east-1:ami-0123", "-o", secretsDir})).To(Succeed())
+
+			Expect(packageCmd.Execute(context.Background(), f)).To(Equal(subcommands.ExitSuccess))
+
+			_, sourceConfig, _, _ := packagerFactory.NewPackagerArgsForCall(0)
+			Expect(sourceConfig.Password).To(BeEmpty())
+		})
+	})
+})
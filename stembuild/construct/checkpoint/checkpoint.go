@@ -0,0 +1,158 @@
+package checkpoint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// State is the content of a construct state file. It records which steps of
+// `stembuild construct` have completed for one VM and one stembuild version.
+type State struct {
+	VMInventoryPath  string    `json:"vm_inventory_path"`
+	StembuildVersion string    `json:"stembuild_version"`
+	CompletedSteps   []string  `json:"completed_steps"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// File persists construct progress to a JSON state file. The file name is
+// derived from the VM inventory path and the stembuild version, so progress
+// recorded for one VM or version is never used for another.
+type File struct {
+	path  string
+	state State
+	mutex sync.Mutex
+}
+
+// DefaultDir returns the directory construct state files are written to.
+func DefaultDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "stembuild", "construct")
+}
+
+// Load reads the state file for the given VM and stembuild version from dir.
+// A missing state file is not an error; it results in no completed steps.
+func Load(dir, vmInventoryPath, stembuildVersion string) (*File, error) {
+	f := &File{
+		path: filepath.Join(dir, fileName(vmInventoryPath, stembuildVersion)),
+		state: State{
+			VMInventoryPath:  vmInventoryPath,
+			StembuildVersion: stembuildVersion,
+		},
+	}
+
+	contents, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read construct state file %s: %s", f.path, err)
+	}
+
+	var state State
+	err = json.Unmarshal(contents, &state)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse construct state file %s: %s", f.path, err)
+	}
+
+	if state.VMInventoryPath == vmInventoryPath && state.StembuildVersion == stembuildVersion {
+		f.state.CompletedSteps = state.CompletedSteps
+		f.state.UpdatedAt = state.UpdatedAt
+	}
+
+	return f, nil
+}
+
+// Path returns the location of the state file.
+func (f *File) Path() string {
+	return f.path
+}
+
+func (f *File) Completed(step string) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return slices.Contains(f.state.CompletedSteps, step)
+}
+
+func (f *File) MarkCompleted(step string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !slices.Contains(f.state.CompletedSteps, step) {
+		f.state.CompletedSteps = append(f.state.CompletedSteps, step)
+	}
+
+	return f.write()
+}
+
+// Reset forgets all completed steps, both in memory and on disk.
+func (f *File) Reset() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.state.CompletedSteps = nil
+
+	return f.remove()
+}
+
+func (f *File) write() error {
+	f.state.UpdatedAt = time.Now().UTC()
+
+	contents, err := json.MarshalIndent(f.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(f.path), 0700)
+	if err != nil {
+		return fmt.Errorf("could not create construct state directory: %s", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("could not write construct state file: %s", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	_, err = tmp.Write(contents)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not write construct state file: %s", err)
+	}
+
+	err = os.Rename(tmp.Name(), f.path)
+	if err != nil {
+		return fmt.Errorf("could not write construct state file: %s", err)
+	}
+
+	return nil
+}
+
+func (f *File) remove() error {
+	err := os.Remove(f.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not remove construct state file: %s", err)
+	}
+
+	return nil
+}
+
+func fileName(vmInventoryPath, stembuildVersion string) string {
+	sum := sha256.Sum256([]byte(vmInventoryPath + "\x00" + stembuildVersion))
+
+	return fmt.Sprintf("%s.json", hex.EncodeToString(sum[:])[:16])
+}
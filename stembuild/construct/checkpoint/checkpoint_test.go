@@ -0,0 +1,86 @@
+package checkpoint_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct/checkpoint"
+)
+
+var _ = Describe("File", func() {
+	var stateDir string
+
+	BeforeEach(func() {
+		stateDir = GinkgoT().TempDir()
+	})
+
+	It("has no completed steps when there is no state file", func() {
+		f, err := checkpoint.Load(stateDir, "/dc/vm/my-vm", "2019.2.3")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(f.Completed("upload-artifacts")).To(BeFalse())
+		Expect(f.Path()).NotTo(BeAnExistingFile())
+	})
+
+	It("persists completed steps for the same vm and version", func() {
+		f, err := checkpoint.Load(stateDir, "/dc/vm/my-vm", "2019.2.3")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(f.MarkCompleted("create-provision-dir")).To(Succeed())
+		Expect(f.MarkCompleted("upload-artifacts")).To(Succeed())
+		Expect(f.Path()).To(BeAnExistingFile())
+
+		reloaded, err := checkpoint.Load(stateDir, "/dc/vm/my-vm", "2019.2.3")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded.Completed("create-provision-dir")).To(BeTrue())
+		Expect(reloaded.Completed("upload-artifacts")).To(BeTrue())
+		Expect(reloaded.Completed("enable-winrm")).To(BeFalse())
+	})
+
+	It("keeps progress for different vms and versions apart", func() {
+		f, err := checkpoint.Load(stateDir, "/dc/vm/my-vm", "2019.2.3")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.MarkCompleted("upload-artifacts")).To(Succeed())
+
+		otherVM, err := checkpoint.Load(stateDir, "/dc/vm/other-vm", "2019.2.3")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(otherVM.Completed("upload-artifacts")).To(BeFalse())
+
+		otherVersion, err := checkpoint.Load(stateDir, "/dc/vm/my-vm", "2019.3.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(otherVersion.Completed("upload-artifacts")).To(BeFalse())
+	})
+
+	It("removes the state file on reset", func() {
+		f, err := checkpoint.Load(stateDir, "/dc/vm/my-vm", "2019.2.3")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.MarkCompleted("upload-artifacts")).To(Succeed())
+
+		Expect(f.Reset()).To(Succeed())
+
+		Expect(f.Completed("upload-artifacts")).To(BeFalse())
+		Expect(f.Path()).NotTo(BeAnExistingFile())
+	})
+
+	It("does not leave temporary files behind", func() {
+		f, err := checkpoint.Load(stateDir, "/dc/vm/my-vm", "2019.2.3")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.MarkCompleted("upload-artifacts")).To(Succeed())
+
+		entries, err := os.ReadDir(filepath.Dir(f.Path()))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+
+	It("returns an error when the state file is corrupt", func() {
+		f, err := checkpoint.Load(stateDir, "/dc/vm/my-vm", "2019.2.3")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(f.Path(), []byte("not json"), 0600)).To(Succeed())
+
+		_, err = checkpoint.Load(stateDir, "/dc/vm/my-vm", "2019.2.3")
+		Expect(err).To(MatchError(ContainSubstring("could not parse construct state file")))
+	})
+})
@@ -1,13 +1,111 @@
 package config
 
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli/iaas_clients"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/remotemanager"
+)
+
+const (
+	DefaultRebootTimeout   = time.Hour
+	DefaultShutdownTimeout = 2 * time.Hour
+)
+
+// DefaultDiagnosticsPaths are the files collected from the VM when construct
+// fails: the log of the stemcell automation scripts, the sysprep logs and the
+// Windows Update logs.
+var DefaultDiagnosticsPaths = []string{
+	`C:\provision\log.log`,
+	`C:\Windows\Panther\setupact.log`,
+	`C:\Windows\Panther\setuperr.log`,
+	`C:\Windows\System32\Sysprep\Panther\setupact.log`,
+	`C:\Windows\System32\Sysprep\Panther\setuperr.log`,
+	`C:\Windows\Logs\CBS\CBS.log`,
+	`C:\Windows\SoftwareDistribution\ReportingEvents.log`,
+}
+
 type SourceConfig struct {
-	GuestVmIp       string
-	GuestVMUsername string
-	GuestVMPassword string
-	VCenterUrl      string
-	VCenterUsername string
-	VCenterPassword string
-	VmInventoryPath string
-	CaCertFile      string
-	SetupFlags      []string
+	GuestVmIp        string        `yaml:"vm_ip"`
+	GuestVMUsername  string        `yaml:"vm_username"`
+	GuestVMPassword  string        `yaml:"vm_password"`
+	VCenterUrl       string        `yaml:"vcenter_url"`
+	VCenterUsername  string        `yaml:"vcenter_username"`
+	VCenterPassword  string        `yaml:"vcenter_password"`
+	VmInventoryPath  string        `yaml:"vm_inventory_path"`
+	CaCertFile       string        `yaml:"vcenter_ca_certs"`
+	SetupFlags       []string      `yaml:"setup_args"`
+	SecretSetupFlags []string      `yaml:"secret_setup_args"`
+	Resume           bool          `yaml:"resume"`
+	ForceResume      bool          `yaml:"force_resume"`
+	RebootTimeout    time.Duration `yaml:"reboot_timeout"`
+	ShutdownTimeout  time.Duration `yaml:"shutdown_timeout"`
+	LogDir           string        `yaml:"log_dir"`
+	DiagnosticsPaths []string      `yaml:"diagnostics_paths"`
+
+	Transport     string `yaml:"transport"`
+	VCenterClient string `yaml:"vcenter_client"`
+
+	WinRMHTTPS              bool   `yaml:"winrm_https"`
+	WinRMPort               int    `yaml:"winrm_port"`
+	WinRMCACertFile         string `yaml:"winrm_ca_cert"`
+	WinRMInsecureSkipVerify bool   `yaml:"winrm_insecure_skip_verify"`
+	WinRMAuth               string `yaml:"winrm_auth"`
+	WinRMKerberosConfig     string `yaml:"winrm_kerberos_config"`
+	WinRMKerberosKeytab     string `yaml:"winrm_kerberos_keytab"`
+	WinRMKerberosCCache     string `yaml:"winrm_kerberos_ccache"`
+	WinRMKerberosSPN        string `yaml:"winrm_kerberos_spn"`
+}
+
+// UsesGuestOps reports whether commands run on the VM with guest operations
+// rather than WinRM, in which case the IP of the VM is not needed.
+func (c SourceConfig) UsesGuestOps() bool {
+	return c.Transport == remotemanager.TransportGuestOps
+}
+
+// DiagnosticsPathsOrDefault returns the files to collect from the VM, the
+// DefaultDiagnosticsPaths unless others are given.
+func (c SourceConfig) DiagnosticsPathsOrDefault() []string {
+	if len(c.DiagnosticsPaths) == 0 {
+		return DefaultDiagnosticsPaths
+	}
+
+	return c.DiagnosticsPaths
+}
+
+// Validate checks that the settings are consistent, beyond the required ones
+// being given.
+func (c SourceConfig) Validate() error {
+	if c.Transport != "" && !slices.Contains(remotemanager.Transports, c.Transport) {
+		return fmt.Errorf("transport must be one of %s, got %q", strings.Join(remotemanager.Transports, ", "), c.Transport)
+	}
+
+	if c.VCenterClient != "" && !slices.Contains(iaas_clients.VCenterClients, c.VCenterClient) {
+		return fmt.Errorf("vcenter client must be one of %s, got %q", strings.Join(iaas_clients.VCenterClients, ", "), c.VCenterClient)
+	}
+
+	if c.WinRMPort < 0 || c.WinRMPort > 65535 {
+		return fmt.Errorf("winrm port must be between 1 and 65535, got %d", c.WinRMPort)
+	}
+	if !c.WinRMHTTPS && (c.WinRMCACertFile != "" || c.WinRMInsecureSkipVerify) {
+		return fmt.Errorf("winrm-ca-cert and winrm-insecure-skip-verify need winrm-https")
+	}
+	if c.WinRMCACertFile != "" && c.WinRMInsecureSkipVerify {
+		return fmt.Errorf("winrm-ca-cert and winrm-insecure-skip-verify cannot be used together")
+	}
+
+	if c.WinRMAuth != "" && !slices.Contains(remotemanager.WinRMAuths, c.WinRMAuth) {
+		return fmt.Errorf("winrm auth must be one of %s, got %q", strings.Join(remotemanager.WinRMAuths, ", "), c.WinRMAuth)
+	}
+	if c.WinRMAuth != remotemanager.WinRMAuthKerberos && (c.WinRMKerberosConfig != "" || c.WinRMKerberosKeytab != "" || c.WinRMKerberosCCache != "" || c.WinRMKerberosSPN != "") {
+		return fmt.Errorf("winrm-kerberos-config, winrm-kerberos-keytab, winrm-kerberos-ccache and winrm-kerberos-spn need -winrm-auth %s", remotemanager.WinRMAuthKerberos)
+	}
+	if c.WinRMKerberosKeytab != "" && c.WinRMKerberosCCache != "" {
+		return fmt.Errorf("winrm-kerberos-keytab and winrm-kerberos-ccache cannot be used together")
+	}
+
+	return nil
 }
@@ -2,8 +2,57 @@ package config_test
 
 import (
 	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct/config"
 )
 
 var _ = Describe("SourceConfig", func() {
+	Describe("Validate", func() {
+		It("accepts the default WinRM settings", func() {
+			Expect(config.SourceConfig{}.Validate()).To(Succeed())
+		})
+
+		It("accepts HTTPS with a CA certificate and a port", func() {
+			c := config.SourceConfig{WinRMHTTPS: true, WinRMPort: 443, WinRMCACertFile: "ca.pem"}
+			Expect(c.Validate()).To(Succeed())
+		})
+
+		It("accepts the guest operations transport", func() {
+			c := config.SourceConfig{Transport: "guestops"}
+			Expect(c.Validate()).To(Succeed())
+			Expect(c.UsesGuestOps()).To(BeTrue())
+		})
+
+		It("accepts kerberos authentication with a keytab", func() {
+			c := config.SourceConfig{WinRMAuth: "kerberos", WinRMKerberosConfig: "krb5.conf", WinRMKerberosKeytab: "stembuild.keytab"}
+			Expect(c.Validate()).To(Succeed())
+		})
 
+		DescribeTable("rejects inconsistent WinRM settings",
+			func(c config.SourceConfig, message string) {
+				Expect(c.Validate()).To(MatchError(message))
+			},
+			Entry("an unknown transport", config.SourceConfig{Transport: "ssh"},
+				`transport must be one of winrm, guestops, got "ssh"`),
+			Entry("an unknown vCenter client", config.SourceConfig{VCenterClient: "pyvmomi"},
+				`vcenter client must be one of govc, govmomi, got "pyvmomi"`),
+			Entry("a port out of range", config.SourceConfig{WinRMPort: 65536},
+				"winrm port must be between 1 and 65535, got 65536"),
+			Entry("a CA certificate without HTTPS", config.SourceConfig{WinRMCACertFile: "ca.pem"},
+				"winrm-ca-cert and winrm-insecure-skip-verify need winrm-https"),
+			Entry("skipping verification without HTTPS", config.SourceConfig{WinRMInsecureSkipVerify: true},
+				"winrm-ca-cert and winrm-insecure-skip-verify need winrm-https"),
+			Entry("a CA certificate and skipping verification", config.SourceConfig{WinRMHTTPS: true, WinRMCACertFile: "ca.pem", WinRMInsecureSkipVerify: true},
+				"winrm-ca-cert and winrm-insecure-skip-verify cannot be used together"),
+			Entry("an unknown authentication", config.SourceConfig{WinRMAuth: "digest"},
+				`winrm auth must be one of basic, ntlm, kerberos, got "digest"`),
+			Entry("a keytab without kerberos", config.SourceConfig{WinRMAuth: "ntlm", WinRMKerberosKeytab: "stembuild.keytab"},
+				"winrm-kerberos-config, winrm-kerberos-keytab, winrm-kerberos-ccache and winrm-kerberos-spn need -winrm-auth kerberos"),
+			Entry("a service principal name without kerberos", config.SourceConfig{WinRMKerberosSPN: "HTTP/vm.example.com"},
+				"winrm-kerberos-config, winrm-kerberos-keytab, winrm-kerberos-ccache and winrm-kerberos-spn need -winrm-auth kerberos"),
+			Entry("a keytab and a credential cache", config.SourceConfig{WinRMAuth: "kerberos", WinRMKerberosKeytab: "stembuild.keytab", WinRMKerberosCCache: "krb5cc"},
+				"winrm-kerberos-keytab and winrm-kerberos-ccache cannot be used together"),
+		)
+	})
 })
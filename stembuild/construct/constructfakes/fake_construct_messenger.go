@@ -8,6 +8,20 @@ import (
 )
 
 type FakeConstructMessenger struct {
+	CollectDiagnosticsFailedStub        func(error)
+	collectDiagnosticsFailedMutex       sync.RWMutex
+	collectDiagnosticsFailedArgsForCall []struct {
+		arg1 error
+	}
+	CollectDiagnosticsStartedStub        func()
+	collectDiagnosticsStartedMutex       sync.RWMutex
+	collectDiagnosticsStartedArgsForCall []struct {
+	}
+	CollectDiagnosticsSucceededStub        func(string)
+	collectDiagnosticsSucceededMutex       sync.RWMutex
+	collectDiagnosticsSucceededArgsForCall []struct {
+		arg1 string
+	}
 	CreateProvisionDirStartedStub        func()
 	createProvisionDirStartedMutex       sync.RWMutex
 	createProvisionDirStartedArgsForCall []struct {
@@ -73,6 +87,28 @@ type FakeConstructMessenger struct {
 	shutdownCompletedMutex       sync.RWMutex
 	shutdownCompletedArgsForCall []struct {
 	}
+	StepFailedStub        func(string, error)
+	stepFailedMutex       sync.RWMutex
+	stepFailedArgsForCall []struct {
+		arg1 string
+		arg2 error
+	}
+	StepInterruptedStub        func(string)
+	stepInterruptedMutex       sync.RWMutex
+	stepInterruptedArgsForCall []struct {
+		arg1 string
+	}
+	StepLogFailedStub        func(string, error)
+	stepLogFailedMutex       sync.RWMutex
+	stepLogFailedArgsForCall []struct {
+		arg1 string
+		arg2 error
+	}
+	StepSkippedStub        func(string)
+	stepSkippedMutex       sync.RWMutex
+	stepSkippedArgsForCall []struct {
+		arg1 string
+	}
 	UploadArtifactsStartedStub        func()
 	uploadArtifactsStartedMutex       sync.RWMutex
 	uploadArtifactsStartedArgsForCall []struct {
@@ -110,6 +146,94 @@ type FakeConstructMessenger struct {
 	invocationsMutex sync.RWMutex
 }
 
+func (fake *FakeConstructMessenger) CollectDiagnosticsFailed(arg1 error) {
+	fake.collectDiagnosticsFailedMutex.Lock()
+	fake.collectDiagnosticsFailedArgsForCall = append(fake.collectDiagnosticsFailedArgsForCall, struct {
+		arg1 error
+	}{arg1})
+	stub := fake.CollectDiagnosticsFailedStub
+	fake.recordInvocation("CollectDiagnosticsFailed", []interface{}{arg1})
+	fake.collectDiagnosticsFailedMutex.Unlock()
+	if stub != nil {
+		fake.CollectDiagnosticsFailedStub(arg1)
+	}
+}
+
+func (fake *FakeConstructMessenger) CollectDiagnosticsFailedCallCount() int {
+	fake.collectDiagnosticsFailedMutex.RLock()
+	defer fake.collectDiagnosticsFailedMutex.RUnlock()
+	return len(fake.collectDiagnosticsFailedArgsForCall)
+}
+
+func (fake *FakeConstructMessenger) CollectDiagnosticsFailedCalls(stub func(error)) {
+	fake.collectDiagnosticsFailedMutex.Lock()
+	defer fake.collectDiagnosticsFailedMutex.Unlock()
+	fake.CollectDiagnosticsFailedStub = stub
+}
+
+func (fake *FakeConstructMessenger) CollectDiagnosticsFailedArgsForCall(i int) error {
+	fake.collectDiagnosticsFailedMutex.RLock()
+	defer fake.collectDiagnosticsFailedMutex.RUnlock()
+	argsForCall := fake.collectDiagnosticsFailedArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeConstructMessenger) CollectDiagnosticsStarted() {
+	fake.collectDiagnosticsStartedMutex.Lock()
+	fake.collectDiagnosticsStartedArgsForCall = append(fake.collectDiagnosticsStartedArgsForCall, struct {
+	}{})
+	stub := fake.CollectDiagnosticsStartedStub
+	fake.recordInvocation("CollectDiagnosticsStarted", []interface{}{})
+	fake.collectDiagnosticsStartedMutex.Unlock()
+	if stub != nil {
+		fake.CollectDiagnosticsStartedStub()
+	}
+}
+
+func (fake *FakeConstructMessenger) CollectDiagnosticsStartedCallCount() int {
+	fake.collectDiagnosticsStartedMutex.RLock()
+	defer fake.collectDiagnosticsStartedMutex.RUnlock()
+	return len(fake.collectDiagnosticsStartedArgsForCall)
+}
+
+func (fake *FakeConstructMessenger) CollectDiagnosticsStartedCalls(stub func()) {
+	fake.collectDiagnosticsStartedMutex.Lock()
+	defer fake.collectDiagnosticsStartedMutex.Unlock()
+	fake.CollectDiagnosticsStartedStub = stub
+}
+
+func (fake *FakeConstructMessenger) CollectDiagnosticsSucceeded(arg1 string) {
+	fake.collectDiagnosticsSucceededMutex.Lock()
+	fake.collectDiagnosticsSucceededArgsForCall = append(fake.collectDiagnosticsSucceededArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.CollectDiagnosticsSucceededStub
+	fake.recordInvocation("CollectDiagnosticsSucceeded", []interface{}{arg1})
+	fake.collectDiagnosticsSucceededMutex.Unlock()
+	if stub != nil {
+		fake.CollectDiagnosticsSucceededStub(arg1)
+	}
+}
+
+func (fake *FakeConstructMessenger) CollectDiagnosticsSucceededCallCount() int {
+	fake.collectDiagnosticsSucceededMutex.RLock()
+	defer fake.collectDiagnosticsSucceededMutex.RUnlock()
+	return len(fake.collectDiagnosticsSucceededArgsForCall)
+}
+
+func (fake *FakeConstructMessenger) CollectDiagnosticsSucceededCalls(stub func(string)) {
+	fake.collectDiagnosticsSucceededMutex.Lock()
+	defer fake.collectDiagnosticsSucceededMutex.Unlock()
+	fake.CollectDiagnosticsSucceededStub = stub
+}
+
+func (fake *FakeConstructMessenger) CollectDiagnosticsSucceededArgsForCall(i int) string {
+	fake.collectDiagnosticsSucceededMutex.RLock()
+	defer fake.collectDiagnosticsSucceededMutex.RUnlock()
+	argsForCall := fake.collectDiagnosticsSucceededArgsForCall[i]
+	return argsForCall.arg1
+}
+
 func (fake *FakeConstructMessenger) CreateProvisionDirStarted() {
 	fake.createProvisionDirStartedMutex.Lock()
 	fake.createProvisionDirStartedArgsForCall = append(fake.createProvisionDirStartedArgsForCall, struct {
@@ -502,6 +626,136 @@ func (fake *FakeConstructMessenger) ShutdownCompletedCalls(stub func()) {
 	fake.ShutdownCompletedStub = stub
 }
 
+func (fake *FakeConstructMessenger) StepFailed(arg1 string, arg2 error) {
+	fake.stepFailedMutex.Lock()
+	fake.stepFailedArgsForCall = append(fake.stepFailedArgsForCall, struct {
+		arg1 string
+		arg2 error
+	}{arg1, arg2})
+	stub := fake.StepFailedStub
+	fake.recordInvocation("StepFailed", []interface{}{arg1, arg2})
+	fake.stepFailedMutex.Unlock()
+	if stub != nil {
+		fake.StepFailedStub(arg1, arg2)
+	}
+}
+
+func (fake *FakeConstructMessenger) StepFailedCallCount() int {
+	fake.stepFailedMutex.RLock()
+	defer fake.stepFailedMutex.RUnlock()
+	return len(fake.stepFailedArgsForCall)
+}
+
+func (fake *FakeConstructMessenger) StepFailedCalls(stub func(string, error)) {
+	fake.stepFailedMutex.Lock()
+	defer fake.stepFailedMutex.Unlock()
+	fake.StepFailedStub = stub
+}
+
+func (fake *FakeConstructMessenger) StepFailedArgsForCall(i int) (string, error) {
+	fake.stepFailedMutex.RLock()
+	defer fake.stepFailedMutex.RUnlock()
+	argsForCall := fake.stepFailedArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeConstructMessenger) StepInterrupted(arg1 string) {
+	fake.stepInterruptedMutex.Lock()
+	fake.stepInterruptedArgsForCall = append(fake.stepInterruptedArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.StepInterruptedStub
+	fake.recordInvocation("StepInterrupted", []interface{}{arg1})
+	fake.stepInterruptedMutex.Unlock()
+	if stub != nil {
+		fake.StepInterruptedStub(arg1)
+	}
+}
+
+func (fake *FakeConstructMessenger) StepInterruptedCallCount() int {
+	fake.stepInterruptedMutex.RLock()
+	defer fake.stepInterruptedMutex.RUnlock()
+	return len(fake.stepInterruptedArgsForCall)
+}
+
+func (fake *FakeConstructMessenger) StepInterruptedCalls(stub func(string)) {
+	fake.stepInterruptedMutex.Lock()
+	defer fake.stepInterruptedMutex.Unlock()
+	fake.StepInterruptedStub = stub
+}
+
+func (fake *FakeConstructMessenger) StepInterruptedArgsForCall(i int) string {
+	fake.stepInterruptedMutex.RLock()
+	defer fake.stepInterruptedMutex.RUnlock()
+	argsForCall := fake.stepInterruptedArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeConstructMessenger) StepLogFailed(arg1 string, arg2 error) {
+	fake.stepLogFailedMutex.Lock()
+	fake.stepLogFailedArgsForCall = append(fake.stepLogFailedArgsForCall, struct {
+		arg1 string
+		arg2 error
+	}{arg1, arg2})
+	stub := fake.StepLogFailedStub
+	fake.recordInvocation("StepLogFailed", []interface{}{arg1, arg2})
+	fake.stepLogFailedMutex.Unlock()
+	if stub != nil {
+		fake.StepLogFailedStub(arg1, arg2)
+	}
+}
+
+func (fake *FakeConstructMessenger) StepLogFailedCallCount() int {
+	fake.stepLogFailedMutex.RLock()
+	defer fake.stepLogFailedMutex.RUnlock()
+	return len(fake.stepLogFailedArgsForCall)
+}
+
+func (fake *FakeConstructMessenger) StepLogFailedCalls(stub func(string, error)) {
+	fake.stepLogFailedMutex.Lock()
+	defer fake.stepLogFailedMutex.Unlock()
+	fake.StepLogFailedStub = stub
+}
+
+func (fake *FakeConstructMessenger) StepLogFailedArgsForCall(i int) (string, error) {
+	fake.stepLogFailedMutex.RLock()
+	defer fake.stepLogFailedMutex.RUnlock()
+	argsForCall := fake.stepLogFailedArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeConstructMessenger) StepSkipped(arg1 string) {
+	fake.stepSkippedMutex.Lock()
+	fake.stepSkippedArgsForCall = append(fake.stepSkippedArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.StepSkippedStub
+	fake.recordInvocation("StepSkipped", []interface{}{arg1})
+	fake.stepSkippedMutex.Unlock()
+	if stub != nil {
+		fake.StepSkippedStub(arg1)
+	}
+}
+
+func (fake *FakeConstructMessenger) StepSkippedCallCount() int {
+	fake.stepSkippedMutex.RLock()
+	defer fake.stepSkippedMutex.RUnlock()
+	return len(fake.stepSkippedArgsForCall)
+}
+
+func (fake *FakeConstructMessenger) StepSkippedCalls(stub func(string)) {
+	fake.stepSkippedMutex.Lock()
+	defer fake.stepSkippedMutex.Unlock()
+	fake.StepSkippedStub = stub
+}
+
+func (fake *FakeConstructMessenger) StepSkippedArgsForCall(i int) string {
+	fake.stepSkippedMutex.RLock()
+	defer fake.stepSkippedMutex.RUnlock()
+	argsForCall := fake.stepSkippedArgsForCall[i]
+	return argsForCall.arg1
+}
+
 func (fake *FakeConstructMessenger) UploadArtifactsStarted() {
 	fake.uploadArtifactsStartedMutex.Lock()
 	fake.uploadArtifactsStartedArgsForCall = append(fake.uploadArtifactsStartedArgsForCall, struct {
@@ -705,6 +959,12 @@ func (fake *FakeConstructMessenger) WinRMDisconnectedForRebootCalls(stub func())
 func (fake *FakeConstructMessenger) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
+	fake.collectDiagnosticsFailedMutex.RLock()
+	defer fake.collectDiagnosticsFailedMutex.RUnlock()
+	fake.collectDiagnosticsStartedMutex.RLock()
+	defer fake.collectDiagnosticsStartedMutex.RUnlock()
+	fake.collectDiagnosticsSucceededMutex.RLock()
+	defer fake.collectDiagnosticsSucceededMutex.RUnlock()
 	fake.createProvisionDirStartedMutex.RLock()
 	defer fake.createProvisionDirStartedMutex.RUnlock()
 	fake.createProvisionDirSucceededMutex.RLock()
@@ -737,6 +997,14 @@ func (fake *FakeConstructMessenger) Invocations() map[string][][]interface{} {
 	defer fake.rebootHasStartedMutex.RUnlock()
 	fake.shutdownCompletedMutex.RLock()
 	defer fake.shutdownCompletedMutex.RUnlock()
+	fake.stepFailedMutex.RLock()
+	defer fake.stepFailedMutex.RUnlock()
+	fake.stepInterruptedMutex.RLock()
+	defer fake.stepInterruptedMutex.RUnlock()
+	fake.stepLogFailedMutex.RLock()
+	defer fake.stepLogFailedMutex.RUnlock()
+	fake.stepSkippedMutex.RLock()
+	defer fake.stepSkippedMutex.RUnlock()
 	fake.uploadArtifactsStartedMutex.RLock()
 	defer fake.uploadArtifactsStartedMutex.RUnlock()
 	fake.uploadArtifactsSucceededMutex.RLock()
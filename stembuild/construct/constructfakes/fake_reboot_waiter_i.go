@@ -2,15 +2,17 @@
 package constructfakes
 
 import (
+	"context"
 	"sync"
 
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct"
 )
 
 type FakeRebootWaiterI struct {
-	WaitForRebootFinishedStub        func() error
+	WaitForRebootFinishedStub        func(context.Context) error
 	waitForRebootFinishedMutex       sync.RWMutex
 	waitForRebootFinishedArgsForCall []struct {
+		arg1 context.Context
 	}
 	waitForRebootFinishedReturns struct {
 		result1 error
@@ -22,17 +24,18 @@ type FakeRebootWaiterI struct {
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeRebootWaiterI) WaitForRebootFinished() error {
+func (fake *FakeRebootWaiterI) WaitForRebootFinished(arg1 context.Context) error {
 	fake.waitForRebootFinishedMutex.Lock()
 	ret, specificReturn := fake.waitForRebootFinishedReturnsOnCall[len(fake.waitForRebootFinishedArgsForCall)]
 	fake.waitForRebootFinishedArgsForCall = append(fake.waitForRebootFinishedArgsForCall, struct {
-	}{})
+		arg1 context.Context
+	}{arg1})
 	stub := fake.WaitForRebootFinishedStub
 	fakeReturns := fake.waitForRebootFinishedReturns
-	fake.recordInvocation("WaitForRebootFinished", []interface{}{})
+	fake.recordInvocation("WaitForRebootFinished", []interface{}{arg1})
 	fake.waitForRebootFinishedMutex.Unlock()
 	if stub != nil {
-		return stub()
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
@@ -46,12 +49,19 @@ func (fake *FakeRebootWaiterI) WaitForRebootFinishedCallCount() int {
 	return len(fake.waitForRebootFinishedArgsForCall)
 }
 
-func (fake *FakeRebootWaiterI) WaitForRebootFinishedCalls(stub func() error) {
+func (fake *FakeRebootWaiterI) WaitForRebootFinishedCalls(stub func(context.Context) error) {
 	fake.waitForRebootFinishedMutex.Lock()
 	defer fake.waitForRebootFinishedMutex.Unlock()
 	fake.WaitForRebootFinishedStub = stub
 }
 
+func (fake *FakeRebootWaiterI) WaitForRebootFinishedArgsForCall(i int) context.Context {
+	fake.waitForRebootFinishedMutex.RLock()
+	defer fake.waitForRebootFinishedMutex.RUnlock()
+	argsForCall := fake.waitForRebootFinishedArgsForCall[i]
+	return argsForCall.arg1
+}
+
 func (fake *FakeRebootWaiterI) WaitForRebootFinishedReturns(result1 error) {
 	fake.waitForRebootFinishedMutex.Lock()
 	defer fake.waitForRebootFinishedMutex.Unlock()
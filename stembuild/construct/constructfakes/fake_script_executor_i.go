@@ -6,13 +6,15 @@ import (
 	"time"
 
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/remotemanager"
 )
 
 type FakeScriptExecutorI struct {
-	ExecutePostRebootScriptStub        func(time.Duration) error
+	ExecutePostRebootScriptStub        func(time.Duration, remotemanager.CommandOutput) error
 	executePostRebootScriptMutex       sync.RWMutex
 	executePostRebootScriptArgsForCall []struct {
 		arg1 time.Duration
+		arg2 remotemanager.CommandOutput
 	}
 	executePostRebootScriptReturns struct {
 		result1 error
@@ -20,11 +22,12 @@ type FakeScriptExecutorI struct {
 	executePostRebootScriptReturnsOnCall map[int]struct {
 		result1 error
 	}
-	ExecuteSetupScriptStub        func(string, []string) error
+	ExecuteSetupScriptStub        func(string, []string, remotemanager.CommandOutput) error
 	executeSetupScriptMutex       sync.RWMutex
 	executeSetupScriptArgsForCall []struct {
 		arg1 string
 		arg2 []string
+		arg3 remotemanager.CommandOutput
 	}
 	executeSetupScriptReturns struct {
 		result1 error
@@ -36,18 +39,19 @@ type FakeScriptExecutorI struct {
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeScriptExecutorI) ExecutePostRebootScript(arg1 time.Duration) error {
+func (fake *FakeScriptExecutorI) ExecutePostRebootScript(arg1 time.Duration, arg2 remotemanager.CommandOutput) error {
 	fake.executePostRebootScriptMutex.Lock()
 	ret, specificReturn := fake.executePostRebootScriptReturnsOnCall[len(fake.executePostRebootScriptArgsForCall)]
 	fake.executePostRebootScriptArgsForCall = append(fake.executePostRebootScriptArgsForCall, struct {
 		arg1 time.Duration
-	}{arg1})
+		arg2 remotemanager.CommandOutput
+	}{arg1, arg2})
 	stub := fake.ExecutePostRebootScriptStub
 	fakeReturns := fake.executePostRebootScriptReturns
-	fake.recordInvocation("ExecutePostRebootScript", []interface{}{arg1})
+	fake.recordInvocation("ExecutePostRebootScript", []interface{}{arg1, arg2})
 	fake.executePostRebootScriptMutex.Unlock()
 	if stub != nil {
-		return stub(arg1)
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1
@@ -61,17 +65,17 @@ func (fake *FakeScriptExecutorI) ExecutePostRebootScriptCallCount() int {
 	return len(fake.executePostRebootScriptArgsForCall)
 }
 
-func (fake *FakeScriptExecutorI) ExecutePostRebootScriptCalls(stub func(time.Duration) error) {
+func (fake *FakeScriptExecutorI) ExecutePostRebootScriptCalls(stub func(time.Duration, remotemanager.CommandOutput) error) {
 	fake.executePostRebootScriptMutex.Lock()
 	defer fake.executePostRebootScriptMutex.Unlock()
 	fake.ExecutePostRebootScriptStub = stub
 }
 
-func (fake *FakeScriptExecutorI) ExecutePostRebootScriptArgsForCall(i int) time.Duration {
+func (fake *FakeScriptExecutorI) ExecutePostRebootScriptArgsForCall(i int) (time.Duration, remotemanager.CommandOutput) {
 	fake.executePostRebootScriptMutex.RLock()
 	defer fake.executePostRebootScriptMutex.RUnlock()
 	argsForCall := fake.executePostRebootScriptArgsForCall[i]
-	return argsForCall.arg1
+	return argsForCall.arg1, argsForCall.arg2
 }
 
 func (fake *FakeScriptExecutorI) ExecutePostRebootScriptReturns(result1 error) {
@@ -97,7 +101,7 @@ func (fake *FakeScriptExecutorI) ExecutePostRebootScriptReturnsOnCall(i int, res
 	}{result1}
 }
 
-func (fake *FakeScriptExecutorI) ExecuteSetupScript(arg1 string, arg2 []string) error {
+func (fake *FakeScriptExecutorI) ExecuteSetupScript(arg1 string, arg2 []string, arg3 remotemanager.CommandOutput) error {
 	var arg2Copy []string
 	if arg2 != nil {
 		arg2Copy = make([]string, len(arg2))
@@ -108,13 +112,14 @@ func (fake *FakeScriptExecutorI) ExecuteSetupScript(arg1 string, arg2 []string)
 	fake.executeSetupScriptArgsForCall = append(fake.executeSetupScriptArgsForCall, struct {
 		arg1 string
 		arg2 []string
-	}{arg1, arg2Copy})
+		arg3 remotemanager.CommandOutput
+	}{arg1, arg2Copy, arg3})
 	stub := fake.ExecuteSetupScriptStub
 	fakeReturns := fake.executeSetupScriptReturns
-	fake.recordInvocation("ExecuteSetupScript", []interface{}{arg1, arg2Copy})
+	fake.recordInvocation("ExecuteSetupScript", []interface{}{arg1, arg2Copy, arg3})
 	fake.executeSetupScriptMutex.Unlock()
 	if stub != nil {
-		return stub(arg1, arg2)
+		return stub(arg1, arg2, arg3)
 	}
 	if specificReturn {
 		return ret.result1
@@ -128,17 +133,17 @@ func (fake *FakeScriptExecutorI) ExecuteSetupScriptCallCount() int {
 	return len(fake.executeSetupScriptArgsForCall)
 }
 
-func (fake *FakeScriptExecutorI) ExecuteSetupScriptCalls(stub func(string, []string) error) {
+func (fake *FakeScriptExecutorI) ExecuteSetupScriptCalls(stub func(string, []string, remotemanager.CommandOutput) error) {
 	fake.executeSetupScriptMutex.Lock()
 	defer fake.executeSetupScriptMutex.Unlock()
 	fake.ExecuteSetupScriptStub = stub
 }
 
-func (fake *FakeScriptExecutorI) ExecuteSetupScriptArgsForCall(i int) (string, []string) {
+func (fake *FakeScriptExecutorI) ExecuteSetupScriptArgsForCall(i int) (string, []string, remotemanager.CommandOutput) {
 	fake.executeSetupScriptMutex.RLock()
 	defer fake.executeSetupScriptMutex.RUnlock()
 	argsForCall := fake.executeSetupScriptArgsForCall[i]
-	return argsForCall.arg1, argsForCall.arg2
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
 }
 
 func (fake *FakeScriptExecutorI) ExecuteSetupScriptReturns(result1 error) {
@@ -0,0 +1,250 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package constructfakes
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct"
+)
+
+type FakeStepCheckpointer struct {
+	CompletedStub        func(string) bool
+	completedMutex       sync.RWMutex
+	completedArgsForCall []struct {
+		arg1 string
+	}
+	completedReturns struct {
+		result1 bool
+	}
+	completedReturnsOnCall map[int]struct {
+		result1 bool
+	}
+	MarkCompletedStub        func(string) error
+	markCompletedMutex       sync.RWMutex
+	markCompletedArgsForCall []struct {
+		arg1 string
+	}
+	markCompletedReturns struct {
+		result1 error
+	}
+	markCompletedReturnsOnCall map[int]struct {
+		result1 error
+	}
+	ResetStub        func() error
+	resetMutex       sync.RWMutex
+	resetArgsForCall []struct {
+	}
+	resetReturns struct {
+		result1 error
+	}
+	resetReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeStepCheckpointer) Completed(arg1 string) bool {
+	fake.completedMutex.Lock()
+	ret, specificReturn := fake.completedReturnsOnCall[len(fake.completedArgsForCall)]
+	fake.completedArgsForCall = append(fake.completedArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.CompletedStub
+	fakeReturns := fake.completedReturns
+	fake.recordInvocation("Completed", []interface{}{arg1})
+	fake.completedMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeStepCheckpointer) CompletedCallCount() int {
+	fake.completedMutex.RLock()
+	defer fake.completedMutex.RUnlock()
+	return len(fake.completedArgsForCall)
+}
+
+func (fake *FakeStepCheckpointer) CompletedCalls(stub func(string) bool) {
+	fake.completedMutex.Lock()
+	defer fake.completedMutex.Unlock()
+	fake.CompletedStub = stub
+}
+
+func (fake *FakeStepCheckpointer) CompletedArgsForCall(i int) string {
+	fake.completedMutex.RLock()
+	defer fake.completedMutex.RUnlock()
+	argsForCall := fake.completedArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeStepCheckpointer) CompletedReturns(result1 bool) {
+	fake.completedMutex.Lock()
+	defer fake.completedMutex.Unlock()
+	fake.CompletedStub = nil
+	fake.completedReturns = struct {
+		result1 bool
+	}{result1}
+}
+
+func (fake *FakeStepCheckpointer) CompletedReturnsOnCall(i int, result1 bool) {
+	fake.completedMutex.Lock()
+	defer fake.completedMutex.Unlock()
+	fake.CompletedStub = nil
+	if fake.completedReturnsOnCall == nil {
+		fake.completedReturnsOnCall = make(map[int]struct {
+			result1 bool
+		})
+	}
+	fake.completedReturnsOnCall[i] = struct {
+		result1 bool
+	}{result1}
+}
+
+func (fake *FakeStepCheckpointer) MarkCompleted(arg1 string) error {
+	fake.markCompletedMutex.Lock()
+	ret, specificReturn := fake.markCompletedReturnsOnCall[len(fake.markCompletedArgsForCall)]
+	fake.markCompletedArgsForCall = append(fake.markCompletedArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.MarkCompletedStub
+	fakeReturns := fake.markCompletedReturns
+	fake.recordInvocation("MarkCompleted", []interface{}{arg1})
+	fake.markCompletedMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeStepCheckpointer) MarkCompletedCallCount() int {
+	fake.markCompletedMutex.RLock()
+	defer fake.markCompletedMutex.RUnlock()
+	return len(fake.markCompletedArgsForCall)
+}
+
+func (fake *FakeStepCheckpointer) MarkCompletedCalls(stub func(string) error) {
+	fake.markCompletedMutex.Lock()
+	defer fake.markCompletedMutex.Unlock()
+	fake.MarkCompletedStub = stub
+}
+
+func (fake *FakeStepCheckpointer) MarkCompletedArgsForCall(i int) string {
+	fake.markCompletedMutex.RLock()
+	defer fake.markCompletedMutex.RUnlock()
+	argsForCall := fake.markCompletedArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeStepCheckpointer) MarkCompletedReturns(result1 error) {
+	fake.markCompletedMutex.Lock()
+	defer fake.markCompletedMutex.Unlock()
+	fake.MarkCompletedStub = nil
+	fake.markCompletedReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeStepCheckpointer) MarkCompletedReturnsOnCall(i int, result1 error) {
+	fake.markCompletedMutex.Lock()
+	defer fake.markCompletedMutex.Unlock()
+	fake.MarkCompletedStub = nil
+	if fake.markCompletedReturnsOnCall == nil {
+		fake.markCompletedReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.markCompletedReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeStepCheckpointer) Reset() error {
+	fake.resetMutex.Lock()
+	ret, specificReturn := fake.resetReturnsOnCall[len(fake.resetArgsForCall)]
+	fake.resetArgsForCall = append(fake.resetArgsForCall, struct {
+	}{})
+	stub := fake.ResetStub
+	fakeReturns := fake.resetReturns
+	fake.recordInvocation("Reset", []interface{}{})
+	fake.resetMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeStepCheckpointer) ResetCallCount() int {
+	fake.resetMutex.RLock()
+	defer fake.resetMutex.RUnlock()
+	return len(fake.resetArgsForCall)
+}
+
+func (fake *FakeStepCheckpointer) ResetCalls(stub func() error) {
+	fake.resetMutex.Lock()
+	defer fake.resetMutex.Unlock()
+	fake.ResetStub = stub
+}
+
+func (fake *FakeStepCheckpointer) ResetReturns(result1 error) {
+	fake.resetMutex.Lock()
+	defer fake.resetMutex.Unlock()
+	fake.ResetStub = nil
+	fake.resetReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeStepCheckpointer) ResetReturnsOnCall(i int, result1 error) {
+	fake.resetMutex.Lock()
+	defer fake.resetMutex.Unlock()
+	fake.ResetStub = nil
+	if fake.resetReturnsOnCall == nil {
+		fake.resetReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.resetReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeStepCheckpointer) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.completedMutex.RLock()
+	defer fake.completedMutex.RUnlock()
+	fake.markCompletedMutex.RLock()
+	defer fake.markCompletedMutex.RUnlock()
+	fake.resetMutex.RLock()
+	defer fake.resetMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeStepCheckpointer) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ construct.StepCheckpointer = new(FakeStepCheckpointer)
@@ -0,0 +1,143 @@
+package construct
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/remotemanager"
+)
+
+// diagnosticsErrors is the file in a diagnostics zip that lists the files
+// which could not be downloaded, and why.
+const diagnosticsErrors = "errors.txt"
+
+// Diagnostics downloads files from the VM, such as the logs of the stemcell
+// automation scripts, into a zip to look at after construct fails. Each file
+// is downloaded with the first of the remote managers that can reach the VM
+// and succeeds, so that with WinRM gone the files can still come through
+// guest operations.
+type Diagnostics struct {
+	paths          []string
+	dir            string
+	remoteManagers []remotemanager.RemoteManager
+}
+
+func NewDiagnostics(paths []string, dir string, remoteManagers ...remotemanager.RemoteManager) *Diagnostics {
+	return &Diagnostics{paths: paths, dir: dir, remoteManagers: remoteManagers}
+}
+
+// Collect downloads the files into diagnostics-<time>.zip in the directory of
+// the Diagnostics and returns the path of the zip. Files that cannot be
+// downloaded are listed in errors.txt in the zip; Collect only fails if none
+// can be.
+func (d *Diagnostics) Collect() (string, error) {
+	var remoteManagers []remotemanager.RemoteManager
+	for _, remoteManager := range d.remoteManagers {
+		if remoteManager.CanReachVM() == nil {
+			remoteManagers = append(remoteManagers, remoteManager)
+		}
+	}
+	if len(remoteManagers) == 0 {
+		return "", fmt.Errorf("unable to collect diagnostics: the VM cannot be reached")
+	}
+
+	err := os.MkdirAll(d.dir, 0755)
+	if err != nil {
+		return "", fmt.Errorf("unable to create diagnostics directory: %w", err)
+	}
+	path := filepath.Join(d.dir, fmt.Sprintf("diagnostics-%s.zip", time.Now().Format(logTimeFormat)))
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to create diagnostics zip: %w", err)
+	}
+	defer file.Close() //nolint:errcheck
+
+	archive := zip.NewWriter(file)
+	var failures []string
+	for _, guestPath := range d.paths {
+		err := d.download(archive, guestPath, remoteManagers)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", guestPath, err))
+		}
+	}
+	if len(failures) > 0 && len(failures) == len(d.paths) {
+		os.Remove(path) //nolint:errcheck
+		return "", fmt.Errorf("unable to download any diagnostics from the VM:\n%s", strings.Join(failures, "\n"))
+	}
+
+	if len(failures) > 0 {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: diagnosticsErrors, Method: zip.Deflate, Modified: time.Now()})
+		if err == nil {
+			_, err = io.WriteString(w, strings.Join(failures, "\n")+"\n")
+		}
+		if err != nil {
+			return "", fmt.Errorf("unable to write diagnostics zip: %w", err)
+		}
+	}
+	err = archive.Close()
+	if err != nil {
+		return "", fmt.Errorf("unable to write diagnostics zip: %w", err)
+	}
+	err = file.Close()
+	if err != nil {
+		return "", fmt.Errorf("unable to write diagnostics zip: %w", err)
+	}
+
+	return path, nil
+}
+
+// download adds the file at guestPath to the archive, trying each remote
+// manager in turn. Each attempt goes to a temporary file first, so that a
+// download that fails halfway leaves nothing in the archive. The temporary
+// file is removed before the next attempt.
+func (d *Diagnostics) download(archive *zip.Writer, guestPath string, remoteManagers []remotemanager.RemoteManager) error {
+	var errs []error
+	for _, remoteManager := range remoteManagers {
+		tmp, err := os.CreateTemp("", "stembuild-diagnostics-*")
+		if err != nil {
+			return err
+		}
+
+		downloadErr := remoteManager.DownloadFile(guestPath, tmp)
+		if downloadErr == nil {
+			err = addToArchive(archive, guestPath, tmp)
+		}
+		tmp.Close()           //nolint:errcheck
+		os.Remove(tmp.Name()) //nolint:errcheck
+		if downloadErr == nil {
+			return err
+		}
+		errs = append(errs, downloadErr)
+	}
+
+	return errors.Join(errs...)
+}
+
+// addToArchive copies the downloaded file at guestPath from r into the
+// archive.
+func addToArchive(archive *zip.Writer, guestPath string, r io.ReadSeeker) error {
+	_, err := r.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	w, err := archive.CreateHeader(&zip.FileHeader{Name: diagnosticsName(guestPath), Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// diagnosticsName is the name in a diagnostics zip of the file at guestPath:
+// C:\provision\log.log becomes C/provision/log.log.
+func diagnosticsName(guestPath string) string {
+	name := strings.ReplaceAll(guestPath, `\`, "/")
+	name = strings.ReplaceAll(name, ":", "")
+	return strings.TrimLeft(name, "/")
+}
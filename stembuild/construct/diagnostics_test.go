@@ -0,0 +1,155 @@
+package construct_test
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/remotemanager/remotemanagerfakes"
+)
+
+var _ = Describe("Diagnostics", func() {
+	var (
+		winRM    *remotemanagerfakes.FakeRemoteManager
+		guestOps *remotemanagerfakes.FakeRemoteManager
+		dir      string
+		paths    []string
+		readZip  func(zipPath string) map[string]string
+	)
+
+	BeforeEach(func() {
+		winRM = &remotemanagerfakes.FakeRemoteManager{}
+		guestOps = &remotemanagerfakes.FakeRemoteManager{}
+		dir = filepath.Join(GinkgoT().TempDir(), "logs")
+		paths = []string{`C:\provision\log.log`, `C:\Windows\Panther\setupact.log`}
+
+		winRM.DownloadFileCalls(func(source string, w io.Writer) error {
+			_, err := io.WriteString(w, "winrm "+source)
+			return err
+		})
+		guestOps.DownloadFileCalls(func(source string, w io.Writer) error {
+			_, err := io.WriteString(w, "guestops "+source)
+			return err
+		})
+
+		readZip = func(zipPath string) map[string]string {
+			archive, err := zip.OpenReader(zipPath)
+			Expect(err).NotTo(HaveOccurred())
+			defer archive.Close() //nolint:errcheck
+
+			entries := map[string]string{}
+			for _, f := range archive.File {
+				r, err := f.Open()
+				Expect(err).NotTo(HaveOccurred())
+				contents, err := io.ReadAll(r)
+				Expect(err).NotTo(HaveOccurred())
+				entries[f.Name] = string(contents)
+			}
+			return entries
+		}
+	})
+
+	It("downloads each path into a timestamped zip in the directory", func() {
+		path, err := construct.NewDiagnostics(paths, dir, winRM, guestOps).Collect()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(filepath.Dir(path)).To(Equal(dir))
+		Expect(filepath.Base(path)).To(MatchRegexp(`^diagnostics-\d{8}T\d{6}\.zip$`))
+		Expect(readZip(path)).To(Equal(map[string]string{
+			"C/provision/log.log":            `winrm C:\provision\log.log`,
+			"C/Windows/Panther/setupact.log": `winrm C:\Windows\Panther\setupact.log`,
+		}))
+		Expect(guestOps.DownloadFileCallCount()).To(Equal(0))
+	})
+
+	It("falls back to the next remote manager when a download fails", func() {
+		winRM.DownloadFileCalls(func(source string, w io.Writer) error {
+			io.WriteString(w, "partial") //nolint:errcheck
+			return errors.New("connection reset")
+		})
+
+		path, err := construct.NewDiagnostics(paths, dir, winRM, guestOps).Collect()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(readZip(path)).To(Equal(map[string]string{
+			"C/provision/log.log":            `guestops C:\provision\log.log`,
+			"C/Windows/Panther/setupact.log": `guestops C:\Windows\Panther\setupact.log`,
+		}))
+	})
+
+	It("removes the temporary file of each attempt before the next", func() {
+		tmpDir := GinkgoT().TempDir()
+		GinkgoT().Setenv("TMPDIR", tmpDir)
+		winRM.DownloadFileReturns(errors.New("connection reset"))
+		var tmpFiles [][]string
+		guestOps.DownloadFileCalls(func(source string, w io.Writer) error {
+			files, err := filepath.Glob(filepath.Join(tmpDir, "*"))
+			Expect(err).NotTo(HaveOccurred())
+			tmpFiles = append(tmpFiles, files)
+			return nil
+		})
+
+		_, err := construct.NewDiagnostics(paths, dir, winRM, guestOps).Collect()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(tmpFiles).To(HaveLen(2))
+		Expect(tmpFiles[0]).To(HaveLen(1))
+		Expect(tmpFiles[1]).To(HaveLen(1))
+		Expect(filepath.Glob(filepath.Join(tmpDir, "*"))).To(BeEmpty())
+	})
+
+	It("skips remote managers that cannot reach the VM", func() {
+		winRM.CanReachVMReturns(errors.New("connection refused"))
+
+		path, err := construct.NewDiagnostics(paths, dir, winRM, guestOps).Collect()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(winRM.DownloadFileCallCount()).To(Equal(0))
+		Expect(readZip(path)).To(HaveKeyWithValue("C/provision/log.log", `guestops C:\provision\log.log`))
+	})
+
+	It("lists the files that cannot be downloaded in errors.txt", func() {
+		winRM.DownloadFileCalls(func(source string, w io.Writer) error {
+			if source == paths[1] {
+				return errors.New("file not found")
+			}
+			_, err := io.WriteString(w, "winrm "+source)
+			return err
+		})
+
+		path, err := construct.NewDiagnostics(paths, dir, winRM).Collect()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(readZip(path)).To(Equal(map[string]string{
+			"C/provision/log.log": `winrm C:\provision\log.log`,
+			"errors.txt":          `C:\Windows\Panther\setupact.log: file not found` + "\n",
+		}))
+	})
+
+	It("returns an error and leaves no zip when nothing can be downloaded", func() {
+		winRM.DownloadFileReturns(errors.New("file not found"))
+
+		_, err := construct.NewDiagnostics(paths, dir, winRM).Collect()
+		Expect(err).To(MatchError(ContainSubstring("unable to download any diagnostics from the VM")))
+		Expect(err).To(MatchError(ContainSubstring(`C:\provision\log.log: file not found`)))
+
+		entries, err := os.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+
+	It("returns an error when the VM cannot be reached", func() {
+		winRM.CanReachVMReturns(errors.New("connection refused"))
+		guestOps.CanReachVMReturns(errors.New("VMware Tools not running"))
+
+		_, err := construct.NewDiagnostics(paths, dir, winRM, guestOps).Collect()
+		Expect(err).To(MatchError("unable to collect diagnostics: the VM cannot be reached"))
+		Expect(dir).NotTo(BeAnExistingFile())
+	})
+})
@@ -2,55 +2,65 @@ package construct
 
 import (
 	"context"
+	"io"
 	"os"
+	"slices"
 
 	"github.com/pkg/errors"
 
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/commandparser"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct/archive"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct/checkpoint"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct/config"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/events"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli/iaas_clients"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli/iaas_clients/guest_manager"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/poller"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/remotemanager"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/version"
 )
 
 type Factory struct {
+	// Events replaces the English progress messages on stdout with JSON
+	// events when set.
+	Events *events.Emitter
 }
 
-func (f *Factory) New(config config.SourceConfig, vCenterManager commandparser.VCenterManager) (commandparser.VmConstruct, error) {
-	runner := &iaas_cli.GovcRunner{}
-	client := iaas_clients.NewVcenterClient(config.VCenterUsername, config.VCenterPassword, config.VCenterUrl, config.CaCertFile, runner)
+var (
+	_ IaasClient = (*iaas_clients.VcenterClient)(nil)
+	_ IaasClient = (*iaas_clients.GovmomiVcenterClient)(nil)
+)
 
-	messenger := NewMessenger(os.Stdout)
+func (f *Factory) New(ctx context.Context, config config.SourceConfig, vCenterManager commandparser.VCenterManager) (commandparser.VmConstruct, error) {
+	client := f.iaasClient(ctx, config, vCenterManager)
 
-	ctx := context.Background()
-	err := vCenterManager.Login(ctx)
-	if err != nil {
-		return nil, errors.Wrap(err, "Cannot complete login due to an incorrect vCenter user name or password")
+	var messenger ConstructMessenger = NewMessenger(os.Stdout)
+	if f.Events != nil {
+		messenger = NewJSONMessenger(f.Events)
 	}
 
-	vm, err := vCenterManager.FindVM(ctx, config.VmInventoryPath)
+	winRMOptions, err := newWinRMOptions(config)
 	if err != nil {
 		return nil, err
 	}
 
-	opsManager := vCenterManager.OperationsManager(ctx, vm)
-
-	guestManager, err := vCenterManager.GuestManager(ctx, opsManager, config.GuestVMUsername, config.GuestVMPassword)
+	guestManager, err := f.guestManager(ctx, config, vCenterManager)
 	if err != nil {
 		return nil, err
 	}
+	remoteManager := newRemoteManager(ctx, config, winRMOptions, guestManager)
 
-	winRMManager := &WinRMManager{
-		GuestManager: guestManager,
-		Unarchiver:   &archive.Zip{},
-	}
 	versionGetter := version.NewVersionGetter()
 
-	winRmClientFactory := remotemanager.NewWinRmClientFactory(config.GuestVmIp, config.GuestVMUsername, config.GuestVMPassword)
-	remoteManager := remotemanager.NewWinRM(config.GuestVmIp, config.GuestVMUsername, config.GuestVMPassword, winRmClientFactory)
+	// With guest operations WinRM is never used, so it is not enabled either.
+	var winRMEnabler WinRMEnabler
+	if !config.UsesGuestOps() {
+		winRMEnabler = &WinRMManager{
+			GuestManager: guestManager,
+			Unarchiver:   &archive.Zip{},
+		}
+	}
 
 	vmConnectionValidator := &WinRMConnectionValidator{
 		RemoteManager: remoteManager,
@@ -59,12 +69,18 @@ func (f *Factory) New(config config.SourceConfig, vCenterManager commandparser.V
 	rebootPoller := &poller.Poller{}
 
 	rebootChecker := remotemanager.NewRebootChecker(remoteManager)
+	rebootChecker.Output = remotemanager.CommandOutput{Stdout: f.stdout()}
 
-	rebootWaiter := remotemanager.NewRebootWaiter(rebootPoller, rebootChecker)
+	rebootWaiter := remotemanager.NewRebootWaiter(rebootPoller, rebootChecker, config.RebootTimeout)
 
 	scriptExecutor := NewScriptExecutor(remoteManager)
 
-	return NewVMConstruct(
+	checkpoints, err := checkpoint.Load(checkpoint.DefaultDir(), config.VmInventoryPath, versionGetter.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	vmConstruct := NewVMConstruct(
 		ctx,
 		remoteManager,
 		config.GuestVMUsername,
@@ -72,13 +88,129 @@ func (f *Factory) New(config config.SourceConfig, vCenterManager commandparser.V
 		config.VmInventoryPath,
 		client,
 		guestManager,
-		winRMManager,
+		winRMEnabler,
 		vmConnectionValidator,
 		messenger,
 		rebootPoller,
 		versionGetter,
 		rebootWaiter,
 		scriptExecutor,
-		config.SetupFlags,
-	), nil
+		checkpoints,
+		slices.Concat(config.SetupFlags, config.SecretSetupFlags),
+		config.Resume,
+	)
+	vmConstruct.ShutdownTimeout = config.ShutdownTimeout
+	vmConstruct.ForceResume = config.ForceResume
+	vmConstruct.LogDir = config.LogDir
+	vmConstruct.Stdout = f.stdout()
+	vmConstruct.Diagnostics = newDiagnostics(ctx, config, guestManager, remoteManager)
+
+	return vmConstruct, nil
+}
+
+// iaasClient returns the vCenter client of the config: govc, or govmomi
+// sharing the session of vCenterManager.
+func (f *Factory) iaasClient(ctx context.Context, config config.SourceConfig, vCenterManager commandparser.VCenterManager) IaasClient {
+	if config.VCenterClient == iaas_clients.VCenterClientGovmomi {
+		return iaas_clients.NewGovmomiVcenterClient(ctx, vCenterManager)
+	}
+
+	runner := &iaas_cli.GovcRunner{Context: ctx, Stdout: f.stdout()}
+	return iaas_clients.NewVcenterClient(config.VCenterUsername, config.VCenterPassword, config.VCenterUrl, config.CaCertFile, runner)
+}
+
+// stdout is where the output of commands run on the VM and of govc goes. It
+// is stderr when stdout holds the event stream.
+func (f *Factory) stdout() io.Writer {
+	if f.Events != nil {
+		return os.Stderr
+	}
+
+	return os.Stdout
+}
+
+// NewDiagnosticsCollector returns what collects files from the VM for
+// stembuild collect-logs, in the same way construct does when it fails.
+func (f *Factory) NewDiagnosticsCollector(ctx context.Context, config config.SourceConfig, vCenterManager commandparser.VCenterManager) (commandparser.DiagnosticsCollector, error) {
+	winRMOptions, err := newWinRMOptions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	guestManager, err := f.guestManager(ctx, config, vCenterManager)
+	if err != nil {
+		return nil, err
+	}
+	remoteManager := newRemoteManager(ctx, config, winRMOptions, guestManager)
+
+	return newDiagnostics(ctx, config, guestManager, remoteManager), nil
+}
+
+// guestManager logs in to vCenter and returns the guest operations of the VM.
+func (f *Factory) guestManager(ctx context.Context, config config.SourceConfig, vCenterManager commandparser.VCenterManager) (*guest_manager.GuestManager, error) {
+	err := vCenterManager.Login(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot complete login due to an incorrect vCenter user name or password")
+	}
+
+	vm, err := vCenterManager.FindVM(ctx, config.VmInventoryPath)
+	if err != nil {
+		return nil, err
+	}
+
+	opsManager := vCenterManager.OperationsManager(ctx, vm)
+
+	return vCenterManager.GuestManager(ctx, opsManager, config.GuestVMUsername, config.GuestVMPassword)
+}
+
+// newRemoteManager returns the RemoteManager of the transport of the config.
+func newRemoteManager(ctx context.Context, config config.SourceConfig, winRMOptions remotemanager.WinRMOptions, guestManager *guest_manager.GuestManager) remotemanager.RemoteManager {
+	if config.UsesGuestOps() {
+		return remotemanager.NewGuestOps(ctx, guestManager)
+	}
+
+	winRmClientFactory := remotemanager.NewWinRmClientFactory(ctx, config.GuestVmIp, config.GuestVMUsername, config.GuestVMPassword, winRMOptions)
+	return remotemanager.NewWinRM(ctx, config.GuestVmIp, config.GuestVMUsername, config.GuestVMPassword, winRMOptions, winRmClientFactory)
+}
+
+// newDiagnostics returns what collects the diagnostics paths of the config
+// into its log directory, or the working directory. Over WinRM it falls back
+// to guest operations, which work as long as VMware Tools runs on the VM.
+func newDiagnostics(ctx context.Context, config config.SourceConfig, guestManager *guest_manager.GuestManager, remoteManager remotemanager.RemoteManager) *Diagnostics {
+	dir := config.LogDir
+	if dir == "" {
+		dir = "."
+	}
+
+	remoteManagers := []remotemanager.RemoteManager{remoteManager}
+	if !config.UsesGuestOps() {
+		remoteManagers = append(remoteManagers, remotemanager.NewGuestOps(ctx, guestManager))
+	}
+	return NewDiagnostics(config.DiagnosticsPathsOrDefault(), dir, remoteManagers...)
+}
+
+// newWinRMOptions returns how to connect to WinRM on the VM, reading the CA
+// certificate if one is given.
+func newWinRMOptions(config config.SourceConfig) (remotemanager.WinRMOptions, error) {
+	options := remotemanager.WinRMOptions{
+		HTTPS:              config.WinRMHTTPS,
+		Port:               config.WinRMPort,
+		InsecureSkipVerify: config.WinRMInsecureSkipVerify,
+		Auth:               config.WinRMAuth,
+		Kerberos: remotemanager.KerberosOptions{
+			Config: config.WinRMKerberosConfig,
+			Keytab: config.WinRMKerberosKeytab,
+			CCache: config.WinRMKerberosCCache,
+			SPN:    config.WinRMKerberosSPN,
+		},
+	}
+	if config.WinRMCACertFile != "" {
+		caCert, err := os.ReadFile(config.WinRMCACertFile)
+		if err != nil {
+			return remotemanager.WinRMOptions{}, errors.Wrapf(err, "unable to read WinRM CA certificate %s", config.WinRMCACertFile)
+		}
+		options.CACert = caCert
+	}
+
+	return options, nil
 }
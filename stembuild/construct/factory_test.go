@@ -1,6 +1,8 @@
 package construct_test
 
 import (
+	"context"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/pkg/errors"
@@ -8,6 +10,7 @@ import (
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/commandparser/commandparserfakes"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct/config"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli/iaas_clients"
 )
 
 var _ = Describe("Factory", func() {
@@ -33,11 +36,52 @@ var _ = Describe("Factory", func() {
 				VmInventoryPath: "some-vm-inventory-path",
 			}
 
-			vmPreparer, err := factory.New(sourceConfig, fakeVCenterManager)
+			vmPreparer, err := factory.New(context.Background(), sourceConfig, fakeVCenterManager)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(vmPreparer).To(BeAssignableToTypeOf(&construct.VMConstruct{}))
 		})
 
+		It("should return a New that needs no VM IP with guest operations", func() {
+			fakeVCenterManager := &commandparserfakes.FakeVCenterManager{}
+
+			sourceConfig := config.SourceConfig{
+				GuestVMUsername: "vmUser",
+				GuestVMPassword: "vmPwd",
+				VCenterUrl:      "vCenterUrl",
+				VCenterUsername: "vCenterUser",
+				VCenterPassword: "vCenterPwd",
+				VmInventoryPath: "some-vm-inventory-path",
+				Transport:       "guestops",
+			}
+
+			vmPreparer, err := factory.New(context.Background(), sourceConfig, fakeVCenterManager)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(vmPreparer).To(BeAssignableToTypeOf(&construct.VMConstruct{}))
+		})
+
+		It("should return a New that talks to vCenter with govc by default, or with govmomi", func() {
+			fakeVCenterManager := &commandparserfakes.FakeVCenterManager{}
+
+			sourceConfig := config.SourceConfig{
+				GuestVmIp:       "vmIP",
+				GuestVMUsername: "vmUser",
+				GuestVMPassword: "vmPwd",
+				VCenterUrl:      "vCenterUrl",
+				VCenterUsername: "vCenterUser",
+				VCenterPassword: "vCenterPwd",
+				VmInventoryPath: "some-vm-inventory-path",
+			}
+
+			vmPreparer, err := factory.New(context.Background(), sourceConfig, fakeVCenterManager)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(vmPreparer.(*construct.VMConstruct).Client).To(BeAssignableToTypeOf(&iaas_clients.VcenterClient{}))
+
+			sourceConfig.VCenterClient = iaas_clients.VCenterClientGovmomi
+			vmPreparer, err = factory.New(context.Background(), sourceConfig, fakeVCenterManager)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(vmPreparer.(*construct.VMConstruct).Client).To(BeAssignableToTypeOf(&iaas_clients.GovmomiVcenterClient{}))
+		})
+
 		It("should return a login error when login incorrect to VCenter", func() {
 			// setup
 			fakeVCenterManager := &commandparserfakes.FakeVCenterManager{}
@@ -45,12 +89,59 @@ var _ = Describe("Factory", func() {
 			fakeVCenterManager.LoginReturns(loginFailure)
 			sourceConfig := config.SourceConfig{}
 
-			vmPreparer, err := factory.New(sourceConfig, fakeVCenterManager)
+			vmPreparer, err := factory.New(context.Background(), sourceConfig, fakeVCenterManager)
 
 			Expect(vmPreparer).To(BeNil())
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("Cannot complete login due to an incorrect vCenter user name or password"))
 			Expect(err.Error()).To(ContainSubstring(loginFailure.Error()))
 		})
+
+		It("should return an error when the WinRM CA certificate cannot be read", func() {
+			fakeVCenterManager := &commandparserfakes.FakeVCenterManager{}
+			sourceConfig := config.SourceConfig{WinRMHTTPS: true, WinRMCACertFile: "/does/not/exist.pem"}
+
+			vmPreparer, err := factory.New(context.Background(), sourceConfig, fakeVCenterManager)
+
+			Expect(vmPreparer).To(BeNil())
+			Expect(err).To(MatchError(ContainSubstring("unable to read WinRM CA certificate /does/not/exist.pem")))
+			Expect(fakeVCenterManager.LoginCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("NewDiagnosticsCollector", func() {
+		var (
+			factory *construct.Factory
+		)
+
+		BeforeEach(func() {
+			factory = &construct.Factory{}
+		})
+
+		It("should return Diagnostics", func() {
+			fakeVCenterManager := &commandparserfakes.FakeVCenterManager{}
+			sourceConfig := config.SourceConfig{
+				GuestVmIp:       "vmIP",
+				GuestVMUsername: "vmUser",
+				GuestVMPassword: "vmPwd",
+				VmInventoryPath: "some-vm-inventory-path",
+			}
+
+			collector, err := factory.NewDiagnosticsCollector(context.Background(), sourceConfig, fakeVCenterManager)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(collector).To(BeAssignableToTypeOf(&construct.Diagnostics{}))
+			_, inventoryPath := fakeVCenterManager.FindVMArgsForCall(0)
+			Expect(inventoryPath).To(Equal("some-vm-inventory-path"))
+		})
+
+		It("should return a login error when login incorrect to VCenter", func() {
+			fakeVCenterManager := &commandparserfakes.FakeVCenterManager{}
+			fakeVCenterManager.LoginReturns(errors.New("could not log in"))
+
+			collector, err := factory.NewDiagnosticsCollector(context.Background(), config.SourceConfig{}, fakeVCenterManager)
+
+			Expect(collector).To(BeNil())
+			Expect(err).To(MatchError(ContainSubstring("Cannot complete login due to an incorrect vCenter user name or password")))
+		})
 	})
 })
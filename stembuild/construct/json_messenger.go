@@ -0,0 +1,148 @@
+package construct
+
+import (
+	"errors"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/events"
+)
+
+// JSONMessenger reports construct progress as `-output-format json` events,
+// one per step phase, instead of the English lines written by Messenger.
+type JSONMessenger struct {
+	events   *events.Emitter
+	artifact string
+}
+
+func NewJSONMessenger(emitter *events.Emitter) *JSONMessenger {
+	return &JSONMessenger{events: emitter}
+}
+
+const (
+	stepUploadFile         = "upload-file"
+	stepCollectDiagnostics = "collect-diagnostics"
+)
+
+func (m *JSONMessenger) EnableWinRMStarted() {
+	m.events.Started(StepEnableWinRM, "")
+}
+
+func (m *JSONMessenger) EnableWinRMSucceeded() {
+	m.events.Succeeded(StepEnableWinRM, "")
+}
+
+func (m *JSONMessenger) ValidateVMConnectionStarted() {
+	m.events.Started(StepValidateVMConnection, "")
+}
+
+func (m *JSONMessenger) ValidateVMConnectionSucceeded() {
+	m.events.Succeeded(StepValidateVMConnection, "")
+}
+
+func (m *JSONMessenger) CreateProvisionDirStarted() {
+	m.events.Started(StepCreateProvisionDir, "")
+}
+
+func (m *JSONMessenger) CreateProvisionDirSucceeded() {
+	m.events.Succeeded(StepCreateProvisionDir, "")
+}
+
+func (m *JSONMessenger) UploadArtifactsStarted() {
+	m.events.Started(StepUploadArtifacts, "")
+}
+
+func (m *JSONMessenger) UploadArtifactsSucceeded() {
+	m.events.Succeeded(StepUploadArtifacts, "")
+}
+
+func (m *JSONMessenger) ExtractArtifactsStarted() {
+	m.events.Started(StepExtractArtifacts, "")
+}
+
+func (m *JSONMessenger) ExtractArtifactsSucceeded() {
+	m.events.Succeeded(StepExtractArtifacts, "")
+}
+
+func (m *JSONMessenger) ExecuteSetupScriptStarted() {
+	m.events.Started(StepExecuteSetupScript, "")
+}
+
+func (m *JSONMessenger) ExecuteSetupScriptSucceeded() {
+	m.events.Succeeded(StepExecuteSetupScript, "")
+}
+
+func (m *JSONMessenger) RebootHasStarted() {
+	m.events.Started(StepWaitForReboot, "")
+}
+
+func (m *JSONMessenger) RebootHasFinished() {
+	m.events.Succeeded(StepWaitForReboot, "")
+}
+
+func (m *JSONMessenger) ExecutePostRebootScriptStarted() {
+	m.events.Started(StepExecutePostRebootScript, "")
+}
+
+func (m *JSONMessenger) ExecutePostRebootScriptSucceeded() {
+	m.events.Succeeded(StepExecutePostRebootScript, "")
+}
+
+func (m *JSONMessenger) ExecutePostRebootWarning(warning string) {
+	m.events.Warning(StepExecutePostRebootScript, warning)
+}
+
+func (m *JSONMessenger) UploadFileStarted(artifact string) {
+	m.artifact = artifact
+	m.events.Started(stepUploadFile, artifact)
+}
+
+func (m *JSONMessenger) UploadFileSucceeded() {
+	m.events.Succeeded(stepUploadFile, m.artifact)
+}
+
+func (m *JSONMessenger) LogOutUsersStarted() {
+	m.events.Started(StepLogOutUsers, "")
+}
+
+func (m *JSONMessenger) LogOutUsersSucceeded() {
+	m.events.Succeeded(StepLogOutUsers, "")
+}
+
+// WaitingForShutdown is called on every poll of the VM's power state; only
+// the first call starts the step.
+func (m *JSONMessenger) WaitingForShutdown() {
+	m.events.Started(StepWaitForShutdown, "")
+}
+
+func (m *JSONMessenger) ShutdownCompleted() {
+	m.events.Succeeded(StepWaitForShutdown, "")
+}
+
+func (m *JSONMessenger) WinRMDisconnectedForReboot() {}
+
+func (m *JSONMessenger) StepSkipped(step string) {
+	m.events.Skipped(step, "completed by a previous run")
+}
+
+func (m *JSONMessenger) StepFailed(step string, err error) {
+	m.events.Failed(step, err)
+}
+
+func (m *JSONMessenger) StepLogFailed(step string, err error) {
+	m.events.Warning(step, "unable to save output: "+err.Error())
+}
+
+func (m *JSONMessenger) StepInterrupted(step string) {
+	m.events.Failed(step, errors.New("interrupted"))
+}
+
+func (m *JSONMessenger) CollectDiagnosticsStarted() {
+	m.events.Started(stepCollectDiagnostics, "")
+}
+
+func (m *JSONMessenger) CollectDiagnosticsSucceeded(path string) {
+	m.events.Succeeded(stepCollectDiagnostics, path)
+}
+
+func (m *JSONMessenger) CollectDiagnosticsFailed(err error) {
+	m.events.Failed(stepCollectDiagnostics, err)
+}
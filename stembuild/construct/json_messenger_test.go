@@ -0,0 +1,131 @@
+package construct_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/events"
+)
+
+var _ = Describe("JSONMessenger", func() {
+	var (
+		buf *bytes.Buffer
+		m   *construct.JSONMessenger
+	)
+
+	readEvents := func() []events.Event {
+		var result []events.Event
+		scanner := bufio.NewScanner(buf)
+		for scanner.Scan() {
+			var event events.Event
+			Expect(json.Unmarshal(scanner.Bytes(), &event)).To(Succeed())
+			result = append(result, event)
+		}
+		return result
+	}
+
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+		m = construct.NewJSONMessenger(events.NewEmitter(buf))
+	})
+
+	It("emits started and succeeded events named after the construct step", func() {
+		m.EnableWinRMStarted()
+		m.EnableWinRMSucceeded()
+
+		result := readEvents()
+		Expect(result).To(HaveLen(2))
+		Expect(result[0].Step).To(Equal(construct.StepEnableWinRM))
+		Expect(result[0].Phase).To(Equal(events.PhaseStarted))
+		Expect(result[1].Step).To(Equal(construct.StepEnableWinRM))
+		Expect(result[1].Phase).To(Equal(events.PhaseSucceeded))
+		Expect(result[1].Duration).NotTo(BeNil())
+	})
+
+	It("names the uploaded file in both upload events", func() {
+		m.UploadFileStarted("LGPO")
+		m.UploadFileSucceeded()
+
+		result := readEvents()
+		Expect(result).To(HaveLen(2))
+		Expect(result[0].Message).To(Equal("LGPO"))
+		Expect(result[1].Message).To(Equal("LGPO"))
+	})
+
+	It("starts waiting for shutdown only once however often it polls", func() {
+		m.WaitingForShutdown()
+		m.WaitingForShutdown()
+		m.WaitingForShutdown()
+		m.ShutdownCompleted()
+
+		result := readEvents()
+		Expect(result).To(HaveLen(2))
+		Expect(result[0].Phase).To(Equal(events.PhaseStarted))
+		Expect(result[1].Phase).To(Equal(events.PhaseSucceeded))
+		Expect(result[1].Step).To(Equal(construct.StepWaitForShutdown))
+	})
+
+	It("emits warnings, skipped and failed steps", func() {
+		m.ExecutePostRebootWarning("winrm connection event")
+		m.StepSkipped(construct.StepUploadArtifacts)
+		m.StepFailed(construct.StepWaitForReboot, errors.New("reboot failed"))
+
+		result := readEvents()
+		Expect(result).To(HaveLen(3))
+		Expect(result[0].Step).To(Equal(construct.StepExecutePostRebootScript))
+		Expect(result[0].Phase).To(Equal(events.PhaseWarning))
+		Expect(result[0].Message).To(Equal("winrm connection event"))
+		Expect(result[1].Step).To(Equal(construct.StepUploadArtifacts))
+		Expect(result[1].Phase).To(Equal(events.PhaseSkipped))
+		Expect(result[2].Step).To(Equal(construct.StepWaitForReboot))
+		Expect(result[2].Phase).To(Equal(events.PhaseFailed))
+		Expect(result[2].Error).To(Equal("reboot failed"))
+	})
+
+	It("emits a warning when the output of a step cannot be saved", func() {
+		m.StepLogFailed(construct.StepExecuteSetupScript, errors.New("disk full"))
+
+		result := readEvents()
+		Expect(result).To(HaveLen(1))
+		Expect(result[0].Step).To(Equal(construct.StepExecuteSetupScript))
+		Expect(result[0].Phase).To(Equal(events.PhaseWarning))
+		Expect(result[0].Message).To(Equal("unable to save output: disk full"))
+	})
+
+	It("emits an interrupted step as failed", func() {
+		m.StepInterrupted(construct.StepWaitForReboot)
+
+		result := readEvents()
+		Expect(result).To(HaveLen(1))
+		Expect(result[0].Step).To(Equal(construct.StepWaitForReboot))
+		Expect(result[0].Phase).To(Equal(events.PhaseFailed))
+		Expect(result[0].Error).To(Equal("interrupted"))
+	})
+
+	It("emits the collection of diagnostics with the path of the zip", func() {
+		m.CollectDiagnosticsStarted()
+		m.CollectDiagnosticsSucceeded("diagnostics-20240101T000000.zip")
+		m.CollectDiagnosticsFailed(errors.New("the VM cannot be reached"))
+
+		result := readEvents()
+		Expect(result).To(HaveLen(3))
+		Expect(result[0].Step).To(Equal("collect-diagnostics"))
+		Expect(result[0].Phase).To(Equal(events.PhaseStarted))
+		Expect(result[1].Phase).To(Equal(events.PhaseSucceeded))
+		Expect(result[1].Message).To(Equal("diagnostics-20240101T000000.zip"))
+		Expect(result[2].Phase).To(Equal(events.PhaseFailed))
+		Expect(result[2].Error).To(Equal("the VM cannot be reached"))
+	})
+
+	It("does not emit an event when WinRM disconnects for the reboot", func() {
+		m.WinRMDisconnectedForReboot()
+
+		Expect(buf.Len()).To(BeZero())
+	})
+})
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io"
 	"time"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
 )
 
 type Messenger struct {
@@ -11,7 +13,7 @@ type Messenger struct {
 }
 
 func NewMessenger(out io.Writer) *Messenger {
-	return &Messenger{out}
+	return &Messenger{colorlogger.NewRedactingWriter(out)}
 }
 
 func (m *Messenger) EnableWinRMStarted() {
@@ -133,3 +135,30 @@ func (m *Messenger) WinRMDisconnectedForReboot() {
 	m.out.Write([]byte("\nWinRM has been disconnected so the VM can reboot.\n")) //nolint:errcheck
 
 }
+
+func (m *Messenger) StepSkipped(step string) {
+	m.out.Write([]byte(fmt.Sprintf("\nSkipping %s, it was completed by a previous run.\n", step))) //nolint:errcheck,staticcheck
+}
+
+// StepFailed writes nothing; the construct command reports the error.
+func (m *Messenger) StepFailed(step string, err error) {}
+
+func (m *Messenger) StepLogFailed(step string, err error) {
+	m.out.Write([]byte(fmt.Sprintf("\nWarning: unable to save the output of %s: %s\n", step, err))) //nolint:errcheck,staticcheck
+}
+
+func (m *Messenger) StepInterrupted(step string) {
+	m.out.Write([]byte(fmt.Sprintf("\nInterrupted during %s. The VM may be left in an unknown state; run construct again with -resume to carry on from this step.\n", step))) //nolint:errcheck,staticcheck
+}
+
+func (m *Messenger) CollectDiagnosticsStarted() {
+	m.out.Write([]byte("\nCollecting diagnostics from the VM...")) //nolint:errcheck
+}
+
+func (m *Messenger) CollectDiagnosticsSucceeded(path string) {
+	m.out.Write([]byte(fmt.Sprintf("saved to %s\n", path))) //nolint:errcheck,staticcheck
+}
+
+func (m *Messenger) CollectDiagnosticsFailed(err error) {
+	m.out.Write([]byte(fmt.Sprintf("failed: %s\n", err))) //nolint:errcheck,staticcheck
+}
@@ -1,8 +1,10 @@
 package construct_test
 
 import (
+	"errors"
 	"fmt"
 
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -213,6 +215,16 @@ var _ = Describe("Messenger", func() {
 			Expect(buf).To(Say(expectedMessage))
 		})
 
+		It("redacts registered secrets from the warning message", func() {
+			colorlogger.RegisterSecret("messenger-secret")
+			m := construct.NewMessenger(buf)
+
+			m.ExecutePostRebootWarning("winrm rejected messenger-secret")
+
+			Expect(buf).To(Say("winrm rejected \\[REDACTED\\]\n"))
+			Expect(string(buf.Contents())).NotTo(ContainSubstring("messenger-secret"))
+		})
+
 	})
 
 	Describe("Upload file messages", func() {
@@ -285,6 +297,38 @@ var _ = Describe("Messenger", func() {
 			Expect(buf).To(Say("VM has now been shutdown. Run `stembuild package` to finish building the stemcell.\n"))
 		})
 
+		It("writes the step skipped message to the writer", func() {
+			m := construct.NewMessenger(buf)
+			m.StepSkipped("upload-artifacts")
+
+			Expect(buf).To(Say("Skipping upload-artifacts, it was completed by a previous run.\n"))
+		})
+
+		It("writes the warning when the output of a step cannot be saved", func() {
+			m := construct.NewMessenger(buf)
+			m.StepLogFailed("execute-setup-script", errors.New("disk full"))
+
+			Expect(buf).To(Say("\nWarning: unable to save the output of execute-setup-script: disk full\n"))
+		})
+
+		It("writes the step interrupted message to the writer", func() {
+			m := construct.NewMessenger(buf)
+			m.StepInterrupted("wait-for-reboot")
+
+			Expect(buf).To(Say("Interrupted during wait-for-reboot. The VM may be left in an unknown state; run construct again with -resume to carry on from this step.\n"))
+		})
+
+		It("writes the diagnostics messages to the writer", func() {
+			m := construct.NewMessenger(buf)
+			m.CollectDiagnosticsStarted()
+			m.CollectDiagnosticsSucceeded("diagnostics-20240101T000000.zip")
+			m.CollectDiagnosticsStarted()
+			m.CollectDiagnosticsFailed(errors.New("the VM cannot be reached"))
+
+			Expect(buf).To(Say("\nCollecting diagnostics from the VM...saved to diagnostics-20240101T000000.zip\n"))
+			Expect(buf).To(Say("\nCollecting diagnostics from the VM...failed: the VM cannot be reached\n"))
+		})
+
 	})
 
 })
@@ -0,0 +1,123 @@
+package construct
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/remotemanager"
+)
+
+// logTimeFormat names the log files of a step after the time it started,
+// without the colons Windows does not allow in file names.
+const logTimeFormat = "20060102T150405"
+
+// stepOutput is where the commands a step runs on the VM write their output:
+// the console, with each line prefixed with the name of the step, and, with a
+// log directory, a stdout and a stderr file of the step.
+type stepOutput struct {
+	remotemanager.CommandOutput
+	logs []*logFile
+}
+
+func (c *VMConstruct) newStepOutput(step string) *stepOutput {
+	prefix := fmt.Sprintf("[%s] ", step)
+	output := &stepOutput{CommandOutput: remotemanager.CommandOutput{
+		Stdout: &prefixWriter{w: c.Stdout, prefix: []byte(prefix)},
+		Stderr: &prefixWriter{w: c.Stderr, prefix: []byte(prefix)},
+	}}
+	if c.LogDir == "" {
+		return output
+	}
+
+	name := filepath.Join(c.LogDir, fmt.Sprintf("%s-%s", time.Now().Format(logTimeFormat), step))
+	stdoutLog, stderrLog := &logFile{path: name + ".stdout.log"}, &logFile{path: name + ".stderr.log"}
+	output.logs = []*logFile{stdoutLog, stderrLog}
+	output.Stdout = io.MultiWriter(output.Stdout, stdoutLog)
+	output.Stderr = io.MultiWriter(output.Stderr, stderrLog)
+
+	return output
+}
+
+// Close closes the log files of the step, returning any error writing them.
+func (o *stepOutput) Close() error {
+	var errs []error
+	for _, log := range o.logs {
+		errs = append(errs, log.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// prefixWriter writes each line to w with prefix in front of it.
+type prefixWriter struct {
+	w       io.Writer
+	prefix  []byte
+	midLine bool
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	var out []byte
+	for rest := b; len(rest) > 0; {
+		if !p.midLine {
+			out = append(out, p.prefix...)
+		}
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			out = append(out, rest...)
+			p.midLine = true
+			break
+		}
+		out = append(out, rest[:i+1]...)
+		rest = rest[i+1:]
+		p.midLine = false
+	}
+
+	_, err := p.w.Write(out)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// logFile is a log that is only created once something is written to it, so
+// that steps which run no commands leave no empty files. Writes never fail,
+// as a command whose output cannot be copied would never finish; the first
+// error is returned by Close instead.
+type logFile struct {
+	path string
+	file *os.File
+	err  error
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+	if l.file == nil && l.err == nil {
+		l.err = os.MkdirAll(filepath.Dir(l.path), 0755)
+		if l.err == nil {
+			l.file, l.err = os.Create(l.path)
+		}
+	}
+	if l.err == nil {
+		_, l.err = l.file.Write(p)
+	}
+
+	return len(p), nil
+}
+
+func (l *logFile) Close() error {
+	if l.file != nil {
+		err := l.file.Close()
+		if l.err == nil {
+			l.err = err
+		}
+	}
+	if l.err != nil {
+		return fmt.Errorf("unable to write log %s: %w", l.path, l.err)
+	}
+
+	return nil
+}
@@ -5,8 +5,11 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"slices"
 	"strings"
 	"time"
 	"unicode/utf16"
@@ -37,8 +40,23 @@ type VMConstruct struct {
 	versionGetter         VersionGetter
 	rebootWaiter          RebootWaiterI
 	scriptExecutor        ScriptExecutorI
+	checkpoints           StepCheckpointer
 	RebootWaitTime        time.Duration
+	ShutdownTimeout       time.Duration
 	SetupFlags            []string
+	Resume                bool
+	// ForceResume lets a resumed run start again from a step that is not
+	// idempotent, which it otherwise refuses to do.
+	ForceResume bool
+	// LogDir is where the output of the commands each step runs on the VM
+	// is saved, one stdout and one stderr file per step, if set.
+	LogDir string
+	// Stdout and Stderr show the output of those commands, each line
+	// prefixed with the step that ran it.
+	Stdout io.Writer
+	Stderr io.Writer
+	// Diagnostics collects files from the VM when a step fails, if set.
+	Diagnostics DiagnosticsCollector
 }
 
 const provisionDir = "C:\\provision\\"
@@ -66,7 +84,9 @@ func NewVMConstruct(
 	versionGetter VersionGetter,
 	rebootWaiter RebootWaiterI,
 	scriptExecutor ScriptExecutorI,
+	checkpoints StepCheckpointer,
 	setupFlags []string,
+	resume bool,
 ) *VMConstruct {
 
 	return &VMConstruct{
@@ -84,20 +104,31 @@ func NewVMConstruct(
 		versionGetter:         versionGetter,
 		rebootWaiter:          rebootWaiter,
 		scriptExecutor:        scriptExecutor,
+		checkpoints:           checkpoints,
 		RebootWaitTime:        time.Second * 60,
 		SetupFlags:            setupFlags,
+		Resume:                resume,
+		Stdout:                os.Stdout,
+		Stderr:                os.Stderr,
 	}
 }
 
+//counterfeiter:generate . StepCheckpointer
+type StepCheckpointer interface {
+	Completed(step string) bool
+	MarkCompleted(step string) error
+	Reset() error
+}
+
 //counterfeiter:generate . ScriptExecutorI
 type ScriptExecutorI interface {
-	ExecuteSetupScript(stembuildVersion string, setupFlags []string) error
-	ExecutePostRebootScript(timeout time.Duration) error
+	ExecuteSetupScript(stembuildVersion string, setupFlags []string, output remotemanager.CommandOutput) error
+	ExecutePostRebootScript(timeout time.Duration, output remotemanager.CommandOutput) error
 }
 
 //counterfeiter:generate . RebootWaiterI
 type RebootWaiterI interface {
-	WaitForRebootFinished() error
+	WaitForRebootFinished(ctx context.Context) error
 }
 
 //counterfeiter:generate . GuestManager
@@ -116,6 +147,11 @@ type IaasClient interface {
 	IsPoweredOff(vmInventoryPath string) (bool, error)
 }
 
+//counterfeiter:generate . DiagnosticsCollector
+type DiagnosticsCollector interface {
+	Collect() (string, error)
+}
+
 //counterfeiter:generate . WinRMEnabler
 type WinRMEnabler interface {
 	Enable() error
@@ -152,85 +188,228 @@ type ConstructMessenger interface {
 	WinRMDisconnectedForReboot()
 	LogOutUsersStarted()
 	LogOutUsersSucceeded()
+	StepSkipped(step string)
+	StepFailed(step string, err error)
+	StepLogFailed(step string, err error)
+	StepInterrupted(step string)
+	CollectDiagnosticsStarted()
+	CollectDiagnosticsSucceeded(path string)
+	CollectDiagnosticsFailed(err error)
 }
 
-func (c *VMConstruct) PrepareVM() error {
+const (
+	StepCreateProvisionDir      = "create-provision-dir"
+	StepUploadArtifacts         = "upload-artifacts"
+	StepEnableWinRM             = "enable-winrm"
+	StepValidateVMConnection    = "validate-vm-connection"
+	StepExtractArtifacts        = "extract-artifacts"
+	StepLogOutUsers             = "log-out-users"
+	StepExecuteSetupScript      = "execute-setup-script"
+	StepWaitForReboot           = "wait-for-reboot"
+	StepExecutePostRebootScript = "execute-post-reboot-script"
+	StepWaitForShutdown         = "wait-for-shutdown"
+)
+
+// ErrStepNotIdempotent is returned when a resumed construct would start again
+// from a step that may have partly run on the VM and cannot be run twice.
+var ErrStepNotIdempotent = errors.New("the step may have partly run on the VM and is not safe to run again; run construct with -force-resume to run it again anyway, or without -resume on a fresh VM")
+
+// constructStep is a step of construct. Commands it runs on the VM write to
+// the output given to run. A step is idempotent if running it again after it
+// partly ran leaves the VM as running it once would.
+type constructStep struct {
+	name       string
+	idempotent bool
+	run        func(output remotemanager.CommandOutput) error
+}
+
+// steps returns the construct steps in order. Without a WinRMEnabler, as with
+// guest operations, WinRM is not enabled.
+func (c *VMConstruct) steps() []constructStep {
 	stembuildVersion := c.versionGetter.GetVersion()
 
-	err := c.createProvisionDirectory()
-	if err != nil {
-		return err
+	steps := []constructStep{
+		{StepCreateProvisionDir, true, func(remotemanager.CommandOutput) error {
+			return c.createProvisionDirectory()
+		}},
+		{StepUploadArtifacts, true, func(remotemanager.CommandOutput) error {
+			c.messenger.UploadArtifactsStarted()
+			err := c.uploadArtifacts()
+			if err != nil {
+				return err
+			}
+			c.messenger.UploadArtifactsSucceeded()
+			return nil
+		}},
+		{StepEnableWinRM, true, func(remotemanager.CommandOutput) error {
+			c.messenger.EnableWinRMStarted()
+			err := c.winRMEnabler.Enable()
+			if err != nil {
+				return err
+			}
+			c.messenger.EnableWinRMSucceeded()
+			return nil
+		}},
+		{StepValidateVMConnection, true, func(remotemanager.CommandOutput) error {
+			c.messenger.ValidateVMConnectionStarted()
+			err := c.vmConnectionValidator.Validate()
+			if err != nil {
+				return err
+			}
+			c.messenger.ValidateVMConnectionSucceeded()
+			return nil
+		}},
+		{StepExtractArtifacts, true, func(output remotemanager.CommandOutput) error {
+			c.messenger.ExtractArtifactsStarted()
+			err := c.extractArchive(output)
+			if err != nil {
+				return err
+			}
+			c.messenger.ExtractArtifactsSucceeded()
+			return nil
+		}},
+		{StepLogOutUsers, true, func(output remotemanager.CommandOutput) error {
+			c.messenger.LogOutUsersStarted()
+			err := c.logOutUsers(output)
+			if err != nil {
+				return err
+			}
+			c.messenger.LogOutUsersSucceeded()
+			return nil
+		}},
+		{StepExecuteSetupScript, false, func(output remotemanager.CommandOutput) error {
+			c.messenger.ExecuteSetupScriptStarted()
+			err := c.scriptExecutor.ExecuteSetupScript(stembuildVersion, c.SetupFlags, output)
+			if err != nil {
+				return err
+			}
+			c.messenger.ExecuteSetupScriptSucceeded()
+			c.messenger.WinRMDisconnectedForReboot()
+			return nil
+		}},
+		{StepWaitForReboot, true, func(remotemanager.CommandOutput) error {
+			c.messenger.RebootHasStarted()
+			select {
+			case <-time.After(c.RebootWaitTime):
+			case <-c.ctx.Done():
+				return context.Cause(c.ctx)
+			}
+			err := c.rebootWaiter.WaitForRebootFinished(c.ctx)
+			if err != nil {
+				return err
+			}
+			c.messenger.RebootHasFinished()
+			return nil
+		}},
+		{StepExecutePostRebootScript, true, func(output remotemanager.CommandOutput) error {
+			c.messenger.ExecutePostRebootScriptStarted()
+			err := c.scriptExecutor.ExecutePostRebootScript(24*time.Hour, output)
+			if err != nil {
+				if strings.Contains(err.Error(), "winrm connection event") {
+					c.messenger.ExecutePostRebootWarning(err.Error())
+				} else {
+					return fmt.Errorf("failure in post-reboot script: %s", err)
+				}
+			}
+			c.messenger.ExecutePostRebootScriptSucceeded()
+			return nil
+		}},
+		{StepWaitForShutdown, true, func(remotemanager.CommandOutput) error {
+			err := c.isPoweredOff(time.Minute)
+			if err != nil {
+				return err
+			}
+			c.messenger.ShutdownCompleted()
+			return nil
+		}},
 	}
-	c.messenger.UploadArtifactsStarted()
-	err = c.uploadArtifacts()
-	if err != nil {
-		return err
+	if c.winRMEnabler == nil {
+		steps = slices.DeleteFunc(steps, func(step constructStep) bool { return step.name == StepEnableWinRM })
 	}
-	c.messenger.UploadArtifactsSucceeded()
 
-	c.messenger.EnableWinRMStarted()
-	err = c.winRMEnabler.Enable()
-	if err != nil {
-		return err
-	}
-	c.messenger.EnableWinRMSucceeded()
+	return steps
+}
 
-	c.messenger.ValidateVMConnectionStarted()
-	err = c.vmConnectionValidator.Validate()
-	if err != nil {
-		return err
+// PrepareVM runs each construct step in order and records every completed
+// step. When Resume is set, steps completed by a previous run are skipped up
+// to the first one that did not complete; everything from there on runs again.
+// Unless ForceResume is set, a resumed run refuses to start again from a step
+// that is not idempotent, since it may have partly run on the VM.
+// A step whose output cannot be saved to LogDir still succeeds, with a
+// warning. When a step fails, Diagnostics are collected from the VM before
+// returning.
+func (c *VMConstruct) PrepareVM() error {
+	if !c.Resume {
+		err := c.checkpoints.Reset()
+		if err != nil {
+			return err
+		}
 	}
-	c.messenger.ValidateVMConnectionSucceeded()
 
-	c.messenger.ExtractArtifactsStarted()
-	err = c.extractArchive()
-	if err != nil {
-		return err
-	}
-	c.messenger.ExtractArtifactsSucceeded()
+	resuming := c.Resume
+	for _, step := range c.steps() {
+		if resuming && c.checkpoints.Completed(step.name) {
+			c.messenger.StepSkipped(step.name)
+			continue
+		}
+		if resuming && !step.idempotent && !c.ForceResume {
+			return fmt.Errorf("cannot resume from %s: %w", step.name, ErrStepNotIdempotent)
+		}
+		resuming = false
 
-	c.messenger.LogOutUsersStarted()
-	err = c.logOutUsers()
-	if err != nil {
-		return err
-	}
-	c.messenger.LogOutUsersSucceeded()
+		if err := c.interrupted(step.name); err != nil {
+			return err
+		}
 
-	c.messenger.ExecuteSetupScriptStarted()
-	err = c.scriptExecutor.ExecuteSetupScript(stembuildVersion, c.SetupFlags)
-	if err != nil {
-		return err
+		output := c.newStepOutput(step.name)
+		err := step.run(output.CommandOutput)
+		if logErr := output.Close(); logErr != nil {
+			c.messenger.StepLogFailed(step.name, logErr)
+		}
+		if err := c.interrupted(step.name); err != nil {
+			return err
+		}
+		if err != nil {
+			c.messenger.StepFailed(step.name, err)
+			c.collectDiagnostics()
+			return err
+		}
+
+		err = c.checkpoints.MarkCompleted(step.name)
+		if err != nil {
+			return err
+		}
 	}
-	c.messenger.ExecuteSetupScriptSucceeded()
-	c.messenger.WinRMDisconnectedForReboot()
 
-	c.messenger.RebootHasStarted()
-	time.Sleep(c.RebootWaitTime)
-	err = c.rebootWaiter.WaitForRebootFinished()
-	if err != nil {
-		return err
+	return c.checkpoints.Reset()
+}
+
+// collectDiagnostics reports, rather than returns, a failure to collect the
+// diagnostics, so that the error of the failed step is the one returned.
+func (c *VMConstruct) collectDiagnostics() {
+	if c.Diagnostics == nil {
+		return
 	}
-	c.messenger.RebootHasFinished()
 
-	c.messenger.ExecutePostRebootScriptStarted()
-	err = c.scriptExecutor.ExecutePostRebootScript(24 * time.Hour)
+	c.messenger.CollectDiagnosticsStarted()
+	path, err := c.Diagnostics.Collect()
 	if err != nil {
-		if strings.Contains(err.Error(), "winrm connection event") {
-			c.messenger.ExecutePostRebootWarning(err.Error())
-		} else {
-			return fmt.Errorf("failure in post-reboot script: %s", err)
-		}
+		c.messenger.CollectDiagnosticsFailed(err)
+		return
 	}
+	c.messenger.CollectDiagnosticsSucceeded(path)
+}
 
-	c.messenger.ExecutePostRebootScriptSucceeded()
-
-	err = c.isPoweredOff(time.Minute)
-	if err != nil {
-		return err
+// interrupted reports step as interrupted and returns an error if the
+// construct context has been cancelled. The step is not marked completed, so
+// a resumed run starts again from it.
+func (c *VMConstruct) interrupted(step string) error {
+	if c.ctx.Err() == nil {
+		return nil
 	}
-	c.messenger.ShutdownCompleted()
 
-	return nil
+	c.messenger.StepInterrupted(step)
+	return fmt.Errorf("%s was interrupted: %w", step, context.Cause(c.ctx))
 }
 
 func (c *VMConstruct) createProvisionDirectory() error {
@@ -261,17 +440,17 @@ func (c *VMConstruct) uploadArtifacts() error {
 	return nil
 }
 
-func (c *VMConstruct) extractArchive() error {
-	err := c.remoteManager.ExtractArchive(stemcellAutomationDest, provisionDir)
+func (c *VMConstruct) extractArchive(output remotemanager.CommandOutput) error {
+	err := c.remoteManager.ExtractArchive(stemcellAutomationDest, provisionDir, output)
 	return err
 }
 
-func (c *VMConstruct) logOutUsers() error {
+func (c *VMConstruct) logOutUsers(output remotemanager.CommandOutput) error {
 	failureString := "log out remote user failed with exit code %d: %s"
 	rawLogoffCommand := `&{If([string]::IsNullOrEmpty($(Get-WmiObject win32_computersystem).username)) {Write-Host "No users logged in." } Else {Write-Host "Logging out user."; $(Get-WmiObject win32_operatingsystem).Win32Shutdown(0) 1> $null}}`
 	logoffCommand := EncodePowershellCommand([]byte(rawLogoffCommand))
 
-	exitCode, err := c.remoteManager.ExecuteCommand("powershell.exe -EncodedCommand " + logoffCommand)
+	exitCode, err := c.remoteManager.ExecuteCommand("powershell.exe -EncodedCommand "+logoffCommand, output)
 
 	if err != nil {
 		return fmt.Errorf(failureString, exitCode, err)
@@ -290,7 +469,7 @@ func NewScriptExecutor(remoteManager remotemanager.RemoteManager) *ScriptExecuto
 	}
 }
 
-func (e *ScriptExecutor) ExecuteSetupScript(stembuildVersion string, setupFlags []string) error {
+func (e *ScriptExecutor) ExecuteSetupScript(stembuildVersion string, setupFlags []string, output remotemanager.CommandOutput) error {
 	var automationSetupScriptArgs []string
 	automationSetupScriptArgs = append(automationSetupScriptArgs, fmt.Sprintf("-Version %s", stembuildVersion))
 
@@ -299,12 +478,12 @@ func (e *ScriptExecutor) ExecuteSetupScript(stembuildVersion string, setupFlags
 	}
 
 	powershellCommand := fmt.Sprintf("powershell.exe %s %s", stemcellAutomationSetupScript, strings.Join(automationSetupScriptArgs, " "))
-	_, err := e.remoteManager.ExecuteCommand(powershellCommand)
+	_, err := e.remoteManager.ExecuteCommand(powershellCommand, output)
 	return err
 }
 
-func (e *ScriptExecutor) ExecutePostRebootScript(timeout time.Duration) error {
-	_, err := e.remoteManager.ExecuteCommandWithTimeout("powershell.exe "+stemcellAutomationPostRebootScript, timeout)
+func (e *ScriptExecutor) ExecutePostRebootScript(timeout time.Duration, output remotemanager.CommandOutput) error {
+	_, err := e.remoteManager.ExecuteCommandWithTimeout("powershell.exe "+stemcellAutomationPostRebootScript, timeout, output)
 
 	if err != nil && strings.Contains(err.Error(), remotemanager.PowershellExecutionErrorMessage) {
 		return err
@@ -319,7 +498,7 @@ func (e *ScriptExecutor) ExecutePostRebootScript(timeout time.Duration) error {
 }
 
 func (c *VMConstruct) isPoweredOff(duration time.Duration) error {
-	err := c.poller.Poll(duration, func() (bool, error) {
+	err := c.poller.Poll(c.ctx, poller.Options{Interval: duration, Timeout: c.ShutdownTimeout}, func() (bool, error) {
 		isPoweredOff, err := c.Client.IsPoweredOff(c.vmInventoryPath)
 
 		if err != nil {
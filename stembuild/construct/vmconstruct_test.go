@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct"
@@ -30,7 +32,9 @@ var _ = Describe("construct_helpers", func() {
 		fakeVMConnectionValidator *constructfakes.FakeVMConnectionValidator
 		fakeRebootWaiter          *constructfakes.FakeRebootWaiterI
 		fakeScriptExecutor        *constructfakes.FakeScriptExecutorI
+		fakeCheckpoints           *constructfakes.FakeStepCheckpointer
 		fakeSetupFlags            []string
+		cancel                    context.CancelCauseFunc
 	)
 	const rawLogoffCommand = `&{If([string]::IsNullOrEmpty($(Get-WmiObject win32_computersystem).username)) {Write-Host "No users logged in." } Else {Write-Host "Logging out user."; $(Get-WmiObject win32_operatingsystem).Win32Shutdown(0) 1> $null}}`
 	BeforeEach(func() {
@@ -44,10 +48,15 @@ var _ = Describe("construct_helpers", func() {
 		fakeVMConnectionValidator = &constructfakes.FakeVMConnectionValidator{}
 		fakeRebootWaiter = &constructfakes.FakeRebootWaiterI{}
 		fakeScriptExecutor = &constructfakes.FakeScriptExecutorI{}
+		fakeCheckpoints = &constructfakes.FakeStepCheckpointer{}
 		fakeSetupFlags = []string{"SomeFlag SomeValue", "OtherFlag OtherValue"}
 
+		var ctx context.Context
+		ctx, cancel = context.WithCancelCause(context.Background())
+		DeferCleanup(func() { cancel(nil) })
+
 		vmConstruct = construct.NewVMConstruct(
-			context.TODO(),
+			ctx,
 			fakeRemoteManager,
 			"fakeUser",
 			"fakePass",
@@ -61,7 +70,9 @@ var _ = Describe("construct_helpers", func() {
 			fakeVersionGetter,
 			fakeRebootWaiter,
 			fakeScriptExecutor,
+			fakeCheckpoints,
 			fakeSetupFlags,
+			false,
 		)
 		vmConstruct.RebootWaitTime = 0
 
@@ -81,8 +92,8 @@ var _ = Describe("construct_helpers", func() {
 
 			e := construct.NewScriptExecutor(fakeRemoteManager)
 			version := "11.11.11"
-			err := e.ExecuteSetupScript(version, fakeSetupFlags)
-			executeCommandCallArg := fakeRemoteManager.ExecuteCommandArgsForCall(0)
+			err := e.ExecuteSetupScript(version, fakeSetupFlags, remotemanager.CommandOutput{})
+			executeCommandCallArg, _ := fakeRemoteManager.ExecuteCommandArgsForCall(0)
 
 			Expect(err).NotTo(HaveOccurred())
 			Expect(executeCommandCallArg).To(ContainSubstring("powershell"))
@@ -95,8 +106,8 @@ var _ = Describe("construct_helpers", func() {
 		It("executes post-reboot script with correct arguments", func() {
 			e := construct.NewScriptExecutor(fakeRemoteManager)
 			superLongTimeout := 24 * time.Hour
-			err := e.ExecutePostRebootScript(superLongTimeout)
-			executeCommandCallArg, timeout := fakeRemoteManager.ExecuteCommandWithTimeoutArgsForCall(0)
+			err := e.ExecutePostRebootScript(superLongTimeout, remotemanager.CommandOutput{})
+			executeCommandCallArg, timeout, _ := fakeRemoteManager.ExecuteCommandWithTimeoutArgsForCall(0)
 
 			Expect(err).NotTo(HaveOccurred())
 			Expect(executeCommandCallArg).To(ContainSubstring("powershell"))
@@ -111,7 +122,7 @@ var _ = Describe("construct_helpers", func() {
 			powershellErr := fmt.Errorf("%s: %s", powershellErrorPrefix, "a command failed to run")
 			fakeRemoteManager.ExecuteCommandWithTimeoutReturns(2, powershellErr)
 
-			err := e.ExecutePostRebootScript(superLongTimeout)
+			err := e.ExecutePostRebootScript(superLongTimeout, remotemanager.CommandOutput{})
 
 			Expect(err).To(MatchError(powershellErr))
 		})
@@ -123,7 +134,7 @@ var _ = Describe("construct_helpers", func() {
 
 			fakeRemoteManager.ExecuteCommandWithTimeoutReturns(1, winRMError)
 
-			err := e.ExecutePostRebootScript(superLongTimeout)
+			err := e.ExecutePostRebootScript(superLongTimeout, remotemanager.CommandOutput{})
 
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("winrm connection event"))
@@ -175,6 +186,38 @@ var _ = Describe("construct_helpers", func() {
 				Expect(fakeMessenger.EnableWinRMStartedCallCount()).To(Equal(1))
 				Expect(fakeMessenger.EnableWinRMSucceededCallCount()).To(Equal(1))
 			})
+
+			It("does not enable winrm without an enabler, as with guest operations", func() {
+				vmConstruct = construct.NewVMConstruct(
+					context.Background(),
+					fakeRemoteManager,
+					"fakeUser",
+					"fakePass",
+					"fakeVmPath",
+					fakeVcenterClient,
+					fakeGuestManager,
+					nil,
+					fakeVMConnectionValidator,
+					fakeMessenger,
+					fakePoller,
+					fakeVersionGetter,
+					fakeRebootWaiter,
+					fakeScriptExecutor,
+					fakeCheckpoints,
+					fakeSetupFlags,
+					false,
+				)
+				vmConstruct.RebootWaitTime = 0
+
+				err := vmConstruct.PrepareVM()
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fakeMessenger.EnableWinRMStartedCallCount()).To(Equal(0))
+				Expect(fakeVMConnectionValidator.ValidateCallCount()).To(Equal(1))
+				for i := 0; i < fakeCheckpoints.MarkCompletedCallCount(); i++ {
+					Expect(fakeCheckpoints.MarkCompletedArgsForCall(i)).NotTo(Equal(construct.StepEnableWinRM))
+				}
+			})
 		})
 
 		Describe("connect to VM", func() {
@@ -283,7 +326,7 @@ var _ = Describe("construct_helpers", func() {
 
 				err := vmConstruct.PrepareVM()
 				Expect(err).ToNot(HaveOccurred())
-				command := fakeRemoteManager.ExecuteCommandArgsForCall(0)
+				command, _ := fakeRemoteManager.ExecuteCommandArgsForCall(0)
 
 				encodedCommand := construct.EncodePowershellCommand([]byte(rawLogoffCommand))
 				Expect(command).To(ContainSubstring(encodedCommand))
@@ -325,7 +368,7 @@ var _ = Describe("construct_helpers", func() {
 				err := vmConstruct.PrepareVM()
 				Expect(err).ToNot(HaveOccurred())
 				Expect(fakeRemoteManager.ExtractArchiveCallCount()).To(Equal(1))
-				source, destination := fakeRemoteManager.ExtractArchiveArgsForCall(0)
+				source, destination, _ := fakeRemoteManager.ExtractArchiveArgsForCall(0)
 				Expect(source).To(Equal("C:\\provision\\StemcellAutomation.zip"))
 				Expect(destination).To(Equal("C:\\provision\\"))
 
@@ -358,7 +401,7 @@ var _ = Describe("construct_helpers", func() {
 
 				Expect(fakeScriptExecutor.ExecuteSetupScriptCallCount()).To(Equal(1))
 
-				version, setupFlags := fakeScriptExecutor.ExecuteSetupScriptArgsForCall(0)
+				version, setupFlags, _ := fakeScriptExecutor.ExecuteSetupScriptArgsForCall(0)
 				Expect(version).To(Equal(stembuildVersion))
 				Expect(setupFlags).To(Equal(fakeSetupFlags))
 
@@ -371,12 +414,12 @@ var _ = Describe("construct_helpers", func() {
 			It("waits for reboot finished after the setup script has been executed", func() {
 				var calls []string
 
-				fakeRebootWaiter.WaitForRebootFinishedCalls(func() error {
+				fakeRebootWaiter.WaitForRebootFinishedCalls(func(context.Context) error {
 					calls = append(calls, "waitForRebootFinishedCall")
 					return nil
 				})
 
-				fakeScriptExecutor.ExecuteSetupScriptCalls(func(version string, setupFlags []string) error {
+				fakeScriptExecutor.ExecuteSetupScriptCalls(func(version string, setupFlags []string, output remotemanager.CommandOutput) error {
 					calls = append(calls, "executeSetupScriptCalls")
 					return nil
 				})
@@ -408,12 +451,12 @@ var _ = Describe("construct_helpers", func() {
 			It("checks that the reboot has completed before the post reboot script is executed", func() {
 				var calls []string
 
-				fakeRebootWaiter.WaitForRebootFinishedCalls(func() error {
+				fakeRebootWaiter.WaitForRebootFinishedCalls(func(context.Context) error {
 					calls = append(calls, "waitForRebootFinishedCall")
 					return nil
 				})
 
-				fakeScriptExecutor.ExecutePostRebootScriptCalls(func(duration time.Duration) error {
+				fakeScriptExecutor.ExecutePostRebootScriptCalls(func(duration time.Duration, output remotemanager.CommandOutput) error {
 					calls = append(calls, "executePostRebootScriptCalls")
 					return nil
 				})
@@ -496,9 +539,9 @@ var _ = Describe("construct_helpers", func() {
 				Expect(fakeMessenger.ShutdownCompletedCallCount()).To(Equal(1))
 
 				Expect(fakePoller.PollCallCount()).To(Equal(1))
-				pollDuration, pollFunc := fakePoller.PollArgsForCall(0)
+				_, pollOptions, pollFunc := fakePoller.PollArgsForCall(0)
 
-				Expect(pollDuration).To(Equal(1 * time.Minute))
+				Expect(pollOptions.Interval).To(Equal(1 * time.Minute))
 
 				Expect(fakeVcenterClient.IsPoweredOffCallCount()).To(Equal(0))
 				Expect(fakeMessenger.WaitingForShutdownCallCount()).To(Equal(0))
@@ -520,6 +563,16 @@ var _ = Describe("construct_helpers", func() {
 				Expect(fakeVcenterClient.IsPoweredOffCallCount()).To(Equal(3))
 			})
 
+			It("gives up waiting after the shutdown timeout", func() {
+				vmConstruct.ShutdownTimeout = 90 * time.Minute
+
+				err := vmConstruct.PrepareVM()
+				Expect(err).ToNot(HaveOccurred())
+
+				_, pollOptions, _ := fakePoller.PollArgsForCall(0)
+				Expect(pollOptions.Timeout).To(Equal(90 * time.Minute))
+			})
+
 			It("returns failure when it cannot determine VM power state", func() {
 				errorString := "cannot determine VM state"
 				fakePoller.PollReturnsOnCall(0, errors.New(errorString))
@@ -531,5 +584,355 @@ var _ = Describe("construct_helpers", func() {
 				Expect(fakeMessenger.ShutdownCompletedCallCount()).To(Equal(0))
 			})
 		})
+
+		Describe("records progress", func() {
+			It("clears previous progress before starting a new run", func() {
+				err := vmConstruct.PrepareVM()
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeCheckpoints.ResetCallCount()).To(Equal(2))
+				Expect(fakeCheckpoints.CompletedCallCount()).To(Equal(0))
+			})
+
+			It("marks each step completed in order", func() {
+				err := vmConstruct.PrepareVM()
+				Expect(err).NotTo(HaveOccurred())
+
+				var completed []string
+				for i := 0; i < fakeCheckpoints.MarkCompletedCallCount(); i++ {
+					completed = append(completed, fakeCheckpoints.MarkCompletedArgsForCall(i))
+				}
+				Expect(completed).To(Equal([]string{
+					construct.StepCreateProvisionDir,
+					construct.StepUploadArtifacts,
+					construct.StepEnableWinRM,
+					construct.StepValidateVMConnection,
+					construct.StepExtractArtifacts,
+					construct.StepLogOutUsers,
+					construct.StepExecuteSetupScript,
+					construct.StepWaitForReboot,
+					construct.StepExecutePostRebootScript,
+					construct.StepWaitForShutdown,
+				}))
+			})
+
+			It("does not mark a failed step completed and keeps earlier progress", func() {
+				fakeRebootWaiter.WaitForRebootFinishedReturns(errors.New("reboot failed"))
+
+				err := vmConstruct.PrepareVM()
+				Expect(err).To(MatchError("reboot failed"))
+
+				Expect(fakeCheckpoints.MarkCompletedCallCount()).To(Equal(7))
+				Expect(fakeCheckpoints.MarkCompletedArgsForCall(6)).To(Equal(construct.StepExecuteSetupScript))
+				Expect(fakeCheckpoints.ResetCallCount()).To(Equal(1))
+			})
+
+			It("reports the step that failed to the messenger", func() {
+				fakeRebootWaiter.WaitForRebootFinishedReturns(errors.New("reboot failed"))
+
+				err := vmConstruct.PrepareVM()
+				Expect(err).To(HaveOccurred())
+
+				Expect(fakeMessenger.StepFailedCallCount()).To(Equal(1))
+				step, stepErr := fakeMessenger.StepFailedArgsForCall(0)
+				Expect(step).To(Equal(construct.StepWaitForReboot))
+				Expect(stepErr).To(MatchError("reboot failed"))
+			})
+
+			It("returns an error when progress cannot be recorded", func() {
+				fakeCheckpoints.MarkCompletedReturns(errors.New("disk full"))
+
+				err := vmConstruct.PrepareVM()
+				Expect(err).To(MatchError("disk full"))
+
+				Expect(fakeVcenterClient.UploadArtifactCallCount()).To(Equal(0))
+			})
+
+			It("returns an error when previous progress cannot be cleared", func() {
+				fakeCheckpoints.ResetReturns(errors.New("permission denied"))
+
+				err := vmConstruct.PrepareVM()
+				Expect(err).To(MatchError("permission denied"))
+
+				Expect(fakeVcenterClient.MakeDirectoryCallCount()).To(Equal(0))
+			})
+		})
+
+		Describe("step output", func() {
+			var stdout, stderr *Buffer
+
+			BeforeEach(func() {
+				stdout, stderr = NewBuffer(), NewBuffer()
+				vmConstruct.Stdout, vmConstruct.Stderr = stdout, stderr
+				fakeScriptExecutor.ExecuteSetupScriptCalls(func(_ string, _ []string, output remotemanager.CommandOutput) error {
+					fmt.Fprint(output.Stdout, "Installing updates\nRebooting") //nolint:errcheck
+					fmt.Fprint(output.Stderr, "a warning\n")                   //nolint:errcheck
+					return nil
+				})
+			})
+
+			It("shows the output of commands with each line prefixed with the step", func() {
+				Expect(vmConstruct.PrepareVM()).To(Succeed())
+
+				Expect(string(stdout.Contents())).To(Equal("[execute-setup-script] Installing updates\n[execute-setup-script] Rebooting"))
+				Expect(string(stderr.Contents())).To(Equal("[execute-setup-script] a warning\n"))
+			})
+
+			It("saves the output of the steps that run commands to the log directory", func() {
+				vmConstruct.LogDir = filepath.Join(GinkgoT().TempDir(), "logs")
+
+				Expect(vmConstruct.PrepareVM()).To(Succeed())
+
+				logs, err := filepath.Glob(filepath.Join(vmConstruct.LogDir, "*"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(logs).To(HaveLen(2))
+				Expect(filepath.Base(logs[0])).To(MatchRegexp(`^\d{8}T\d{6}-execute-setup-script\.stderr\.log$`))
+				Expect(filepath.Base(logs[1])).To(MatchRegexp(`^\d{8}T\d{6}-execute-setup-script\.stdout\.log$`))
+				Expect(os.ReadFile(logs[0])).To(BeEquivalentTo("a warning\n"))
+				Expect(os.ReadFile(logs[1])).To(BeEquivalentTo("Installing updates\nRebooting"))
+			})
+
+			It("warns, rather than fails the step, when its output cannot be saved", func() {
+				vmConstruct.LogDir = filepath.Join(GinkgoT().TempDir(), "not-a-directory")
+				Expect(os.WriteFile(vmConstruct.LogDir, nil, 0644)).To(Succeed())
+
+				Expect(vmConstruct.PrepareVM()).To(Succeed())
+
+				Expect(string(stdout.Contents())).To(ContainSubstring("Installing updates"))
+				Expect(fakeMessenger.StepLogFailedCallCount()).To(Equal(1))
+				step, logErr := fakeMessenger.StepLogFailedArgsForCall(0)
+				Expect(step).To(Equal(construct.StepExecuteSetupScript))
+				Expect(logErr).To(MatchError(ContainSubstring("unable to write log " + vmConstruct.LogDir)))
+				Expect(fakeMessenger.StepFailedCallCount()).To(Equal(0))
+				Expect(fakeRebootWaiter.WaitForRebootFinishedCallCount()).To(Equal(1))
+			})
+		})
+
+		Describe("diagnostics", func() {
+			var fakeDiagnostics *constructfakes.FakeDiagnosticsCollector
+
+			BeforeEach(func() {
+				fakeDiagnostics = &constructfakes.FakeDiagnosticsCollector{}
+				fakeDiagnostics.CollectReturns("logs/diagnostics-20240101T000000.zip", nil)
+				vmConstruct.Diagnostics = fakeDiagnostics
+			})
+
+			It("collects diagnostics from the VM when a step fails", func() {
+				fakeRebootWaiter.WaitForRebootFinishedReturns(errors.New("reboot failed"))
+
+				err := vmConstruct.PrepareVM()
+				Expect(err).To(MatchError("reboot failed"))
+
+				Expect(fakeDiagnostics.CollectCallCount()).To(Equal(1))
+				Expect(fakeMessenger.CollectDiagnosticsStartedCallCount()).To(Equal(1))
+				Expect(fakeMessenger.CollectDiagnosticsSucceededCallCount()).To(Equal(1))
+				Expect(fakeMessenger.CollectDiagnosticsSucceededArgsForCall(0)).To(Equal("logs/diagnostics-20240101T000000.zip"))
+			})
+
+			It("reports diagnostics that cannot be collected without hiding the failure of the step", func() {
+				fakeRebootWaiter.WaitForRebootFinishedReturns(errors.New("reboot failed"))
+				fakeDiagnostics.CollectReturns("", errors.New("the VM cannot be reached"))
+
+				err := vmConstruct.PrepareVM()
+				Expect(err).To(MatchError("reboot failed"))
+
+				Expect(fakeMessenger.CollectDiagnosticsFailedCallCount()).To(Equal(1))
+				Expect(fakeMessenger.CollectDiagnosticsFailedArgsForCall(0)).To(MatchError("the VM cannot be reached"))
+			})
+
+			It("does not collect diagnostics when construct succeeds", func() {
+				Expect(vmConstruct.PrepareVM()).To(Succeed())
+
+				Expect(fakeDiagnostics.CollectCallCount()).To(Equal(0))
+			})
+
+			It("does not collect diagnostics when construct is interrupted", func() {
+				fakeScriptExecutor.ExecuteSetupScriptCalls(func(string, []string, remotemanager.CommandOutput) error {
+					cancel(errors.New("received interrupt signal"))
+					return nil
+				})
+
+				Expect(vmConstruct.PrepareVM()).NotTo(Succeed())
+
+				Expect(fakeDiagnostics.CollectCallCount()).To(Equal(0))
+			})
+		})
+
+		Describe("interrupts", func() {
+			var interrupt = errors.New("received interrupt signal")
+
+			It("stops before the next step and does not mark the interrupted step completed", func() {
+				fakeScriptExecutor.ExecuteSetupScriptCalls(func(string, []string, remotemanager.CommandOutput) error {
+					cancel(interrupt)
+					return nil
+				})
+
+				err := vmConstruct.PrepareVM()
+				Expect(err).To(MatchError(interrupt))
+				Expect(err).To(MatchError(ContainSubstring(construct.StepExecuteSetupScript + " was interrupted")))
+
+				Expect(fakeRebootWaiter.WaitForRebootFinishedCallCount()).To(Equal(0))
+				Expect(fakeCheckpoints.MarkCompletedCallCount()).To(Equal(6))
+				Expect(fakeCheckpoints.MarkCompletedArgsForCall(5)).To(Equal(construct.StepLogOutUsers))
+			})
+
+			It("reports the interrupted step to the messenger instead of a failure", func() {
+				fakeRebootWaiter.WaitForRebootFinishedCalls(func(context.Context) error {
+					cancel(interrupt)
+					return context.Canceled
+				})
+
+				err := vmConstruct.PrepareVM()
+				Expect(err).To(MatchError(interrupt))
+
+				Expect(fakeMessenger.StepInterruptedCallCount()).To(Equal(1))
+				Expect(fakeMessenger.StepInterruptedArgsForCall(0)).To(Equal(construct.StepWaitForReboot))
+				Expect(fakeMessenger.StepFailedCallCount()).To(Equal(0))
+			})
+
+			It("does not start when already interrupted", func() {
+				cancel(interrupt)
+
+				err := vmConstruct.PrepareVM()
+				Expect(err).To(MatchError(interrupt))
+
+				Expect(fakeVcenterClient.MakeDirectoryCallCount()).To(Equal(0))
+				Expect(fakeMessenger.StepInterruptedArgsForCall(0)).To(Equal(construct.StepCreateProvisionDir))
+			})
+
+			It("stops waiting for the VM to begin rebooting", func() {
+				vmConstruct.RebootWaitTime = time.Hour
+				fakeScriptExecutor.ExecuteSetupScriptCalls(func(string, []string, remotemanager.CommandOutput) error {
+					go cancel(interrupt)
+					return nil
+				})
+
+				err := vmConstruct.PrepareVM()
+				Expect(err).To(MatchError(interrupt))
+				Expect(fakeRebootWaiter.WaitForRebootFinishedCallCount()).To(Equal(0))
+			})
+		})
+
+		Describe("resume", func() {
+			BeforeEach(func() {
+				vmConstruct.Resume = true
+				fakeCheckpoints.CompletedStub = func(step string) bool {
+					switch step {
+					case construct.StepCreateProvisionDir,
+						construct.StepUploadArtifacts,
+						construct.StepEnableWinRM,
+						construct.StepValidateVMConnection,
+						construct.StepExtractArtifacts,
+						construct.StepLogOutUsers,
+						construct.StepExecuteSetupScript,
+						construct.StepWaitForReboot:
+						return true
+					}
+					return false
+				}
+			})
+
+			It("skips the steps completed by a previous run", func() {
+				err := vmConstruct.PrepareVM()
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeVcenterClient.MakeDirectoryCallCount()).To(Equal(0))
+				Expect(fakeVcenterClient.UploadArtifactCallCount()).To(Equal(0))
+				Expect(fakeWinRMEnabler.EnableCallCount()).To(Equal(0))
+				Expect(fakeVMConnectionValidator.ValidateCallCount()).To(Equal(0))
+				Expect(fakeRemoteManager.ExtractArchiveCallCount()).To(Equal(0))
+				Expect(fakeRemoteManager.ExecuteCommandCallCount()).To(Equal(0))
+				Expect(fakeScriptExecutor.ExecuteSetupScriptCallCount()).To(Equal(0))
+				Expect(fakeRebootWaiter.WaitForRebootFinishedCallCount()).To(Equal(0))
+
+				Expect(fakeMessenger.StepSkippedCallCount()).To(Equal(8))
+				Expect(fakeMessenger.StepSkippedArgsForCall(7)).To(Equal(construct.StepWaitForReboot))
+			})
+
+			It("carries on from the first incomplete step", func() {
+				err := vmConstruct.PrepareVM()
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeScriptExecutor.ExecutePostRebootScriptCallCount()).To(Equal(1))
+				Expect(fakePoller.PollCallCount()).To(Equal(1))
+				Expect(fakeCheckpoints.MarkCompletedCallCount()).To(Equal(2))
+			})
+
+			It("keeps previous progress until construct finishes", func() {
+				fakeScriptExecutor.ExecutePostRebootScriptReturns(errors.New(remotemanager.PowershellExecutionErrorMessage))
+
+				err := vmConstruct.PrepareVM()
+				Expect(err).To(HaveOccurred())
+
+				Expect(fakeCheckpoints.ResetCallCount()).To(Equal(0))
+			})
+
+			It("runs every step after the first incomplete one", func() {
+				fakeCheckpoints.CompletedStub = func(step string) bool {
+					return step != construct.StepUploadArtifacts
+				}
+
+				err := vmConstruct.PrepareVM()
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeVcenterClient.MakeDirectoryCallCount()).To(Equal(0))
+				Expect(fakeVcenterClient.UploadArtifactCallCount()).To(Equal(2))
+				Expect(fakeScriptExecutor.ExecuteSetupScriptCallCount()).To(Equal(1))
+				Expect(fakeScriptExecutor.ExecutePostRebootScriptCallCount()).To(Equal(1))
+				Expect(fakeMessenger.StepSkippedCallCount()).To(Equal(1))
+			})
+
+			It("waits for the reboot again after the wait failed, without being forced to", func() {
+				fakeCheckpoints.CompletedStub = func(step string) bool {
+					return step != construct.StepWaitForReboot &&
+						step != construct.StepExecutePostRebootScript &&
+						step != construct.StepWaitForShutdown
+				}
+
+				err := vmConstruct.PrepareVM()
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeScriptExecutor.ExecuteSetupScriptCallCount()).To(Equal(0))
+				Expect(fakeRebootWaiter.WaitForRebootFinishedCallCount()).To(Equal(1))
+				Expect(fakeScriptExecutor.ExecutePostRebootScriptCallCount()).To(Equal(1))
+				Expect(fakeCheckpoints.MarkCompletedArgsForCall(0)).To(Equal(construct.StepWaitForReboot))
+			})
+
+			Context("when the first incomplete step is not idempotent", func() {
+				BeforeEach(func() {
+					fakeCheckpoints.CompletedStub = func(step string) bool {
+						switch step {
+						case construct.StepExecuteSetupScript,
+							construct.StepWaitForReboot,
+							construct.StepExecutePostRebootScript,
+							construct.StepWaitForShutdown:
+							return false
+						}
+						return true
+					}
+				})
+
+				It("refuses to run it again", func() {
+					err := vmConstruct.PrepareVM()
+					Expect(err).To(MatchError(construct.ErrStepNotIdempotent))
+					Expect(err).To(MatchError(ContainSubstring("cannot resume from " + construct.StepExecuteSetupScript)))
+
+					Expect(fakeScriptExecutor.ExecuteSetupScriptCallCount()).To(Equal(0))
+					Expect(fakeScriptExecutor.ExecutePostRebootScriptCallCount()).To(Equal(0))
+					Expect(fakeCheckpoints.MarkCompletedCallCount()).To(Equal(0))
+					Expect(fakeCheckpoints.ResetCallCount()).To(Equal(0))
+				})
+
+				It("runs it again when forced to", func() {
+					vmConstruct.ForceResume = true
+
+					err := vmConstruct.PrepareVM()
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(fakeScriptExecutor.ExecuteSetupScriptCallCount()).To(Equal(1))
+					Expect(fakeScriptExecutor.ExecutePostRebootScriptCallCount()).To(Equal(1))
+				})
+			})
+		})
 	})
 })
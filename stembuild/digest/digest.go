@@ -0,0 +1,242 @@
+// Package digest computes the checksums recorded in stemcell manifests and OVF
+// manifests, and reads and writes the BOSH multi-digest format used in the
+// sha1 field of stemcell.MF.
+package digest
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Algorithm is a checksum algorithm, named as in BOSH multi-digests.
+type Algorithm string
+
+const (
+	SHA1   Algorithm = "sha1"
+	SHA256 Algorithm = "sha256"
+)
+
+// New returns a hash for the algorithm, or nil if it is not supported.
+func (a Algorithm) New() hash.Hash {
+	switch a {
+	case SHA1:
+		return sha1.New()
+	case SHA256:
+		return sha256.New()
+	default:
+		return nil
+	}
+}
+
+// OVFName is the name of the algorithm in an OVF manifest (.mf) file.
+func (a Algorithm) OVFName() string {
+	return strings.ToUpper(string(a))
+}
+
+// strength orders the supported algorithms from weakest to strongest.
+func (a Algorithm) strength() int {
+	switch a {
+	case SHA1:
+		return 1
+	case SHA256:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// Algorithms is a list of algorithms. It implements flag.Value, parsing a
+// comma separated list such as "sha1,sha256", and can be read from YAML.
+type Algorithms []Algorithm
+
+// Default is what stemcells are checksummed with unless other algorithms are
+// asked for.
+var Default = Algorithms{SHA1}
+
+func ParseAlgorithms(list string) (Algorithms, error) {
+	var algorithms Algorithms
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		algorithms = append(algorithms, Algorithm(name))
+	}
+
+	return algorithms, algorithms.Validate()
+}
+
+// Validate returns an error if the list is empty, or names an algorithm that is
+// not supported or one more than once.
+func (as Algorithms) Validate() error {
+	if len(as) == 0 {
+		return fmt.Errorf("at least one digest algorithm is required, supported algorithms are %s and %s", SHA1, SHA256)
+	}
+
+	seen := map[Algorithm]bool{}
+	for _, a := range as {
+		if a.New() == nil {
+			return fmt.Errorf("unsupported digest algorithm %q, supported algorithms are %s and %s", a, SHA1, SHA256)
+		}
+		if seen[a] {
+			return fmt.Errorf("digest algorithm %s is given more than once", a)
+		}
+		seen[a] = true
+	}
+
+	return nil
+}
+
+// Strongest returns the strongest algorithm in the list, which is used where
+// only one checksum can be recorded, such as an OVF manifest. An empty list
+// gives SHA1.
+func (as Algorithms) Strongest() Algorithm {
+	strongest := SHA1
+	for _, a := range as {
+		if a.strength() > strongest.strength() {
+			strongest = a
+		}
+	}
+
+	return strongest
+}
+
+func (as *Algorithms) String() string {
+	if as == nil {
+		return ""
+	}
+
+	names := make([]string, len(*as))
+	for i, a := range *as {
+		names[i] = string(a)
+	}
+	return strings.Join(names, ",")
+}
+
+func (as *Algorithms) Set(list string) error {
+	algorithms, err := ParseAlgorithms(list)
+	if err != nil {
+		return err
+	}
+
+	*as = algorithms
+	return nil
+}
+
+// UnmarshalYAML reads algorithms from either a list or a comma separated
+// string, as given to the flag.
+func (as *Algorithms) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return as.Set(node.Value)
+	}
+
+	var names []string
+	err := node.Decode(&names)
+	if err != nil {
+		return err
+	}
+	return as.Set(strings.Join(names, ","))
+}
+
+// Digest is the hex encoded checksum of some content.
+type Digest struct {
+	Algorithm Algorithm
+	Sum       string
+}
+
+// Digests are checksums of the same content.
+type Digests []Digest
+
+// Get returns the checksum for the algorithm, if there is one.
+func (ds Digests) Get(a Algorithm) (string, bool) {
+	for _, d := range ds {
+		if d.Algorithm == a {
+			return d.Sum, true
+		}
+	}
+
+	return "", false
+}
+
+// String formats the digests as a BOSH multi-digest, "sha1:<sum>;sha256:<sum>".
+// A lone sha1 is written as a bare sum, so that stemcells checksummed only with
+// sha1 keep the manifest that older directors expect.
+func (ds Digests) String() string {
+	if len(ds) == 1 && ds[0].Algorithm == SHA1 {
+		return ds[0].Sum
+	}
+
+	parts := make([]string, len(ds))
+	for i, d := range ds {
+		parts[i] = string(d.Algorithm) + ":" + d.Sum
+	}
+	return strings.Join(parts, ";")
+}
+
+// Parse reads a BOSH multi-digest. A bare sum is a sha1. Algorithms that are
+// not supported are kept, so that callers can decide to ignore them.
+func Parse(multiDigest string) (Digests, error) {
+	var digests Digests
+	for _, part := range strings.Split(multiDigest, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		algorithm, sum, found := strings.Cut(part, ":")
+		if !found {
+			algorithm, sum = string(SHA1), part
+		}
+		if sum == "" {
+			return nil, fmt.Errorf("digest %q has no checksum for %s", multiDigest, algorithm)
+		}
+
+		digests = append(digests, Digest{Algorithm: Algorithm(strings.ToLower(algorithm)), Sum: strings.ToLower(sum)})
+	}
+
+	if len(digests) == 0 {
+		return nil, fmt.Errorf("digest %q is empty", multiDigest)
+	}
+	return digests, nil
+}
+
+// Hash computes the checksums of everything written to it with each of its
+// algorithms at once.
+type Hash struct {
+	algorithms Algorithms
+	hashes     []hash.Hash
+}
+
+// NewHash returns a Hash for algorithms, which must be valid.
+func NewHash(algorithms Algorithms) *Hash {
+	h := &Hash{algorithms: algorithms}
+	for _, a := range algorithms {
+		h.hashes = append(h.hashes, a.New())
+	}
+
+	return h
+}
+
+func (h *Hash) Write(p []byte) (int, error) {
+	for _, hash := range h.hashes {
+		hash.Write(p) //nolint:errcheck
+	}
+
+	return len(p), nil
+}
+
+// Digests returns the checksums of what has been written, in the order of the
+// algorithms.
+func (h *Hash) Digests() Digests {
+	digests := make(Digests, len(h.hashes))
+	for i, hash := range h.hashes {
+		digests[i] = Digest{Algorithm: h.algorithms[i], Sum: fmt.Sprintf("%x", hash.Sum(nil))}
+	}
+
+	return digests
+}
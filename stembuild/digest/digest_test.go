@@ -0,0 +1,133 @@
+package digest_test
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/digest"
+)
+
+var _ = Describe("digest", func() {
+	Describe("ParseAlgorithms", func() {
+		It("parses a comma separated list", func() {
+			algorithms, err := digest.ParseAlgorithms(" SHA1, sha256 ")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(algorithms).To(Equal(digest.Algorithms{digest.SHA1, digest.SHA256}))
+		})
+
+		It("rejects an unsupported algorithm", func() {
+			_, err := digest.ParseAlgorithms("sha1,md5")
+			Expect(err).To(MatchError(ContainSubstring(`unsupported digest algorithm "md5"`)))
+		})
+
+		It("rejects an empty list", func() {
+			_, err := digest.ParseAlgorithms(" , ")
+			Expect(err).To(MatchError(ContainSubstring("at least one digest algorithm is required")))
+		})
+
+		It("rejects an algorithm given twice", func() {
+			_, err := digest.ParseAlgorithms("sha256,sha256")
+			Expect(err).To(MatchError("digest algorithm sha256 is given more than once"))
+		})
+
+		It("can be used as a flag", func() {
+			algorithms := digest.Default
+			f := flag.NewFlagSet("test", flag.ContinueOnError)
+			f.SetOutput(io.Discard)
+			f.Var(&algorithms, "digest-algorithms", "")
+
+			Expect(f.Lookup("digest-algorithms").DefValue).To(Equal("sha1"))
+			Expect(f.Parse([]string{"-digest-algorithms", "sha256,sha1"})).To(Succeed())
+			Expect(algorithms).To(Equal(digest.Algorithms{digest.SHA256, digest.SHA1}))
+			Expect(f.Parse([]string{"-digest-algorithms", "sha3"})).NotTo(Succeed())
+		})
+	})
+
+	Describe("UnmarshalYAML", func() {
+		It("reads a list or a comma separated string", func() {
+			var config struct {
+				List   digest.Algorithms `yaml:"list"`
+				String digest.Algorithms `yaml:"string"`
+			}
+			Expect(yaml.Unmarshal([]byte("{list: [sha256], string: 'sha1, sha256'}"), &config)).To(Succeed())
+
+			Expect(config.List).To(Equal(digest.Algorithms{digest.SHA256}))
+			Expect(config.String).To(Equal(digest.Algorithms{digest.SHA1, digest.SHA256}))
+		})
+
+		It("rejects an unsupported algorithm", func() {
+			var algorithms digest.Algorithms
+			Expect(yaml.Unmarshal([]byte("[md5]"), &algorithms)).NotTo(Succeed())
+		})
+	})
+
+	Describe("Strongest", func() {
+		It("prefers sha256 over sha1", func() {
+			Expect(digest.Algorithms{digest.SHA1, digest.SHA256}.Strongest()).To(Equal(digest.SHA256))
+			Expect(digest.Algorithms{digest.SHA1}.Strongest()).To(Equal(digest.SHA1))
+			Expect(digest.Algorithms{}.Strongest()).To(Equal(digest.SHA1))
+		})
+	})
+
+	Describe("Hash", func() {
+		It("computes every algorithm at once", func() {
+			h := digest.NewHash(digest.Algorithms{digest.SHA1, digest.SHA256})
+			_, err := io.WriteString(h, "some image")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(h.Digests()).To(Equal(digest.Digests{
+				{Algorithm: digest.SHA1, Sum: fmt.Sprintf("%x", sha1.Sum([]byte("some image")))},
+				{Algorithm: digest.SHA256, Sum: fmt.Sprintf("%x", sha256.Sum256([]byte("some image")))},
+			}))
+		})
+	})
+
+	Describe("Digests", func() {
+		It("formats several digests as a multi-digest", func() {
+			digests := digest.Digests{{Algorithm: digest.SHA1, Sum: "abc"}, {Algorithm: digest.SHA256, Sum: "def"}}
+			Expect(digests.String()).To(Equal("sha1:abc;sha256:def"))
+		})
+
+		It("formats a lone sha1 as a bare sum", func() {
+			Expect(digest.Digests{{Algorithm: digest.SHA1, Sum: "abc"}}.String()).To(Equal("abc"))
+			Expect(digest.Digests{{Algorithm: digest.SHA256, Sum: "def"}}.String()).To(Equal("sha256:def"))
+		})
+
+		It("parses what it formats", func() {
+			digests := digest.Digests{{Algorithm: digest.SHA1, Sum: "abc"}, {Algorithm: digest.SHA256, Sum: "def"}}
+			Expect(digest.Parse(digests.String())).To(Equal(digests))
+		})
+
+		It("parses a bare sum as a sha1", func() {
+			digests, err := digest.Parse("ABC")
+			Expect(err).NotTo(HaveOccurred())
+			sum, found := digests.Get(digest.SHA1)
+			Expect(found).To(BeTrue())
+			Expect(sum).To(Equal("abc"))
+			_, found = digests.Get(digest.SHA256)
+			Expect(found).To(BeFalse())
+		})
+
+		It("keeps algorithms it does not support", func() {
+			digests, err := digest.Parse("sha512:fff;sha256:def")
+			Expect(err).NotTo(HaveOccurred())
+			sum, found := digests.Get("sha512")
+			Expect(found).To(BeTrue())
+			Expect(sum).To(Equal("fff"))
+		})
+
+		It("rejects an empty digest", func() {
+			_, err := digest.Parse("")
+			Expect(err).To(HaveOccurred())
+			_, err = digest.Parse("sha256:")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
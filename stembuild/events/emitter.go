@@ -0,0 +1,109 @@
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
+)
+
+type Phase string
+
+const (
+	PhaseStarted   Phase = "started"
+	PhaseSucceeded Phase = "succeeded"
+	PhaseFailed    Phase = "failed"
+	PhaseWarning   Phase = "warning"
+	PhaseSkipped   Phase = "skipped"
+)
+
+// Event is a single line of the `-output-format json` event stream. Duration
+// is in seconds and is only set on the events that finish a started step.
+type Event struct {
+	Timestamp time.Time `json:"timestamp"`
+	Step      string    `json:"step"`
+	Phase     Phase     `json:"phase"`
+	Duration  *float64  `json:"duration,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Emitter writes one JSON object per line to out and keeps track of when each
+// step started so that finishing events carry the step's duration.
+type Emitter struct {
+	mutex   sync.Mutex
+	out     io.Writer
+	started map[string]time.Time
+}
+
+func NewEmitter(out io.Writer) *Emitter {
+	return &Emitter{out: out, started: map[string]time.Time{}}
+}
+
+// Started emits a started event, unless the step has already been started and
+// not finished yet. This lets callers report progress repeatedly while
+// waiting without resetting the step's duration.
+func (e *Emitter) Started(step, message string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if _, ok := e.started[step]; ok {
+		return
+	}
+
+	now := time.Now()
+	e.started[step] = now
+	e.write(Event{Timestamp: now, Step: step, Phase: PhaseStarted, Message: message})
+}
+
+func (e *Emitter) Succeeded(step, message string) {
+	e.finish(Event{Step: step, Phase: PhaseSucceeded, Message: message})
+}
+
+func (e *Emitter) Failed(step string, err error) {
+	event := Event{Step: step, Phase: PhaseFailed}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	e.finish(event)
+}
+
+func (e *Emitter) Warning(step, message string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.write(Event{Timestamp: time.Now(), Step: step, Phase: PhaseWarning, Message: message})
+}
+
+func (e *Emitter) Skipped(step, message string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.write(Event{Timestamp: time.Now(), Step: step, Phase: PhaseSkipped, Message: message})
+}
+
+func (e *Emitter) finish(event Event) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	event.Timestamp = time.Now()
+	if start, ok := e.started[event.Step]; ok {
+		duration := event.Timestamp.Sub(start).Seconds()
+		event.Duration = &duration
+		delete(e.started, event.Step)
+	}
+	e.write(event)
+}
+
+func (e *Emitter) write(event Event) {
+	event.Message = colorlogger.Redact(event.Message)
+	event.Error = colorlogger.Redact(event.Error)
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	e.out.Write(append(line, '\n')) //nolint:errcheck
+}
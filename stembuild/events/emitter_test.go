@@ -0,0 +1,114 @@
+package events_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/events"
+)
+
+func readEvents(buf *bytes.Buffer) []events.Event {
+	var result []events.Event
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var event events.Event
+		Expect(json.Unmarshal(scanner.Bytes(), &event)).To(Succeed())
+		result = append(result, event)
+	}
+	return result
+}
+
+var _ = Describe("Emitter", func() {
+	var (
+		buf     *bytes.Buffer
+		emitter *events.Emitter
+	)
+
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+		emitter = events.NewEmitter(buf)
+	})
+
+	It("writes one JSON object per line", func() {
+		emitter.Started("upload-artifacts", "")
+		emitter.Succeeded("upload-artifacts", "")
+
+		lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+		Expect(lines).To(HaveLen(2))
+		Expect(string(lines[0])).To(MatchJSON(`{"timestamp":` + jsonTimestamp(lines[0]) + `,"step":"upload-artifacts","phase":"started"}`))
+	})
+
+	It("sets the duration on the event that finishes a started step", func() {
+		emitter.Started("enable-winrm", "")
+		emitter.Succeeded("enable-winrm", "")
+
+		result := readEvents(buf)
+		Expect(result).To(HaveLen(2))
+		Expect(result[0].Phase).To(Equal(events.PhaseStarted))
+		Expect(result[0].Duration).To(BeNil())
+		Expect(result[1].Phase).To(Equal(events.PhaseSucceeded))
+		Expect(result[1].Duration).NotTo(BeNil())
+		Expect(*result[1].Duration).To(BeNumerically(">=", 0))
+		Expect(result[1].Timestamp).NotTo(BeTemporally("<", result[0].Timestamp))
+	})
+
+	It("does not restart a step that has not finished", func() {
+		emitter.Started("wait-for-shutdown", "")
+		emitter.Started("wait-for-shutdown", "")
+
+		Expect(readEvents(buf)).To(HaveLen(1))
+	})
+
+	It("reports failures with their error", func() {
+		emitter.Started("extract-artifacts", "")
+		emitter.Failed("extract-artifacts", errors.New("unzip failed"))
+
+		result := readEvents(buf)
+		Expect(result[1].Phase).To(Equal(events.PhaseFailed))
+		Expect(result[1].Error).To(Equal("unzip failed"))
+		Expect(result[1].Duration).NotTo(BeNil())
+	})
+
+	It("reports failures of steps that never started without a duration", func() {
+		emitter.Failed("construct", errors.New("missing arguments"))
+
+		result := readEvents(buf)
+		Expect(result).To(HaveLen(1))
+		Expect(result[0].Duration).To(BeNil())
+	})
+
+	It("reports warnings and skipped steps with their message", func() {
+		emitter.Warning("execute-post-reboot-script", "winrm connection event")
+		emitter.Skipped("upload-artifacts", "completed by a previous run")
+
+		result := readEvents(buf)
+		Expect(result[0].Phase).To(Equal(events.PhaseWarning))
+		Expect(result[0].Message).To(Equal("winrm connection event"))
+		Expect(result[1].Phase).To(Equal(events.PhaseSkipped))
+		Expect(result[1].Message).To(Equal("completed by a previous run"))
+	})
+
+	It("redacts registered secrets from messages and errors", func() {
+		colorlogger.RegisterSecret("emitter-secret")
+
+		emitter.Warning("execute-post-reboot-script", "saw emitter-secret")
+		emitter.Failed("construct", errors.New("rejected emitter-secret"))
+
+		Expect(buf.String()).NotTo(ContainSubstring("emitter-secret"))
+		result := readEvents(buf)
+		Expect(result[0].Message).To(Equal("saw [REDACTED]"))
+		Expect(result[1].Error).To(Equal("rejected [REDACTED]"))
+	})
+})
+
+func jsonTimestamp(line []byte) string {
+	var raw map[string]json.RawMessage
+	Expect(json.Unmarshal(line, &raw)).To(Succeed())
+	return string(raw["timestamp"])
+}
@@ -2,17 +2,26 @@ package iaas_cli
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"io"
 	"os"
+	"reflect"
 
 	"github.com/vmware/govmomi/cli"
 	_ "github.com/vmware/govmomi/cli/about"
 	_ "github.com/vmware/govmomi/cli/device"
 	_ "github.com/vmware/govmomi/cli/device/cdrom"
 	_ "github.com/vmware/govmomi/cli/export"
+	"github.com/vmware/govmomi/cli/flags"
 	_ "github.com/vmware/govmomi/cli/object"
 	_ "github.com/vmware/govmomi/cli/vm"
 	_ "github.com/vmware/govmomi/cli/vm/guest"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
 )
 
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 -generate
@@ -23,46 +32,123 @@ type CliRunner interface {
 	RunWithOutput(args []string) (string, int, error)
 }
 
+// GovcRunner runs govc commands in-process. Every invocation gets its own
+// copy of the registered command and its own output writer, so it is safe to
+// use from multiple goroutines at once.
 type GovcRunner struct {
+	// Context cancels running commands, e.g. an export, when it is done. A
+	// nil Context never cancels.
+	Context context.Context
+	// Stdout is where Run writes the output of commands, os.Stdout if nil.
+	Stdout io.Writer
 }
 
 func (r *GovcRunner) Run(args []string) int {
-	return cli.Run(args)
+	if r.Stdout == nil {
+		return r.run(args, os.Stdout)
+	}
+
+	return r.run(args, r.Stdout)
 }
 
 func (r *GovcRunner) RunWithOutput(args []string) (string, int, error) {
-	old := os.Stdout          // keep backup of the real stdout
-	reader, w, _ := os.Pipe() //nolint:errcheck
-	os.Stdout = w
-
-	print()
-
-	outC := make(chan string)
-	errC := make(chan error)
-	// copy the output in a separate goroutine so printing can't block indefinitely
-	go func() {
-		var buf bytes.Buffer
-		_, err := io.Copy(&buf, reader)
-		if err != nil {
-			errC <- err
-		} else {
-			outC <- buf.String()
+	var out bytes.Buffer
+	exitCode := r.run(args, &out)
+
+	return out.String(), exitCode, nil
+}
+
+func (r *GovcRunner) run(args []string, out io.Writer) int {
+	if len(args) == 0 {
+		return cli.Run(args)
+	}
+
+	registered, ok := cli.Commands()[args[0]]
+	if !ok {
+		// Let govc report unknown commands and aliases itself.
+		return cli.Run(args)
+	}
+	cmd := newCommand(registered)
+
+	ctx := r.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if id := os.Getenv("GOVC_OPERATION_ID"); id != "" {
+		ctx = context.WithValue(ctx, types.ID{}, id)
+	}
+
+	// Commands look up their output flag in the context, so seeding it here
+	// points all of their output at this invocation's writer.
+	outputFlag, ctx := flags.NewOutputFlag(ctx)
+	outputFlag.Out = out
+
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cmd.Register(ctx, fs)
+
+	err := fs.Parse(args[1:])
+	if err == nil {
+		err = cmd.Process(ctx)
+	}
+	if err == nil {
+		err = cmd.Run(ctx, fs)
+	}
+	if err == nil {
+		err = logout(ctx, cmd)
+		if err == nil {
+			return 0
 		}
-	}()
+	}
+
+	exitCode := 1
+	if x, ok := err.(interface{ ExitCode() int }); ok {
+		// propagate exit code, e.g. from guest.run
+		exitCode = x.ExitCode()
+	} else {
+		writeError(cmd, args[0], err)
+	}
+
+	_ = logout(ctx, cmd)
+
+	return exitCode
+}
+
+// writeError reports err as govc does, which with -json writes it as JSON,
+// but with registered secrets, such as the credentials passed with -u or -l,
+// redacted.
+func writeError(cmd cli.Command, name string, err error) {
+	if redacted := colorlogger.Redact(err.Error()); redacted != err.Error() {
+		err = errors.New(redacted)
+	}
+
+	if w, ok := cmd.(interface{ WriteError(error) bool }); ok && w.WriteError(err) {
+		return
+	}
 
-	exitCode := r.Run(args)
+	fmt.Fprintf(os.Stderr, "govc %s: %s\n", name, err) //nolint:errcheck
+}
 
-	// back to normal state
-	err := w.Close()
-	os.Stdout = old // restoring the real stdout
-	if err != nil {
-		return "", exitCode, err
+func logout(ctx context.Context, cmd cli.Command) error {
+	if l, ok := cmd.(interface{ Logout(context.Context) error }); ok {
+		// Log out of the session even when the command was cancelled.
+		return l.Logout(context.WithoutCancel(ctx))
 	}
 
-	select {
-	case out := <-outC:
-		return out, exitCode, nil
-	case err := <-errC:
-		return "", exitCode, err
+	return nil
+}
+
+// newCommand returns a shallow copy of a registered govc command. Commands
+// replace their embedded flags with fresh ones from the context when they are
+// registered, so the copy does not share flag state with other invocations.
+func newCommand(registered cli.Command) cli.Command {
+	v := reflect.ValueOf(registered)
+	if v.Kind() != reflect.Ptr {
+		return registered
 	}
+
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+
+	return c.Interface().(cli.Command)
 }
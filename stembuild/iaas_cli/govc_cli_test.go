@@ -1,22 +1,244 @@
 package iaas_cli_test
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/vmware/govmomi/cli"
+	"github.com/vmware/govmomi/cli/flags"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
 
+// echoCommand is a govc command that writes its arguments through the output
+// flag after a short delay, so that concurrent invocations overlap.
+type echoCommand struct {
+	*flags.OutputFlag
+
+	delay time.Duration
+}
+
+func init() {
+	cli.Register("stembuild.test.echo", &echoCommand{})
+}
+
+func (cmd *echoCommand) Register(ctx context.Context, f *flag.FlagSet) {
+	cmd.OutputFlag, _ = flags.NewOutputFlag(ctx)
+	cmd.OutputFlag.Register(ctx, f)
+
+	f.DurationVar(&cmd.delay, "delay", 0, "Time to wait before writing output")
+}
+
+func (cmd *echoCommand) Run(ctx context.Context, f *flag.FlagSet) error {
+	select {
+	case <-time.After(cmd.delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if f.Arg(0) == "fail" {
+		return fmt.Errorf("failed as requested")
+	}
+
+	_, err := fmt.Fprint(cmd.Out, strings.Join(f.Args(), " "))
+	return err
+}
+
+// failCommand fails with its first argument as the error and records the
+// errors govc's WriteError is given.
+type failCommand struct {
+	*flags.OutputFlag
+}
+
+var writtenErrors []error
+
+func init() {
+	cli.Register("stembuild.test.fail", &failCommand{})
+}
+
+func (cmd *failCommand) Register(ctx context.Context, f *flag.FlagSet) {
+	cmd.OutputFlag, _ = flags.NewOutputFlag(ctx)
+	cmd.OutputFlag.Register(ctx, f)
+}
+
+func (cmd *failCommand) Run(_ context.Context, f *flag.FlagSet) error {
+	return errors.New(f.Arg(0))
+}
+
+func (cmd *failCommand) WriteError(err error) bool {
+	writtenErrors = append(writtenErrors, err)
+	return true
+}
+
+// startProgramManager starts every program in the guest with the same PID,
+// since the simulator can only run guest programs in containers.
+type startProgramManager struct {
+	*simulator.GuestProcessManager
+}
+
+func (m *startProgramManager) StartProgramInGuest(_ *simulator.Context, _ *types.StartProgramInGuest) soap.HasFault {
+	return &methods.StartProgramInGuestBody{Res: &types.StartProgramInGuestResponse{Returnval: 4242}}
+}
+
 var _ = Describe("GovcCli", func() {
-	Describe("RunWithOutputs", func() {
+	Describe("RunWithOutput", func() {
 		var runner iaas_cli.GovcRunner
 
 		BeforeEach(func() {
 			runner = iaas_cli.GovcRunner{}
 		})
 
+		It("returns the output of the command", func() {
+			out, exitCode, err := runner.RunWithOutput([]string{"stembuild.test.echo", "hello", "world"})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exitCode).To(Equal(0))
+			Expect(out).To(Equal("hello world"))
+		})
+
+		It("returns exit code 1 and no output when the command fails", func() {
+			out, exitCode, err := runner.RunWithOutput([]string{"stembuild.test.echo", "fail"})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exitCode).To(Equal(1))
+			Expect(out).To(Equal(""))
+		})
+
+		It("returns each caller its own output when run concurrently", func() {
+			const callers = 20
+
+			var wg sync.WaitGroup
+			outputs := make([]string, callers)
+			exitCodes := make([]int, callers)
+			for i := 0; i < callers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					delay := fmt.Sprintf("%dms", (callers-i)*5)
+					out, exitCode, err := runner.RunWithOutput([]string{"stembuild.test.echo", "-delay", delay, fmt.Sprintf("caller-%d", i)})
+					Expect(err).NotTo(HaveOccurred())
+
+					outputs[i] = out
+					exitCodes[i] = exitCode
+				}(i)
+			}
+			wg.Wait()
+
+			for i := 0; i < callers; i++ {
+				Expect(exitCodes[i]).To(Equal(0))
+				Expect(outputs[i]).To(Equal(fmt.Sprintf("caller-%d", i)))
+			}
+		})
+
+		It("does not replace os.Stdout", func() {
+			stdout := os.Stdout
+
+			_, _, err := runner.RunWithOutput([]string{"stembuild.test.echo", "-delay", "10ms", "hello"})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(os.Stdout).To(BeIdenticalTo(stdout))
+		})
+
+		It("reports errors through the WriteError of the command with registered secrets redacted", func() {
+			writtenErrors = nil
+			colorlogger.RegisterSecret("govc-cli-secret")
+
+			out, exitCode, err := runner.RunWithOutput([]string{"stembuild.test.fail", "-json", "cannot login as user:govc-cli-secret"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exitCode).To(Equal(1))
+			Expect(out).To(BeEmpty())
+
+			Expect(writtenErrors).To(HaveLen(1))
+			Expect(writtenErrors[0]).To(MatchError("cannot login as user:[REDACTED]"))
+		})
+
+		It("stops the command when its context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			runner.Context = ctx
+			time.AfterFunc(10*time.Millisecond, cancel)
+
+			out, exitCode, err := runner.RunWithOutput([]string{"stembuild.test.echo", "-delay", "1m", "hello"})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exitCode).To(Equal(1))
+			Expect(out).To(Equal(""))
+		})
+	})
+
+	Describe(iaas_cli.GuestStartCommand, func() {
+		It("returns the PID of the started program without writing to os.Stdout", func() {
+			stdout := os.Stdout
+
+			simulator.Test(func(ctx context.Context, c *vim25.Client) {
+				registry := simulator.Map(ctx)
+				processManager := registry.Get(types.ManagedObjectReference{
+					Type:  "GuestProcessManager",
+					Value: "guestOperationsProcessManager",
+				}).(*simulator.GuestProcessManager)
+				registry.Put(&startProgramManager{processManager})
+
+				vm := registry.Any("VirtualMachine").(*simulator.VirtualMachine)
+				u := *c.URL()
+				u.User = url.UserPassword("user", "pass")
+
+				runner := iaas_cli.GovcRunner{Context: ctx}
+				out, exitCode, err := runner.RunWithOutput([]string{
+					iaas_cli.GuestStartCommand, "-u", u.String(), "-k", "-l", "Administrator:password", "-vm", vm.Name,
+					"powershell.exe", "-Command", "Get-Date",
+				})
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(exitCode).To(Equal(0))
+				Expect(out).To(Equal("4242\n"))
+			})
+
+			Expect(os.Stdout).To(BeIdenticalTo(stdout))
+		})
+
+		It("logs out of vCenter after running", func() {
+			Expect(cli.Commands()).To(HaveKey(iaas_cli.GuestStartCommand))
+
+			_, ok := cli.Commands()[iaas_cli.GuestStartCommand].(interface{ Logout(context.Context) error })
+			Expect(ok).To(BeTrue())
+		})
+	})
+
+	Describe("RunWithOutput against vCenter", func() {
+		var runner iaas_cli.GovcRunner
+		var targetVMPath string
+		var vCenterCredentialUrl string
+
+		BeforeEach(func() {
+			vCenterCredentialUrl = os.Getenv("VCENTER_ADMIN_CREDENTIAL_URL")
+			Expect(vCenterCredentialUrl).NotTo(Equal(""), "VCENTER_ADMIN_CREDENTIAL_URL is required")
+
+			vmFolder := os.Getenv("VM_FOLDER")
+			Expect(vmFolder).NotTo(Equal(""), "VM_FOLDER is required")
+			vmName := os.Getenv("PACKAGE_TEST_VM_NAME")
+			Expect(vmName).NotTo(Equal(""), "PACKAGE_TEST_VM_NAME is required")
+
+			targetVMPath = fmt.Sprintf("%s/%s", vmFolder, vmName)
+			runner = iaas_cli.GovcRunner{}
+		})
+
 		It("lists the devices for a known VCenter VM", func() {
 			out, _, err := runner.RunWithOutput([]string{"device.ls", "-vm", targetVMPath, "-u", vCenterCredentialUrl})
 
@@ -0,0 +1,69 @@
+package iaas_cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/vmware/govmomi/cli"
+	"github.com/vmware/govmomi/cli/flags"
+	"github.com/vmware/govmomi/cli/vm/guest"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// GuestStartCommand starts a program in the VM like govc's guest.start, but
+// writes the PID through the output flag of the invocation. guest.start
+// prints it straight to os.Stdout, so its output could only be captured by
+// swapping out os.Stdout for the whole process.
+const GuestStartCommand = "stembuild.guest.start"
+
+func init() {
+	cli.Register(GuestStartCommand, &guestStart{})
+}
+
+type guestStart struct {
+	*guest.GuestFlag
+	*flags.OutputFlag
+}
+
+func (cmd *guestStart) Register(ctx context.Context, f *flag.FlagSet) {
+	cmd.GuestFlag = &guest.GuestFlag{AuthFlag: &guest.AuthFlag{}}
+	cmd.GuestFlag.ClientFlag, ctx = flags.NewClientFlag(ctx)
+	cmd.GuestFlag.VirtualMachineFlag, ctx = flags.NewVirtualMachineFlag(ctx)
+	cmd.GuestFlag.Register(ctx, f)
+
+	cmd.OutputFlag, _ = flags.NewOutputFlag(ctx)
+}
+
+func (cmd *guestStart) Process(ctx context.Context) error {
+	return cmd.GuestFlag.Process(ctx)
+}
+
+func (cmd *guestStart) Logout(ctx context.Context) error {
+	return cmd.GuestFlag.ClientFlag.Logout(ctx)
+}
+
+func (cmd *guestStart) Usage() string {
+	return "PATH [ARG]..."
+}
+
+func (cmd *guestStart) Run(ctx context.Context, f *flag.FlagSet) error {
+	m, err := cmd.ProcessManager()
+	if err != nil {
+		return err
+	}
+
+	spec := types.GuestProgramSpec{
+		ProgramPath: f.Arg(0),
+		Arguments:   strings.Join(f.Args()[1:], " "),
+	}
+
+	pid, err := m.StartProgram(ctx, cmd.Auth(), &spec)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(cmd.Out, "%d\n", pid)
+	return err
+}
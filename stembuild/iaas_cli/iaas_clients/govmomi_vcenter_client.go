@@ -0,0 +1,497 @@
+package iaas_clients
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vmware/govmomi/fault"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/guest"
+	"github.com/vmware/govmomi/nfc"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/ovf"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/progress"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/digest"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrVMNotFound         = errors.New("vm not found")
+	ErrDeviceNotFound     = errors.New("device not found")
+	ErrProcessNotFound    = errors.New("process not found")
+)
+
+// VcenterClientError is returned by every GovmomiVcenterClient operation so
+// that callers can inspect the failed operation and its target, and match the
+// underlying cause with errors.Is / errors.As.
+type VcenterClientError struct {
+	Op     string
+	Target string
+	Err    error
+}
+
+func (e *VcenterClientError) Error() string {
+	return fmt.Sprintf("vcenter_client - %s %s: %s", e.Op, e.Target, e.Err)
+}
+
+func (e *VcenterClientError) Unwrap() error {
+	return e.Err
+}
+
+// VCenterSession is the part of vcenter_manager.VCenterManager that
+// GovmomiVcenterClient relies on.
+type VCenterSession interface {
+	Login(ctx context.Context) error
+	FindVM(ctx context.Context, inventoryPath string) (*object.VirtualMachine, error)
+	VimClient() *vim25.Client
+}
+
+// GovmomiVcenterClient implements the same operations as VcenterClient, but
+// talks to vCenter directly through govmomi rather than by running govc
+// commands. Like govc, it logs in before its first operation, unless
+// ValidateCredentials already has.
+type GovmomiVcenterClient struct {
+	ctx      context.Context
+	session  VCenterSession
+	loggedIn bool
+	// ManifestDigest is the algorithm of the .mf file written by exports,
+	// sha1 if unset.
+	ManifestDigest digest.Algorithm
+}
+
+// NewGovmomiVcenterClient returns a client whose operations are cancelled when
+// ctx is done.
+func NewGovmomiVcenterClient(ctx context.Context, session VCenterSession) *GovmomiVcenterClient {
+	return &GovmomiVcenterClient{ctx: ctx, session: session}
+}
+
+func (c *GovmomiVcenterClient) ValidateUrl() error {
+	vimClient := c.session.VimClient()
+	_, err := methods.RetrieveServiceContent(c.ctx, vimClient, &types.RetrieveServiceContent{This: vim25.ServiceInstance})
+	if err != nil {
+		return &VcenterClientError{Op: "validate url", Target: vimClient.URL().Host, Err: err}
+	}
+
+	return nil
+}
+
+func (c *GovmomiVcenterClient) ValidateCredentials() error {
+	err := c.session.Login(c.ctx)
+	if err != nil {
+		if fault.Is(err, &types.InvalidLogin{}) {
+			err = fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+		}
+		return &VcenterClientError{Op: "login", Target: c.session.VimClient().URL().Host, Err: err}
+	}
+	c.loggedIn = true
+
+	return nil
+}
+
+// login logs in unless the client already has.
+func (c *GovmomiVcenterClient) login() error {
+	if c.loggedIn {
+		return nil
+	}
+
+	return c.ValidateCredentials()
+}
+
+func (c *GovmomiVcenterClient) FindVM(vmInventoryPath string) error {
+	_, err := c.findVM(vmInventoryPath)
+	return err
+}
+
+func (c *GovmomiVcenterClient) ListDevices(vmInventoryPath string) ([]string, error) {
+	_, devices, err := c.devices(vmInventoryPath)
+	if err != nil {
+		return []string{}, err
+	}
+
+	names := make([]string, 0, len(devices))
+	for _, device := range devices {
+		names = append(names, devices.Name(device))
+	}
+
+	return names, nil
+}
+
+func (c *GovmomiVcenterClient) RemoveDevice(vmInventoryPath string, deviceName string) error {
+	vm, devices, err := c.devices(vmInventoryPath)
+	if err != nil {
+		return err
+	}
+
+	device := devices.Find(deviceName)
+	if device == nil {
+		return &VcenterClientError{Op: "remove device", Target: deviceName, Err: ErrDeviceNotFound}
+	}
+
+	err = vm.RemoveDevice(c.ctx, false, device)
+	if err != nil {
+		return &VcenterClientError{Op: "remove device", Target: deviceName, Err: err}
+	}
+
+	return nil
+}
+
+func (c *GovmomiVcenterClient) EjectCDRom(vmInventoryPath string, deviceName string) error {
+	vm, devices, err := c.devices(vmInventoryPath)
+	if err != nil {
+		return err
+	}
+
+	cdrom, err := devices.FindCdrom(deviceName)
+	if err != nil {
+		return &VcenterClientError{Op: "eject cdrom", Target: deviceName, Err: fmt.Errorf("%w: %w", ErrDeviceNotFound, err)}
+	}
+
+	err = vm.EditDevice(c.ctx, devices.EjectIso(cdrom))
+	if err != nil {
+		return &VcenterClientError{Op: "eject cdrom", Target: deviceName, Err: err}
+	}
+
+	return nil
+}
+
+// ExportFileWriter receives the files of a VM export as they are downloaded:
+// the disks, then the OVF descriptor, then the manifest. size is -1 when
+// vCenter does not report the size of a disk in advance.
+type ExportFileWriter interface {
+	WriteFile(name string, size int64, r io.Reader) error
+}
+
+// StreamExportVM exports the VM and hands each file to w as it is downloaded,
+// without writing anything to disk.
+func (c *GovmomiVcenterClient) StreamExportVM(vmInventoryPath string, w ExportFileWriter) error {
+	vm, err := c.findVM(vmInventoryPath)
+	if err != nil {
+		return err
+	}
+
+	return c.exportVM(vm, vmInventoryPath, w)
+}
+
+func (c *GovmomiVcenterClient) exportVM(vm *object.VirtualMachine, vmInventoryPath string, w ExportFileWriter) (err error) {
+	exportErr := func(err error) error {
+		return &VcenterClientError{Op: "export", Target: vmInventoryPath, Err: err}
+	}
+
+	name := vm.Name()
+	lease, err := vm.Export(c.ctx)
+	if err != nil {
+		return exportErr(err)
+	}
+	// The lease holds the VM until it is completed or aborted, so any failure
+	// from here on aborts it.
+	defer func() {
+		if err != nil {
+			lease.Abort(context.WithoutCancel(c.ctx), nil) //nolint:errcheck
+		}
+	}()
+
+	info, err := lease.Wait(c.ctx, nil)
+	if err != nil {
+		return exportErr(err)
+	}
+
+	updater := lease.StartUpdater(c.ctx, info)
+	defer updater.Done()
+
+	manifestDigest := c.ManifestDigest
+	if manifestDigest == "" {
+		manifestDigest = digest.SHA1
+	}
+
+	var manifest bytes.Buffer
+	descriptorParams := types.OvfCreateDescriptorParams{Name: name}
+
+	// Disks are exported in the order of their names, so that the export of
+	// an unchanged VM is the same every time.
+	items := slices.Clone(info.Items)
+	slices.SortFunc(items, func(a, b nfc.FileItem) int { return strings.Compare(a.Path, b.Path) })
+
+	for _, item := range items {
+		if filepath.Ext(item.Path) != ".vmdk" {
+			continue
+		}
+		if !strings.HasPrefix(item.Path, name) {
+			item.Path = name + "-" + item.Path
+		}
+
+		size, sum, err := c.downloadDisk(vm.Client(), item, manifestDigest, w)
+		if err != nil {
+			return exportErr(fmt.Errorf("downloading %s: %w", item.Path, err))
+		}
+		fmt.Fprintf(&manifest, "%s(%s)= %x\n", manifestDigest.OVFName(), item.Path, sum) //nolint:errcheck
+
+		item.Size = size
+		descriptorParams.OvfFiles = append(descriptorParams.OvfFiles, item.File())
+	}
+
+	descriptor, err := ovf.NewManager(vm.Client()).CreateDescriptor(c.ctx, vm, descriptorParams)
+	if err != nil {
+		return exportErr(err)
+	}
+
+	ovfName := name + ".ovf"
+	err = w.WriteFile(ovfName, int64(len(descriptor.OvfDescriptor)), strings.NewReader(descriptor.OvfDescriptor))
+	if err != nil {
+		return exportErr(err)
+	}
+	ovfHash := manifestDigest.New()
+	io.WriteString(ovfHash, descriptor.OvfDescriptor)                                           //nolint:errcheck
+	fmt.Fprintf(&manifest, "%s(%s)= %x\n", manifestDigest.OVFName(), ovfName, ovfHash.Sum(nil)) //nolint:errcheck
+
+	err = w.WriteFile(name+".mf", int64(manifest.Len()), &manifest)
+	if err != nil {
+		return exportErr(err)
+	}
+
+	err = lease.Complete(c.ctx)
+	if err != nil {
+		return exportErr(err)
+	}
+
+	return nil
+}
+
+// downloadDisk streams one disk of an export lease into w, and returns its
+// size and checksum.
+func (c *GovmomiVcenterClient) downloadDisk(client *vim25.Client, item nfc.FileItem, algorithm digest.Algorithm, w ExportFileWriter) (int64, []byte, error) {
+	body, size, err := client.Download(c.ctx, item.URL, &soap.DefaultDownload)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer body.Close() //nolint:errcheck
+
+	// Reporting progress keeps the lease alive while the disk is read.
+	progressReader := progress.NewReader(c.ctx, item, body, item.Size)
+	defer progressReader.Done(nil)
+
+	h := algorithm.New()
+	counter := &countingReader{r: io.TeeReader(progressReader, h)}
+	err = w.WriteFile(item.Path, size, counter)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return counter.n, h.Sum(nil), nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *GovmomiVcenterClient) UploadArtifact(vmInventoryPath, artifact, destination, username, password string) error {
+	uploadErr := func(err error) error {
+		return &VcenterClientError{Op: "upload", Target: artifact, Err: err}
+	}
+
+	f, err := os.Open(artifact)
+	if err != nil {
+		return uploadErr(err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	fi, err := f.Stat()
+	if err != nil {
+		return uploadErr(err)
+	}
+
+	ops, err := c.operationsManager(vmInventoryPath)
+	if err != nil {
+		return err
+	}
+
+	fileManager, err := ops.FileManager(c.ctx)
+	if err != nil {
+		return uploadErr(err)
+	}
+
+	transferURL, err := fileManager.InitiateFileTransferToGuest(c.ctx, guestAuth(username, password), destination, &types.GuestFileAttributes{}, fi.Size(), true)
+	if err != nil {
+		return uploadErr(err)
+	}
+
+	u, err := fileManager.TransferURL(c.ctx, transferURL)
+	if err != nil {
+		return uploadErr(err)
+	}
+
+	params := soap.DefaultUpload
+	params.ContentLength = fi.Size()
+	err = c.session.VimClient().Client.Upload(c.ctx, f, u, &params)
+	if err != nil {
+		return uploadErr(err)
+	}
+
+	return nil
+}
+
+func (c *GovmomiVcenterClient) MakeDirectory(vmInventoryPath, path, username, password string) error {
+	ops, err := c.operationsManager(vmInventoryPath)
+	if err != nil {
+		return err
+	}
+
+	fileManager, err := ops.FileManager(c.ctx)
+	if err != nil {
+		return &VcenterClientError{Op: "make directory", Target: path, Err: err}
+	}
+
+	err = fileManager.MakeDirectory(c.ctx, guestAuth(username, password), path, true)
+	if err != nil && !fault.Is(err, &types.FileAlreadyExists{}) {
+		return &VcenterClientError{Op: "make directory", Target: path, Err: err}
+	}
+
+	return nil
+}
+
+func (c *GovmomiVcenterClient) Start(vmInventoryPath, username, password, command string, args ...string) (string, error) {
+	processManager, err := c.processManager(vmInventoryPath)
+	if err != nil {
+		return "", err
+	}
+
+	spec := types.GuestProgramSpec{
+		ProgramPath: command,
+		Arguments:   strings.Join(args, " "),
+	}
+
+	pid, err := processManager.StartProgram(c.ctx, guestAuth(username, password), &spec)
+	if err != nil {
+		return "", &VcenterClientError{Op: "start", Target: command, Err: err}
+	}
+
+	return strconv.FormatInt(pid, 10), nil
+}
+
+func (c *GovmomiVcenterClient) WaitForExit(vmInventoryPath, username, password, pid string) (int, error) {
+	waitErr := func(err error) error {
+		return &VcenterClientError{Op: "wait for exit of PID", Target: pid, Err: err}
+	}
+
+	p, err := strconv.ParseInt(pid, 10, 64)
+	if err != nil {
+		return 0, waitErr(err)
+	}
+
+	processManager, err := c.processManager(vmInventoryPath)
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		procs, err := processManager.ListProcesses(c.ctx, guestAuth(username, password), []int64{p})
+		if err != nil {
+			return 0, waitErr(err)
+		}
+		if len(procs) != 1 {
+			return 0, waitErr(ErrProcessNotFound)
+		}
+		if procs[0].EndTime != nil {
+			return int(procs[0].ExitCode), nil
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return 0, waitErr(c.ctx.Err())
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
+
+func (c *GovmomiVcenterClient) IsPoweredOff(vmInventoryPath string) (bool, error) {
+	vm, err := c.findVM(vmInventoryPath)
+	if err != nil {
+		return false, err
+	}
+
+	state, err := vm.PowerState(c.ctx)
+	if err != nil {
+		return false, &VcenterClientError{Op: "get power state", Target: vmInventoryPath, Err: err}
+	}
+
+	return state == types.VirtualMachinePowerStatePoweredOff, nil
+}
+
+func (c *GovmomiVcenterClient) findVM(vmInventoryPath string) (*object.VirtualMachine, error) {
+	err := c.login()
+	if err != nil {
+		return nil, err
+	}
+
+	vm, err := c.session.FindVM(c.ctx, vmInventoryPath)
+	if err != nil {
+		var notFound *find.NotFoundError
+		if errors.As(err, &notFound) {
+			err = fmt.Errorf("%w: %w", ErrVMNotFound, err)
+		}
+		return nil, &VcenterClientError{Op: "find vm", Target: vmInventoryPath, Err: err}
+	}
+
+	return vm, nil
+}
+
+func (c *GovmomiVcenterClient) devices(vmInventoryPath string) (*object.VirtualMachine, object.VirtualDeviceList, error) {
+	vm, err := c.findVM(vmInventoryPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	devices, err := vm.Device(c.ctx)
+	if err != nil {
+		return nil, nil, &VcenterClientError{Op: "list devices", Target: vmInventoryPath, Err: err}
+	}
+
+	return vm, devices, nil
+}
+
+func (c *GovmomiVcenterClient) operationsManager(vmInventoryPath string) (*guest.OperationsManager, error) {
+	vm, err := c.findVM(vmInventoryPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return guest.NewOperationsManager(c.session.VimClient(), vm.Reference()), nil
+}
+
+func (c *GovmomiVcenterClient) processManager(vmInventoryPath string) (*guest.ProcessManager, error) {
+	ops, err := c.operationsManager(vmInventoryPath)
+	if err != nil {
+		return nil, err
+	}
+
+	processManager, err := ops.ProcessManager(c.ctx)
+	if err != nil {
+		return nil, &VcenterClientError{Op: "guest operations", Target: vmInventoryPath, Err: err}
+	}
+
+	return processManager, nil
+}
+
+func guestAuth(username, password string) *types.NamePasswordAuthentication {
+	return &types.NamePasswordAuthentication{Username: username, Password: password}
+}
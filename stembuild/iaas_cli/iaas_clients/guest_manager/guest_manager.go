@@ -10,6 +10,8 @@ import (
 	"github.com/vmware/govmomi/vim25"
 	"github.com/vmware/govmomi/vim25/soap"
 	"github.com/vmware/govmomi/vim25/types"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
 )
 
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 -generate
@@ -24,22 +26,25 @@ type ProcManager interface {
 //counterfeiter:generate . FileManager
 type FileManager interface {
 	InitiateFileTransferFromGuest(ctx context.Context, auth types.BaseGuestAuthentication, guestFilePath string) (*types.FileTransferInformation, error)
+	InitiateFileTransferToGuest(ctx context.Context, auth types.BaseGuestAuthentication, guestFilePath string, fileAttributes types.BaseGuestFileAttributes, fileSize int64, overwrite bool) (string, error)
+	DeleteFile(ctx context.Context, auth types.BaseGuestAuthentication, filePath string) error
 	TransferURL(ctx context.Context, u string) (*url.URL, error)
 }
 
-//counterfeiter:generate . DownloadClient
-type DownloadClient interface {
+//counterfeiter:generate . TransferClient
+type TransferClient interface {
 	Download(ctx context.Context, u *url.URL, param *soap.Download) (io.ReadCloser, int64, error)
+	Upload(ctx context.Context, f io.Reader, u *url.URL, param *soap.Upload) error
 }
 
 type GuestManager struct {
 	auth           types.NamePasswordAuthentication
 	processManager ProcManager
 	fileManager    FileManager
-	client         DownloadClient
+	client         TransferClient
 }
 
-func NewGuestManager(auth types.NamePasswordAuthentication, processManager ProcManager, fileManager FileManager, client DownloadClient) *GuestManager {
+func NewGuestManager(auth types.NamePasswordAuthentication, processManager ProcManager, fileManager FileManager, client TransferClient) *GuestManager {
 	return &GuestManager{auth, processManager, fileManager, client}
 }
 
@@ -51,8 +56,8 @@ func (g *GuestManager) StartProgramInGuest(ctx context.Context, command, args st
 
 	pid, err := g.processManager.StartProgram(ctx, &g.auth, &spec)
 	if err != nil {
-		return -1, fmt.Errorf("vcenter_client - could not run process: %s on guest os, error: %s",
-			fmt.Sprintf("%s %s", command, args), err.Error())
+		return -1, colorlogger.Errorf("vcenter_client - could not run process: %s on guest os, error: %w",
+			fmt.Sprintf("%s %s", command, args), err)
 	}
 
 	return pid, nil
@@ -62,15 +67,19 @@ func (g *GuestManager) ExitCodeForProgramInGuest(ctx context.Context, pid int64)
 	for {
 		procs, err := g.processManager.ListProcesses(ctx, &g.auth, []int64{pid})
 		if err != nil {
-			return -1, fmt.Errorf("vcenter_client - could not observe program exiting: %s", err.Error())
+			return -1, colorlogger.Errorf("vcenter_client - could not observe program exiting: %w", err)
 		}
 
 		if len(procs) != 1 {
-			return -1, fmt.Errorf("vcenter_client - could not observe program exiting")
+			return -1, colorlogger.Errorf("vcenter_client - could not observe program exiting")
 		}
 
 		if procs[0].EndTime == nil {
-			<-time.After(time.Millisecond * 250)
+			select {
+			case <-ctx.Done():
+				return -1, colorlogger.Errorf("vcenter_client - could not observe program exiting: %w", ctx.Err())
+			case <-time.After(time.Millisecond * 250):
+			}
 			continue
 		}
 
@@ -81,20 +90,53 @@ func (g *GuestManager) ExitCodeForProgramInGuest(ctx context.Context, pid int64)
 func (g *GuestManager) DownloadFileInGuest(ctx context.Context, path string) (io.Reader, int64, error) {
 	info, err := g.fileManager.InitiateFileTransferFromGuest(ctx, &g.auth, path)
 	if err != nil {
-		return nil, 0, fmt.Errorf("vcenter_client - unable to download file: %s", err.Error())
+		return nil, 0, colorlogger.Errorf("vcenter_client - unable to download file: %w", err)
 	}
 
 	u, err := g.fileManager.TransferURL(ctx, info.Url)
 	if err != nil {
-		return nil, 0, fmt.Errorf("vcenter_client - unable to download file: %s", err.Error())
+		return nil, 0, colorlogger.Errorf("vcenter_client - unable to download file: %w", err)
 	}
 
 	p := soap.DefaultDownload
 
 	f, n, err := g.client.Download(ctx, u, &p)
 	if err != nil {
-		return nil, n, fmt.Errorf("vcenter_client - unable to download file: %s", err.Error())
+		return nil, n, colorlogger.Errorf("vcenter_client - unable to download file: %w", err)
 	}
 
 	return f, n, nil
 }
+
+// UploadFileInGuest writes the size bytes of r to path on the guest, replacing
+// any file already there.
+func (g *GuestManager) UploadFileInGuest(ctx context.Context, path string, r io.Reader, size int64) error {
+	transferURL, err := g.fileManager.InitiateFileTransferToGuest(ctx, &g.auth, path, &types.GuestWindowsFileAttributes{}, size, true)
+	if err != nil {
+		return colorlogger.Errorf("vcenter_client - unable to upload file: %w", err)
+	}
+
+	u, err := g.fileManager.TransferURL(ctx, transferURL)
+	if err != nil {
+		return colorlogger.Errorf("vcenter_client - unable to upload file: %w", err)
+	}
+
+	p := soap.DefaultUpload
+	p.ContentLength = size
+
+	err = g.client.Upload(ctx, r, u, &p)
+	if err != nil {
+		return colorlogger.Errorf("vcenter_client - unable to upload file: %w", err)
+	}
+
+	return nil
+}
+
+func (g *GuestManager) DeleteFileInGuest(ctx context.Context, path string) error {
+	err := g.fileManager.DeleteFile(ctx, &g.auth, path)
+	if err != nil {
+		return colorlogger.Errorf("vcenter_client - unable to delete file: %w", err)
+	}
+
+	return nil
+}
@@ -3,12 +3,15 @@ package guest_manager_test
 import (
 	"context"
 	"errors"
+	"net/url"
+	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/vmware/govmomi/vim25/types"
 
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli/iaas_clients/guest_manager"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli/iaas_clients/guest_manager/guest_managerfakes"
 )
@@ -19,7 +22,7 @@ var _ = Describe("GuestManager", func() {
 		ctx          context.Context
 		procManager  guest_managerfakes.FakeProcManager
 		fileManager  guest_managerfakes.FakeFileManager
-		client       guest_managerfakes.FakeDownloadClient
+		client       guest_managerfakes.FakeTransferClient
 		guestManager *guest_manager.GuestManager
 	)
 
@@ -28,7 +31,7 @@ var _ = Describe("GuestManager", func() {
 		auth = types.NamePasswordAuthentication{}
 		procManager = guest_managerfakes.FakeProcManager{}
 		fileManager = guest_managerfakes.FakeFileManager{}
-		client = guest_managerfakes.FakeDownloadClient{}
+		client = guest_managerfakes.FakeTransferClient{}
 		guestManager = guest_manager.NewGuestManager(auth, &procManager, &fileManager, &client)
 	})
 
@@ -48,6 +51,16 @@ var _ = Describe("GuestManager", func() {
 			_, err := guestManager.StartProgramInGuest(ctx, "mkdir", "C:\\dummy")
 			Expect(err).To(MatchError("vcenter_client - could not run process: mkdir C:\\dummy on guest os, error: You aint nothin but a hound dog"))
 		})
+
+		It("redacts a registered guest password from the error", func() {
+			colorlogger.RegisterSecret("guest-manager-secret")
+			auth.Password = "guest-manager-secret"
+			guestManager = guest_manager.NewGuestManager(auth, &procManager, &fileManager, &client)
+			procManager.StartProgramReturns(int64(0), errors.New("login as admin:guest-manager-secret failed"))
+
+			_, err := guestManager.StartProgramInGuest(ctx, "mkdir", "C:\\dummy")
+			Expect(err).To(MatchError(ContainSubstring("login as admin:[REDACTED] failed")))
+		})
 	})
 
 	Describe("ExitCodeForProgramInGuest", func() {
@@ -67,10 +80,12 @@ var _ = Describe("GuestManager", func() {
 		})
 
 		It("returns an error if ListProcesses does", func() {
-			procManager.ListProcessesReturns(nil, errors.New("yo"))
+			listErr := errors.New("yo")
+			procManager.ListProcessesReturns(nil, listErr)
 
 			_, err := guestManager.ExitCodeForProgramInGuest(ctx, 1000)
 			Expect(err).To(MatchError("vcenter_client - could not observe program exiting: yo"))
+			Expect(err).To(MatchError(listErr))
 		})
 
 		It("returns an error if ListProcesses does not find pid", func() {
@@ -79,6 +94,18 @@ var _ = Describe("GuestManager", func() {
 			_, err := guestManager.ExitCodeForProgramInGuest(ctx, 1000)
 			Expect(err).To(MatchError("vcenter_client - could not observe program exiting"))
 		})
+
+		It("stops waiting for the program to exit when the context is done", func() {
+			ctx, cancel := context.WithCancel(ctx)
+			procManager.ListProcessesCalls(func(context.Context, types.BaseGuestAuthentication, []int64) ([]types.GuestProcessInfo, error) {
+				cancel()
+				return []types.GuestProcessInfo{{}}, nil
+			})
+
+			_, err := guestManager.ExitCodeForProgramInGuest(ctx, 1000)
+			Expect(err).To(MatchError(context.Canceled))
+			Expect(procManager.ListProcessesCallCount()).To(Equal(1))
+		})
 	})
 
 	Describe("DownloadFileInGuest", func() {
@@ -100,12 +127,14 @@ var _ = Describe("GuestManager", func() {
 		})
 
 		It("returns an error if Download fails", func() {
+			downloadErr := errors.New("couldn't initiate file transfer :(")
 			fileManager.InitiateFileTransferFromGuestReturns(&types.FileTransferInformation{Url: "my.dude.edu"}, nil)
-			client.DownloadReturns(nil, 0, errors.New("couldn't initiate file transfer :("))
+			client.DownloadReturns(nil, 0, downloadErr)
 
 			_, _, err := guestManager.DownloadFileInGuest(context.TODO(), "MYPATH")
 			Expect(err).To(HaveOccurred())
 			Expect(err).To(MatchError("vcenter_client - unable to download file: couldn't initiate file transfer :("))
+			Expect(err).To(MatchError(downloadErr))
 		})
 
 		It("successfully downloads file", func() {
@@ -118,4 +147,63 @@ var _ = Describe("GuestManager", func() {
 			Expect(client.DownloadCallCount()).To(Equal(1))
 		})
 	})
+
+	Describe("UploadFileInGuest", func() {
+		It("uploads the file to the given path, replacing any file there", func() {
+			fileManager.InitiateFileTransferToGuestReturns("https://*/guestFile?id=1", nil)
+			transferURL, _ := url.Parse("https://esxi.example.com/guestFile?id=1")
+			fileManager.TransferURLReturns(transferURL, nil)
+			content := strings.NewReader("some content")
+
+			err := guestManager.UploadFileInGuest(ctx, "C:\\provision\\file.zip", content, 12)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, _, path, _, size, overwrite := fileManager.InitiateFileTransferToGuestArgsForCall(0)
+			Expect(path).To(Equal("C:\\provision\\file.zip"))
+			Expect(size).To(Equal(int64(12)))
+			Expect(overwrite).To(BeTrue())
+			_, rawURL := fileManager.TransferURLArgsForCall(0)
+			Expect(rawURL).To(Equal("https://*/guestFile?id=1"))
+
+			Expect(client.UploadCallCount()).To(Equal(1))
+			_, body, u, param := client.UploadArgsForCall(0)
+			Expect(body).To(Equal(content))
+			Expect(u).To(Equal(transferURL))
+			Expect(param.ContentLength).To(Equal(int64(12)))
+		})
+
+		It("returns an error if the transfer cannot be initiated", func() {
+			fileManager.InitiateFileTransferToGuestReturns("", errors.New("no tools"))
+
+			err := guestManager.UploadFileInGuest(ctx, "C:\\file", strings.NewReader(""), 0)
+			Expect(err).To(MatchError("vcenter_client - unable to upload file: no tools"))
+			Expect(client.UploadCallCount()).To(Equal(0))
+		})
+
+		It("returns an error if Upload fails", func() {
+			uploadErr := errors.New("connection reset")
+			client.UploadReturns(uploadErr)
+
+			err := guestManager.UploadFileInGuest(ctx, "C:\\file", strings.NewReader(""), 0)
+			Expect(err).To(MatchError("vcenter_client - unable to upload file: connection reset"))
+			Expect(err).To(MatchError(uploadErr))
+		})
+	})
+
+	Describe("DeleteFileInGuest", func() {
+		It("deletes the file", func() {
+			err := guestManager.DeleteFileInGuest(ctx, "C:\\file")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, _, path := fileManager.DeleteFileArgsForCall(0)
+			Expect(path).To(Equal("C:\\file"))
+		})
+
+		It("returns an error if DeleteFile does", func() {
+			fileManager.DeleteFileReturns(errors.New("not found"))
+
+			err := guestManager.DeleteFileInGuest(ctx, "C:\\file")
+			Expect(err).To(MatchError("vcenter_client - unable to delete file: not found"))
+		})
+	})
 })
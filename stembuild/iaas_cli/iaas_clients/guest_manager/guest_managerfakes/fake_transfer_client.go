@@ -11,7 +11,7 @@ import (
 	"github.com/vmware/govmomi/vim25/soap"
 )
 
-type FakeDownloadClient struct {
+type FakeTransferClient struct {
 	DownloadStub        func(context.Context, *url.URL, *soap.Download) (io.ReadCloser, int64, error)
 	downloadMutex       sync.RWMutex
 	downloadArgsForCall []struct {
@@ -29,11 +29,25 @@ type FakeDownloadClient struct {
 		result2 int64
 		result3 error
 	}
+	UploadStub        func(context.Context, io.Reader, *url.URL, *soap.Upload) error
+	uploadMutex       sync.RWMutex
+	uploadArgsForCall []struct {
+		arg1 context.Context
+		arg2 io.Reader
+		arg3 *url.URL
+		arg4 *soap.Upload
+	}
+	uploadReturns struct {
+		result1 error
+	}
+	uploadReturnsOnCall map[int]struct {
+		result1 error
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeDownloadClient) Download(arg1 context.Context, arg2 *url.URL, arg3 *soap.Download) (io.ReadCloser, int64, error) {
+func (fake *FakeTransferClient) Download(arg1 context.Context, arg2 *url.URL, arg3 *soap.Download) (io.ReadCloser, int64, error) {
 	fake.downloadMutex.Lock()
 	ret, specificReturn := fake.downloadReturnsOnCall[len(fake.downloadArgsForCall)]
 	fake.downloadArgsForCall = append(fake.downloadArgsForCall, struct {
@@ -54,26 +68,26 @@ func (fake *FakeDownloadClient) Download(arg1 context.Context, arg2 *url.URL, ar
 	return fakeReturns.result1, fakeReturns.result2, fakeReturns.result3
 }
 
-func (fake *FakeDownloadClient) DownloadCallCount() int {
+func (fake *FakeTransferClient) DownloadCallCount() int {
 	fake.downloadMutex.RLock()
 	defer fake.downloadMutex.RUnlock()
 	return len(fake.downloadArgsForCall)
 }
 
-func (fake *FakeDownloadClient) DownloadCalls(stub func(context.Context, *url.URL, *soap.Download) (io.ReadCloser, int64, error)) {
+func (fake *FakeTransferClient) DownloadCalls(stub func(context.Context, *url.URL, *soap.Download) (io.ReadCloser, int64, error)) {
 	fake.downloadMutex.Lock()
 	defer fake.downloadMutex.Unlock()
 	fake.DownloadStub = stub
 }
 
-func (fake *FakeDownloadClient) DownloadArgsForCall(i int) (context.Context, *url.URL, *soap.Download) {
+func (fake *FakeTransferClient) DownloadArgsForCall(i int) (context.Context, *url.URL, *soap.Download) {
 	fake.downloadMutex.RLock()
 	defer fake.downloadMutex.RUnlock()
 	argsForCall := fake.downloadArgsForCall[i]
 	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
 }
 
-func (fake *FakeDownloadClient) DownloadReturns(result1 io.ReadCloser, result2 int64, result3 error) {
+func (fake *FakeTransferClient) DownloadReturns(result1 io.ReadCloser, result2 int64, result3 error) {
 	fake.downloadMutex.Lock()
 	defer fake.downloadMutex.Unlock()
 	fake.DownloadStub = nil
@@ -84,7 +98,7 @@ func (fake *FakeDownloadClient) DownloadReturns(result1 io.ReadCloser, result2 i
 	}{result1, result2, result3}
 }
 
-func (fake *FakeDownloadClient) DownloadReturnsOnCall(i int, result1 io.ReadCloser, result2 int64, result3 error) {
+func (fake *FakeTransferClient) DownloadReturnsOnCall(i int, result1 io.ReadCloser, result2 int64, result3 error) {
 	fake.downloadMutex.Lock()
 	defer fake.downloadMutex.Unlock()
 	fake.DownloadStub = nil
@@ -102,11 +116,77 @@ func (fake *FakeDownloadClient) DownloadReturnsOnCall(i int, result1 io.ReadClos
 	}{result1, result2, result3}
 }
 
-func (fake *FakeDownloadClient) Invocations() map[string][][]interface{} {
+func (fake *FakeTransferClient) Upload(arg1 context.Context, arg2 io.Reader, arg3 *url.URL, arg4 *soap.Upload) error {
+	fake.uploadMutex.Lock()
+	ret, specificReturn := fake.uploadReturnsOnCall[len(fake.uploadArgsForCall)]
+	fake.uploadArgsForCall = append(fake.uploadArgsForCall, struct {
+		arg1 context.Context
+		arg2 io.Reader
+		arg3 *url.URL
+		arg4 *soap.Upload
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.UploadStub
+	fakeReturns := fake.uploadReturns
+	fake.recordInvocation("Upload", []interface{}{arg1, arg2, arg3, arg4})
+	fake.uploadMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeTransferClient) UploadCallCount() int {
+	fake.uploadMutex.RLock()
+	defer fake.uploadMutex.RUnlock()
+	return len(fake.uploadArgsForCall)
+}
+
+func (fake *FakeTransferClient) UploadCalls(stub func(context.Context, io.Reader, *url.URL, *soap.Upload) error) {
+	fake.uploadMutex.Lock()
+	defer fake.uploadMutex.Unlock()
+	fake.UploadStub = stub
+}
+
+func (fake *FakeTransferClient) UploadArgsForCall(i int) (context.Context, io.Reader, *url.URL, *soap.Upload) {
+	fake.uploadMutex.RLock()
+	defer fake.uploadMutex.RUnlock()
+	argsForCall := fake.uploadArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeTransferClient) UploadReturns(result1 error) {
+	fake.uploadMutex.Lock()
+	defer fake.uploadMutex.Unlock()
+	fake.UploadStub = nil
+	fake.uploadReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeTransferClient) UploadReturnsOnCall(i int, result1 error) {
+	fake.uploadMutex.Lock()
+	defer fake.uploadMutex.Unlock()
+	fake.UploadStub = nil
+	if fake.uploadReturnsOnCall == nil {
+		fake.uploadReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.uploadReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeTransferClient) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
 	fake.downloadMutex.RLock()
 	defer fake.downloadMutex.RUnlock()
+	fake.uploadMutex.RLock()
+	defer fake.uploadMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
@@ -114,7 +194,7 @@ func (fake *FakeDownloadClient) Invocations() map[string][][]interface{} {
 	return copiedInvocations
 }
 
-func (fake *FakeDownloadClient) recordInvocation(key string, args []interface{}) {
+func (fake *FakeTransferClient) recordInvocation(key string, args []interface{}) {
 	fake.invocationsMutex.Lock()
 	defer fake.invocationsMutex.Unlock()
 	if fake.invocations == nil {
@@ -126,4 +206,4 @@ func (fake *FakeDownloadClient) recordInvocation(key string, args []interface{})
 	fake.invocations[key] = append(fake.invocations[key], args)
 }
 
-var _ guest_manager.DownloadClient = new(FakeDownloadClient)
+var _ guest_manager.TransferClient = new(FakeTransferClient)
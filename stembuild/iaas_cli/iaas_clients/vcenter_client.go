@@ -4,13 +4,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
-	"os"
 	"regexp"
 	"strings"
 
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli"
 )
 
+// The clients construct and package can talk to vCenter with: govc commands,
+// or govmomi directly.
+const (
+	VCenterClientGovc    = "govc"
+	VCenterClientGovmomi = "govmomi"
+)
+
+// VCenterClients are the values -vcenter-client accepts.
+var VCenterClients = []string{VCenterClientGovc, VCenterClientGovmomi}
+
 type VcenterClient struct {
 	Url           string
 	credentialUrl string
@@ -44,7 +54,7 @@ func (c *VcenterClient) ValidateUrl() error {
 
 	errCode := c.Runner.Run(args)
 	if errCode != 0 {
-		return fmt.Errorf("vcenter_client - %s: %s", errMsg, c.Url)
+		return colorlogger.Errorf("vcenter_client - %s: %s", errMsg, c.Url)
 	}
 
 	return nil
@@ -54,7 +64,7 @@ func (c *VcenterClient) ValidateCredentials() error {
 	args := c.buildGovcCommand("about")
 	errCode := c.Runner.Run(args)
 	if errCode != 0 {
-		return fmt.Errorf("vcenter_client - invalid credentials for: %s", c.redactedUrl)
+		return colorlogger.Errorf("vcenter_client - invalid credentials for: %s", c.redactedUrl)
 	}
 
 	return nil
@@ -64,7 +74,7 @@ func (c *VcenterClient) FindVM(vmInventoryPath string) error {
 	args := c.buildGovcCommand("find", "-maxdepth=0", vmInventoryPath)
 	errCode := c.Runner.Run(args)
 	if errCode != 0 {
-		return fmt.Errorf("vcenter_client - unable to find VM: %s. Ensure your inventory path is formatted properly and includes \"vm\" in its path, example: /my-datacenter/vm/my-folder/my-vm-name", vmInventoryPath)
+		return colorlogger.Errorf("vcenter_client - unable to find VM: %s. Ensure your inventory path is formatted properly and includes \"vm\" in its path, example: /my-datacenter/vm/my-folder/my-vm-name", vmInventoryPath)
 	}
 
 	return nil
@@ -75,11 +85,11 @@ func (c *VcenterClient) ListDevices(vmInventoryPath string) ([]string, error) {
 	o, exitCode, err := c.Runner.RunWithOutput(args)
 
 	if exitCode != 0 {
-		return []string{}, fmt.Errorf("vcenter_client - failed to list devices in vCenter, govc exit code %d", exitCode)
+		return []string{}, colorlogger.Errorf("vcenter_client - failed to list devices in vCenter, govc exit code %d", exitCode)
 	}
 
 	if err != nil {
-		return []string{}, fmt.Errorf("vcenter_client - failed to parse list of devices. Err: %s", err)
+		return []string{}, colorlogger.Errorf("vcenter_client - failed to parse list of devices. Err: %s", err)
 	}
 
 	entries := strings.Split(o, "\n")
@@ -97,7 +107,7 @@ func (c *VcenterClient) RemoveDevice(vmInventoryPath string, deviceName string)
 	args := c.buildGovcCommand("device.remove", "-vm", vmInventoryPath, deviceName)
 	errCode := c.Runner.Run(args)
 	if errCode != 0 {
-		return fmt.Errorf("vcenter_client - %s could not be removed", deviceName)
+		return colorlogger.Errorf("vcenter_client - %s could not be removed", deviceName)
 	}
 
 	return nil
@@ -107,21 +117,7 @@ func (c *VcenterClient) EjectCDRom(vmInventoryPath string, deviceName string) er
 	args := c.buildGovcCommand("device.cdrom.eject", "-vm", vmInventoryPath, "-device", deviceName)
 	errCode := c.Runner.Run(args)
 	if errCode != 0 {
-		return fmt.Errorf("vcenter_client - %s could not be ejected", deviceName)
-	}
-
-	return nil
-}
-
-func (c *VcenterClient) ExportVM(vmInventoryPath string, destination string) error {
-	_, err := os.Stat(destination)
-	if err != nil {
-		return fmt.Errorf("vcenter_client - provided destination directory: %s does not exist", destination)
-	}
-	args := c.buildGovcCommand("export.ovf", "-sha", "1", "-vm", vmInventoryPath, destination)
-	errCode := c.Runner.Run(args)
-	if errCode != 0 {
-		return fmt.Errorf("vcenter_client - %s could not be exported", vmInventoryPath)
+		return colorlogger.Errorf("vcenter_client - %s could not be ejected", deviceName)
 	}
 
 	return nil
@@ -132,7 +128,7 @@ func (c *VcenterClient) UploadArtifact(vmInventoryPath, artifact, destination, u
 	args := c.buildGovcCommand("guest.upload", "-f", "-l", vmCredentials, "-vm", vmInventoryPath, artifact, destination)
 	errCode := c.Runner.Run(args)
 	if errCode != 0 {
-		return fmt.Errorf("vcenter_client - %s could not be uploaded", artifact)
+		return colorlogger.Errorf("vcenter_client - %s could not be uploaded", artifact)
 	}
 
 	return nil
@@ -144,7 +140,7 @@ func (c *VcenterClient) MakeDirectory(vmInventoryPath, path, username, password
 	args := c.buildGovcCommand("guest.mkdir", "-l", vmCredentials, "-vm", vmInventoryPath, "-p", path)
 	errCode := c.Runner.Run(args)
 	if errCode != 0 {
-		return fmt.Errorf("vcenter_client - directory `%s` could not be created", path)
+		return colorlogger.Errorf("vcenter_client - directory `%s` could not be created", path)
 	}
 
 	return nil
@@ -153,16 +149,16 @@ func (c *VcenterClient) MakeDirectory(vmInventoryPath, path, username, password
 func (c *VcenterClient) Start(vmInventoryPath, username, password, command string, args ...string) (string, error) {
 	vmCredentials := fmt.Sprintf("%s:%s", username, password)
 
-	cmdArgs := c.buildGovcCommand(append([]string{"guest.start", "-l", vmCredentials, "-vm", vmInventoryPath, command}, args...)...)
+	cmdArgs := c.buildGovcCommand(append([]string{iaas_cli.GuestStartCommand, "-l", vmCredentials, "-vm", vmInventoryPath, command}, args...)...)
 	pid, exitCode, err := c.Runner.RunWithOutput(cmdArgs)
 	if err != nil {
-		return "", fmt.Errorf("vcenter_client - failed to run '%s': %s", command, err)
+		return "", colorlogger.Errorf("vcenter_client - failed to run '%s': %s", command, err)
 	}
 	if exitCode != 0 {
-		return "", fmt.Errorf("vcenter_client - '%s' returned exit code: %d", command, exitCode)
+		return "", colorlogger.Errorf("vcenter_client - '%s' returned exit code: %d", command, exitCode)
 	}
 
-	return strings.TrimSuffix(pid, "\n"), nil // trim since govc outputs the pid with an '\n' in the output
+	return strings.TrimSuffix(pid, "\n"), nil // trim since the pid is written with an '\n'
 }
 
 type govcPS struct {
@@ -182,19 +178,19 @@ func (c *VcenterClient) WaitForExit(vmInventoryPath, username, password, pid str
 	args := c.buildGovcCommand("guest.ps", "-l", vmCredentials, "-vm", vmInventoryPath, "-p", pid, "-X", "-json")
 	output, exitCode, err := c.Runner.RunWithOutput(args)
 	if err != nil {
-		return 0, fmt.Errorf("vcenter_client - failed to fetch exit code for PID %s: %s", pid, err)
+		return 0, colorlogger.Errorf("vcenter_client - failed to fetch exit code for PID %s: %s", pid, err)
 	}
 	if exitCode != 0 {
-		return 0, fmt.Errorf("vcenter_client - fetching PID %s returned with exit code: %d", pid, exitCode)
+		return 0, colorlogger.Errorf("vcenter_client - fetching PID %s returned with exit code: %d", pid, exitCode)
 	}
 
 	ps := govcPS{}
 	err = json.Unmarshal([]byte(output), &ps)
 	if err != nil {
-		return 0, fmt.Errorf("vcenter_client - received bad JSON output for PID %s: %s", pid, output)
+		return 0, colorlogger.Errorf("vcenter_client - received bad JSON output for PID %s: %s", pid, output)
 	}
 	if len(ps.ProcessInfo) != 1 {
-		return 0, fmt.Errorf("vcenter_client - couldn't get exit code for PID %s", pid)
+		return 0, colorlogger.Errorf("vcenter_client - couldn't get exit code for PID %s", pid)
 	}
 
 	return ps.ProcessInfo[0].ExitCode, nil
@@ -210,20 +206,35 @@ func (c *VcenterClient) buildGovcCommand(args ...string) []string {
 	return args
 }
 
+type govcVMInfo struct {
+	VirtualMachines []struct {
+		Runtime struct {
+			PowerState string `json:"powerState"`
+		} `json:"runtime"`
+	} `json:"virtualMachines"`
+}
+
 func (c *VcenterClient) IsPoweredOff(vmInventoryPath string) (bool, error) {
-	args := c.buildGovcCommand("vm.info", vmInventoryPath)
+	// -json makes vm.info write through govc's output flag instead of directly
+	// to os.Stdout, which keeps the call safe to run alongside other output.
+	args := c.buildGovcCommand("vm.info", "-json", vmInventoryPath)
 	out, exitCode, err := c.Runner.RunWithOutput(args)
 	if exitCode != 0 {
-		return false, fmt.Errorf("vcenter_client - failed to get vm info, govc exit code: %d", exitCode)
+		return false, colorlogger.Errorf("vcenter_client - failed to get vm info, govc exit code: %d", exitCode)
 	}
 
 	if err != nil {
-		return false, fmt.Errorf("vcenter_client - failed to determine vm power state: %s", err)
+		return false, colorlogger.Errorf("vcenter_client - failed to determine vm power state: %s", err)
 	}
 
-	if strings.Contains(out, "poweredOff") {
-		return true, nil
+	info := govcVMInfo{}
+	err = json.Unmarshal([]byte(out), &info)
+	if err != nil {
+		return false, colorlogger.Errorf("vcenter_client - received bad JSON output for vm info: %s", err)
+	}
+	if len(info.VirtualMachines) != 1 {
+		return false, colorlogger.Errorf("vcenter_client - couldn't get power state for vm: %s", vmInventoryPath)
 	}
 
-	return false, nil
+	return info.VirtualMachines[0].Runtime.PowerState == "poweredOff", nil
 }
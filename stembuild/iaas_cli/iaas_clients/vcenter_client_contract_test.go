@@ -2,12 +2,27 @@ package iaas_clients
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	neturl "net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli"
 	vcenterclientfactory "github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli/iaas_clients/vcenter_manager"
 
@@ -86,17 +101,374 @@ var _ = Describe("VcenterManager", func() {
 			})
 		})
 
-		Context("govc_cli client login", func() {
-			It("Succeeds", func() {
+		clients := map[string]func(password string) contractClient{
+			"VcenterClient": func(password string) contractClient {
+				return NewVcenterClient(vCenterUsername, password, vCenterUrl, certPath, &iaas_cli.GovcRunner{})
+			},
+			"GovmomiVcenterClient": func(password string) contractClient {
+				ctx := context.TODO()
+				vCenterManager, err := newManagerFactory(vCenterUrl, vCenterUsername, password, certPath).VCenterManager(ctx)
+				Expect(err).ToNot(HaveOccurred())
+
+				return NewGovmomiVcenterClient(ctx, vCenterManager)
+			},
+		}
+
+		for name, newClient := range clients {
+			Context(name, func() {
+				var (
+					client contractClient
+					vmPath string
+				)
+
+				BeforeEach(func() {
+					if runtime.GOOS == "windows" {
+						Skip("windows cannot run a vcsim server")
+					}
+
+					vmPath = "/DC0/vm/DC0_H0_VM0"
+					client = newClient(vCenterPassword)
+				})
+
+				It("validates the url and credentials", func() {
+					Expect(client.ValidateUrl()).To(Succeed())
+					Expect(client.ValidateCredentials()).To(Succeed())
+				})
+
+				It("rejects invalid credentials", func() {
+					Expect(newClient("not-the-password").ValidateCredentials()).ToNot(Succeed())
+				})
+
+				It("finds an existing VM", func() {
+					Expect(client.FindVM(vmPath)).To(Succeed())
+				})
+
+				It("fails to find a missing VM", func() {
+					Expect(client.FindVM("/DC0/vm/does-not-exist")).ToNot(Succeed())
+				})
+
+				It("lists, removes and ejects devices", func() {
+					devices, err := client.ListDevices(vmPath)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(devices).To(ContainElement("ethernet-0"))
+
+					var cdrom string
+					for _, device := range devices {
+						if strings.HasPrefix(device, "cdrom-") {
+							cdrom = device
+						}
+					}
+					Expect(cdrom).ToNot(BeEmpty())
+
+					Expect(client.EjectCDRom(vmPath, cdrom)).To(Succeed())
+					Expect(client.RemoveDevice(vmPath, "ethernet-0")).To(Succeed())
+
+					devices, err = client.ListDevices(vmPath)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(devices).ToNot(ContainElement("ethernet-0"))
+
+					Expect(client.RemoveDevice(vmPath, "ethernet-0")).ToNot(Succeed())
+				})
+
+				It("reports the power state of a VM", func() {
+					poweredOff, err := client.IsPoweredOff(vmPath)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(poweredOff).To(BeFalse())
+				})
+			})
+		}
+
+		Context("GovmomiVcenterClient errors", func() {
+			var (
+				ctx    context.Context
+				client *GovmomiVcenterClient
+			)
+
+			BeforeEach(func() {
 				if runtime.GOOS == "windows" {
 					Skip("windows cannot run a vcsim server")
 				}
-				runner := &iaas_cli.GovcRunner{}
-				client := NewVcenterClient(vCenterUsername, vCenterPassword, vCenterUrl, certPath, runner)
 
-				err := client.ValidateCredentials()
-				Expect(err).NotTo(HaveOccurred())
+				ctx = context.TODO()
+				vCenterManager, err := newManagerFactory(vCenterUrl, vCenterUsername, vCenterPassword, certPath).VCenterManager(ctx)
+				Expect(err).ToNot(HaveOccurred())
+				client = NewGovmomiVcenterClient(ctx, vCenterManager)
+			})
+
+			It("reports invalid credentials with a typed error", func() {
+				vCenterManager, err := newManagerFactory(vCenterUrl, vCenterUsername, "not-the-password", certPath).VCenterManager(ctx)
+				Expect(err).ToNot(HaveOccurred())
+
+				err = NewGovmomiVcenterClient(ctx, vCenterManager).ValidateCredentials()
+				Expect(errors.Is(err, ErrInvalidCredentials)).To(BeTrue())
+			})
+
+			It("reports a missing VM with a typed error", func() {
+				err := client.FindVM("/DC0/vm/does-not-exist")
+
+				var clientErr *VcenterClientError
+				Expect(errors.As(err, &clientErr)).To(BeTrue())
+				Expect(clientErr.Op).To(Equal("find vm"))
+				Expect(errors.Is(err, ErrVMNotFound)).To(BeTrue())
+			})
+
+			It("reports a missing device with a typed error", func() {
+				err := client.RemoveDevice("/DC0/vm/DC0_H0_VM0", "ethernet-9")
+				Expect(errors.Is(err, ErrDeviceNotFound)).To(BeTrue())
+			})
+		})
+	})
+
+	Context("in-process vcsim server with guest operations", func() {
+		var (
+			vmPath    string
+			url       string
+			caCert    string
+			processes *guestProcesses
+			files     *guestFiles
+		)
+
+		BeforeEach(func() {
+			model := simulator.VPX()
+			Expect(model.Create()).To(Succeed())
+			DeferCleanup(model.Remove)
+			model.Service.TLS = new(tls.Config)
+
+			// The simulator runs guest operations in containers, so they are
+			// answered here instead.
+			registry := model.Map()
+			processManager := registry.Get(types.ManagedObjectReference{Type: "GuestProcessManager", Value: "guestOperationsProcessManager"}).(*simulator.GuestProcessManager)
+			processes = &guestProcesses{GuestProcessManager: processManager}
+			registry.Put(processes)
+			fileManager := registry.Get(types.ManagedObjectReference{Type: "GuestFileManager", Value: "guestOperationsFileManager"}).(*simulator.GuestFileManager)
+			files = &guestFiles{GuestFileManager: fileManager, uploads: map[string]string{}}
+			registry.Put(files)
+			model.Service.HandleFunc(guestUploadPath, files.receiveUpload)
+
+			vm := registry.Any("VirtualMachine").(*simulator.VirtualMachine)
+			registry.Put(&exportingVM{vm})
+			ovfManager := registry.Get(types.ManagedObjectReference{Type: "OvfManager", Value: "OvfManager"}).(*simulator.OvfManager)
+			registry.Put(&describingOvfManager{ovfManager})
+
+			server := model.Service.NewServer()
+			DeferCleanup(server.Close)
+			var err error
+			caCert, err = server.CertificateFile()
+			Expect(err).ToNot(HaveOccurred())
+
+			url = server.URL.Host + server.URL.Path
+			vmPath = "/DC0/vm/" + vm.Name
+		})
+
+		clients := map[string]func() contractClient{
+			"VcenterClient": func() contractClient {
+				return NewVcenterClient("user", "pass", url, caCert, &iaas_cli.GovcRunner{})
+			},
+			"GovmomiVcenterClient": func() contractClient {
+				ctx := context.TODO()
+				vCenterManager, err := newManagerFactory(url, "user", "pass", caCert).VCenterManager(ctx)
+				Expect(err).ToNot(HaveOccurred())
+
+				return NewGovmomiVcenterClient(ctx, vCenterManager)
+			},
+		}
+
+		for name, newClient := range clients {
+			Context(name, func() {
+				var client contractClient
+
+				BeforeEach(func() {
+					client = newClient()
+				})
+
+				It("makes a directory in the guest", func() {
+					Expect(client.MakeDirectory(vmPath, `C:\provision`, "guest-user", "guest-pass")).To(Succeed())
+
+					Expect(files.directories).To(Equal([]string{`C:\provision`}))
+				})
+
+				It("uploads an artifact to the guest", func() {
+					artifact := filepath.Join(GinkgoT().TempDir(), "artifact.zip")
+					Expect(os.WriteFile(artifact, []byte("artifact contents"), 0644)).To(Succeed())
+
+					Expect(client.UploadArtifact(vmPath, artifact, `C:\provision\artifact.zip`, "guest-user", "guest-pass")).To(Succeed())
+
+					Expect(files.uploads).To(Equal(map[string]string{`C:\provision\artifact.zip`: "artifact contents"}))
+				})
+
+				It("starts a program in the guest and waits for its exit code", func() {
+					pid, err := client.Start(vmPath, "guest-user", "guest-pass", "powershell.exe", "-Command", "exit 3")
+					Expect(err).ToNot(HaveOccurred())
+					Expect(pid).To(Equal(strconv.Itoa(guestPid)))
+
+					Expect(processes.started).To(HaveLen(1))
+					Expect(processes.started[0].ProgramPath).To(Equal("powershell.exe"))
+					Expect(processes.started[0].Arguments).To(Equal("-Command exit 3"))
+
+					exitCode, err := client.WaitForExit(vmPath, "guest-user", "guest-pass", pid)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(exitCode).To(Equal(3))
+				})
+
+				It("fails to wait for an unknown program", func() {
+					_, err := client.WaitForExit(vmPath, "guest-user", "guest-pass", "1")
+					Expect(err).To(HaveOccurred())
+				})
 			})
+		}
+
+		It("exports a VM with the govmomi client", func() {
+			ctx := context.TODO()
+			vCenterManager, err := newManagerFactory(url, "user", "pass", caCert).VCenterManager(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			client := NewGovmomiVcenterClient(ctx, vCenterManager)
+
+			exported := &exportedFiles{contents: map[string]string{}}
+			Expect(client.StreamExportVM(vmPath, exported)).To(Succeed())
+
+			name := path.Base(vmPath)
+			Expect(exported.names).To(HaveLen(3))
+			Expect(exported.names[0]).To(MatchRegexp(`^` + name + `.*\.vmdk$`))
+			Expect(exported.names[1:]).To(Equal([]string{name + ".ovf", name + ".mf"}))
+			Expect(exported.contents[name+".ovf"]).To(Equal("<Envelope/>"))
+			Expect(exported.contents[name+".mf"]).To(MatchRegexp(`^SHA1\(\S+\.vmdk\)= [0-9a-f]{40}\nSHA1\(` + name + `\.ovf\)= [0-9a-f]{40}\n$`))
 		})
 	})
 })
+
+// contractClient is what both vCenter clients are checked for against vcsim.
+type contractClient interface {
+	ValidateUrl() error
+	ValidateCredentials() error
+	FindVM(vmInventoryPath string) error
+	ListDevices(vmInventoryPath string) ([]string, error)
+	RemoveDevice(vmInventoryPath string, deviceName string) error
+	EjectCDRom(vmInventoryPath string, deviceName string) error
+	IsPoweredOff(vmInventoryPath string) (bool, error)
+	UploadArtifact(vmInventoryPath, artifact, destination, username, password string) error
+	MakeDirectory(vmInventoryPath, path, username, password string) error
+	Start(vmInventoryPath, username, password, command string, args ...string) (string, error)
+	WaitForExit(vmInventoryPath, username, password, pid string) (int, error)
+}
+
+func newManagerFactory(url, username, password, certPath string) *vcenterclientfactory.ManagerFactory {
+	return &vcenterclientfactory.ManagerFactory{
+		Config: vcenterclientfactory.FactoryConfig{
+			VCenterServer:  url,
+			Username:       username,
+			Password:       password,
+			ClientCreator:  &vcenterclientfactory.ClientCreator{},
+			FinderCreator:  &vcenterclientfactory.GovmomiFinderCreator{},
+			RootCACertPath: certPath,
+		},
+	}
+}
+
+// guestPid is the PID of every program started in a guest of the in-process
+// vcsim server.
+const guestPid = 42
+
+// guestProcesses records the programs started in a guest, and reports each of
+// them as having exited with code 3.
+type guestProcesses struct {
+	*simulator.GuestProcessManager
+	started []types.GuestProgramSpec
+}
+
+func (m *guestProcesses) StartProgramInGuest(_ *simulator.Context, req *types.StartProgramInGuest) soap.HasFault {
+	m.started = append(m.started, *req.Spec.(*types.GuestProgramSpec))
+	return &methods.StartProgramInGuestBody{Res: &types.StartProgramInGuestResponse{Returnval: guestPid}}
+}
+
+func (m *guestProcesses) ListProcessesInGuest(_ *simulator.Context, req *types.ListProcessesInGuest) soap.HasFault {
+	var procs []types.GuestProcessInfo
+	if len(m.started) > 0 && slices.Contains(req.Pids, guestPid) {
+		start := time.Now().Add(-time.Second)
+		end := time.Now()
+		procs = append(procs, types.GuestProcessInfo{
+			Name:      m.started[0].ProgramPath,
+			Pid:       guestPid,
+			CmdLine:   m.started[0].ProgramPath + " " + m.started[0].Arguments,
+			StartTime: start,
+			EndTime:   &end,
+			ExitCode:  3,
+		})
+	}
+	return &methods.ListProcessesInGuestBody{Res: &types.ListProcessesInGuestResponse{Returnval: procs}}
+}
+
+const guestUploadPath = "/stembuild-guest-upload"
+
+// guestFiles records the directories made in a guest and the files uploaded
+// to it.
+type guestFiles struct {
+	*simulator.GuestFileManager
+	directories []string
+	uploads     map[string]string
+}
+
+func (m *guestFiles) MakeDirectoryInGuest(_ *simulator.Context, req *types.MakeDirectoryInGuest) soap.HasFault {
+	m.directories = append(m.directories, req.DirectoryPath)
+	return &methods.MakeDirectoryInGuestBody{Res: new(types.MakeDirectoryInGuestResponse)}
+}
+
+// InitiateFileTransferToGuest hands out a URL on the host "*", which the
+// clients replace with the vCenter they talk to.
+func (m *guestFiles) InitiateFileTransferToGuest(_ *simulator.Context, req *types.InitiateFileTransferToGuest) soap.HasFault {
+	u := neturl.URL{Scheme: "https", Host: "*", Path: guestUploadPath, RawQuery: neturl.Values{"path": {req.GuestFilePath}}.Encode()}
+	return &methods.InitiateFileTransferToGuestBody{Res: &types.InitiateFileTransferToGuestResponse{Returnval: u.String()}}
+}
+
+func (m *guestFiles) receiveUpload(w http.ResponseWriter, r *http.Request) {
+	contents, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	m.uploads[r.URL.Query().Get("path")] = string(contents)
+}
+
+// exportingVM exports a VM through a snapshot of it, as the simulator
+// cannot export VMs themselves. It can export the VM once.
+type exportingVM struct {
+	*simulator.VirtualMachine
+}
+
+func (vm *exportingVM) ExportVm(ctx *simulator.Context, _ *types.ExportVm) soap.HasFault {
+	// The rest of the simulator, exporting the snapshot included, expects
+	// the VM itself.
+	ctx.Map.Put(vm.VirtualMachine)
+
+	snapshot := &simulator.VirtualMachineSnapshot{VirtualMachineSnapshot: mo.VirtualMachineSnapshot{
+		Config: *vm.Config,
+		Vm:     vm.Self,
+	}}
+	lease := snapshot.ExportSnapshot(ctx, &types.ExportSnapshot{}).(*methods.ExportSnapshotBody).Res.Returnval
+
+	return &methods.ExportVmBody{Res: &types.ExportVmResponse{Returnval: lease}}
+}
+
+// describingOvfManager describes every VM with the same OVF descriptor, as the
+// simulator cannot describe VMs.
+type describingOvfManager struct {
+	*simulator.OvfManager
+}
+
+func (m *describingOvfManager) CreateDescriptor(_ *simulator.Context, _ *types.CreateDescriptor) soap.HasFault {
+	return &methods.CreateDescriptorBody{Res: &types.CreateDescriptorResponse{
+		Returnval: types.OvfCreateDescriptorResult{OvfDescriptor: "<Envelope/>"},
+	}}
+}
+
+// exportedFiles records the files of a VM export, in the order they arrive.
+type exportedFiles struct {
+	names    []string
+	contents map[string]string
+}
+
+func (f *exportedFiles) WriteFile(name string, _ int64, r io.Reader) error {
+	contents, err := io.ReadAll(r)
+	f.names = append(f.names, name)
+	f.contents[name] = string(contents)
+	return err
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli/iaas_clifakes"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -252,47 +254,6 @@ ethernet-0         VirtualE1000e                 internal-network
 		})
 	})
 
-	Context("ExportVM", func() {
-		var destinationDir string
-		BeforeEach(func() {
-			destinationDir = GinkgoT().TempDir() // automatically cleaned up
-		})
-
-		It("exports the VM to local machine from vcenter using vm inventory path", func() {
-			expectedArgs := []string{"export.ovf", "-u", credentialUrl, "-sha", "1", "-vm", "validVMPath", destinationDir}
-			runner.RunReturns(0)
-			err := vcenterClient.ExportVM("validVMPath", destinationDir)
-
-			Expect(err).To(Not(HaveOccurred()))
-			Expect(runner.RunCallCount()).To(Equal(1))
-
-			argsForRun := runner.RunArgsForCall(0)
-			Expect(argsForRun).To(Equal(expectedArgs))
-		})
-
-		It("Returns an error message if ExportVM fails to export the VM", func() {
-			vmInventoryPath := "validVMPath"
-			expectedArgs := []string{"export.ovf", "-u", credentialUrl, "-sha", "1", "-vm", vmInventoryPath, destinationDir}
-			runner.RunReturns(1)
-			err := vcenterClient.ExportVM("validVMPath", destinationDir)
-
-			expectedErrorMsg := fmt.Sprintf("vcenter_client - %s could not be exported", vmInventoryPath)
-			Expect(err).To(HaveOccurred())
-			Expect(runner.RunCallCount()).To(Equal(1))
-
-			argsForRun := runner.RunArgsForCall(0)
-			Expect(argsForRun).To(Equal(expectedArgs))
-			Expect(err.Error()).To(Equal(expectedErrorMsg))
-		})
-
-		It("prints an appropriate error message if the given directory doesn't exist", func() {
-			err := vcenterClient.ExportVM("validVMPath", "/FooBar/stuff")
-			Expect(err).To(HaveOccurred())
-
-			Expect(err.Error()).To(Equal("vcenter_client - provided destination directory: /FooBar/stuff does not exist"))
-		})
-	})
-
 	Describe("UploadArtifact", func() {
 		It("Uploads artifact to the given vm", func() {
 			runner.RunReturns(0)
@@ -341,7 +302,7 @@ ethernet-0         VirtualE1000e                 internal-network
 
 			Expect(err).To(Not(HaveOccurred()))
 			Expect(pid).To(Equal("1856"))
-			expectedArgs := []string{"guest.start", "-u", credentialUrl, "-l", "user:pass", "-vm", "validVMPath", "command", "arg1", "arg2", "arg3"}
+			expectedArgs := []string{iaas_cli.GuestStartCommand, "-u", credentialUrl, "-l", "user:pass", "-vm", "validVMPath", "command", "arg1", "arg2", "arg3"}
 			Expect(runner.RunWithOutputCallCount()).To(Equal(1))
 			Expect(runner.RunWithOutputArgsForCall(0)).To(Equal(expectedArgs))
 		})
@@ -358,6 +319,12 @@ ethernet-0         VirtualE1000e                 internal-network
 			Expect(err).To(HaveOccurred())
 			Expect(err).To(MatchError("vcenter_client - 'command2' returned exit code: 1"))
 		})
+		It("redacts a registered guest password from the error", func() {
+			colorlogger.RegisterSecret("start-guest-secret")
+			runner.RunWithOutputReturns("", 0, errors.New("cannot login as user:start-guest-secret"))
+			_, err := vcenterClient.Start("validVMPath", "user", "start-guest-secret", "command2")
+			Expect(err).To(MatchError("vcenter_client - failed to run 'command2': cannot login as user:[REDACTED]"))
+		})
 	})
 
 	Describe("WaitForExit", func() {
@@ -414,8 +381,8 @@ ethernet-0         VirtualE1000e                 internal-network
 
 	Describe("IsPoweredOff", func() {
 		It("Uses vm.info correctly to get power state", func() {
-			expectedArgs := []string{"vm.info", "-u", credentialUrl, "validVMPath"}
-			runner.RunWithOutputReturns("some result", 0, nil)
+			expectedArgs := []string{"vm.info", "-u", credentialUrl, "-json", "validVMPath"}
+			runner.RunWithOutputReturns(`{"virtualMachines":[{"runtime":{"powerState":"poweredOn"}}]}`, 0, nil)
 
 			_, err := vcenterClient.IsPoweredOff("validVMPath")
 			argsForRun := runner.RunWithOutputArgsForCall(0)
@@ -426,7 +393,7 @@ ethernet-0         VirtualE1000e                 internal-network
 
 		})
 		It("Gets the power state of the vm and returns false when vm is not powered off", func() {
-			runner.RunWithOutputReturns("Power state:  poweredOn", 0, nil)
+			runner.RunWithOutputReturns(`{"virtualMachines":[{"runtime":{"powerState":"poweredOn"}}]}`, 0, nil)
 			out, err := vcenterClient.IsPoweredOff("validVMPath")
 
 			Expect(out).To(BeFalse())
@@ -434,7 +401,7 @@ ethernet-0         VirtualE1000e                 internal-network
 			Expect(runner.RunWithOutputCallCount()).To(Equal(1))
 		})
 		It("Gets the power state of the vm and returns true when the vm is powered off", func() {
-			runner.RunWithOutputReturns("Power state:  poweredOff", 0, nil)
+			runner.RunWithOutputReturns(`{"virtualMachines":[{"runtime":{"powerState":"poweredOff"}}]}`, 0, nil)
 			out, err := vcenterClient.IsPoweredOff("validVMPath")
 
 			Expect(out).To(BeTrue())
@@ -442,6 +409,13 @@ ethernet-0         VirtualE1000e                 internal-network
 			Expect(runner.RunWithOutputCallCount()).To(Equal(1))
 		})
 
+		It("Returns an error if vm.info output cannot be parsed", func() {
+			runner.RunWithOutputReturns("Power state:  poweredOff", 0, nil)
+			_, err := vcenterClient.IsPoweredOff("validVMPath")
+
+			Expect(err).To(MatchError(ContainSubstring("vcenter_client - received bad JSON output for vm info")))
+		})
+
 		It("Returns an exit code error if the runner returns a non zero exit code", func() {
 			runner.RunWithOutputReturns("", 1, nil)
 			_, err := vcenterClient.IsPoweredOff("validVMPath")
@@ -49,6 +49,12 @@ func NewVCenterManager(govmomiClient GovmomiClient, vimClient *vim25.Client, fin
 	return &VCenterManager{govmomiClient: govmomiClient, vimClient: vimClient, finder: finder, username: username, password: password}, nil
 }
 
+// VimClient returns the vim25 client backing this manager so that other
+// clients can reuse its session instead of logging in again.
+func (v *VCenterManager) VimClient() *vim25.Client {
+	return v.vimClient
+}
+
 func (v *VCenterManager) Login(ctx context.Context) error {
 	credentials := url.UserPassword(v.username, v.password)
 	err := v.govmomiClient.Login(ctx, credentials)
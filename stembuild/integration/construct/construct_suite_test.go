@@ -1,6 +1,7 @@
 package construct_test
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -190,8 +191,8 @@ func revertSnapshot(vmIpath string, snapshotName string) {
 
 func waitForVmToBeReady(vmIp string, vmUsername string, vmPassword string) {
 	By("Waiting for reverting snapshot to finish...")
-	clientFactory := remotemanager.NewWinRmClientFactory(vmIp, vmUsername, vmPassword)
-	rm := remotemanager.NewWinRM(vmIp, vmUsername, vmPassword, clientFactory)
+	clientFactory := remotemanager.NewWinRmClientFactory(context.Background(), vmIp, vmUsername, vmPassword, remotemanager.WinRMOptions{})
+	rm := remotemanager.NewWinRM(context.Background(), vmIp, vmUsername, vmPassword, remotemanager.WinRMOptions{}, clientFactory)
 	Expect(rm).ToNot(BeNil())
 
 	start := time.Now()
@@ -201,7 +202,7 @@ func waitForVmToBeReady(vmIp string, vmUsername string, vmPassword string) {
 			Fail(fmt.Sprintf("VM at %s failed to start", vmIp))
 		}
 		time.Sleep(5 * time.Second)
-		_, err := rm.ExecuteCommand(`powershell.exe "ls c:\windows 1>$null"`)
+		_, err := rm.ExecuteCommand(`powershell.exe "ls c:\windows 1>$null"`, remotemanager.CommandOutput{})
 		if err != nil {
 			By(fmt.Sprintf("VM not yet ready: %v", err))
 		}
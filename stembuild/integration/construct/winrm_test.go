@@ -1,6 +1,7 @@
 package construct_test
 
 import (
+	"context"
 	"path/filepath"
 
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/remotemanager"
@@ -14,13 +15,13 @@ var _ = Describe("WinRM Remote Manager", func() {
 	var rm remotemanager.RemoteManager
 
 	BeforeEach(func() {
-		clientFactory := remotemanager.NewWinRmClientFactory(conf.TargetIP, conf.VMUsername, conf.VMPassword)
-		rm = remotemanager.NewWinRM(conf.TargetIP, conf.VMUsername, conf.VMPassword, clientFactory)
+		clientFactory := remotemanager.NewWinRmClientFactory(context.Background(), conf.TargetIP, conf.VMUsername, conf.VMPassword, remotemanager.WinRMOptions{})
+		rm = remotemanager.NewWinRM(context.Background(), conf.TargetIP, conf.VMUsername, conf.VMPassword, remotemanager.WinRMOptions{}, clientFactory)
 		Expect(rm).ToNot(BeNil())
 	})
 
 	AfterEach(func() {
-		_, err := rm.ExecuteCommand("powershell.exe Remove-Item c:\\provision -recurse")
+		_, err := rm.ExecuteCommand("powershell.exe Remove-Item c:\\provision -recurse", remotemanager.CommandOutput{})
 		Expect(err).ToNot(HaveOccurred())
 	})
 
@@ -31,12 +32,12 @@ var _ = Describe("WinRM Remote Manager", func() {
 		})
 
 		It("succeeds when Extract-Archive powershell function returns zero exit code", func() {
-			err := rm.ExtractArchive("C:\\provision\\StemcellAutomation.zip", "C:\\provision")
+			err := rm.ExtractArchive("C:\\provision\\StemcellAutomation.zip", "C:\\provision", remotemanager.CommandOutput{})
 			Expect(err).ToNot(HaveOccurred())
 		})
 
 		It("fails when Extract-Archive powershell function returns non-zero exit code", func() {
-			err := rm.ExtractArchive("C:\\provision\\NonExistingFile.zip", "C:\\provision")
+			err := rm.ExtractArchive("C:\\provision\\NonExistingFile.zip", "C:\\provision", remotemanager.CommandOutput{})
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("powershell encountered an issue: "))
 		})
@@ -44,12 +45,12 @@ var _ = Describe("WinRM Remote Manager", func() {
 
 	Context("ExecuteCommand", func() {
 		It("succeeds when powershell command returns a zero exit code", func() {
-			_, err := rm.ExecuteCommand("powershell.exe \"ls c:\\windows 1>$null\"")
+			_, err := rm.ExecuteCommand("powershell.exe \"ls c:\\windows 1>$null\"", remotemanager.CommandOutput{})
 			Expect(err).ToNot(HaveOccurred())
 		})
 
 		It("fails when powershell command returns non-zero exit code", func() {
-			_, err := rm.ExecuteCommand("powershell.exe notRealCommand")
+			_, err := rm.ExecuteCommand("powershell.exe notRealCommand", remotemanager.CommandOutput{})
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("powershell encountered an issue: "))
 		})
@@ -13,7 +13,9 @@ import (
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/assets"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/commandparser"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/construct"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/events"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli/iaas_clients/vcenter_manager"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/inspector"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/packager"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/version"
 )
@@ -35,10 +37,16 @@ func main() {
 	}
 
 	var gf commandparser.GlobalFlags
-	packageCmd := commandparser.NewPackageCommand(version.NewVersionGetter(), &packager.Factory{}, &commandparser.PackageMessenger{Output: os.Stderr})
+	packagerFactory := &packager.Factory{}
+	packageCmd := commandparser.NewPackageCommand(version.NewVersionGetter(), packagerFactory, &commandparser.PackageMessenger{Output: os.Stderr})
 	packageCmd.GlobalFlags = &gf
-	constructCmd := commandparser.NewConstructCmd(context.Background(), &construct.Factory{}, &vcenter_manager.ManagerFactory{}, &commandparser.ConstructValidator{}, &commandparser.ConstructCmdMessenger{OutputChannel: os.Stderr})
+	constructFactory := &construct.Factory{}
+	constructCmd := commandparser.NewConstructCmd(context.Background(), constructFactory, &vcenter_manager.ManagerFactory{}, &commandparser.ConstructValidator{}, &commandparser.ConstructCmdMessenger{OutputChannel: os.Stderr})
 	constructCmd.GlobalFlags = &gf
+	collectLogsCmd := commandparser.NewCollectLogsCmd(context.Background(), constructFactory, &vcenter_manager.ManagerFactory{}, &commandparser.ConstructValidator{}, os.Stdout, os.Stderr)
+	collectLogsCmd.GlobalFlags = &gf
+	inspectCmd := commandparser.NewInspectCmd(&inspector.Inspector{}, os.Stdout, os.Stderr)
+	inspectCmd.GlobalFlags = &gf
 
 	var commands = make([]subcommands.Command, 0)
 
@@ -47,6 +55,8 @@ func main() {
 	fs.BoolVar(&gf.Color, "color", false, "Colorize debug output")
 	fs.BoolVar(&gf.ShowVersion, "version", false, "Show Stembuild version")
 	fs.BoolVar(&gf.ShowVersion, "v", false, "Stembuild version (shorthand)")
+	gf.OutputFormat = commandparser.OutputFormatText
+	fs.Var(&gf.OutputFormat, "output-format", "Format of construct and package progress: text or json (one JSON event per line on stdout)")
 
 	commander := subcommands.NewCommander(fs, path.Base(os.Args[0]))
 
@@ -56,9 +66,13 @@ func main() {
 
 	commander.Register(packageCmd, "")
 	commander.Register(constructCmd, "")
+	commander.Register(collectLogsCmd, "")
+	commander.Register(inspectCmd, "")
 
 	commands = append(commands, packageCmd)
 	commands = append(commands, constructCmd)
+	commands = append(commands, collectLogsCmd)
+	commands = append(commands, inspectCmd)
 
 	// Override the default usage text of Google's Subcommand with our own
 	fs.Usage = func() { sh.Explain(commander.Error) }
@@ -70,6 +84,15 @@ func main() {
 		os.Exit(0)
 	}
 
+	if gf.OutputFormat == commandparser.OutputFormatJSON {
+		// stdout holds the event stream; the factories send everything else
+		// that would go to stdout, such as govc and WinRM command output, to
+		// stderr.
+		gf.Events = events.NewEmitter(os.Stdout)
+		constructFactory.Events = gf.Events
+		packagerFactory.Events = gf.Events
+	}
+
 	ctx := context.Background()
 	i := int(commander.Execute(ctx))
 	os.Remove(s) //nolint:errcheck
@@ -0,0 +1,97 @@
+// Package oscatalog lists the Windows versions stembuild builds stemcells for.
+// Supporting a new Windows release only takes another entry in the catalog.
+package oscatalog
+
+import "strings"
+
+// OS is a Windows version stemcells are built for.
+type OS struct {
+	// Name is how the OS is given throughout stembuild, such as 2019 or
+	// 2012R2.
+	Name string
+	// VersionCode is the major version of the stembuild releases for the OS,
+	// such as 2019, or 1200 for 2012R2.
+	VersionCode string
+	// DisplayName is what Microsoft calls the OS, such as Windows Server
+	// 2019.
+	DisplayName string
+	// GuestOS is the guestOS of the VMX of VMs running the OS.
+	GuestOS string
+	// OVFOSType is the vSphere guest ID of GuestOS, which OVF descriptors
+	// give as the osType of the VM.
+	OVFOSType string
+	// MinHWVersion is the lowest virtual hardware version that supports
+	// GuestOS.
+	MinHWVersion int
+	// StemcellSuffix follows the IaaS in the names of stemcells, as in
+	// bosh-vsphere-esxi-windows2019-go_agent, and is their operating system.
+	StemcellSuffix string
+}
+
+// Catalog is every OS stembuild supports, oldest first. The guest ID of
+// Windows Server 2022 was added in vSphere 7.0 U1, whose first virtual
+// hardware version is 18.
+var Catalog = []OS{
+	{Name: "2012R2", VersionCode: "1200", DisplayName: "Windows Server 2012 R2", GuestOS: "windows8srv-64", OVFOSType: "windows8Server64Guest", MinHWVersion: 9, StemcellSuffix: "windows2012R2"},
+	{Name: "2016", VersionCode: "2016", DisplayName: "Windows Server 2016", GuestOS: "windows8srv-64", OVFOSType: "windows8Server64Guest", MinHWVersion: 10, StemcellSuffix: "windows2016"},
+	{Name: "1803", VersionCode: "1803", DisplayName: "Windows Server, version 1803", GuestOS: "windows8srv-64", OVFOSType: "windows8Server64Guest", MinHWVersion: 10, StemcellSuffix: "windows1803"},
+	{Name: "2019", VersionCode: "2019", DisplayName: "Windows Server 2019", GuestOS: "windows8srv-64", OVFOSType: "windows8Server64Guest", MinHWVersion: 10, StemcellSuffix: "windows2019"},
+	{Name: "2022", VersionCode: "2022", DisplayName: "Windows Server 2022", GuestOS: "windows2019srvnext-64", OVFOSType: "windows2019srvNext_64Guest", MinHWVersion: 18, StemcellSuffix: "windows2022"},
+}
+
+// Lookup returns the OS with the given name, ignoring case.
+func Lookup(name string) (OS, bool) {
+	for _, os := range Catalog {
+		if strings.EqualFold(os.Name, name) {
+			return os, true
+		}
+	}
+
+	return OS{}, false
+}
+
+// ByVersionCode returns the OS that stembuild releases with the given major
+// version are for.
+func ByVersionCode(code string) (OS, bool) {
+	for _, os := range Catalog {
+		if os.VersionCode == code {
+			return os, true
+		}
+	}
+
+	return OS{}, false
+}
+
+// ByGuestOS returns the first OS whose VMs have the given VMX guestOS,
+// ignoring case.
+func ByGuestOS(guestOS string) (OS, bool) {
+	for _, os := range Catalog {
+		if strings.EqualFold(os.GuestOS, guestOS) {
+			return os, true
+		}
+	}
+
+	return OS{}, false
+}
+
+// ByStemcellSuffix returns the OS that is the operating system of stemcells
+// named with the given suffix, such as windows2019.
+func ByStemcellSuffix(suffix string) (OS, bool) {
+	for _, os := range Catalog {
+		if os.StemcellSuffix == suffix {
+			return os, true
+		}
+	}
+
+	return OS{}, false
+}
+
+// Names returns the names of the OSes in the catalog.
+func Names() []string {
+	names := make([]string, len(Catalog))
+	for i, os := range Catalog {
+		names[i] = os.Name
+	}
+
+	return names
+}
@@ -0,0 +1,13 @@
+package oscatalog_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestOSCatalog(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "OS Catalog Suite")
+}
@@ -0,0 +1,111 @@
+package oscatalog_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/oscatalog"
+)
+
+var _ = Describe("OS catalog", func() {
+	It("describes every OS completely and once", func() {
+		names := map[string]bool{}
+		codes := map[string]bool{}
+		osTypes := map[string]string{}
+		for _, os := range oscatalog.Catalog {
+			Expect(os.Name).NotTo(BeEmpty())
+			Expect(os.VersionCode).NotTo(BeEmpty(), os.Name)
+			Expect(os.DisplayName).To(HavePrefix("Windows Server"), os.Name)
+			Expect(os.GuestOS).NotTo(BeEmpty(), os.Name)
+			Expect(os.OVFOSType).NotTo(BeEmpty(), os.Name)
+			Expect(os.MinHWVersion).To(BeNumerically(">", 0), os.Name)
+			Expect(os.StemcellSuffix).To(HavePrefix("windows"), os.Name)
+
+			Expect(names).NotTo(HaveKey(os.Name))
+			Expect(codes).NotTo(HaveKey(os.VersionCode))
+			names[os.Name] = true
+			codes[os.VersionCode] = true
+
+			// OSes with the same guest OS have the same vSphere guest ID.
+			if osType, ok := osTypes[os.GuestOS]; ok {
+				Expect(os.OVFOSType).To(Equal(osType), os.Name)
+			}
+			osTypes[os.GuestOS] = os.OVFOSType
+		}
+	})
+
+	Describe("Lookup", func() {
+		It("finds an OS by name, ignoring case", func() {
+			os, ok := oscatalog.Lookup("2012r2")
+			Expect(ok).To(BeTrue())
+			Expect(os.Name).To(Equal("2012R2"))
+			Expect(os.GuestOS).To(Equal("windows8srv-64"))
+			Expect(os.MinHWVersion).To(Equal(9))
+			Expect(os.StemcellSuffix).To(Equal("windows2012R2"))
+		})
+
+		It("finds Windows Server 2022", func() {
+			os, ok := oscatalog.Lookup("2022")
+			Expect(ok).To(BeTrue())
+			Expect(os.DisplayName).To(Equal("Windows Server 2022"))
+			Expect(os.GuestOS).To(Equal("windows2019srvnext-64"))
+			Expect(os.OVFOSType).To(Equal("windows2019srvNext_64Guest"))
+			Expect(os.MinHWVersion).To(Equal(18))
+		})
+
+		It("keeps the guest OS of the VMX stembuild has always written for 2019", func() {
+			os, ok := oscatalog.Lookup("2019")
+			Expect(ok).To(BeTrue())
+			Expect(os.GuestOS).To(Equal("windows8srv-64"))
+			Expect(os.MinHWVersion).To(Equal(10))
+		})
+
+		It("does not find an OS that is not in the catalog", func() {
+			_, ok := oscatalog.Lookup("1709")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("ByVersionCode", func() {
+		It("finds the OS of a stembuild release", func() {
+			os, ok := oscatalog.ByVersionCode("1200")
+			Expect(ok).To(BeTrue())
+			Expect(os.Name).To(Equal("2012R2"))
+		})
+
+		It("does not find an unknown version code", func() {
+			_, ok := oscatalog.ByVersionCode("dev")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("ByGuestOS", func() {
+		It("finds an OS by the guest OS of its VMX, ignoring case", func() {
+			os, ok := oscatalog.ByGuestOS("Windows2019srvNext-64")
+			Expect(ok).To(BeTrue())
+			Expect(os.OVFOSType).To(Equal("windows2019srvNext_64Guest"))
+		})
+
+		It("does not find an unknown guest OS", func() {
+			_, ok := oscatalog.ByGuestOS("other-64")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("ByStemcellSuffix", func() {
+		It("finds the operating system of a stemcell", func() {
+			os, ok := oscatalog.ByStemcellSuffix("windows2012R2")
+			Expect(ok).To(BeTrue())
+			Expect(os.DisplayName).To(Equal("Windows Server 2012 R2"))
+		})
+
+		It("does not find an unknown operating system", func() {
+			_, ok := oscatalog.ByStemcellSuffix("ubuntu-jammy")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	It("lists the names of the OSes", func() {
+		Expect(oscatalog.Names()).To(Equal([]string{"2012R2", "2016", "1803", "2019", "2022"}))
+	})
+})
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CloudProperties are added to the cloud_properties of stemcell.MF, replacing
+// those stembuild sets itself. As a flag, each -cloud-property key=value sets
+// one of them: true, false and whole numbers are recorded as such, anything
+// else as a string.
+type CloudProperties map[string]interface{}
+
+func (c *CloudProperties) String() string {
+	if c == nil {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(*c))
+	for key, value := range *c {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", key, value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (c *CloudProperties) Set(pair string) error {
+	key, value, found := strings.Cut(pair, "=")
+	key = strings.TrimSpace(key)
+	if !found || key == "" {
+		return fmt.Errorf("cloud property must be key=value, got %q", pair)
+	}
+	if *c == nil {
+		*c = CloudProperties{}
+	}
+	if _, ok := (*c)[key]; ok {
+		return fmt.Errorf("cloud property %q is given more than once", key)
+	}
+
+	(*c)[key] = parseCloudProperty(value)
+	return nil
+}
+
+func parseCloudProperty(value string) interface{} {
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if i, err := strconv.Atoi(value); err == nil {
+		return i
+	}
+
+	return value
+}
@@ -0,0 +1,46 @@
+package config_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/config"
+)
+
+var _ = Describe("CloudProperties", func() {
+	var cloudProperties config.CloudProperties
+
+	BeforeEach(func() {
+		cloudProperties = nil
+	})
+
+	It("sets a property for each key=value", func() {
+		Expect(cloudProperties.Set("boot_mode=uefi")).To(Succeed())
+		Expect(cloudProperties.Set("encrypted=false")).To(Succeed())
+		Expect(cloudProperties.Set("root_disk_size_gb=40")).To(Succeed())
+		Expect(cloudProperties.Set("tags=a=b")).To(Succeed())
+
+		Expect(cloudProperties).To(Equal(config.CloudProperties{
+			"boot_mode":         "uefi",
+			"encrypted":         false,
+			"root_disk_size_gb": 40,
+			"tags":              "a=b",
+		}))
+		Expect(cloudProperties.String()).To(Equal("boot_mode=uefi,encrypted=false,root_disk_size_gb=40,tags=a=b"))
+	})
+
+	It("keeps a value that only looks like a number a string", func() {
+		Expect(cloudProperties.Set("version=2019.10")).To(Succeed())
+		Expect(cloudProperties).To(HaveKeyWithValue("version", "2019.10"))
+	})
+
+	It("rejects a property without a key", func() {
+		Expect(cloudProperties.Set("uefi")).To(MatchError(`cloud property must be key=value, got "uefi"`))
+		Expect(cloudProperties.Set("=uefi")).To(MatchError(`cloud property must be key=value, got "=uefi"`))
+	})
+
+	It("rejects a property given twice", func() {
+		Expect(cloudProperties.Set("boot_mode=uefi")).To(Succeed())
+		Expect(cloudProperties.Set("boot_mode=bios")).To(MatchError(`cloud property "boot_mode" is given more than once`))
+	})
+})
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/oscatalog"
+)
+
+// The IaaSes stemcells are packaged for. vSphere stemcells hold the image of
+// the VM; the others are light stemcells, which reference an image already
+// published to the IaaS.
+const (
+	IaaSvSphere = "vsphere"
+	IaaSAWS     = "aws"
+	IaaSAzure   = "azure"
+	IaaSGCP     = "gcp"
+)
+
+// infrastructures are the IaaS and hypervisor in the names of stemcells.
+var infrastructures = map[string]string{
+	IaaSvSphere: "vsphere-esxi",
+	IaaSAWS:     "aws-xen-hvm",
+	IaaSAzure:   "azure-hyperv",
+	IaaSGCP:     "google-kvm",
+}
+
+// IsValidLightIaaS reports whether light stemcells can be packaged for iaas.
+func IsValidLightIaaS(iaas string) bool {
+	switch iaas {
+	case IaaSAWS, IaaSAzure, IaaSGCP:
+		return true
+	default:
+		return false
+	}
+}
+
+// OperatingSystem is the operating system of stemcells for os, which ends
+// their names, such as windows2019.
+func OperatingSystem(os string) string {
+	if known, ok := oscatalog.Lookup(os); ok {
+		return known.StemcellSuffix
+	}
+
+	return "windows" + os
+}
+
+// StemcellName is the name of a stemcell in its stemcell.MF, such as
+// bosh-vsphere-esxi-windows2019-go_agent.
+func StemcellName(iaas, os string) string {
+	return fmt.Sprintf("bosh-%s-%s-go_agent", infrastructures[iaas], OperatingSystem(os))
+}
+
+// StemcellFilename is the name stemcells are published under, with the
+// "light-" prefix of light stemcells.
+func StemcellFilename(version, os, iaas string, light bool) string {
+	prefix := ""
+	if light {
+		prefix = "light-"
+	}
+
+	return fmt.Sprintf("%sbosh-stemcell-%s-%s-%s-go_agent.tgz", prefix, version, infrastructures[iaas], OperatingSystem(os))
+}
@@ -1,16 +1,80 @@
 package config
 
 import (
+	"compress/gzip"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/digest"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/oscatalog"
+)
+
+// DefaultCompressionLevel is the gzip level used for stemcells unless
+// -compression-level is given.
+const DefaultCompressionLevel = gzip.DefaultCompression
+
+// SourceDateEpochEnvVar sets the modification time of the files in
+// reproducible stemcells, in seconds since the Unix epoch.
+// See https://reproducible-builds.org/specs/source-date-epoch/
+const SourceDateEpochEnvVar = "SOURCE_DATE_EPOCH"
+
+// The ways OVAs are built from VMDKs: with VMware's ovftool, or natively
+// without it.
+const (
+	OVABuilderOvftool = "ovftool"
+	OVABuilderNative  = "native"
 )
 
 type OutputConfig struct {
-	Os              string
-	StemcellVersion string
-	OutputDir       string
+	Os              string `yaml:"-"`
+	StemcellVersion string `yaml:"-"`
+	OutputDir       string `yaml:"output_dir"`
+	// CompressionLevel is a compress/gzip level, and CompressionThreads the
+	// number of blocks compressed in parallel; 0 uses one thread per CPU.
+	CompressionLevel   int `yaml:"compression_level"`
+	CompressionThreads int `yaml:"compression_threads"`
+	// DigestAlgorithms are the checksums recorded for the image in
+	// stemcell.MF; the strongest of them is also used for the OVF manifest.
+	DigestAlgorithms digest.Algorithms `yaml:"digest_algorithms"`
+	// Reproducible stemcells are byte-identical for identical inputs.
+	Reproducible bool `yaml:"reproducible"`
+	// OVABuilder builds the OVA of stemcells made from a VMDK, ovftool if
+	// not set.
+	OVABuilder string `yaml:"ova_builder"`
+	// Light stemcells reference an image published to the IaaS instead of
+	// holding one. IaaS is vSphere if not set, which has no light stemcells.
+	Light bool   `yaml:"light"`
+	IaaS  string `yaml:"iaas"`
+	// CloudProperties are added to those stembuild puts in stemcell.MF.
+	CloudProperties CloudProperties `yaml:"cloud_properties"`
+}
+
+// Infrastructure returns the IaaS the stemcell is for.
+func (c OutputConfig) Infrastructure() string {
+	if c.IaaS == "" {
+		return IaaSvSphere
+	}
+
+	return c.IaaS
+}
+
+// StemcellFilename returns the name of the stemcell file.
+func (c OutputConfig) StemcellFilename() string {
+	return StemcellFilename(c.StemcellVersion, c.Os, c.Infrastructure(), c.Light)
+}
+
+// Digests returns the algorithms to checksum the stemcell with, sha1 unless
+// others were asked for.
+func (c OutputConfig) Digests() digest.Algorithms {
+	if len(c.DigestAlgorithms) == 0 {
+		return digest.Default
+	}
+
+	return c.DigestAlgorithms
 }
 
 func (c OutputConfig) ValidateConfig() error {
@@ -24,6 +88,35 @@ func (c OutputConfig) ValidateConfig() error {
 		)
 	}
 
+	if !IsValidCompressionLevel(c.CompressionLevel) {
+		return fmt.Errorf("compression level must be between %d and %d, got %d", gzip.HuffmanOnly, gzip.BestCompression, c.CompressionLevel)
+	}
+
+	if c.CompressionThreads < 0 {
+		return fmt.Errorf("compression threads must be 0 or more, got %d", c.CompressionThreads)
+	}
+
+	if err := c.Digests().Validate(); err != nil {
+		return err
+	}
+
+	if !IsValidOVABuilder(c.OVABuilder) {
+		return fmt.Errorf("OVA builder must be %s or %s, got %q", OVABuilderOvftool, OVABuilderNative, c.OVABuilder)
+	}
+
+	if c.Light && !IsValidLightIaaS(c.IaaS) {
+		return fmt.Errorf("light stemcells are for IaaS %s, %s or %s, got %q", IaaSAWS, IaaSAzure, IaaSGCP, c.IaaS)
+	}
+	if !c.Light && c.Infrastructure() != IaaSvSphere {
+		return fmt.Errorf("stemcells for %s must be light stemcells", c.IaaS)
+	}
+
+	if c.Reproducible {
+		if _, err := SourceDateEpoch(); err != nil {
+			return err
+		}
+	}
+
 	if c.OutputDir == "" || c.OutputDir == "." {
 		cwd, err := os.Getwd()
 		if err != nil {
@@ -34,7 +127,7 @@ func (c OutputConfig) ValidateConfig() error {
 		return err
 	}
 
-	name := filepath.Join(c.OutputDir, stemcellFilename(c.StemcellVersion, c.Os))
+	name := filepath.Join(c.OutputDir, c.StemcellFilename())
 	if _, err := os.Stat(name); !os.IsNotExist(err) {
 		return fmt.Errorf("error with output file (%s): %v (file may already exist)", name, err) //nolint:staticcheck
 	}
@@ -42,15 +135,42 @@ func (c OutputConfig) ValidateConfig() error {
 	return nil
 }
 
-func IsValidOS(os string) bool {
-	switch os {
-	case "2012R2", "1803", "2016", "2019", "2022":
+// SourceDateEpoch returns the modification time for the files in reproducible
+// stemcells: $SOURCE_DATE_EPOCH, or the Unix epoch if it is not set.
+func SourceDateEpoch() (time.Time, error) {
+	value := os.Getenv(SourceDateEpochEnvVar)
+	if value == "" {
+		return time.Unix(0, 0).UTC(), nil
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return time.Time{}, fmt.Errorf("%s must be a whole number of seconds since 1970-01-01, got %q", SourceDateEpochEnvVar, value)
+	}
+
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// IsValidCompressionLevel reports whether level is one of the compress/gzip
+// levels, from -2 (Huffman only) and -1 (default) to 9 (best compression).
+func IsValidCompressionLevel(level int) bool {
+	return level >= gzip.HuffmanOnly && level <= gzip.BestCompression
+}
+
+func IsValidOVABuilder(builder string) bool {
+	switch builder {
+	case "", OVABuilderOvftool, OVABuilderNative:
 		return true
 	default:
 		return false
 	}
 }
 
+func IsValidOS(os string) bool {
+	_, ok := oscatalog.Lookup(os)
+	return ok
+}
+
 func ValidateOrCreateOutputDir(outputDir string) error {
 
 	fi, err := os.Stat(outputDir)
@@ -89,8 +209,3 @@ func IsValidStemcellVersion(version string) bool {
 
 	return false
 }
-
-func stemcellFilename(version, os string) string {
-	return fmt.Sprintf("bosh-stemcell-%s-vsphere-esxi-windows%s-go_agent.tgz",
-		version, os)
-}
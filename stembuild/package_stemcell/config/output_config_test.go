@@ -3,7 +3,9 @@ package config_test
 import (
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/digest"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/config"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -39,6 +41,11 @@ var _ = Describe("OutputConfig", func() {
 				valid := config.IsValidOS("2019")
 				Expect(valid).To(BeTrue())
 			})
+
+			It("2022 should be valid", func() {
+				valid := config.IsValidOS("2022")
+				Expect(valid).To(BeTrue())
+			})
 		})
 
 		Context("something other than a supported os is specified", func() {
@@ -80,6 +87,81 @@ var _ = Describe("OutputConfig", func() {
 		})
 	})
 
+	Describe("compression level", func() {
+		It("accepts the compress/gzip levels", func() {
+			for level := -2; level <= 9; level++ {
+				Expect(config.IsValidCompressionLevel(level)).To(BeTrue(), "level %d", level)
+			}
+		})
+
+		It("rejects levels outside of them", func() {
+			Expect(config.IsValidCompressionLevel(-3)).To(BeFalse())
+			Expect(config.IsValidCompressionLevel(10)).To(BeFalse())
+		})
+
+		It("is reported by ValidateConfig", func() {
+			c := config.OutputConfig{Os: "2019", StemcellVersion: "1.2", OutputDir: GinkgoT().TempDir(), CompressionLevel: 10}
+			Expect(c.ValidateConfig()).To(MatchError("compression level must be between -2 and 9, got 10"))
+		})
+
+		It("rejects a negative number of compression threads", func() {
+			c := config.OutputConfig{Os: "2019", StemcellVersion: "1.2", OutputDir: GinkgoT().TempDir(), CompressionThreads: -1}
+			Expect(c.ValidateConfig()).To(MatchError("compression threads must be 0 or more, got -1"))
+		})
+
+		It("rejects an unsupported digest algorithm", func() {
+			c := config.OutputConfig{Os: "2019", StemcellVersion: "1.2", OutputDir: GinkgoT().TempDir(), DigestAlgorithms: digest.Algorithms{"md5"}}
+			Expect(c.ValidateConfig()).To(MatchError(ContainSubstring(`unsupported digest algorithm "md5"`)))
+		})
+
+		It("rejects an unknown OVA builder", func() {
+			c := config.OutputConfig{Os: "2019", StemcellVersion: "1.2", OutputDir: GinkgoT().TempDir(), OVABuilder: "qemu-img"}
+			Expect(c.ValidateConfig()).To(MatchError(`OVA builder must be ovftool or native, got "qemu-img"`))
+
+			c.OVABuilder = config.OVABuilderNative
+			Expect(c.ValidateConfig()).To(Succeed())
+		})
+
+		It("rejects a light stemcell for an IaaS without them", func() {
+			c := config.OutputConfig{Os: "2019", StemcellVersion: "1.2", OutputDir: GinkgoT().TempDir(), Light: true, IaaS: config.IaaSvSphere}
+			Expect(c.ValidateConfig()).To(MatchError(`light stemcells are for IaaS aws, azure or gcp, got "vsphere"`))
+
+			c.IaaS = config.IaaSAzure
+			Expect(c.ValidateConfig()).To(Succeed())
+		})
+
+		It("rejects a stemcell for a public cloud that is not light", func() {
+			c := config.OutputConfig{Os: "2019", StemcellVersion: "1.2", OutputDir: GinkgoT().TempDir(), IaaS: config.IaaSGCP}
+			Expect(c.ValidateConfig()).To(MatchError("stemcells for gcp must be light stemcells"))
+		})
+
+		It("rejects an invalid SOURCE_DATE_EPOCH for reproducible stemcells", func() {
+			GinkgoT().Setenv("SOURCE_DATE_EPOCH", "yesterday")
+			c := config.OutputConfig{Os: "2019", StemcellVersion: "1.2", OutputDir: GinkgoT().TempDir(), Reproducible: true}
+			Expect(c.ValidateConfig()).To(MatchError(`SOURCE_DATE_EPOCH must be a whole number of seconds since 1970-01-01, got "yesterday"`))
+
+			c.Reproducible = false
+			Expect(c.ValidateConfig()).To(Succeed())
+		})
+
+		It("checksums with sha1 unless other digest algorithms are given", func() {
+			Expect(config.OutputConfig{}.Digests()).To(Equal(digest.Algorithms{digest.SHA1}))
+			Expect(config.OutputConfig{DigestAlgorithms: digest.Algorithms{digest.SHA256}}.Digests()).To(Equal(digest.Algorithms{digest.SHA256}))
+		})
+	})
+
+	Describe("SourceDateEpoch", func() {
+		It("is the time given in SOURCE_DATE_EPOCH", func() {
+			GinkgoT().Setenv("SOURCE_DATE_EPOCH", "1700000000")
+			Expect(config.SourceDateEpoch()).To(Equal(time.Unix(1700000000, 0).UTC()))
+		})
+
+		It("is the Unix epoch when SOURCE_DATE_EPOCH is not set", func() {
+			GinkgoT().Setenv("SOURCE_DATE_EPOCH", "")
+			Expect(config.SourceDateEpoch()).To(Equal(time.Unix(0, 0).UTC()))
+		})
+	})
+
 	Describe("validateOutputDir", func() {
 		var outputDir string
 
@@ -166,4 +248,19 @@ var _ = Describe("OutputConfig", func() {
 			})
 		})
 	})
+
+	Describe("StemcellFilename", func() {
+		It("names stemcells after their IaaS", func() {
+			c := config.OutputConfig{Os: "2019", StemcellVersion: "2019.12"}
+			Expect(c.StemcellFilename()).To(Equal("bosh-stemcell-2019.12-vsphere-esxi-windows2019-go_agent.tgz"))
+
+			c.Light = true
+			c.IaaS = config.IaaSAWS
+			Expect(c.StemcellFilename()).To(Equal("light-bosh-stemcell-2019.12-aws-xen-hvm-windows2019-go_agent.tgz"))
+			c.IaaS = config.IaaSAzure
+			Expect(c.StemcellFilename()).To(Equal("light-bosh-stemcell-2019.12-azure-hyperv-windows2019-go_agent.tgz"))
+			c.IaaS = config.IaaSGCP
+			Expect(c.StemcellFilename()).To(Equal("light-bosh-stemcell-2019.12-google-kvm-windows2019-go_agent.tgz"))
+		})
+	})
 })
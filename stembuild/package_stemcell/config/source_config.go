@@ -5,12 +5,17 @@ import (
 )
 
 type SourceConfig struct {
-	Vmdk            string
-	URL             string
-	Username        string
-	Password        string
-	VmInventoryPath string
-	CaCertFile      string
+	Vmdk            string `yaml:"vmdk"`
+	URL             string `yaml:"vcenter_url"`
+	Username        string `yaml:"vcenter_username"`
+	Password        string `yaml:"vcenter_password"`
+	VmInventoryPath string `yaml:"vm_inventory_path"`
+	CaCertFile      string `yaml:"vcenter_ca_certs"`
+	// VCenterClient is how to talk to vCenter, with govc unless it is
+	// iaas_clients.VCenterClientGovmomi.
+	VCenterClient string `yaml:"vcenter_client"`
+	// ImageRef is the published image that a light stemcell references.
+	ImageRef string `yaml:"image_ref"`
 }
 
 type Source int
@@ -18,10 +23,18 @@ type Source int
 const (
 	VMDK Source = iota
 	VCENTER
+	IMAGE
 	NIL
 )
 
 func (c SourceConfig) GetSource() (Source, error) {
+	if c.imageRefProvided() {
+		if c.vmdkProvided() || c.partialvCenterProvided() {
+			return NIL, errors.New("configuration provided for an image reference & a VMDK or vCenter source")
+		}
+		return IMAGE, nil
+	}
+
 	if c.vmdkProvided() && c.partialvCenterProvided() {
 		return NIL, errors.New("configuration provided for VMDK & vCenter sources")
 	}
@@ -45,6 +58,10 @@ func (c SourceConfig) vmdkProvided() bool {
 	return c.Vmdk != ""
 }
 
+func (c SourceConfig) imageRefProvided() bool {
+	return c.ImageRef != ""
+}
+
 func (c SourceConfig) vcenterProvided() bool {
 	if c.VmInventoryPath != "" && c.Username != "" && c.Password != "" && c.URL != "" {
 		return true
@@ -52,6 +52,25 @@ var _ = Describe("SourceConfig", func() {
 
 		})
 
+		It("returns no error when only an image reference is given", func() {
+			srcConfig := config.SourceConfig{
+				ImageRef: "us-east-1:ami-0123456789abcdef0",
+			}
+			source, err := srcConfig.GetSource()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(source).To(Equal(config.IMAGE))
+		})
+
+		It("returns an error when an image reference and a VMDK are given", func() {
+			srcConfig := config.SourceConfig{
+				Vmdk:     "/some/path/to/a/file",
+				ImageRef: "us-east-1:ami-0123456789abcdef0",
+			}
+			source, err := srcConfig.GetSource()
+			Expect(err).To(MatchError("configuration provided for an image reference & a VMDK or vCenter source"))
+			Expect(source).To(Equal(config.NIL))
+		})
+
 		It("returns an error when Vcenter configurations only partially specified", func() {
 			srcConfig := config.SourceConfig{
 				VmInventoryPath: "/my-datacenter/vm/my-folder/my-vm",
@@ -1,8 +1,19 @@
 package config
 
+import "github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/digest"
+
 type VmdkOptions struct {
 	OSVersion string `yaml:"os_version"`
 	OutputDir string `yaml:"output_dir"`
 	Version   string `yaml:"version"`
 	VMDKFile  string `yaml:"vmdk_file"`
+
+	CompressionLevel   int `yaml:"compression_level"`
+	CompressionThreads int `yaml:"compression_threads"`
+
+	DigestAlgorithms digest.Algorithms `yaml:"digest_algorithms"`
+
+	OVABuilder string `yaml:"ova_builder"`
+
+	CloudProperties CloudProperties `yaml:"cloud_properties"`
 }
@@ -0,0 +1,218 @@
+package inspector
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/digest"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/manifest"
+)
+
+const (
+	manifestName = "stemcell.MF"
+	imageName    = "image"
+)
+
+// Member is a file found inside the stemcell image.
+type Member struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+}
+
+// Report is the result of inspecting a stemcell tarball. Sha1Verified is true
+// when every digest in the sha1 field of the manifest that inspect can compute
+// matches the image, and there is at least one.
+type Report struct {
+	Path         string                    `json:"path"`
+	Manifest     manifest.StemcellManifest `json:"manifest"`
+	ImageSha1    string                    `json:"image_sha1"`
+	ImageSha256  string                    `json:"image_sha256"`
+	Sha1Verified bool                      `json:"sha1_verified"`
+	ImageMembers []Member                  `json:"image_members"`
+}
+
+// ImageDigest returns the digests of the image in the format of the manifest:
+// a bare sha1, or a multi-digest if the manifest has one.
+func (r Report) ImageDigest() string {
+	if !strings.Contains(r.Manifest.SHA1, ":") {
+		return r.ImageSha1
+	}
+
+	return digest.Digests{{Algorithm: digest.SHA1, Sum: r.ImageSha1}, {Algorithm: digest.SHA256, Sum: r.ImageSha256}}.String()
+}
+
+type Inspector struct{}
+
+// Inspect opens a stemcell tarball as produced by `stembuild package`, parses
+// its stemcell.MF, checks the manifest sha1 against the embedded image and
+// lists the files inside the image.
+func (i *Inspector) Inspect(stemcellPath string) (Report, error) {
+	report := Report{Path: stemcellPath}
+
+	f, err := os.Open(stemcellPath)
+	if err != nil {
+		return report, fmt.Errorf("unable to open stemcell %s: %s", stemcellPath, err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		return report, fmt.Errorf("stemcell %s is not a gzip compressed tarball: %s", stemcellPath, err)
+	}
+	defer gzr.Close() //nolint:errcheck
+
+	foundManifest, foundImage := false, false
+	tr := tar.NewReader(gzr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("unable to read stemcell %s: %s", stemcellPath, err)
+		}
+
+		switch path.Clean(header.Name) {
+		case manifestName:
+			foundManifest = true
+			report.Manifest, err = parseManifest(tr)
+		case imageName:
+			foundImage = true
+			var image digest.Digests
+			image, report.ImageMembers, err = readImage(tr)
+			report.ImageSha1, _ = image.Get(digest.SHA1)
+			report.ImageSha256, _ = image.Get(digest.SHA256)
+		}
+		if err != nil {
+			return report, err
+		}
+	}
+
+	if !foundManifest {
+		return report, fmt.Errorf("stemcell %s does not contain %s", stemcellPath, manifestName)
+	}
+	if !foundImage {
+		return report, fmt.Errorf("stemcell %s does not contain an %s", stemcellPath, imageName)
+	}
+
+	report.Sha1Verified = verify(report.Manifest.SHA1, digest.Digests{
+		{Algorithm: digest.SHA1, Sum: report.ImageSha1},
+		{Algorithm: digest.SHA256, Sum: report.ImageSha256},
+	})
+
+	return report, nil
+}
+
+// verify reports whether the digests in manifestDigest match those of the
+// image. Algorithms that were not computed for the image are ignored, but at
+// least one digest has to match.
+func verify(manifestDigest string, image digest.Digests) bool {
+	expected, err := digest.Parse(manifestDigest)
+	if err != nil {
+		return false
+	}
+
+	matched := false
+	for _, d := range expected {
+		sum, found := image.Get(d.Algorithm)
+		if !found {
+			continue
+		}
+		if sum != d.Sum {
+			return false
+		}
+		matched = true
+	}
+
+	return matched
+}
+
+func parseManifest(r io.Reader) (manifest.StemcellManifest, error) {
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return manifest.StemcellManifest{}, fmt.Errorf("unable to read %s: %s", manifestName, err)
+	}
+
+	m, err := manifest.Unmarshal(contents)
+	if err != nil {
+		return m, fmt.Errorf("unable to parse %s: %s", manifestName, err)
+	}
+
+	return m, nil
+}
+
+// readImage computes the sha1 and sha256 of the (compressed) image while
+// listing the members of the tarball it contains. The image of a light
+// stemcell is empty, and has no members.
+func readImage(r io.Reader) (digest.Digests, []Member, error) {
+	h := digest.NewHash(digest.Algorithms{digest.SHA1, digest.SHA256})
+	image := bufio.NewReader(io.TeeReader(r, h))
+
+	var members []Member
+	_, err := image.Peek(1)
+	if !errors.Is(err, io.EOF) {
+		members, err = listMembers(image)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	_, err = io.Copy(io.Discard, image)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read %s: %s", imageName, err)
+	}
+
+	return h.Digests(), members, nil
+}
+
+func listMembers(r io.Reader) ([]Member, error) {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not gzip compressed: %s", imageName, err)
+	}
+	defer gzr.Close() //nolint:errcheck
+
+	var members []Member
+	tr := tar.NewReader(gzr)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to list files in %s: %s", imageName, err)
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		members = append(members, Member{
+			Name: header.Name,
+			Type: memberType(header.Name),
+			Size: header.Size,
+		})
+	}
+
+	return members, nil
+}
+
+func memberType(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".ovf":
+		return "ovf"
+	case ".vmdk":
+		return "vmdk"
+	case ".mf":
+		return "manifest"
+	default:
+		return "other"
+	}
+}
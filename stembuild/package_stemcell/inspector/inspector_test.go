@@ -0,0 +1,207 @@
+package inspector_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/config"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/inspector"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/packager"
+)
+
+func sha256File(path string) string {
+	contents, err := os.ReadFile(path)
+	Expect(err).NotTo(HaveOccurred())
+	return fmt.Sprintf("%x", sha256.Sum256(contents))
+}
+
+var _ = Describe("Inspector", func() {
+	var (
+		workDir     string
+		stemcellDir string
+		stemcell    string
+		imageSha1   string
+	)
+
+	BeforeEach(func() {
+		workDir = GinkgoT().TempDir()
+
+		vmDir := filepath.Join(workDir, "my-vm")
+		Expect(os.Mkdir(vmDir, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(vmDir, "my-vm.ovf"), []byte("<Envelope/>"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(vmDir, "my-vm-disk1.vmdk"), []byte("KDMV disk contents"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(vmDir, "my-vm.mf"), []byte("SHA1(my-vm.ovf)= abc\n"), 0644)).To(Succeed())
+
+		stemcellDir = filepath.Join(workDir, "stemcell")
+		Expect(os.Mkdir(stemcellDir, 0755)).To(Succeed())
+
+		var err error
+		imageSha1, err = packager.TarGenerator(filepath.Join(stemcellDir, "image"), vmDir, packager.Entries{})
+		Expect(err).NotTo(HaveOccurred())
+
+		stemcell = filepath.Join(workDir, packager.StemcellFilename("2019.7", "2019"))
+	})
+
+	writeStemcell := func(sha1 string) {
+		manifest, err := packager.CreateManifest("2019", "2019.7", sha1).Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(packager.WriteManifest(string(manifest), stemcellDir)).To(Succeed())
+		_, err = packager.TarGenerator(stemcell, stemcellDir, packager.Entries{})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	It("parses the manifest of the stemcell", func() {
+		writeStemcell(imageSha1)
+
+		report, err := (&inspector.Inspector{}).Inspect(stemcell)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(report.Path).To(Equal(stemcell))
+		Expect(report.Manifest.Name).To(Equal("bosh-vsphere-esxi-windows2019-go_agent"))
+		Expect(report.Manifest.Version).To(Equal("2019.7"))
+		Expect(report.Manifest.APIVersion).To(Equal(3))
+		Expect(report.Manifest.OperatingSystem).To(Equal("windows2019"))
+		Expect(report.Manifest.StemcellFormats).To(Equal([]string{"vsphere-ovf", "vsphere-ova"}))
+		Expect(report.Manifest.CloudProperties).To(HaveKeyWithValue("infrastructure", "vsphere"))
+	})
+
+	It("verifies the sha1 of the image", func() {
+		writeStemcell(imageSha1)
+
+		report, err := (&inspector.Inspector{}).Inspect(stemcell)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(report.ImageSha1).To(Equal(imageSha1))
+		Expect(report.Sha1Verified).To(BeTrue())
+	})
+
+	It("reports a sha1 that does not match the image", func() {
+		writeStemcell("0000000000000000000000000000000000000000")
+
+		report, err := (&inspector.Inspector{}).Inspect(stemcell)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(report.ImageSha1).To(Equal(imageSha1))
+		Expect(report.Sha1Verified).To(BeFalse())
+	})
+
+	It("verifies a multi-digest of the image", func() {
+		imageSha256 := sha256File(filepath.Join(stemcellDir, "image"))
+		writeStemcell(fmt.Sprintf("sha1:%s;sha256:%s", imageSha1, imageSha256))
+
+		report, err := (&inspector.Inspector{}).Inspect(stemcell)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(report.ImageSha256).To(Equal(imageSha256))
+		Expect(report.Sha1Verified).To(BeTrue())
+		Expect(report.ImageDigest()).To(Equal(report.Manifest.SHA1))
+	})
+
+	It("verifies a manifest with only a sha256 of the image", func() {
+		writeStemcell("sha256:" + sha256File(filepath.Join(stemcellDir, "image")))
+
+		report, err := (&inspector.Inspector{}).Inspect(stemcell)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(report.Sha1Verified).To(BeTrue())
+	})
+
+	It("reports a multi-digest with a sha256 that does not match the image", func() {
+		writeStemcell(fmt.Sprintf("sha1:%s;sha256:%064d", imageSha1, 0))
+
+		report, err := (&inspector.Inspector{}).Inspect(stemcell)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(report.Sha1Verified).To(BeFalse())
+	})
+
+	It("ignores digest algorithms it cannot compute as long as another one matches", func() {
+		writeStemcell(fmt.Sprintf("sha1:%s;sha512:%0128d", imageSha1, 0))
+
+		report, err := (&inspector.Inspector{}).Inspect(stemcell)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(report.Sha1Verified).To(BeTrue())
+	})
+
+	It("lists the members of the image", func() {
+		writeStemcell(imageSha1)
+
+		report, err := (&inspector.Inspector{}).Inspect(stemcell)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(report.ImageMembers).To(ConsistOf(
+			inspector.Member{Name: "my-vm.ovf", Type: "ovf", Size: 11},
+			inspector.Member{Name: "my-vm-disk1.vmdk", Type: "vmdk", Size: 18},
+			inspector.Member{Name: "my-vm.mf", Type: "manifest", Size: 21},
+		))
+	})
+
+	It("inspects a light stemcell, whose image is empty", func() {
+		lightPackager := packager.LightPackager{
+			SourceConfig: config.SourceConfig{ImageRef: "us-east-1:ami-0123456789abcdef0"},
+			OutputConfig: config.OutputConfig{
+				Os:               "2019",
+				StemcellVersion:  "2019.12",
+				OutputDir:        workDir,
+				CompressionLevel: config.DefaultCompressionLevel,
+				Light:            true,
+				IaaS:             config.IaaSAWS,
+			},
+			Logger: colorlogger.New(colorlogger.NONE, false, GinkgoWriter),
+		}
+		Expect(lightPackager.Package()).To(Succeed())
+
+		report, err := (&inspector.Inspector{}).Inspect(filepath.Join(workDir, lightPackager.OutputConfig.StemcellFilename()))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(report.ImageMembers).To(BeEmpty())
+		Expect(report.ImageSha1).To(Equal("da39a3ee5e6b4b0d3255bfef95601890afd80709"))
+		Expect(report.Sha1Verified).To(BeTrue())
+	})
+
+	It("reports a sha1 that does not match an empty image", func() {
+		Expect(os.WriteFile(filepath.Join(stemcellDir, "image"), nil, 0644)).To(Succeed())
+		writeStemcell(imageSha1)
+
+		report, err := (&inspector.Inspector{}).Inspect(stemcell)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(report.ImageMembers).To(BeEmpty())
+		Expect(report.Sha1Verified).To(BeFalse())
+	})
+
+	It("returns an error when the stemcell has no manifest", func() {
+		_, err := packager.TarGenerator(stemcell, stemcellDir, packager.Entries{})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = (&inspector.Inspector{}).Inspect(stemcell)
+		Expect(err).To(MatchError(ContainSubstring("does not contain stemcell.MF")))
+	})
+
+	It("returns an error when the stemcell has no image", func() {
+		Expect(os.Remove(filepath.Join(stemcellDir, "image"))).To(Succeed())
+		writeStemcell(imageSha1)
+
+		_, err := (&inspector.Inspector{}).Inspect(stemcell)
+		Expect(err).To(MatchError(ContainSubstring("does not contain an image")))
+	})
+
+	It("returns an error when the file is not a gzip compressed tarball", func() {
+		Expect(os.WriteFile(stemcell, []byte("not a stemcell"), 0644)).To(Succeed())
+
+		_, err := (&inspector.Inspector{}).Inspect(stemcell)
+		Expect(err).To(MatchError(ContainSubstring("is not a gzip compressed tarball")))
+	})
+
+	It("returns an error when the stemcell does not exist", func() {
+		_, err := (&inspector.Inspector{}).Inspect(filepath.Join(workDir, "missing.tgz"))
+		Expect(err).To(MatchError(ContainSubstring("unable to open stemcell")))
+	})
+})
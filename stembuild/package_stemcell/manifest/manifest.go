@@ -0,0 +1,141 @@
+// Package manifest reads, writes and validates stemcell.MF, the manifest that
+// tells the BOSH director what a stemcell is.
+package manifest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/digest"
+)
+
+// APIVersion is the version of the stemcell API of the BOSH agent in the
+// stemcells.
+const APIVersion = 3
+
+// digestLengths are the lengths of the hex encoded checksums of the algorithms
+// BOSH accepts in the sha1 field.
+var digestLengths = map[digest.Algorithm]int{
+	digest.SHA1:   40,
+	digest.SHA256: 64,
+	"sha512":      128,
+}
+
+// StemcellManifest is the stemcell.MF of a stemcell, which tells the BOSH
+// director what the stemcell is and the cloud properties the CPI creates VMs
+// with.
+type StemcellManifest struct {
+	Name       string `yaml:"name" json:"name"`
+	Version    string `yaml:"version" json:"version"`
+	APIVersion int    `yaml:"api_version,omitempty" json:"api_version"`
+	// SHA1 is either a bare sha1 of the image or a BOSH multi-digest, such
+	// as "sha1:<sum>;sha256:<sum>".
+	SHA1            string                 `yaml:"sha1" json:"sha1"`
+	OperatingSystem string                 `yaml:"operating_system" json:"operating_system"`
+	CloudProperties map[string]interface{} `yaml:"cloud_properties" json:"cloud_properties"`
+	StemcellFormats []string               `yaml:"stemcell_formats" json:"stemcell_formats"`
+}
+
+// Unmarshal parses the YAML document of a stemcell.MF. It does not validate
+// the manifest.
+func Unmarshal(data []byte) (StemcellManifest, error) {
+	var m StemcellManifest
+	err := yaml.Unmarshal(data, &m)
+	return m, err
+}
+
+// Marshal returns the manifest as the YAML document of stemcell.MF. A
+// multi-digest is quoted, as BOSH writes it.
+func (m StemcellManifest) Marshal() ([]byte, error) {
+	var node yaml.Node
+	err := node.Encode(m)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "sha1" && strings.Contains(node.Content[i+1].Value, ":") {
+			node.Content[i+1].Style = yaml.DoubleQuotedStyle
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("---\n")
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	err = encoder.Encode(&node)
+	if err != nil {
+		return nil, err
+	}
+	err = encoder.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// Validate checks the manifest against the rules the BOSH director applies
+// when a stemcell is uploaded: name, version and sha1 are required, sha1 must
+// hold checksums of algorithms BOSH knows, and the optional fields must be
+// well formed if given.
+func (m StemcellManifest) Validate() error {
+	if m.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if m.Version == "" {
+		return fmt.Errorf("version is required")
+	}
+	if m.APIVersion < 0 {
+		return fmt.Errorf("api_version must not be negative, got %d", m.APIVersion)
+	}
+
+	if m.SHA1 == "" {
+		return fmt.Errorf("sha1 is required")
+	}
+	digests, err := digest.Parse(m.SHA1)
+	if err != nil {
+		return fmt.Errorf("sha1 is not a checksum or multi-digest: %w", err)
+	}
+	for _, d := range digests {
+		length, ok := digestLengths[d.Algorithm]
+		if !ok {
+			return fmt.Errorf("sha1 has a checksum of unsupported algorithm %q", d.Algorithm)
+		}
+		if _, err := hex.DecodeString(d.Sum); err != nil || len(d.Sum) != length {
+			return fmt.Errorf("sha1 has an invalid %s checksum %q", d.Algorithm, d.Sum)
+		}
+	}
+
+	for key := range m.CloudProperties {
+		if key == "" {
+			return fmt.Errorf("cloud_properties has an empty key")
+		}
+	}
+
+	for _, format := range m.StemcellFormats {
+		if format == "" {
+			return fmt.Errorf("stemcell_formats has an empty format")
+		}
+	}
+
+	return nil
+}
+
+// WithCloudProperties returns a copy of the manifest with extra added to its
+// cloud properties, replacing any with the same key.
+func (m StemcellManifest) WithCloudProperties(extra map[string]interface{}) StemcellManifest {
+	cloudProperties := make(map[string]interface{}, len(m.CloudProperties)+len(extra))
+	for key, value := range m.CloudProperties {
+		cloudProperties[key] = value
+	}
+	for key, value := range extra {
+		cloudProperties[key] = value
+	}
+
+	m.CloudProperties = cloudProperties
+	return m
+}
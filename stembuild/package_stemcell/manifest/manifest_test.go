@@ -0,0 +1,124 @@
+package manifest_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/manifest"
+)
+
+const (
+	sha1Sum   = "da39a3ee5e6b4b0d3255bfef95601890afd80709"
+	sha256Sum = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+var _ = Describe("StemcellManifest", func() {
+	var stemcellManifest manifest.StemcellManifest
+
+	BeforeEach(func() {
+		stemcellManifest = manifest.StemcellManifest{
+			Name:            "bosh-vsphere-esxi-windows2019-go_agent",
+			Version:         "2019.10",
+			APIVersion:      manifest.APIVersion,
+			SHA1:            sha1Sum,
+			OperatingSystem: "windows2019",
+			CloudProperties: map[string]interface{}{"infrastructure": "vsphere", "hypervisor": "esxi"},
+			StemcellFormats: []string{"vsphere-ovf", "vsphere-ova"},
+		}
+	})
+
+	Describe("Marshal", func() {
+		It("writes the YAML document of stemcell.MF", func() {
+			contents, err := stemcellManifest.Marshal()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(string(contents)).To(Equal(`---
+name: bosh-vsphere-esxi-windows2019-go_agent
+version: "2019.10"
+api_version: 3
+sha1: ` + sha1Sum + `
+operating_system: windows2019
+cloud_properties:
+  hypervisor: esxi
+  infrastructure: vsphere
+stemcell_formats:
+  - vsphere-ovf
+  - vsphere-ova
+`))
+		})
+
+		It("quotes a multi-digest", func() {
+			stemcellManifest.SHA1 = "sha1:" + sha1Sum + ";sha256:" + sha256Sum
+
+			contents, err := stemcellManifest.Marshal()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring("\nsha1: \"sha1:" + sha1Sum + ";sha256:" + sha256Sum + "\"\n"))
+		})
+	})
+
+	Describe("Unmarshal", func() {
+		It("reads back a marshalled manifest", func() {
+			contents, err := stemcellManifest.Marshal()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(manifest.Unmarshal(contents)).To(Equal(stemcellManifest))
+		})
+
+		It("reads a version written as a number", func() {
+			m, err := manifest.Unmarshal([]byte("name: stemcell\nversion: 1200.10\n"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(m.Version).To(Equal("1200.10"))
+		})
+
+		It("returns an error for fields of the wrong type", func() {
+			_, err := manifest.Unmarshal([]byte("name: stemcell\ncloud_properties: [a, b]\n"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Validate", func() {
+		It("accepts a complete manifest", func() {
+			Expect(stemcellManifest.Validate()).To(Succeed())
+		})
+
+		It("accepts a manifest without the optional fields", func() {
+			Expect(manifest.StemcellManifest{Name: "stemcell", Version: "1", SHA1: sha1Sum}.Validate()).To(Succeed())
+		})
+
+		It("accepts a multi-digest", func() {
+			stemcellManifest.SHA1 = "sha1:" + sha1Sum + ";sha256:" + sha256Sum
+			Expect(stemcellManifest.Validate()).To(Succeed())
+		})
+
+		DescribeTable("rejects a manifest that BOSH would not accept",
+			func(change func(*manifest.StemcellManifest), message string) {
+				change(&stemcellManifest)
+				Expect(stemcellManifest.Validate()).To(MatchError(ContainSubstring(message)))
+			},
+			Entry("without a name", func(m *manifest.StemcellManifest) { m.Name = "" }, "name is required"),
+			Entry("without a version", func(m *manifest.StemcellManifest) { m.Version = "" }, "version is required"),
+			Entry("without a sha1", func(m *manifest.StemcellManifest) { m.SHA1 = "" }, "sha1 is required"),
+			Entry("with a negative api_version", func(m *manifest.StemcellManifest) { m.APIVersion = -1 }, "api_version must not be negative"),
+			Entry("with a short sha1", func(m *manifest.StemcellManifest) { m.SHA1 = "da39a3ee" }, `invalid sha1 checksum "da39a3ee"`),
+			Entry("with a sha1 that is not hex", func(m *manifest.StemcellManifest) { m.SHA1 = "sha1sum" }, `invalid sha1 checksum "sha1sum"`),
+			Entry("with an unknown algorithm", func(m *manifest.StemcellManifest) { m.SHA1 = "md5:d41d8cd98f00b204e9800998ecf8427e" }, `unsupported algorithm "md5"`),
+			Entry("with a digest without a checksum", func(m *manifest.StemcellManifest) { m.SHA1 = "sha256:" }, "not a checksum or multi-digest"),
+			Entry("with an empty cloud property", func(m *manifest.StemcellManifest) { m.CloudProperties[""] = "x" }, "cloud_properties has an empty key"),
+			Entry("with an empty stemcell format", func(m *manifest.StemcellManifest) { m.StemcellFormats = []string{""} }, "stemcell_formats has an empty format"),
+		)
+	})
+
+	Describe("WithCloudProperties", func() {
+		It("adds to and replaces the cloud properties of a copy", func() {
+			withProperties := stemcellManifest.WithCloudProperties(map[string]interface{}{"hypervisor": "esxi8", "boot_mode": "uefi"})
+
+			Expect(withProperties.CloudProperties).To(Equal(map[string]interface{}{
+				"infrastructure": "vsphere",
+				"hypervisor":     "esxi8",
+				"boot_mode":      "uefi",
+			}))
+			Expect(stemcellManifest.CloudProperties).To(HaveKeyWithValue("hypervisor", "esxi"))
+			Expect(stemcellManifest.CloudProperties).NotTo(HaveKey("boot_mode"))
+		})
+	})
+})
@@ -0,0 +1,196 @@
+// Package ova builds OVA packages from the .vmx that stembuild writes for a
+// VMDK, without VMware's ovftool.
+package ova
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/digest"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/vmdk"
+)
+
+// maxUSTARSize is the largest file a USTAR header can give the size of.
+const maxUSTARSize = 1<<33 - 1
+
+// Options are the settings for Create.
+type Options struct {
+	// Digest is the checksum of each file recorded in the manifest, SHA1 if
+	// not set.
+	Digest digest.Algorithm
+	// CompressionLevel is the compress/zlib level of the disk, and
+	// CompressionThreads the number of its grains compressed at once; 0
+	// uses one thread per CPU.
+	CompressionLevel   int
+	CompressionThreads int
+	// ModTime dates the files in the OVA, the current time if not set.
+	ModTime time.Time
+}
+
+// Create writes an OVA to ovaPath for the VM described by the .vmx at
+// vmxPath. Its disk is converted to streamOptimized next to ovaPath first, as
+// the OVF descriptor and the manifest, which precede the disk in the OVA,
+// record its size and checksum.
+//
+// The OVA holds <name>.ovf, <name>.mf and <name>-disk1.vmdk, where name is the
+// base name of ovaPath.
+func Create(ctx context.Context, vmxPath, ovaPath string, options Options) error {
+	if options.Digest == "" {
+		options.Digest = digest.SHA1
+	}
+	if options.ModTime.IsZero() {
+		options.ModTime = time.Now()
+	}
+
+	vmxFile, err := os.Open(vmxPath)
+	if err != nil {
+		return err
+	}
+	vmx, err := ReadVMX(vmxFile)
+	vmxFile.Close() //nolint:errcheck
+	if err != nil {
+		return err
+	}
+	hw, err := vmx.Hardware()
+	if err != nil {
+		return err
+	}
+
+	diskPath := hw.Disk
+	if !filepath.IsAbs(diskPath) {
+		diskPath = filepath.Join(filepath.Dir(vmxPath), diskPath)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(ovaPath), filepath.Ext(ovaPath))
+	disk := Disk{File: name + "-disk1.vmdk"}
+	diskFile, converted, err := convertDisk(ctx, diskPath, filepath.Dir(ovaPath), disk.File, options)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(diskFile.Name()) //nolint:errcheck
+	defer diskFile.Close()           //nolint:errcheck
+
+	fi, err := diskFile.Stat()
+	if err != nil {
+		return err
+	}
+	disk.Size = fi.Size()
+	disk.Capacity = converted.capacity
+
+	descriptor, err := Descriptor(hw, disk)
+	if err != nil {
+		return err
+	}
+	descriptorHash := digest.NewHash(digest.Algorithms{options.Digest})
+	descriptorHash.Write(descriptor) //nolint:errcheck
+	manifest := manifestEntry(options.Digest, name+".ovf", descriptorHash.Digests()[0].Sum) +
+		manifestEntry(options.Digest, disk.File, converted.sum)
+
+	ova, err := os.OpenFile(ovaPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	err = writeOVA(ova, options.ModTime, []ovaFile{
+		{name: name + ".ovf", size: int64(len(descriptor)), r: bytes.NewReader(descriptor)},
+		{name: name + ".mf", size: int64(len(manifest)), r: strings.NewReader(manifest)},
+		{name: disk.File, size: disk.Size, r: diskFile},
+	})
+	if closeErr := ova.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(ovaPath) //nolint:errcheck
+		return fmt.Errorf("unable to write %s: %w", ovaPath, err)
+	}
+
+	return nil
+}
+
+type convertedDisk struct {
+	capacity int64
+	sum      string
+}
+
+// convertDisk writes the VMDK at path as a streamOptimized VMDK to a temp file
+// in dir, which is returned open at its start.
+func convertDisk(ctx context.Context, path, dir, fileName string, options Options) (*os.File, convertedDisk, error) {
+	var converted convertedDisk
+
+	source, err := vmdk.Open(path)
+	if err != nil {
+		return nil, converted, err
+	}
+	defer source.Close() //nolint:errcheck
+	converted.capacity = source.Capacity()
+
+	file, err := os.CreateTemp(dir, "stembuild-disk-*.vmdk")
+	if err != nil {
+		return nil, converted, err
+	}
+
+	h := digest.NewHash(digest.Algorithms{options.Digest})
+	err = source.WriteStreamOptimized(ctx, io.MultiWriter(file, h), vmdk.StreamOptions{
+		FileName: fileName,
+		Level:    options.CompressionLevel,
+		Threads:  options.CompressionThreads,
+	})
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()           //nolint:errcheck
+		os.Remove(file.Name()) //nolint:errcheck
+		return nil, converted, fmt.Errorf("unable to convert %s to streamOptimized: %w", path, err)
+	}
+
+	converted.sum = h.Digests()[0].Sum
+	return file, converted, nil
+}
+
+// manifestEntry is the line of an OVF manifest giving the checksum of a file.
+func manifestEntry(algorithm digest.Algorithm, name, sum string) string {
+	return fmt.Sprintf("%s(%s)= %s\n", algorithm.OVFName(), name, sum)
+}
+
+type ovaFile struct {
+	name string
+	size int64
+	r    io.Reader
+}
+
+// writeOVA writes files to w as a tar archive, in the USTAR format that OVF
+// requires, unless a file is too large for it.
+func writeOVA(w io.Writer, modTime time.Time, files []ovaFile) error {
+	tarWriter := tar.NewWriter(w)
+	for _, file := range files {
+		header := &tar.Header{
+			Name:     file.name,
+			Size:     file.size,
+			Mode:     0644,
+			ModTime:  modTime.Truncate(time.Second),
+			Typeflag: tar.TypeReg,
+			Format:   tar.FormatUSTAR,
+		}
+		if file.size > maxUSTARSize {
+			header.Format = tar.FormatGNU
+		}
+
+		err := tarWriter.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tarWriter, file.r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tarWriter.Close()
+}
@@ -0,0 +1,13 @@
+package ova_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestOva(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "OVA Suite")
+}
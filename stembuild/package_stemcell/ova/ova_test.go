@@ -0,0 +1,255 @@
+package ova_test
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/ovf"
+	"github.com/vmware/govmomi/ovf/importer"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/mo"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/digest"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/ova"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/vmdk"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/templates"
+)
+
+var _ = Describe("OVA", func() {
+	var dir string
+	var diskData []byte
+	var vmxPath string
+	var options ova.Options
+
+	// writeVMX writes the VMX that stembuild packages VMDKs with, for a flat
+	// disk holding diskData.
+	writeVMX := func(hwVersion int) string {
+		flatPath := filepath.Join(dir, "source-flat.vmdk")
+		Expect(os.WriteFile(flatPath, diskData, 0644)).To(Succeed())
+		vmdkPath := filepath.Join(dir, "source.vmdk")
+		Expect(os.WriteFile(vmdkPath, []byte(fmt.Sprintf(`# Disk DescriptorFile
+version=1
+CID=fffffffe
+parentCID=ffffffff
+createType="monolithicFlat"
+
+RW %d FLAT "source-flat.vmdk" 0
+`, len(diskData)/512)), 0644)).To(Succeed())
+
+		path := filepath.Join(dir, fmt.Sprintf("image-%d.vmx", hwVersion))
+		Expect(templates.WriteVMXTemplate(vmdkPath, "windows8srv-64", hwVersion, path)).To(Succeed())
+		return path
+	}
+
+	// readOVA returns the names of the files in the OVA, in order, and their
+	// contents.
+	readOVA := func(path string) ([]string, map[string][]byte) {
+		file, err := os.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close() //nolint:errcheck
+
+		var names []string
+		contents := map[string][]byte{}
+		tarReader := tar.NewReader(file)
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(header.Format).To(Equal(tar.FormatUSTAR))
+			names = append(names, header.Name)
+			contents[header.Name], err = io.ReadAll(tarReader)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		return names, contents
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		diskData = make([]byte, 4<<20)
+		for i := 0; i < len(diskData); i += 3 << 16 {
+			copy(diskData[i:], strings.Repeat("stemcell disk data ", 1000))
+		}
+		vmxPath = writeVMX(10)
+		options = ova.Options{Digest: digest.SHA256, CompressionLevel: 6, ModTime: time.Unix(1700000000, 0)}
+	})
+
+	It("writes the OVF descriptor, manifest and streamOptimized disk", func() {
+		ovaPath := filepath.Join(dir, "image.ova")
+		Expect(ova.Create(context.Background(), vmxPath, ovaPath, options)).To(Succeed())
+
+		names, contents := readOVA(ovaPath)
+		Expect(names).To(Equal([]string{"image.ovf", "image.mf", "image-disk1.vmdk"}))
+
+		Expect(string(contents["image.mf"])).To(Equal(fmt.Sprintf(
+			"SHA256(image.ovf)= %x\nSHA256(image-disk1.vmdk)= %x\n",
+			sha256.Sum256(contents["image.ovf"]), sha256.Sum256(contents["image-disk1.vmdk"]),
+		)))
+
+		diskPath := filepath.Join(dir, "extracted.vmdk")
+		Expect(os.WriteFile(diskPath, contents["image-disk1.vmdk"], 0644)).To(Succeed())
+		disk, err := vmdk.Open(diskPath)
+		Expect(err).NotTo(HaveOccurred())
+		defer disk.Close() //nolint:errcheck
+		Expect(disk.Descriptor.CreateType).To(Equal("streamOptimized"))
+		Expect(disk.Descriptor.Extents[0].File).To(Equal("image-disk1.vmdk"))
+		extracted := make([]byte, disk.Capacity())
+		_, err = disk.ReadAt(extracted, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(extracted).To(Equal(diskData))
+	})
+
+	It("describes the hardware of the VMX in the OVF descriptor", func() {
+		ovaPath := filepath.Join(dir, "image.ova")
+		Expect(ova.Create(context.Background(), vmxPath, ovaPath, options)).To(Succeed())
+		_, contents := readOVA(ovaPath)
+
+		envelope, err := ovf.Unmarshal(strings.NewReader(string(contents["image.ovf"])))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(*envelope.VirtualSystem.Name).To(Equal("BOSH-Windows-Stemcell"))
+		Expect(*envelope.VirtualSystem.OperatingSystem.OSType).To(Equal("windows8Server64Guest"))
+		hardware := envelope.VirtualSystem.VirtualHardware[0]
+		Expect(*hardware.System.VirtualSystemType).To(Equal("vmx-10"))
+
+		items := map[uint16]ovf.ResourceAllocationSettingData{}
+		for _, item := range hardware.Item {
+			items[uint16(*item.ResourceType)] = item
+		}
+		Expect(*items[3].VirtualQuantity).To(Equal(uint(2)))
+		Expect(*items[4].VirtualQuantity).To(Equal(uint(2048)))
+		Expect(*items[6].ResourceSubType).To(Equal("lsilogicsas"))
+		Expect(items[17].HostResource).To(Equal([]string{"ovf:/disk/vmdisk1"}))
+		Expect(items).To(HaveKey(uint16(15)))
+
+		Expect(envelope.Disk.Disks[0].Capacity).To(Equal(fmt.Sprint(len(diskData))))
+		Expect(*envelope.Disk.Disks[0].Format).To(Equal(vmdk.StreamOptimizedFormat))
+		Expect(envelope.References[0].Href).To(Equal("image-disk1.vmdk"))
+		Expect(envelope.References[0].Size).To(Equal(uint(len(contents["image-disk1.vmdk"]))))
+	})
+
+	It("gives the vSphere guest ID of the guest OS of the VMX as the OS type", func() {
+		vmx, err := os.ReadFile(vmxPath)
+		Expect(err).NotTo(HaveOccurred())
+		vmx = []byte(strings.Replace(string(vmx), `"windows8srv-64"`, `"windows2019srvnext-64"`, 1))
+		Expect(os.WriteFile(vmxPath, vmx, 0644)).To(Succeed())
+
+		ovaPath := filepath.Join(dir, "image.ova")
+		Expect(ova.Create(context.Background(), vmxPath, ovaPath, options)).To(Succeed())
+		_, contents := readOVA(ovaPath)
+
+		envelope, err := ovf.Unmarshal(strings.NewReader(string(contents["image.ovf"])))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*envelope.VirtualSystem.OperatingSystem.OSType).To(Equal("windows2019srvNext_64Guest"))
+	})
+
+	It("returns an error for a guest OS that is not in the catalog", func() {
+		vmx, err := os.ReadFile(vmxPath)
+		Expect(err).NotTo(HaveOccurred())
+		vmx = []byte(strings.Replace(string(vmx), `"windows8srv-64"`, `"other-64"`, 1))
+		Expect(os.WriteFile(vmxPath, vmx, 0644)).To(Succeed())
+
+		err = ova.Create(context.Background(), vmxPath, filepath.Join(dir, "image.ova"), options)
+		Expect(err).To(MatchError(ContainSubstring(`unsupported guest OS "other-64"`)))
+	})
+
+	It("writes the same OVA from the same inputs", func() {
+		create := func() []byte {
+			ovaPath := filepath.Join(GinkgoT().TempDir(), "image.ova")
+			Expect(ova.Create(context.Background(), vmxPath, ovaPath, options)).To(Succeed())
+			contents, err := os.ReadFile(ovaPath)
+			Expect(err).NotTo(HaveOccurred())
+			return contents
+		}
+
+		Expect(create()).To(Equal(create()))
+	})
+
+	It("can be imported into vCenter", func() {
+		// vcsim does not know the OVF name of the LSI Logic SAS controller
+		// that vCenter uses, so the import is tested with LSI Logic.
+		vmx, err := os.ReadFile(vmxPath)
+		Expect(err).NotTo(HaveOccurred())
+		vmx = []byte(strings.Replace(string(vmx), `"lsisas1068"`, `"lsilogic"`, 1))
+		Expect(os.WriteFile(vmxPath, vmx, 0644)).To(Succeed())
+
+		// vcsim checks uploads against sha1 manifests only.
+		options.Digest = digest.SHA1
+		ovaPath := filepath.Join(dir, "image.ova")
+		Expect(ova.Create(context.Background(), vmxPath, ovaPath, options)).To(Succeed())
+
+		simulator.Test(func(ctx context.Context, c *vim25.Client) {
+			finder := find.NewFinder(c)
+			datacenter, err := finder.DefaultDatacenter(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			finder.SetDatacenter(datacenter)
+			datastore, err := finder.DefaultDatastore(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			host, err := finder.DefaultHostSystem(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			pool, err := host.ResourcePool(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			folders, err := datacenter.Folders(ctx)
+			Expect(err).NotTo(HaveOccurred())
+
+			imp := importer.Importer{
+				Log:            func(string) (int, error) { return 0, nil },
+				VerifyManifest: true,
+				Client:         c,
+				Finder:         finder,
+				Datacenter:     datacenter,
+				Datastore:      datastore,
+				ResourcePool:   pool,
+				Host:           host,
+				Folder:         folders.VmFolder,
+				Archive:        &importer.TapeArchive{Path: ovaPath},
+			}
+			name := "stemcell-vm"
+			ref, err := imp.Import(ctx, "*.ovf", importer.Options{Name: &name})
+			Expect(err).NotTo(HaveOccurred())
+
+			var vm mo.VirtualMachine
+			Expect(object.NewVirtualMachine(c, *ref).Properties(ctx, *ref, []string{"config"}, &vm)).To(Succeed())
+			Expect(vm.Config.GuestId).To(Equal("windows8Server64Guest"))
+			Expect(vm.Config.Hardware.NumCPU).To(Equal(int32(2)))
+			Expect(vm.Config.Hardware.MemoryMB).To(Equal(int32(2048)))
+			Expect(vm.Config.Version).To(Equal("vmx-10"))
+		}, simulator.ESX())
+	})
+
+	It("returns an error when the VMX has no virtual hardware version", func() {
+		err := ova.Create(context.Background(), writeVMX(0), filepath.Join(dir, "image.ova"), options)
+
+		Expect(err).To(MatchError(ContainSubstring("virtualHW.version must be set")))
+		Expect(os.Stat(filepath.Join(dir, "image.ova"))).Error().To(MatchError(os.ErrNotExist))
+	})
+
+	It("removes the OVA and converted disk when interrupted", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := ova.Create(ctx, vmxPath, filepath.Join(dir, "image.ova"), options)
+
+		Expect(err).To(MatchError(context.Canceled))
+		entries, err := os.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		for _, entry := range entries {
+			Expect(entry.Name()).NotTo(HavePrefix("stembuild-disk-"))
+			Expect(entry.Name()).NotTo(HaveSuffix(".ova"))
+		}
+	})
+})
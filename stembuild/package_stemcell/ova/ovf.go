@@ -0,0 +1,159 @@
+package ova
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/oscatalog"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/vmdk"
+)
+
+// scsiController maps .vmx SCSI virtualDevs to OVF resource subtypes.
+var scsiController = map[string]string{
+	"":           "lsilogic",
+	"lsilogic":   "lsilogic",
+	"lsisas1068": "lsilogicsas",
+	"pvscsi":     "VirtualSCSI",
+	"buslogic":   "buslogic",
+}
+
+// cimWindowsServer is the CIM operating system type that vSphere gives
+// 64-bit Windows Server in OVF descriptors.
+const cimWindowsServer = 112
+
+const ovfTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:cim="http://schemas.dmtf.org/wbem/wscim/1/common" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1" xmlns:rasd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData" xmlns:vmw="http://www.vmware.com/schema/ovf" xmlns:vssd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <References>
+    <File ovf:href="{{.DiskFile}}" ovf:id="file1" ovf:size="{{.DiskFileSize}}"/>
+  </References>
+  <DiskSection>
+    <Info>Virtual disk information</Info>
+    <Disk ovf:capacity="{{.DiskCapacity}}" ovf:capacityAllocationUnits="byte" ovf:diskId="vmdisk1" ovf:fileRef="file1" ovf:format="{{.DiskFormat}}"/>
+  </DiskSection>
+  <VirtualSystem ovf:id="{{.Name}}">
+    <Info>A virtual machine</Info>
+    <Name>{{.Name}}</Name>
+    <OperatingSystemSection ovf:id="{{.OSID}}" vmw:osType="{{.OSType}}">
+      <Info>The kind of installed guest operating system</Info>
+    </OperatingSystemSection>
+    <VirtualHardwareSection>
+      <Info>Virtual hardware requirements</Info>
+      <System>
+        <vssd:ElementName>Virtual Hardware Family</vssd:ElementName>
+        <vssd:InstanceID>0</vssd:InstanceID>
+        <vssd:VirtualSystemIdentifier>{{.Name}}</vssd:VirtualSystemIdentifier>
+        <vssd:VirtualSystemType>{{.SystemType}}</vssd:VirtualSystemType>
+      </System>
+      <Item>
+        <rasd:AllocationUnits>hertz * 10^6</rasd:AllocationUnits>
+        <rasd:Description>Number of Virtual CPUs</rasd:Description>
+        <rasd:ElementName>{{.CPUs}} virtual CPU(s)</rasd:ElementName>
+        <rasd:InstanceID>1</rasd:InstanceID>
+        <rasd:ResourceType>3</rasd:ResourceType>
+        <rasd:VirtualQuantity>{{.CPUs}}</rasd:VirtualQuantity>
+      </Item>
+      <Item>
+        <rasd:AllocationUnits>byte * 2^20</rasd:AllocationUnits>
+        <rasd:Description>Memory Size</rasd:Description>
+        <rasd:ElementName>{{.MemoryMB}}MB of memory</rasd:ElementName>
+        <rasd:InstanceID>2</rasd:InstanceID>
+        <rasd:ResourceType>4</rasd:ResourceType>
+        <rasd:VirtualQuantity>{{.MemoryMB}}</rasd:VirtualQuantity>
+      </Item>
+      <Item>
+        <rasd:Address>0</rasd:Address>
+        <rasd:Description>SCSI Controller</rasd:Description>
+        <rasd:ElementName>SCSI Controller 0</rasd:ElementName>
+        <rasd:InstanceID>3</rasd:InstanceID>
+        <rasd:ResourceSubType>{{.SCSIController}}</rasd:ResourceSubType>
+        <rasd:ResourceType>6</rasd:ResourceType>
+      </Item>
+      <Item>
+        <rasd:AddressOnParent>0</rasd:AddressOnParent>
+        <rasd:ElementName>Hard Disk 1</rasd:ElementName>
+        <rasd:HostResource>ovf:/disk/vmdisk1</rasd:HostResource>
+        <rasd:InstanceID>4</rasd:InstanceID>
+        <rasd:Parent>3</rasd:Parent>
+        <rasd:ResourceType>17</rasd:ResourceType>
+      </Item>{{if .CDROM}}
+      <Item>
+        <rasd:Address>0</rasd:Address>
+        <rasd:Description>IDE Controller</rasd:Description>
+        <rasd:ElementName>IDE Controller 0</rasd:ElementName>
+        <rasd:InstanceID>5</rasd:InstanceID>
+        <rasd:ResourceType>5</rasd:ResourceType>
+      </Item>
+      <Item ovf:required="false">
+        <rasd:AddressOnParent>0</rasd:AddressOnParent>
+        <rasd:AutomaticAllocation>false</rasd:AutomaticAllocation>
+        <rasd:ElementName>CD-ROM 1</rasd:ElementName>
+        <rasd:InstanceID>6</rasd:InstanceID>
+        <rasd:Parent>5</rasd:Parent>
+        <rasd:ResourceSubType>vmware.cdrom.remotepassthrough</rasd:ResourceSubType>
+        <rasd:ResourceType>15</rasd:ResourceType>
+      </Item>{{end}}
+    </VirtualHardwareSection>
+  </VirtualSystem>
+</Envelope>
+`
+
+// Disk is the streamOptimized VMDK of an OVF package.
+type Disk struct {
+	File     string
+	Size     int64
+	Capacity int64
+}
+
+// Descriptor returns the OVF descriptor of a VM with the given hardware and
+// disk.
+func Descriptor(hw Hardware, disk Disk) ([]byte, error) {
+	windows, ok := oscatalog.ByGuestOS(hw.GuestOS)
+	if !ok {
+		return nil, fmt.Errorf("unsupported guest OS %q", hw.GuestOS)
+	}
+	controller, ok := scsiController[strings.ToLower(hw.SCSIController)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported SCSI controller %q", hw.SCSIController)
+	}
+
+	var name bytes.Buffer
+	xml.EscapeText(&name, []byte(hw.Name)) //nolint:errcheck
+
+	t, err := template.New("ovf").Parse(ovfTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	var descriptor bytes.Buffer
+	err = t.Execute(&descriptor, struct {
+		Hardware
+		Name           string
+		OSID           int
+		OSType         string
+		SystemType     string
+		SCSIController string
+		DiskFile       string
+		DiskFileSize   int64
+		DiskCapacity   int64
+		DiskFormat     string
+	}{
+		Hardware:       hw,
+		Name:           name.String(),
+		OSID:           cimWindowsServer,
+		OSType:         windows.OVFOSType,
+		SystemType:     fmt.Sprintf("vmx-%02d", hw.HWVersion),
+		SCSIController: controller,
+		DiskFile:       disk.File,
+		DiskFileSize:   disk.Size,
+		DiskCapacity:   disk.Capacity,
+		DiskFormat:     vmdk.StreamOptimizedFormat,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return descriptor.Bytes(), nil
+}
@@ -0,0 +1,104 @@
+package ova
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// VMX is the configuration of a VM, as written to a .vmx file.
+type VMX map[string]string
+
+// ReadVMX parses the lines of a .vmx file, 'key = "value"'.
+func ReadVMX(r io.Reader) (VMX, error) {
+	vmx := VMX{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("vmx: unexpected line %q", line)
+		}
+		vmx[strings.ToLower(strings.TrimSpace(key))] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("vmx: %w", err)
+	}
+
+	return vmx, nil
+}
+
+func (v VMX) get(key string) string {
+	return v[strings.ToLower(key)]
+}
+
+func (v VMX) present(device string) bool {
+	return strings.EqualFold(v.get(device+".present"), "TRUE")
+}
+
+func (v VMX) int(key string) (int, error) {
+	value, err := strconv.Atoi(v.get(key))
+	if err != nil {
+		return 0, fmt.Errorf("vmx: %s must be a number, got %q", key, v.get(key))
+	}
+
+	return value, nil
+}
+
+// Hardware is the part of a VM's configuration that goes into its OVF
+// descriptor.
+type Hardware struct {
+	Name      string
+	GuestOS   string
+	HWVersion int
+	CPUs      int
+	MemoryMB  int
+	// SCSIController is the .vmx virtualDev of the controller of the disk.
+	SCSIController string
+	// Disk is the VMDK attached to the controller as scsi0:0.
+	Disk string
+	// CDROM is whether the VM has a CD-ROM drive on its first IDE
+	// controller.
+	CDROM bool
+}
+
+// Hardware returns the hardware of the VM, with its one disk on scsi0:0.
+func (v VMX) Hardware() (Hardware, error) {
+	hw := Hardware{
+		Name:           v.get("displayName"),
+		GuestOS:        v.get("guestOS"),
+		SCSIController: v.get("scsi0.virtualDev"),
+		Disk:           v.get("scsi0:0.fileName"),
+		CDROM:          v.present("ide0:0") && strings.HasPrefix(v.get("ide0:0.deviceType"), "cdrom"),
+	}
+
+	var err error
+	if hw.HWVersion, err = v.int("virtualHW.version"); err != nil {
+		return hw, err
+	}
+	if hw.HWVersion <= 0 {
+		return hw, fmt.Errorf("vmx: virtualHW.version must be set, got %d", hw.HWVersion)
+	}
+	if hw.CPUs, err = v.int("numvcpus"); err != nil {
+		return hw, err
+	}
+	if hw.MemoryMB, err = v.int("memsize"); err != nil {
+		return hw, err
+	}
+
+	if !v.present("scsi0") || !v.present("scsi0:0") || hw.Disk == "" {
+		return hw, fmt.Errorf("vmx: no disk on scsi0:0")
+	}
+	if hw.Name == "" {
+		hw.Name = "vm"
+	}
+
+	return hw, nil
+}
@@ -0,0 +1,67 @@
+package packager
+
+import (
+	"compress/gzip"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// benchmarkImage is compressible but not trivially so, like a disk image.
+func benchmarkImage() []byte {
+	words := []string{"windows", "stemcell", "bosh", "agent", "\x00\x00\x00\x00", "registry", "C:\\Windows\\System32", "\xff\xfe"}
+	r := rand.New(rand.NewSource(1))
+
+	var image []byte
+	for len(image) < 32<<20 {
+		if r.Intn(4) == 0 {
+			image = append(image, byte(r.Intn(256)))
+			continue
+		}
+		image = append(image, words[r.Intn(len(words))]...)
+	}
+	return image
+}
+
+func benchmarkCompression(b *testing.B, newWriter func(io.Writer) (io.WriteCloser, error)) {
+	image := benchmarkImage()
+	b.SetBytes(int64(len(image)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		w, err := newWriter(io.Discard)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := w.Write(image); err != nil {
+			b.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompressionGzip(b *testing.B) {
+	benchmarkCompression(b, func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, gzip.DefaultCompression)
+	})
+}
+
+func BenchmarkCompressionParallelOneThread(b *testing.B) {
+	benchmarkCompression(b, func(w io.Writer) (io.WriteCloser, error) {
+		return Compression{Level: gzip.DefaultCompression, Threads: 1}.newWriter(w)
+	})
+}
+
+func BenchmarkCompressionParallelAllThreads(b *testing.B) {
+	benchmarkCompression(b, func(w io.Writer) (io.WriteCloser, error) {
+		return Compression{Level: gzip.DefaultCompression}.newWriter(w)
+	})
+}
+
+func BenchmarkCompressionParallelBestSpeed(b *testing.B) {
+	benchmarkCompression(b, func(w io.Writer) (io.WriteCloser, error) {
+		return Compression{Level: gzip.BestSpeed}.newWriter(w)
+	})
+}
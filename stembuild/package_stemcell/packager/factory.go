@@ -1,40 +1,73 @@
 package packager
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"os"
 	"strings"
 
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/commandparser"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/digest"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/events"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli/iaas_clients"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli/iaas_clients/vcenter_manager"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/config"
 )
 
-type Factory struct{}
+type Factory struct {
+	// Events receives each step of packaging when set, and anything else
+	// written to stdout then goes to stderr.
+	Events *events.Emitter
+}
+
+func (f *Factory) NewPackager(ctx context.Context, sourceConfig config.SourceConfig, outputConfig config.OutputConfig, logger colorlogger.Logger) (commandparser.Packager, error) {
+	if outputConfig.Light && sourceConfig.ImageRef == "" {
+		return nil, errors.New("light stemcells need the image reference of an image published to the IaaS")
+	}
 
-func (f *Factory) NewPackager(sourceConfig config.SourceConfig, outputConfig config.OutputConfig, logger colorlogger.Logger) (commandparser.Packager, error) {
 	source, err := sourceConfig.GetSource()
 	if err != nil {
 		return nil, err
 	}
 
+	entries, err := newEntries(outputConfig)
+	if err != nil {
+		return nil, err
+	}
+
 	switch source {
+	case config.IMAGE:
+		if !outputConfig.Light {
+			return nil, errors.New("an image reference can only be packaged as a light stemcell")
+		}
+
+		return &LightPackager{
+			SourceConfig: sourceConfig,
+			OutputConfig: outputConfig,
+			Entries:      entries,
+			Logger:       logger,
+			Messenger:    f.messenger(),
+		}, nil
 	case config.VCENTER:
-		client :=
-			iaas_clients.NewVcenterClient(
-				sourceConfig.Username,
-				sourceConfig.Password,
-				sourceConfig.URL,
-				sourceConfig.CaCertFile,
-				&iaas_cli.GovcRunner{},
-			)
+		client, exporter, err := f.vCenterClient(ctx, sourceConfig, outputConfig)
+		if err != nil {
+			return nil, err
+		}
 
 		return &VCenterPackager{
 			SourceConfig: sourceConfig,
 			OutputConfig: outputConfig,
 			Client:       client,
+			Exporter:     exporter,
+			Entries:      entries,
 			Logger:       logger,
+			Messenger:    f.messenger(),
+			Context:      ctx,
+			Stdout:       f.stdout(),
 		}, nil
 	case config.VMDK:
 		options :=
@@ -43,14 +76,129 @@ func (f *Factory) NewPackager(sourceConfig config.SourceConfig, outputConfig con
 				OSVersion: strings.ToUpper(outputConfig.Os),
 				Version:   outputConfig.StemcellVersion,
 				OutputDir: outputConfig.OutputDir,
+
+				CompressionLevel:   outputConfig.CompressionLevel,
+				CompressionThreads: outputConfig.CompressionThreads,
+				DigestAlgorithms:   outputConfig.Digests(),
+
+				OVABuilder:      outputConfig.OVABuilder,
+				CloudProperties: outputConfig.CloudProperties,
 			}
 
 		return &VmdkPackager{
 			Stop:         make(chan struct{}),
+			Context:      ctx,
 			BuildOptions: options,
+			Entries:      entries,
 			Logger:       logger,
+			Messenger:    f.messenger(),
+			Stdout:       f.stdout(),
 		}, nil
 	default:
 		return nil, errors.New("unable to determine packager")
 	}
 }
+
+var (
+	_ IaasClient = (*iaas_clients.VcenterClient)(nil)
+	_ IaasClient = (*iaas_clients.GovmomiVcenterClient)(nil)
+	_ VMExporter = (*iaas_clients.GovmomiVcenterClient)(nil)
+)
+
+// vCenterClient returns the vCenter client of the source config and what
+// exports the VM. The govmomi client does both, over one session; govc cannot
+// stream an export, so with govc the VM is exported through govmomi anyway.
+func (f *Factory) vCenterClient(ctx context.Context, sourceConfig config.SourceConfig, outputConfig config.OutputConfig) (IaasClient, VMExporter, error) {
+	managerConfig := vcenter_manager.FactoryConfig{
+		VCenterServer:  sourceConfig.URL,
+		Username:       sourceConfig.Username,
+		Password:       sourceConfig.Password,
+		ClientCreator:  &vcenter_manager.ClientCreator{},
+		FinderCreator:  &vcenter_manager.GovmomiFinderCreator{},
+		RootCACertPath: sourceConfig.CaCertFile,
+	}
+
+	switch sourceConfig.VCenterClient {
+	case "", iaas_clients.VCenterClientGovc:
+		client := iaas_clients.NewVcenterClient(
+			sourceConfig.Username,
+			sourceConfig.Password,
+			sourceConfig.URL,
+			sourceConfig.CaCertFile,
+			&iaas_cli.GovcRunner{Context: ctx, Stdout: f.stdout()},
+		)
+		exporter := &vCenterExporter{ctx: ctx, config: managerConfig, manifestDigest: outputConfig.Digests().Strongest()}
+		return client, exporter, nil
+	case iaas_clients.VCenterClientGovmomi:
+		manager, err := (&vcenter_manager.ManagerFactory{Config: managerConfig}).VCenterManager(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		client := iaas_clients.NewGovmomiVcenterClient(ctx, manager)
+		client.ManifestDigest = outputConfig.Digests().Strongest()
+		return client, client, nil
+	default:
+		return nil, nil, fmt.Errorf("vcenter client must be one of %s, got %q", strings.Join(iaas_clients.VCenterClients, ", "), sourceConfig.VCenterClient)
+	}
+}
+
+// messenger returns what reports the steps of packaging, which is nothing
+// unless they are reported as events.
+func (f *Factory) messenger() StepMessenger {
+	if f.Events == nil {
+		return nil
+	}
+
+	return NewJSONMessenger(f.Events)
+}
+
+// stdout is where output other than the progress of packaging goes. It is
+// stderr when stdout holds the event stream.
+func (f *Factory) stdout() io.Writer {
+	if f.Events != nil {
+		return os.Stderr
+	}
+
+	return os.Stdout
+}
+
+// newEntries returns the metadata for the entries of the stemcell, which are
+// normalised to SOURCE_DATE_EPOCH for reproducible stemcells.
+func newEntries(outputConfig config.OutputConfig) (Entries, error) {
+	if !outputConfig.Reproducible {
+		return Entries{}, nil
+	}
+
+	modTime, err := config.SourceDateEpoch()
+	if err != nil {
+		return Entries{}, err
+	}
+
+	return Entries{Reproducible: true, ModTime: modTime}, nil
+}
+
+// vCenterExporter streams the VM export through govmomi, as govc can only
+// export to a directory. It logs in when the export starts, so that creating a
+// packager does not connect to vCenter.
+type vCenterExporter struct {
+	ctx            context.Context
+	config         vcenter_manager.FactoryConfig
+	manifestDigest digest.Algorithm
+}
+
+func (e *vCenterExporter) StreamExportVM(vmInventoryPath string, w iaas_clients.ExportFileWriter) error {
+	ctx := e.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	managerFactory := &vcenter_manager.ManagerFactory{Config: e.config}
+	manager, err := managerFactory.VCenterManager(ctx)
+	if err != nil {
+		return err
+	}
+
+	client := iaas_clients.NewGovmomiVcenterClient(ctx, manager)
+	client.ManifestDigest = e.manifestDigest
+	return client.StreamExportVM(vmInventoryPath, w)
+}
@@ -1,10 +1,25 @@
 package packager_test
 
 import (
+	"context"
+	"crypto/tls"
+	"io"
+	"os"
+	"path"
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
 
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/digest"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/events"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli/iaas_clients"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/config"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/packager"
 )
@@ -32,7 +47,7 @@ var _ = Describe("Factory", func() {
 					Vmdk: "path/to/a/vmdk",
 				}
 
-				actualPackager, err := packagerFactory.NewPackager(sourceConfig, outputConfig, logger)
+				actualPackager, err := packagerFactory.NewPackager(context.Background(), sourceConfig, outputConfig, logger)
 				Expect(err).NotTo(HaveOccurred())
 
 				Expect(actualPackager).To(BeAssignableToTypeOf(&packager.VmdkPackager{}))
@@ -49,11 +64,94 @@ var _ = Describe("Factory", func() {
 					VmInventoryPath: "some-vm-inventory-path",
 				}
 
-				actualPackager, err := packagerFactory.NewPackager(sourceConfig, outputConfig, logger)
+				actualPackager, err := packagerFactory.NewPackager(context.Background(), sourceConfig, outputConfig, logger)
 				Expect(err).NotTo(HaveOccurred())
 
 				Expect(actualPackager).To(BeAssignableToTypeOf(&packager.VCenterPackager{}))
 				Expect(actualPackager).NotTo(BeAssignableToTypeOf(&packager.VmdkPackager{}))
+				Expect(actualPackager.(*packager.VCenterPackager).Exporter).NotTo(BeNil())
+			})
+		})
+
+		Context("When progress is reported as events", func() {
+			BeforeEach(func() {
+				packagerFactory.Events = events.NewEmitter(GinkgoWriter)
+			})
+
+			It("reports the steps of packaging as events", func() {
+				vmdkPackager, err := packagerFactory.NewPackager(context.Background(), config.SourceConfig{Vmdk: "path/to/a/vmdk"}, outputConfig, logger)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(vmdkPackager.(*packager.VmdkPackager).Messenger).To(BeAssignableToTypeOf(&packager.JSONMessenger{}))
+				Expect(vmdkPackager.(*packager.VmdkPackager).Stdout).To(Equal(os.Stderr))
+
+				vCenterPackager, err := packagerFactory.NewPackager(context.Background(), config.SourceConfig{
+					Username:        "user",
+					Password:        "pass",
+					URL:             "some-url",
+					VmInventoryPath: "some-vm-inventory-path",
+				}, outputConfig, logger)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(vCenterPackager.(*packager.VCenterPackager).Messenger).To(BeAssignableToTypeOf(&packager.JSONMessenger{}))
+			})
+
+			It("does not report the steps of packaging otherwise", func() {
+				packagerFactory.Events = nil
+
+				vmdkPackager, err := packagerFactory.NewPackager(context.Background(), config.SourceConfig{Vmdk: "path/to/a/vmdk"}, outputConfig, logger)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(vmdkPackager.(*packager.VmdkPackager).Messenger).To(BeNil())
+				Expect(vmdkPackager.(*packager.VmdkPackager).Stdout).To(Equal(os.Stdout))
+			})
+		})
+
+		Context("When a reproducible stemcell is asked for", func() {
+			sourceConfig := config.SourceConfig{Vmdk: "path/to/a/vmdk"}
+			reproducibleConfig := outputConfig
+			reproducibleConfig.Reproducible = true
+
+			It("dates the entries of the stemcell to SOURCE_DATE_EPOCH", func() {
+				GinkgoT().Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+				actualPackager, err := packagerFactory.NewPackager(context.Background(), sourceConfig, reproducibleConfig, logger)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(actualPackager.(*packager.VmdkPackager).Entries).To(Equal(packager.Entries{Reproducible: true, ModTime: time.Unix(1700000000, 0).UTC()}))
+			})
+
+			It("returns an error when SOURCE_DATE_EPOCH is not a number", func() {
+				GinkgoT().Setenv("SOURCE_DATE_EPOCH", "soon")
+
+				_, err := packagerFactory.NewPackager(context.Background(), sourceConfig, reproducibleConfig, logger)
+				Expect(err).To(MatchError(ContainSubstring("SOURCE_DATE_EPOCH must be a whole number of seconds")))
+			})
+		})
+
+		Context("When a light stemcell is asked for", func() {
+			lightConfig := outputConfig
+			lightConfig.Light = true
+			lightConfig.IaaS = config.IaaSAWS
+
+			It("returns a light packager for an image reference", func() {
+				sourceConfig := config.SourceConfig{ImageRef: "us-east-1:ami-0123456789abcdef0"}
+
+				actualPackager, err := packagerFactory.NewPackager(context.Background(), sourceConfig, lightConfig, logger)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(actualPackager).To(BeAssignableToTypeOf(&packager.LightPackager{}))
+			})
+
+			It("returns an error without an image reference", func() {
+				sourceConfig := config.SourceConfig{Vmdk: "path/to/a/vmdk"}
+
+				_, err := packagerFactory.NewPackager(context.Background(), sourceConfig, lightConfig, logger)
+				Expect(err).To(MatchError("light stemcells need the image reference of an image published to the IaaS"))
+			})
+
+			It("returns an error for an image reference when a light stemcell is not asked for", func() {
+				sourceConfig := config.SourceConfig{ImageRef: "us-east-1:ami-0123456789abcdef0"}
+
+				_, err := packagerFactory.NewPackager(context.Background(), sourceConfig, outputConfig, logger)
+				Expect(err).To(MatchError("an image reference can only be packaged as a light stemcell"))
 			})
 		})
 
@@ -64,7 +162,7 @@ var _ = Describe("Factory", func() {
 					VmInventoryPath: "some-vm",
 				}
 
-				packager, err := packagerFactory.NewPackager(sourceConfig, outputConfig, logger)
+				packager, err := packagerFactory.NewPackager(context.Background(), sourceConfig, outputConfig, logger)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(Equal("configuration provided for VMDK & vCenter sources"))
 				Expect(packager).To(BeNil())
@@ -79,7 +177,7 @@ var _ = Describe("Factory", func() {
 					URL:             "some-url",
 				}
 
-				packager, err := packagerFactory.NewPackager(sourceConfig, outputConfig, logger)
+				packager, err := packagerFactory.NewPackager(context.Background(), sourceConfig, outputConfig, logger)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(Equal("missing vCenter configurations"))
 				Expect(packager).To(BeNil())
@@ -90,11 +188,135 @@ var _ = Describe("Factory", func() {
 			It("returns an error", func() {
 				sourceConfig := config.SourceConfig{}
 
-				packager, err := packagerFactory.NewPackager(sourceConfig, outputConfig, logger)
+				packager, err := packagerFactory.NewPackager(context.Background(), sourceConfig, outputConfig, logger)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(Equal("no configuration was provided"))
 				Expect(packager).To(BeNil())
 			})
 		})
+
+		Context("When the VM is exported from vCenter", func() {
+			var server *simulator.Server
+			var sourceConfig config.SourceConfig
+
+			BeforeEach(func() {
+				model := simulator.VPX()
+				Expect(model.Create()).To(Succeed())
+				DeferCleanup(model.Remove)
+				model.Service.TLS = new(tls.Config)
+
+				registry := model.Map()
+				vm := registry.Any("VirtualMachine").(*simulator.VirtualMachine)
+				registry.Put(&exportingVM{vm})
+				ovfManager := registry.Get(types.ManagedObjectReference{Type: "OvfManager", Value: "OvfManager"}).(*simulator.OvfManager)
+				registry.Put(&describingOvfManager{ovfManager})
+
+				server = model.Service.NewServer()
+				DeferCleanup(server.Close)
+				caCertFile, err := server.CertificateFile()
+				Expect(err).NotTo(HaveOccurred())
+
+				sourceConfig = config.SourceConfig{
+					Username:        "user",
+					Password:        "pass",
+					URL:             server.URL.Host,
+					CaCertFile:      caCertFile,
+					VmInventoryPath: "/DC0/vm/" + vm.Name,
+				}
+			})
+
+			exportManifest := func(outputConfig config.OutputConfig) string {
+				actualPackager, err := packagerFactory.NewPackager(context.Background(), sourceConfig, outputConfig, logger)
+				Expect(err).NotTo(HaveOccurred())
+
+				files := &exportedFiles{contents: map[string]string{}}
+				err = actualPackager.(*packager.VCenterPackager).Exporter.StreamExportVM(sourceConfig.VmInventoryPath, files)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(files.contents).To(HaveKey(path.Base(sourceConfig.VmInventoryPath) + ".mf"))
+				return files.contents[path.Base(sourceConfig.VmInventoryPath)+".mf"]
+			}
+
+			It("exports the VM with govmomi when it is the vCenter client", func() {
+				sourceConfig.VCenterClient = iaas_clients.VCenterClientGovmomi
+
+				actualPackager, err := packagerFactory.NewPackager(context.Background(), sourceConfig, outputConfig, logger)
+				Expect(err).NotTo(HaveOccurred())
+
+				vCenterPackager := actualPackager.(*packager.VCenterPackager)
+				Expect(vCenterPackager.Client).To(BeAssignableToTypeOf(&iaas_clients.GovmomiVcenterClient{}))
+				Expect(vCenterPackager.Exporter).To(BeIdenticalTo(vCenterPackager.Client))
+
+				Expect(vCenterPackager.Client.FindVM(sourceConfig.VmInventoryPath)).To(Succeed())
+			})
+
+			It("returns an error for an unknown vCenter client", func() {
+				sourceConfig.VCenterClient = "pyvmomi"
+
+				_, err := packagerFactory.NewPackager(context.Background(), sourceConfig, outputConfig, logger)
+				Expect(err).To(MatchError(`vcenter client must be one of govc, govmomi, got "pyvmomi"`))
+			})
+
+			It("writes the OVF manifest with sha1 by default", func() {
+				manifest := exportManifest(outputConfig)
+
+				Expect(manifest).To(MatchRegexp(`^SHA1\(\S+\.vmdk\)= [0-9a-f]{40}\n`))
+				Expect(manifest).To(MatchRegexp(`SHA1\(\S+\.ovf\)= [0-9a-f]{40}\n$`))
+			})
+
+			It("writes the OVF manifest with the strongest of the digest algorithms", func() {
+				sha256Config := outputConfig
+				sha256Config.DigestAlgorithms = digest.Algorithms{digest.SHA1, digest.SHA256}
+
+				manifest := exportManifest(sha256Config)
+
+				Expect(manifest).To(MatchRegexp(`^SHA256\(\S+\.vmdk\)= [0-9a-f]{64}\n`))
+				Expect(manifest).To(MatchRegexp(`SHA256\(\S+\.ovf\)= [0-9a-f]{64}\n$`))
+				Expect(manifest).NotTo(ContainSubstring("SHA1("))
+			})
+		})
 	})
 })
+
+// exportingVM exports a VM through a snapshot of it, as the simulator
+// cannot export VMs themselves. It can export the VM once.
+type exportingVM struct {
+	*simulator.VirtualMachine
+}
+
+func (vm *exportingVM) ExportVm(ctx *simulator.Context, _ *types.ExportVm) soap.HasFault {
+	// The rest of the simulator, exporting the snapshot included, expects
+	// the VM itself.
+	ctx.Map.Put(vm.VirtualMachine)
+
+	snapshot := &simulator.VirtualMachineSnapshot{VirtualMachineSnapshot: mo.VirtualMachineSnapshot{
+		Config: *vm.Config,
+		Vm:     vm.Self,
+	}}
+	lease := snapshot.ExportSnapshot(ctx, &types.ExportSnapshot{}).(*methods.ExportSnapshotBody).Res.Returnval
+
+	return &methods.ExportVmBody{Res: &types.ExportVmResponse{Returnval: lease}}
+}
+
+// describingOvfManager describes every VM with the same OVF descriptor, as the
+// simulator cannot describe VMs.
+type describingOvfManager struct {
+	*simulator.OvfManager
+}
+
+func (m *describingOvfManager) CreateDescriptor(_ *simulator.Context, _ *types.CreateDescriptor) soap.HasFault {
+	return &methods.CreateDescriptorBody{Res: &types.CreateDescriptorResponse{
+		Returnval: types.OvfCreateDescriptorResult{OvfDescriptor: "<Envelope/>"},
+	}}
+}
+
+// exportedFiles records the files of a VM export.
+type exportedFiles struct {
+	contents map[string]string
+}
+
+func (f *exportedFiles) WriteFile(name string, _ int64, r io.Reader) error {
+	contents, err := io.ReadAll(r)
+	f.contents[name] = string(contents)
+	return err
+}
@@ -0,0 +1,173 @@
+package packager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/digest"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/filesystem"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/config"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/manifest"
+)
+
+// gcpImageURLPrefix is prepended to GCP image references given as a path,
+// such as projects/<project>/global/images/<image>.
+const gcpImageURLPrefix = "https://www.googleapis.com/compute/v1/"
+
+var (
+	awsImageRef   = regexp.MustCompile(`^([a-z]{2}(?:-[a-z]+)+-\d+):(ami-[0-9a-f]+)$`)
+	azureImageRef = regexp.MustCompile(`^([^:]+):([^:]+):([^:]+):([^:]+)$`)
+	gcpImageRef   = regexp.MustCompile(`^projects/[^/]+/global/images/[^/]+$`)
+)
+
+// LightPackager creates light stemcells, which reference an image already
+// published to a public cloud instead of holding one, so their image is an
+// empty file.
+type LightPackager struct {
+	SourceConfig config.SourceConfig
+	OutputConfig config.OutputConfig
+	Entries      Entries
+	Logger       colorlogger.Logger
+	// Messenger is told about each step of packaging, if set.
+	Messenger StepMessenger
+}
+
+// ValidateFreeSpaceForPackage does nothing, as light stemcells only hold a
+// manifest.
+func (l LightPackager) ValidateFreeSpaceForPackage(fs filesystem.FileSystem) error {
+	return nil
+}
+
+func (l LightPackager) ValidateSourceParameters() error {
+	_, err := lightCloudProperties(l.OutputConfig.IaaS, l.SourceConfig.ImageRef)
+	return err
+}
+
+func (l LightPackager) Package() error {
+	stemcellPath := filepath.Join(l.OutputConfig.OutputDir, l.OutputConfig.StemcellFilename())
+	l.Logger.Printf("creating light stemcell for image (%s): %s", l.SourceConfig.ImageRef, stemcellPath)
+
+	cloudProperties, err := lightCloudProperties(l.OutputConfig.IaaS, l.SourceConfig.ImageRef)
+	if err != nil {
+		return err
+	}
+
+	// The stemcell is written next to its final path and only renamed once
+	// complete, as the vCenter packager does.
+	stemcell, err := os.CreateTemp(l.OutputConfig.OutputDir, ".light-stemcell-*")
+	if err != nil {
+		return fmt.Errorf("failed to create stemcell: %w", err)
+	}
+	defer os.Remove(stemcell.Name()) //nolint:errcheck
+	defer stemcell.Close()           //nolint:errcheck
+
+	options := StemcellOptions{
+		Compression: Compression{Level: l.OutputConfig.CompressionLevel, Threads: l.OutputConfig.CompressionThreads},
+		Digests:     l.OutputConfig.Digests(),
+		Entries:     l.Entries,
+	}
+	err = runStep(l.Messenger, StepCompress, func() error {
+		return WriteStemcell(stemcell, options, func(ImageWriter) error {
+			return nil
+		}, func(image digest.Digests) (contents string, err error) {
+			err = runStep(l.Messenger, StepManifest, func() error {
+				contents, err = manifestContents(manifest.StemcellManifest{
+					Name:            config.StemcellName(l.OutputConfig.IaaS, l.OutputConfig.Os),
+					Version:         l.OutputConfig.StemcellVersion,
+					APIVersion:      manifest.APIVersion,
+					SHA1:            image.String(),
+					OperatingSystem: config.OperatingSystem(l.OutputConfig.Os),
+					CloudProperties: cloudProperties,
+					StemcellFormats: []string{lightStemcellFormat(l.OutputConfig.IaaS)},
+				}, l.OutputConfig.CloudProperties)
+				return err
+			})
+			return contents, err
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	err = stemcell.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write stemcell: %w", err)
+	}
+	err = os.Chmod(stemcell.Name(), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write stemcell: %w", err)
+	}
+	err = os.Rename(stemcell.Name(), stemcellPath)
+	if err != nil {
+		return fmt.Errorf("failed to move stemcell into the output directory: %w", err)
+	}
+
+	l.Logger.Printf("created stemcell: %s", stemcellPath)
+	return nil
+}
+
+// lightStemcellFormat is the stemcell format that the CPI of iaas accepts
+// light stemcells in.
+func lightStemcellFormat(iaas string) string {
+	if iaas == config.IaaSGCP {
+		return "google-light"
+	}
+
+	return iaas + "-light"
+}
+
+// lightCloudProperties returns the cloud properties with which the CPI of iaas
+// finds the image of a light stemcell:
+//   - aws: comma separated region:ami-id pairs, recorded as the ami map
+//   - azure: a publisher:offer:sku:version URN, recorded as the image map
+//   - gcp: the image URL, or its projects/<project>/global/images/<image> path
+func lightCloudProperties(iaas, imageRef string) (map[string]interface{}, error) {
+	if imageRef == "" {
+		return nil, fmt.Errorf("light stemcells need an image reference")
+	}
+
+	properties := map[string]interface{}{"infrastructure": iaas}
+	switch iaas {
+	case config.IaaSAWS:
+		amis := map[string]string{}
+		for _, pair := range strings.Split(imageRef, ",") {
+			match := awsImageRef.FindStringSubmatch(strings.TrimSpace(pair))
+			if match == nil {
+				return nil, fmt.Errorf("AWS image reference must be region:ami-id pairs separated by commas, got %q", pair)
+			}
+			if _, ok := amis[match[1]]; ok {
+				return nil, fmt.Errorf("AWS image reference has more than one AMI for region %s", match[1])
+			}
+			amis[match[1]] = match[2]
+		}
+		properties["ami"] = amis
+	case config.IaaSAzure:
+		match := azureImageRef.FindStringSubmatch(imageRef)
+		if match == nil {
+			return nil, fmt.Errorf("Azure image reference must be a publisher:offer:sku:version URN, got %q", imageRef) //nolint:staticcheck
+		}
+		properties["os_type"] = "windows"
+		properties["image"] = map[string]string{
+			"publisher": match[1],
+			"offer":     match[2],
+			"sku":       match[3],
+			"version":   match[4],
+		}
+	case config.IaaSGCP:
+		imageURL := imageRef
+		if gcpImageRef.MatchString(imageRef) {
+			imageURL = gcpImageURLPrefix + imageRef
+		} else if !strings.HasPrefix(imageRef, gcpImageURLPrefix) || !gcpImageRef.MatchString(strings.TrimPrefix(imageRef, gcpImageURLPrefix)) {
+			return nil, fmt.Errorf("GCP image reference must be an image URL or projects/<project>/global/images/<image>, got %q", imageRef)
+		}
+		properties["image_url"] = imageURL
+	default:
+		return nil, fmt.Errorf("light stemcells are for IaaS %s, %s or %s, got %q", config.IaaSAWS, config.IaaSAzure, config.IaaSGCP, iaas)
+	}
+
+	return properties, nil
+}
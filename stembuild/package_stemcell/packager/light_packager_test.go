@@ -0,0 +1,193 @@
+package packager_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/digest"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/config"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/manifest"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/packager"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/packager/packagerfakes"
+)
+
+var _ = Describe("LightPackager", func() {
+	var lightPackager packager.LightPackager
+
+	BeforeEach(func() {
+		lightPackager = packager.LightPackager{
+			SourceConfig: config.SourceConfig{ImageRef: "us-east-1:ami-0123456789abcdef0,eu-west-1:ami-0fedcba9876543210"},
+			OutputConfig: config.OutputConfig{
+				Os:               "2019",
+				StemcellVersion:  "2019.12",
+				OutputDir:        GinkgoT().TempDir(),
+				CompressionLevel: config.DefaultCompressionLevel,
+				Light:            true,
+				IaaS:             config.IaaSAWS,
+			},
+			Logger: colorlogger.New(0, false, GinkgoWriter),
+		}
+	})
+
+	// readStemcell returns the files of the stemcell and its manifest.
+	readStemcell := func() (map[string][]byte, manifest.StemcellManifest) {
+		file, err := os.Open(filepath.Join(lightPackager.OutputConfig.OutputDir, lightPackager.OutputConfig.StemcellFilename()))
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close() //nolint:errcheck
+		gzr, err := gzip.NewReader(file)
+		Expect(err).NotTo(HaveOccurred())
+
+		files := map[string][]byte{}
+		tarReader := tar.NewReader(gzr)
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			files[header.Name], err = io.ReadAll(tarReader)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		stemcellManifest, err := manifest.Unmarshal(files["stemcell.MF"])
+		Expect(err).NotTo(HaveOccurred())
+		return files, stemcellManifest
+	}
+
+	It("logs where the stemcell is created", func() {
+		logOutput := gbytes.NewBuffer()
+		lightPackager.Logger = colorlogger.New(colorlogger.DEBUG, false, logOutput)
+
+		Expect(lightPackager.Package()).To(Succeed())
+
+		stemcellPath := filepath.Join(lightPackager.OutputConfig.OutputDir, lightPackager.OutputConfig.StemcellFilename())
+		Expect(logOutput).To(gbytes.Say("created stemcell: " + regexp.QuoteMeta(stemcellPath) + "\n"))
+	})
+
+	It("creates an AWS light stemcell with the AMI of each region", func() {
+		Expect(lightPackager.ValidateSourceParameters()).To(Succeed())
+		Expect(lightPackager.Package()).To(Succeed())
+
+		entries, err := os.ReadDir(lightPackager.OutputConfig.OutputDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Name()).To(Equal("light-bosh-stemcell-2019.12-aws-xen-hvm-windows2019-go_agent.tgz"))
+
+		files, stemcellManifest := readStemcell()
+		Expect(files).To(HaveLen(2))
+		Expect(files["image"]).To(BeEmpty())
+		Expect(stemcellManifest).To(Equal(manifest.StemcellManifest{
+			Name:            "bosh-aws-xen-hvm-windows2019-go_agent",
+			Version:         "2019.12",
+			APIVersion:      3,
+			SHA1:            "da39a3ee5e6b4b0d3255bfef95601890afd80709",
+			OperatingSystem: "windows2019",
+			CloudProperties: map[string]interface{}{
+				"infrastructure": "aws",
+				"ami": map[string]interface{}{
+					"us-east-1": "ami-0123456789abcdef0",
+					"eu-west-1": "ami-0fedcba9876543210",
+				},
+			},
+			StemcellFormats: []string{"aws-light"},
+		}))
+	})
+
+	It("creates an Azure light stemcell with the image of the URN", func() {
+		lightPackager.OutputConfig.IaaS = config.IaaSAzure
+		lightPackager.SourceConfig.ImageRef = "pivotal:bosh-windows-server-2019:2019-SKU:2019.12.0"
+		lightPackager.OutputConfig.DigestAlgorithms = digest.Algorithms{digest.SHA1, digest.SHA256}
+
+		Expect(lightPackager.Package()).To(Succeed())
+
+		_, stemcellManifest := readStemcell()
+		Expect(stemcellManifest.Name).To(Equal("bosh-azure-hyperv-windows2019-go_agent"))
+		Expect(stemcellManifest.SHA1).To(Equal("sha1:da39a3ee5e6b4b0d3255bfef95601890afd80709;sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"))
+		Expect(stemcellManifest.CloudProperties).To(Equal(map[string]interface{}{
+			"infrastructure": "azure",
+			"os_type":        "windows",
+			"image": map[string]interface{}{
+				"publisher": "pivotal",
+				"offer":     "bosh-windows-server-2019",
+				"sku":       "2019-SKU",
+				"version":   "2019.12.0",
+			},
+		}))
+		Expect(stemcellManifest.StemcellFormats).To(Equal([]string{"azure-light"}))
+	})
+
+	It("creates a GCP light stemcell with the image URL", func() {
+		lightPackager.OutputConfig.IaaS = config.IaaSGCP
+		lightPackager.SourceConfig.ImageRef = "projects/bosh-windows/global/images/windows2019-2019-12"
+
+		Expect(lightPackager.Package()).To(Succeed())
+
+		_, stemcellManifest := readStemcell()
+		Expect(stemcellManifest.Name).To(Equal("bosh-google-kvm-windows2019-go_agent"))
+		Expect(stemcellManifest.CloudProperties).To(Equal(map[string]interface{}{
+			"infrastructure": "gcp",
+			"image_url":      "https://www.googleapis.com/compute/v1/projects/bosh-windows/global/images/windows2019-2019-12",
+		}))
+		Expect(stemcellManifest.StemcellFormats).To(Equal([]string{"google-light"}))
+	})
+
+	It("adds the given cloud properties to those of the image", func() {
+		lightPackager.OutputConfig.CloudProperties = config.CloudProperties{"encrypted": false, "root_device_name": "/dev/sda1"}
+
+		Expect(lightPackager.Package()).To(Succeed())
+
+		_, stemcellManifest := readStemcell()
+		Expect(stemcellManifest.CloudProperties).To(HaveKeyWithValue("encrypted", false))
+		Expect(stemcellManifest.CloudProperties).To(HaveKeyWithValue("root_device_name", "/dev/sda1"))
+		Expect(stemcellManifest.CloudProperties).To(HaveKey("ami"))
+	})
+
+	It("reports writing the manifest while compressing the stemcell", func() {
+		messenger := &packagerfakes.FakeStepMessenger{}
+		var steps []string
+		messenger.StepStartedCalls(func(step string) { steps = append(steps, step+" started") })
+		messenger.StepSucceededCalls(func(step string) { steps = append(steps, step+" succeeded") })
+		lightPackager.Messenger = messenger
+
+		Expect(lightPackager.Package()).To(Succeed())
+
+		Expect(steps).To(Equal([]string{"compress started", "manifest started", "manifest succeeded", "compress succeeded"}))
+	})
+
+	It("does not create a stemcell with an invalid manifest", func() {
+		lightPackager.OutputConfig.CloudProperties = config.CloudProperties{"": "no key"}
+
+		Expect(lightPackager.Package()).To(MatchError("invalid stemcell.MF: cloud_properties has an empty key"))
+
+		entries, err := os.ReadDir(lightPackager.OutputConfig.OutputDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+
+	DescribeTable("rejects a malformed image reference",
+		func(iaas, imageRef, message string) {
+			lightPackager.OutputConfig.IaaS = iaas
+			lightPackager.SourceConfig.ImageRef = imageRef
+
+			Expect(lightPackager.ValidateSourceParameters()).To(MatchError(ContainSubstring(message)))
+			Expect(lightPackager.Package()).To(MatchError(ContainSubstring(message)))
+
+			entries, err := os.ReadDir(lightPackager.OutputConfig.OutputDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+		},
+		Entry("an AMI without a region", config.IaaSAWS, "ami-0123456789abcdef0", "region:ami-id pairs"),
+		Entry("two AMIs for a region", config.IaaSAWS, "us-east-1:ami-01,us-east-1:ami-02", "more than one AMI for region us-east-1"),
+		Entry("an incomplete URN", config.IaaSAzure, "pivotal:bosh-windows-server-2019", "publisher:offer:sku:version URN"),
+		Entry("a GCP image name", config.IaaSGCP, "windows2019-2019-12", "image URL or projects/<project>/global/images/<image>"),
+	)
+})
@@ -0,0 +1,59 @@
+package packager
+
+import (
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/events"
+)
+
+// The steps of packaging a stemcell. Compressing spans the whole stemcell,
+// so the export of the image and the manifest are written within it.
+const (
+	StepExport   = "export"
+	StepCompress = "compress"
+	StepManifest = "manifest"
+)
+
+//counterfeiter:generate . StepMessenger
+type StepMessenger interface {
+	StepStarted(step string)
+	StepSucceeded(step string)
+	StepFailed(step string, err error)
+}
+
+// runStep runs step, reporting when it starts and how it ends to messenger
+// if there is one.
+func runStep(messenger StepMessenger, step string, run func() error) error {
+	if messenger == nil {
+		return run()
+	}
+
+	messenger.StepStarted(step)
+	err := run()
+	if err != nil {
+		messenger.StepFailed(step, err)
+		return err
+	}
+	messenger.StepSucceeded(step)
+	return nil
+}
+
+// JSONMessenger reports the steps of packaging as `-output-format json`
+// events.
+type JSONMessenger struct {
+	events *events.Emitter
+}
+
+func NewJSONMessenger(emitter *events.Emitter) *JSONMessenger {
+	return &JSONMessenger{events: emitter}
+}
+
+func (m *JSONMessenger) StepStarted(step string) {
+	m.events.Started(step, "")
+}
+
+func (m *JSONMessenger) StepSucceeded(step string) {
+	m.events.Succeeded(step, "")
+}
+
+func (m *JSONMessenger) StepFailed(step string, err error) {
+	m.events.Failed(step, err)
+}
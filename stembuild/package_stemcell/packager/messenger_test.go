@@ -0,0 +1,42 @@
+package packager_test
+
+import (
+	"encoding/json"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/events"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/packager"
+)
+
+var _ = Describe("JSONMessenger", func() {
+	It("writes an event for each phase of a step", func() {
+		out := gbytes.NewBuffer()
+		messenger := packager.NewJSONMessenger(events.NewEmitter(out))
+
+		messenger.StepStarted(packager.StepExport)
+		messenger.StepSucceeded(packager.StepExport)
+		messenger.StepStarted(packager.StepManifest)
+		messenger.StepFailed(packager.StepManifest, errors.New("invalid stemcell.MF"))
+
+		var written []events.Event
+		decoder := json.NewDecoder(out)
+		for decoder.More() {
+			var event events.Event
+			Expect(decoder.Decode(&event)).To(Succeed())
+			written = append(written, event)
+		}
+
+		Expect(written).To(HaveLen(4))
+		Expect(written[0].Step).To(Equal("export"))
+		Expect(written[0].Phase).To(Equal(events.PhaseStarted))
+		Expect(written[1].Phase).To(Equal(events.PhaseSucceeded))
+		Expect(written[1].Duration).NotTo(BeNil())
+		Expect(written[3].Step).To(Equal("manifest"))
+		Expect(written[3].Phase).To(Equal(events.PhaseFailed))
+		Expect(written[3].Error).To(Equal("invalid stemcell.MF"))
+	})
+})
@@ -8,6 +8,11 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/config"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/manifest"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/pgzip"
 )
 
 func WriteManifest(manifestContents, manifestPath string) error {
@@ -33,25 +38,43 @@ func WriteManifest(manifestContents, manifestPath string) error {
 	return nil
 }
 
-func CreateManifest(osVersion, version, sha1sum string) string {
-	const format = `---
-name: bosh-vsphere-esxi-windows%[1]s-go_agent
-version: '%[2]s'
-api_version: 3
-sha1: %[3]s
-operating_system: windows%[1]s
-cloud_properties:
-  infrastructure: vsphere
-  hypervisor: esxi
-stemcell_formats:
-- vsphere-ovf
-- vsphere-ova
-`
-	return fmt.Sprintf(format, osVersion, version, sha1sum)
+// CreateManifest returns the stemcell.MF of a vSphere stemcell. imageDigest
+// is either a bare sha1 or a BOSH multi-digest such as
+// "sha1:<sum>;sha256:<sum>".
+func CreateManifest(osVersion, version, imageDigest string) manifest.StemcellManifest {
+	return manifest.StemcellManifest{
+		Name:            config.StemcellName(config.IaaSvSphere, osVersion),
+		Version:         version,
+		APIVersion:      manifest.APIVersion,
+		SHA1:            imageDigest,
+		OperatingSystem: config.OperatingSystem(osVersion),
+		CloudProperties: map[string]interface{}{
+			"infrastructure": "vsphere",
+			"hypervisor":     "esxi",
+		},
+		StemcellFormats: []string{"vsphere-ovf", "vsphere-ova"},
+	}
+}
+
+// manifestContents adds cloudProperties to m and returns it as the contents of
+// stemcell.MF, once it has been validated.
+func manifestContents(m manifest.StemcellManifest, cloudProperties config.CloudProperties) (string, error) {
+	m = m.WithCloudProperties(cloudProperties)
+	err := m.Validate()
+	if err != nil {
+		return "", fmt.Errorf("invalid stemcell.MF: %w", err)
+	}
 
+	contents, err := m.Marshal()
+	if err != nil {
+		return "", fmt.Errorf("unable to create stemcell.MF: %w", err)
+	}
+	return string(contents), nil
 }
 
-func TarGenerator(destFileName string, sourceDirName string) (string, error) {
+// TarGenerator writes the files in sourceDirName, in the order of their names,
+// to a gzipped tarball and returns its sha1.
+func TarGenerator(destFileName string, sourceDirName string, entries Entries) (string, error) {
 	sourceDir, err := os.Open(sourceDirName)
 	if err != nil {
 		return "", fmt.Errorf("unable to open %s", sourceDirName)
@@ -62,6 +85,8 @@ func TarGenerator(destFileName string, sourceDirName string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("unable to list files in %s", sourceDirName)
 	}
+	// Readdir returns the files in whatever order the filesystem keeps them.
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
 
 	// create tar file
 	destFile, err := os.Create(destFileName)
@@ -71,7 +96,10 @@ func TarGenerator(destFileName string, sourceDirName string) (string, error) {
 	defer destFile.Close() //nolint:errcheck
 
 	sha1Hash := sha1.New()
-	gzw := gzip.NewWriter(io.MultiWriter(destFile, sha1Hash))
+	gzw, err := pgzip.NewWriter(io.MultiWriter(destFile, sha1Hash), gzip.DefaultCompression, 0)
+	if err != nil {
+		return "", err
+	}
 	tarWriter := tar.NewWriter(gzw)
 
 	for _, fileInfo := range files {
@@ -79,7 +107,7 @@ func TarGenerator(destFileName string, sourceDirName string) (string, error) {
 			continue
 		}
 
-		err = writeFileHeader(fileInfo, tarWriter)
+		err = writeFileHeader(fileInfo, entries, tarWriter)
 		if err != nil {
 			return "", fmt.Errorf("unable to write to header of destination tar file %w", err)
 		}
@@ -102,14 +130,14 @@ func TarGenerator(destFileName string, sourceDirName string) (string, error) {
 	return fmt.Sprintf("%x", sha1Hash.Sum(nil)), nil
 }
 
-func writeFileHeader(fileInfo os.FileInfo, tarWriter *tar.Writer) error {
+func writeFileHeader(fileInfo os.FileInfo, entries Entries, tarWriter *tar.Writer) error {
 	header := new(tar.Header)
 	header.Name = fileInfo.Name()
 	header.Size = fileInfo.Size()
 	header.Mode = int64(fileInfo.Mode())
 	header.ModTime = fileInfo.ModTime()
 
-	return tarWriter.WriteHeader(header)
+	return tarWriter.WriteHeader(entries.normalize(header))
 }
 
 func writeFilePathToTar(filepath string, tarWriter *tar.Writer) error {
@@ -127,6 +155,7 @@ func writeFilePathToTar(filepath string, tarWriter *tar.Writer) error {
 	return nil
 }
 
+// StemcellFilename returns the file name of a vSphere stemcell.
 func StemcellFilename(version, os string) string {
-	return fmt.Sprintf("bosh-stemcell-%s-vsphere-esxi-windows%s-go_agent.tgz", version, os)
+	return config.StemcellFilename(version, os, config.IaaSvSphere, false)
 }
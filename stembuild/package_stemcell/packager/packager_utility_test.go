@@ -9,6 +9,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -50,7 +51,7 @@ var _ = Describe("Packager Utility", func() {
 
 			tarball := filepath.Join(destinationDir, "tarball")
 
-			sha1Sum, err := TarGenerator(tarball, sourceDir)
+			sha1Sum, err := TarGenerator(tarball, sourceDir, Entries{})
 
 			Expect(err).NotTo(HaveOccurred())
 
@@ -91,25 +92,73 @@ var _ = Describe("Packager Utility", func() {
 			expectedSha1Sum := fmt.Sprintf("%x", expectedSha1.Sum(nil))
 			Expect(sha1Sum).To(Equal(expectedSha1Sum))
 		})
+
+		It("writes the same tarball for the same files when reproducible", func() {
+			entries := Entries{Reproducible: true, ModTime: time.Unix(1700000000, 0)}
+			writeFiles := func(dir string, names []string, mode os.FileMode, modTime time.Time) {
+				for _, name := range names {
+					path := filepath.Join(dir, name)
+					Expect(os.WriteFile(path, []byte(name+" content\n"), mode)).To(Succeed())
+					Expect(os.Chmod(path, mode)).To(Succeed())
+					Expect(os.Chtimes(path, modTime, modTime)).To(Succeed())
+				}
+			}
+
+			writeFiles(sourceDir, []string{"b", "a", "c"}, 0600, time.Now())
+			firstSha1, err := TarGenerator(filepath.Join(destinationDir, "first"), sourceDir, entries)
+			Expect(err).NotTo(HaveOccurred())
+
+			otherSourceDir := filepath.Join(destinationDir, "other-source")
+			Expect(os.Mkdir(otherSourceDir, 0755)).To(Succeed())
+			writeFiles(otherSourceDir, []string{"c", "a", "b"}, 0755, time.Now().Add(-time.Hour))
+			secondSha1, err := TarGenerator(filepath.Join(destinationDir, "second"), otherSourceDir, entries)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(secondSha1).To(Equal(firstSha1))
+
+			tarball, err := os.Open(filepath.Join(destinationDir, "first"))
+			Expect(err).NotTo(HaveOccurred())
+			defer tarball.Close() //nolint:errcheck
+			gzr, err := gzip.NewReader(tarball)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(gzr.ModTime.IsZero()).To(BeTrue())
+
+			var names []string
+			tarReader := tar.NewReader(gzr)
+			for {
+				header, err := tarReader.Next()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).NotTo(HaveOccurred())
+				names = append(names, header.Name)
+				Expect(header.ModTime).To(BeTemporally("==", entries.ModTime))
+				Expect(header.Mode).To(Equal(int64(0644)))
+				Expect(header.Uid).To(BeZero())
+				Expect(header.Uname).To(BeEmpty())
+			}
+			Expect(names).To(Equal([]string{"a", "b", "c"}))
+		})
 	})
 
 	Context("CreateManifest", func() {
 		It("Creates a manifest correctly", func() {
 			expectedManifest := `---
 name: bosh-vsphere-esxi-windows1-go_agent
-version: 'version'
+version: version
 api_version: 3
 sha1: sha1sum
 operating_system: windows1
 cloud_properties:
-  infrastructure: vsphere
   hypervisor: esxi
+  infrastructure: vsphere
 stemcell_formats:
-- vsphere-ovf
-- vsphere-ova
+  - vsphere-ovf
+  - vsphere-ova
 `
-			result := CreateManifest("1", "version", "sha1sum")
-			Expect(result).To(Equal(expectedManifest))
+			result, err := CreateManifest("1", "version", "sha1sum").Marshal()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(result)).To(Equal(expectedManifest))
 		})
 	})
 
@@ -20,18 +20,6 @@ type FakeIaasClient struct {
 	ejectCDRomReturnsOnCall map[int]struct {
 		result1 error
 	}
-	ExportVMStub        func(string, string) error
-	exportVMMutex       sync.RWMutex
-	exportVMArgsForCall []struct {
-		arg1 string
-		arg2 string
-	}
-	exportVMReturns struct {
-		result1 error
-	}
-	exportVMReturnsOnCall map[int]struct {
-		result1 error
-	}
 	FindVMStub        func(string) error
 	findVMMutex       sync.RWMutex
 	findVMArgsForCall []struct {
@@ -154,68 +142,6 @@ func (fake *FakeIaasClient) EjectCDRomReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
-func (fake *FakeIaasClient) ExportVM(arg1 string, arg2 string) error {
-	fake.exportVMMutex.Lock()
-	ret, specificReturn := fake.exportVMReturnsOnCall[len(fake.exportVMArgsForCall)]
-	fake.exportVMArgsForCall = append(fake.exportVMArgsForCall, struct {
-		arg1 string
-		arg2 string
-	}{arg1, arg2})
-	stub := fake.ExportVMStub
-	fakeReturns := fake.exportVMReturns
-	fake.recordInvocation("ExportVM", []interface{}{arg1, arg2})
-	fake.exportVMMutex.Unlock()
-	if stub != nil {
-		return stub(arg1, arg2)
-	}
-	if specificReturn {
-		return ret.result1
-	}
-	return fakeReturns.result1
-}
-
-func (fake *FakeIaasClient) ExportVMCallCount() int {
-	fake.exportVMMutex.RLock()
-	defer fake.exportVMMutex.RUnlock()
-	return len(fake.exportVMArgsForCall)
-}
-
-func (fake *FakeIaasClient) ExportVMCalls(stub func(string, string) error) {
-	fake.exportVMMutex.Lock()
-	defer fake.exportVMMutex.Unlock()
-	fake.ExportVMStub = stub
-}
-
-func (fake *FakeIaasClient) ExportVMArgsForCall(i int) (string, string) {
-	fake.exportVMMutex.RLock()
-	defer fake.exportVMMutex.RUnlock()
-	argsForCall := fake.exportVMArgsForCall[i]
-	return argsForCall.arg1, argsForCall.arg2
-}
-
-func (fake *FakeIaasClient) ExportVMReturns(result1 error) {
-	fake.exportVMMutex.Lock()
-	defer fake.exportVMMutex.Unlock()
-	fake.ExportVMStub = nil
-	fake.exportVMReturns = struct {
-		result1 error
-	}{result1}
-}
-
-func (fake *FakeIaasClient) ExportVMReturnsOnCall(i int, result1 error) {
-	fake.exportVMMutex.Lock()
-	defer fake.exportVMMutex.Unlock()
-	fake.ExportVMStub = nil
-	if fake.exportVMReturnsOnCall == nil {
-		fake.exportVMReturnsOnCall = make(map[int]struct {
-			result1 error
-		})
-	}
-	fake.exportVMReturnsOnCall[i] = struct {
-		result1 error
-	}{result1}
-}
-
 func (fake *FakeIaasClient) FindVM(arg1 string) error {
 	fake.findVMMutex.Lock()
 	ret, specificReturn := fake.findVMReturnsOnCall[len(fake.findVMArgsForCall)]
@@ -514,8 +440,6 @@ func (fake *FakeIaasClient) Invocations() map[string][][]interface{} {
 	defer fake.invocationsMutex.RUnlock()
 	fake.ejectCDRomMutex.RLock()
 	defer fake.ejectCDRomMutex.RUnlock()
-	fake.exportVMMutex.RLock()
-	defer fake.exportVMMutex.RUnlock()
 	fake.findVMMutex.RLock()
 	defer fake.findVMMutex.RUnlock()
 	fake.listDevicesMutex.RLock()
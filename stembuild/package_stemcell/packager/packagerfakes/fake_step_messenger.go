@@ -0,0 +1,156 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package packagerfakes
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/packager"
+)
+
+type FakeStepMessenger struct {
+	StepFailedStub        func(string, error)
+	stepFailedMutex       sync.RWMutex
+	stepFailedArgsForCall []struct {
+		arg1 string
+		arg2 error
+	}
+	StepStartedStub        func(string)
+	stepStartedMutex       sync.RWMutex
+	stepStartedArgsForCall []struct {
+		arg1 string
+	}
+	StepSucceededStub        func(string)
+	stepSucceededMutex       sync.RWMutex
+	stepSucceededArgsForCall []struct {
+		arg1 string
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeStepMessenger) StepFailed(arg1 string, arg2 error) {
+	fake.stepFailedMutex.Lock()
+	fake.stepFailedArgsForCall = append(fake.stepFailedArgsForCall, struct {
+		arg1 string
+		arg2 error
+	}{arg1, arg2})
+	stub := fake.StepFailedStub
+	fake.recordInvocation("StepFailed", []interface{}{arg1, arg2})
+	fake.stepFailedMutex.Unlock()
+	if stub != nil {
+		fake.StepFailedStub(arg1, arg2)
+	}
+}
+
+func (fake *FakeStepMessenger) StepFailedCallCount() int {
+	fake.stepFailedMutex.RLock()
+	defer fake.stepFailedMutex.RUnlock()
+	return len(fake.stepFailedArgsForCall)
+}
+
+func (fake *FakeStepMessenger) StepFailedCalls(stub func(string, error)) {
+	fake.stepFailedMutex.Lock()
+	defer fake.stepFailedMutex.Unlock()
+	fake.StepFailedStub = stub
+}
+
+func (fake *FakeStepMessenger) StepFailedArgsForCall(i int) (string, error) {
+	fake.stepFailedMutex.RLock()
+	defer fake.stepFailedMutex.RUnlock()
+	argsForCall := fake.stepFailedArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeStepMessenger) StepStarted(arg1 string) {
+	fake.stepStartedMutex.Lock()
+	fake.stepStartedArgsForCall = append(fake.stepStartedArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.StepStartedStub
+	fake.recordInvocation("StepStarted", []interface{}{arg1})
+	fake.stepStartedMutex.Unlock()
+	if stub != nil {
+		fake.StepStartedStub(arg1)
+	}
+}
+
+func (fake *FakeStepMessenger) StepStartedCallCount() int {
+	fake.stepStartedMutex.RLock()
+	defer fake.stepStartedMutex.RUnlock()
+	return len(fake.stepStartedArgsForCall)
+}
+
+func (fake *FakeStepMessenger) StepStartedCalls(stub func(string)) {
+	fake.stepStartedMutex.Lock()
+	defer fake.stepStartedMutex.Unlock()
+	fake.StepStartedStub = stub
+}
+
+func (fake *FakeStepMessenger) StepStartedArgsForCall(i int) string {
+	fake.stepStartedMutex.RLock()
+	defer fake.stepStartedMutex.RUnlock()
+	argsForCall := fake.stepStartedArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeStepMessenger) StepSucceeded(arg1 string) {
+	fake.stepSucceededMutex.Lock()
+	fake.stepSucceededArgsForCall = append(fake.stepSucceededArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.StepSucceededStub
+	fake.recordInvocation("StepSucceeded", []interface{}{arg1})
+	fake.stepSucceededMutex.Unlock()
+	if stub != nil {
+		fake.StepSucceededStub(arg1)
+	}
+}
+
+func (fake *FakeStepMessenger) StepSucceededCallCount() int {
+	fake.stepSucceededMutex.RLock()
+	defer fake.stepSucceededMutex.RUnlock()
+	return len(fake.stepSucceededArgsForCall)
+}
+
+func (fake *FakeStepMessenger) StepSucceededCalls(stub func(string)) {
+	fake.stepSucceededMutex.Lock()
+	defer fake.stepSucceededMutex.Unlock()
+	fake.StepSucceededStub = stub
+}
+
+func (fake *FakeStepMessenger) StepSucceededArgsForCall(i int) string {
+	fake.stepSucceededMutex.RLock()
+	defer fake.stepSucceededMutex.RUnlock()
+	argsForCall := fake.stepSucceededArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeStepMessenger) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.stepFailedMutex.RLock()
+	defer fake.stepFailedMutex.RUnlock()
+	fake.stepStartedMutex.RLock()
+	defer fake.stepStartedMutex.RUnlock()
+	fake.stepSucceededMutex.RLock()
+	defer fake.stepSucceededMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeStepMessenger) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ packager.StepMessenger = new(FakeStepMessenger)
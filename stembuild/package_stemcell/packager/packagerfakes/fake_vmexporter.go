@@ -0,0 +1,114 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package packagerfakes
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli/iaas_clients"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/packager"
+)
+
+type FakeVMExporter struct {
+	StreamExportVMStub        func(string, iaas_clients.ExportFileWriter) error
+	streamExportVMMutex       sync.RWMutex
+	streamExportVMArgsForCall []struct {
+		arg1 string
+		arg2 iaas_clients.ExportFileWriter
+	}
+	streamExportVMReturns struct {
+		result1 error
+	}
+	streamExportVMReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeVMExporter) StreamExportVM(arg1 string, arg2 iaas_clients.ExportFileWriter) error {
+	fake.streamExportVMMutex.Lock()
+	ret, specificReturn := fake.streamExportVMReturnsOnCall[len(fake.streamExportVMArgsForCall)]
+	fake.streamExportVMArgsForCall = append(fake.streamExportVMArgsForCall, struct {
+		arg1 string
+		arg2 iaas_clients.ExportFileWriter
+	}{arg1, arg2})
+	stub := fake.StreamExportVMStub
+	fakeReturns := fake.streamExportVMReturns
+	fake.recordInvocation("StreamExportVM", []interface{}{arg1, arg2})
+	fake.streamExportVMMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeVMExporter) StreamExportVMCallCount() int {
+	fake.streamExportVMMutex.RLock()
+	defer fake.streamExportVMMutex.RUnlock()
+	return len(fake.streamExportVMArgsForCall)
+}
+
+func (fake *FakeVMExporter) StreamExportVMCalls(stub func(string, iaas_clients.ExportFileWriter) error) {
+	fake.streamExportVMMutex.Lock()
+	defer fake.streamExportVMMutex.Unlock()
+	fake.StreamExportVMStub = stub
+}
+
+func (fake *FakeVMExporter) StreamExportVMArgsForCall(i int) (string, iaas_clients.ExportFileWriter) {
+	fake.streamExportVMMutex.RLock()
+	defer fake.streamExportVMMutex.RUnlock()
+	argsForCall := fake.streamExportVMArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeVMExporter) StreamExportVMReturns(result1 error) {
+	fake.streamExportVMMutex.Lock()
+	defer fake.streamExportVMMutex.Unlock()
+	fake.StreamExportVMStub = nil
+	fake.streamExportVMReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeVMExporter) StreamExportVMReturnsOnCall(i int, result1 error) {
+	fake.streamExportVMMutex.Lock()
+	defer fake.streamExportVMMutex.Unlock()
+	fake.StreamExportVMStub = nil
+	if fake.streamExportVMReturnsOnCall == nil {
+		fake.streamExportVMReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.streamExportVMReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeVMExporter) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.streamExportVMMutex.RLock()
+	defer fake.streamExportVMMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeVMExporter) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ packager.VMExporter = new(FakeVMExporter)
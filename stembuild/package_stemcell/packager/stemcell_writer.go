@@ -0,0 +1,445 @@
+package packager
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/digest"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/pgzip"
+)
+
+// Compression is the gzip level and the number of threads used to compress
+// stemcells and their images.
+type Compression struct {
+	Level   int
+	Threads int
+}
+
+func (c Compression) newWriter(w io.Writer) (*pgzip.Writer, error) {
+	return pgzip.NewWriter(w, c.Level, c.Threads)
+}
+
+// Entries sets the metadata of the files written into stemcells and their
+// images. Reproducible entries all get ModTime, mode 0644 and no owner, so
+// that identical inputs give byte-identical stemcells; otherwise they get the
+// current time.
+type Entries struct {
+	Reproducible bool
+	ModTime      time.Time
+}
+
+// header returns the header of a regular file.
+func (e Entries) header(name string, size int64) *tar.Header {
+	return e.normalize(&tar.Header{
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	})
+}
+
+// normalize clears everything in h that depends on when or by whom the file
+// was written, if entries are reproducible.
+func (e Entries) normalize(h *tar.Header) *tar.Header {
+	if !e.Reproducible {
+		return h
+	}
+
+	h.ModTime = e.ModTime
+	h.AccessTime = time.Time{}
+	h.ChangeTime = time.Time{}
+	h.Uid, h.Gid = 0, 0
+	h.Uname, h.Gname = "", ""
+	h.Mode = 0644
+	if h.Typeflag == tar.TypeDir {
+		h.Mode = 0755
+	}
+
+	return h
+}
+
+// StemcellOptions are the settings for writing a stemcell: how it is
+// compressed, the digests of the image recorded in its manifest and the
+// metadata of its entries.
+type StemcellOptions struct {
+	Compression Compression
+	Digests     digest.Algorithms
+	Entries     Entries
+}
+
+const (
+	tarBlockSize = 512
+	// headerMemberSize is the size of a gzip member holding one tar block
+	// in a single stored (uncompressed) deflate block: the 10 byte gzip
+	// header, the 5 byte block header, the tar block and the 8 byte trailer.
+	headerMemberSize = 10 + 5 + tarBlockSize + 8
+)
+
+// ImageWriter is what the gzipped image of a stemcell is written to.
+type ImageWriter interface {
+	io.Writer
+	// Reserve leaves size bytes of the image, at most maxStoredSize, to be
+	// filled in by fill once they are known: the tar header of a file whose
+	// size is only known once it has been written, for instance.
+	Reserve(size int) (fill func([]byte) error, err error)
+}
+
+// WriteStemcell writes a stemcell tarball to out in a single pass, so that
+// the image never has to be stored on disk on its own. writeImage streams the
+// gzipped image, and manifest returns the contents of stemcell.MF for the
+// digests of the image, computed with each of options.Digests.
+//
+// A tar entry needs its size up front, which is not known until the image has
+// been written. The tarball is therefore written as a multi-member gzip file:
+// the tar header of the image is stored uncompressed in a fixed size member
+// at the start, which is filled in once the image is complete, followed by a
+// compressed member with the image and stemcell.MF. gzip and tar read such a
+// file as one stream. Parts of the image reserved by writeImage are stored in
+// members of their own in the same way; as they are only filled in afterwards,
+// the image is then read back from out to compute its digests.
+func WriteStemcell(out io.ReadWriteSeeker, options StemcellOptions, writeImage func(ImageWriter) error, manifest func(image digest.Digests) (string, error)) error {
+	start, err := out.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(make([]byte, headerMemberSize))
+	if err != nil {
+		return fmt.Errorf("unable to write stemcell: %w", err)
+	}
+
+	gzw, err := options.Compression.newWriter(out)
+	if err != nil {
+		return err
+	}
+	image := &stemcellImage{out: out, compression: options.Compression, gzw: gzw, hash: digest.NewHash(options.Digests)}
+	// Closing again is harmless, and stops the compressing goroutines if the
+	// stemcell is abandoned part way through.
+	defer func() {
+		image.gzw.Close() //nolint:errcheck
+	}()
+
+	err = writeImage(image)
+	if err != nil {
+		return err
+	}
+
+	imageDigests := image.hash.Digests()
+	if len(image.reserved) > 0 {
+		imageDigests, err = image.fill(start+headerMemberSize, options.Digests)
+		if err != nil {
+			return err
+		}
+	}
+
+	if pad := image.n % tarBlockSize; pad != 0 {
+		_, err = image.gzw.Write(make([]byte, tarBlockSize-pad))
+		if err != nil {
+			return fmt.Errorf("unable to write stemcell: %w", err)
+		}
+	}
+
+	manifestContents, err := manifest(imageDigests)
+	if err != nil {
+		return err
+	}
+	tarWriter := tar.NewWriter(image.gzw)
+	err = tarWriter.WriteHeader(options.Entries.header("stemcell.MF", int64(len(manifestContents))))
+	if err != nil {
+		return fmt.Errorf("unable to write stemcell.MF: %w", err)
+	}
+	_, err = io.WriteString(tarWriter, manifestContents)
+	if err != nil {
+		return fmt.Errorf("unable to write stemcell.MF: %w", err)
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		return fmt.Errorf("unable to close stemcell: %w", err)
+	}
+	err = image.gzw.Close()
+	if err != nil {
+		return fmt.Errorf("unable to close stemcell (gzip): %w", err)
+	}
+
+	member, err := headerMember(options.Entries, "image", image.n)
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Seek(start, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(member)
+	if err != nil {
+		return fmt.Errorf("unable to write stemcell: %w", err)
+	}
+
+	_, err = out.Seek(0, io.SeekEnd)
+	return err
+}
+
+// stemcellImage writes the image into the compressed stream of a stemcell,
+// counting and hashing it as it goes.
+type stemcellImage struct {
+	out         io.ReadWriteSeeker
+	compression Compression
+	gzw         *pgzip.Writer
+	hash        *digest.Hash
+	n           int64
+	reserved    []*reservation
+}
+
+// reservation is a part of the image stored in a gzip member of its own at
+// offset in the stemcell, with the data it is to be filled with.
+type reservation struct {
+	offset int64
+	size   int
+	data   []byte
+}
+
+func (i *stemcellImage) Write(p []byte) (int, error) {
+	n, err := i.gzw.Write(p)
+	i.hash.Write(p[:n]) //nolint:errcheck
+	i.n += int64(n)
+	return n, err
+}
+
+func (i *stemcellImage) Reserve(size int) (func([]byte) error, error) {
+	if size > maxStoredSize {
+		return nil, fmt.Errorf("unable to reserve %d bytes of image: at most %d can be reserved", size, maxStoredSize)
+	}
+
+	err := i.gzw.Close()
+	if err != nil {
+		return nil, fmt.Errorf("unable to write stemcell (gzip): %w", err)
+	}
+	offset, err := i.out.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	_, err = i.out.Write(make([]byte, storedMemberSize(size)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to write stemcell: %w", err)
+	}
+	i.gzw, err = i.compression.newWriter(i.out)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &reservation{offset: offset, size: size}
+	i.reserved = append(i.reserved, r)
+	i.n += int64(size)
+
+	return func(data []byte) error {
+		if len(data) != r.size {
+			return fmt.Errorf("unable to fill reserved image: got %d bytes, want %d", len(data), r.size)
+		}
+		r.data = data
+		return nil
+	}, nil
+}
+
+// fill writes the reserved parts of the image, which starts at offset in the
+// stemcell, and returns the digests of the image read back from the stemcell.
+// A new compressed member is started for the rest of the stemcell.
+func (i *stemcellImage) fill(offset int64, algorithms digest.Algorithms) (digest.Digests, error) {
+	err := i.gzw.Close()
+	if err != nil {
+		return nil, fmt.Errorf("unable to write stemcell (gzip): %w", err)
+	}
+	end, err := i.out.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range i.reserved {
+		if r.data == nil {
+			return nil, errors.New("unable to write stemcell: part of the image was reserved but never filled")
+		}
+		_, err = i.out.Seek(r.offset, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+		_, err = i.out.Write(storedMember(r.data))
+		if err != nil {
+			return nil, fmt.Errorf("unable to write stemcell: %w", err)
+		}
+	}
+
+	_, err = i.out.Seek(offset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	gzr, err := gzip.NewReader(io.LimitReader(i.out, end-offset))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read image back from stemcell: %w", err)
+	}
+	hash := digest.NewHash(algorithms)
+	_, err = io.Copy(hash, gzr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read image back from stemcell: %w", err)
+	}
+
+	_, err = i.out.Seek(end, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	i.gzw, err = i.compression.newWriter(i.out)
+	if err != nil {
+		return nil, err
+	}
+
+	return hash.Digests(), nil
+}
+
+// headerMember returns the gzip member holding the tar header of a file of
+// the given size.
+func headerMember(entries Entries, name string, size int64) ([]byte, error) {
+	var header bytes.Buffer
+	tarWriter := tar.NewWriter(&header)
+	// The header is written straight away; the file itself never is. The GNU
+	// format encodes sizes of 8GiB and over within the one block.
+	fileHeader := entries.header(name, size)
+	fileHeader.Format = tar.FormatGNU
+	err := tarWriter.WriteHeader(fileHeader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to write header of %s: %w", name, err)
+	}
+	if header.Len() != tarBlockSize {
+		return nil, fmt.Errorf("unable to write header of %s: got %d bytes, want %d", name, header.Len(), tarBlockSize)
+	}
+
+	return storedMember(header.Bytes()), nil
+}
+
+// maxStoredSize is the most data a single stored deflate block can hold.
+const maxStoredSize = 0xffff
+
+// storedMemberSize is the size of a gzip member holding size bytes, at most
+// maxStoredSize, in a single stored (uncompressed) deflate block.
+func storedMemberSize(size int) int {
+	return 10 + 5 + size + 8
+}
+
+// storedMember returns a gzip member holding data, at most maxStoredSize
+// bytes, in a single stored deflate block.
+func storedMember(data []byte) []byte {
+	member := make([]byte, 0, storedMemberSize(len(data)))
+	member = append(member, 0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 0xff)
+	member = append(member, 1) // final block, stored
+	member = binary.LittleEndian.AppendUint16(member, uint16(len(data)))
+	member = binary.LittleEndian.AppendUint16(member, ^uint16(len(data)))
+	member = append(member, data...)
+	member = binary.LittleEndian.AppendUint32(member, crc32.ChecksumIEEE(data))
+	member = binary.LittleEndian.AppendUint32(member, uint32(len(data)))
+
+	return member
+}
+
+// imageWriter writes the files of an exported VM into the gzipped tarball
+// that becomes the stemcell image.
+type imageWriter struct {
+	w           ImageWriter
+	compression Compression
+	gzw         *pgzip.Writer
+	tarWriter   *tar.Writer
+	entries     Entries
+}
+
+func newImageWriter(w ImageWriter, compression Compression, entries Entries) (*imageWriter, error) {
+	gzw, err := compression.newWriter(w)
+	if err != nil {
+		return nil, err
+	}
+
+	return &imageWriter{w: w, compression: compression, gzw: gzw, tarWriter: tar.NewWriter(gzw), entries: entries}, nil
+}
+
+func (w *imageWriter) WriteFile(name string, size int64, r io.Reader) error {
+	if size < 0 {
+		return w.writeUnsizedFile(name, r)
+	}
+
+	err := w.tarWriter.WriteHeader(w.entries.header(name, size))
+	if err != nil {
+		return fmt.Errorf("unable to write header of %s to image: %w", name, err)
+	}
+
+	_, err = io.Copy(w.tarWriter, r)
+	if err != nil {
+		return fmt.Errorf("unable to write %s to image: %w", name, err)
+	}
+
+	return nil
+}
+
+// writeUnsizedFile streams a file whose size is only known once it has been
+// read, such as a disk vCenter generates as it is downloaded. Its tar header
+// goes in a gzip member of its own, reserved in the image and filled in once
+// the file is written, followed by a new compressed member for the file and
+// the rest of the image.
+func (w *imageWriter) writeUnsizedFile(name string, r io.Reader) error {
+	err := w.tarWriter.Flush()
+	if err != nil {
+		return fmt.Errorf("unable to write image: %w", err)
+	}
+	err = w.gzw.Close()
+	if err != nil {
+		return fmt.Errorf("unable to write image (gzip): %w", err)
+	}
+
+	fill, err := w.w.Reserve(headerMemberSize)
+	if err != nil {
+		return err
+	}
+
+	w.gzw, err = w.compression.newWriter(w.w)
+	if err != nil {
+		return err
+	}
+	w.tarWriter = tar.NewWriter(w.gzw)
+
+	size, err := io.Copy(w.gzw, r)
+	if err != nil {
+		return fmt.Errorf("unable to write %s to image: %w", name, err)
+	}
+	if pad := size % tarBlockSize; pad != 0 {
+		_, err = w.gzw.Write(make([]byte, tarBlockSize-pad))
+		if err != nil {
+			return fmt.Errorf("unable to write %s to image: %w", name, err)
+		}
+	}
+
+	member, err := headerMember(w.entries, name, size)
+	if err != nil {
+		return err
+	}
+	return fill(member)
+}
+
+// Close finishes the image. The gzip writer is closed even if the tarball is
+// incomplete, so that its goroutines always stop.
+func (w *imageWriter) Close() error {
+	err := w.tarWriter.Close()
+	if err != nil {
+		w.gzw.Close() //nolint:errcheck
+		return fmt.Errorf("unable to close image: %w", err)
+	}
+
+	err = w.gzw.Close()
+	if err != nil {
+		return fmt.Errorf("unable to close image (gzip): %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,250 @@
+package packager
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing/iotest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/digest"
+)
+
+var _ = Describe("WriteStemcell", func() {
+	var stemcellPath string
+	var image []byte
+	var algorithms digest.Algorithms
+
+	BeforeEach(func() {
+		algorithms = digest.Default
+		stemcellPath = filepath.Join(GinkgoT().TempDir(), "stemcell.tgz")
+		// An odd length, so that the image has to be padded to a tar block.
+		image = bytes.Repeat([]byte("not really a gzipped image "), 1001)
+	})
+
+	writeStemcell := func(writeImage func(ImageWriter) error) error {
+		f, err := os.Create(stemcellPath)
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close() //nolint:errcheck
+
+		options := StemcellOptions{Compression: Compression{Level: gzip.DefaultCompression}, Digests: algorithms}
+		return WriteStemcell(f, options, writeImage, func(image digest.Digests) (string, error) {
+			return "sha1: " + image.String() + "\n", nil
+		})
+	}
+
+	readStemcell := func() map[string][]byte {
+		f, err := os.Open(stemcellPath)
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close() //nolint:errcheck
+
+		gzr, err := gzip.NewReader(f)
+		Expect(err).NotTo(HaveOccurred())
+		tarReader := tar.NewReader(gzr)
+
+		entries := map[string][]byte{}
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			contents, err := io.ReadAll(tarReader)
+			Expect(err).NotTo(HaveOccurred())
+			entries[header.Name] = contents
+		}
+		return entries
+	}
+
+	It("writes the image and a manifest with its sha1", func() {
+		err := writeStemcell(func(w ImageWriter) error {
+			_, err := w.Write(image)
+			return err
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		entries := readStemcell()
+		Expect(entries).To(HaveLen(2))
+		Expect(entries["image"]).To(Equal(image))
+		Expect(string(entries["stemcell.MF"])).To(Equal(fmt.Sprintf("sha1: %x\n", sha1.Sum(image))))
+	})
+
+	It("writes a manifest with every digest of the image", func() {
+		algorithms = digest.Algorithms{digest.SHA1, digest.SHA256}
+		err := writeStemcell(func(w ImageWriter) error {
+			_, err := w.Write(image)
+			return err
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		entries := readStemcell()
+		Expect(string(entries["stemcell.MF"])).To(Equal(fmt.Sprintf("sha1: sha1:%x;sha256:%x\n", sha1.Sum(image), sha256.Sum256(image))))
+	})
+
+	It("writes a tarball that tar can list", func() {
+		tarPath, err := exec.LookPath("tar")
+		if err != nil {
+			Skip("tar is not installed")
+		}
+
+		err = writeStemcell(func(w ImageWriter) error {
+			_, err := w.Write(image)
+			return err
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		out, err := exec.Command(tarPath, "-tzf", stemcellPath).CombinedOutput()
+		Expect(err).NotTo(HaveOccurred(), string(out))
+		Expect(strings.Fields(string(out))).To(Equal([]string{"image", "stemcell.MF"}))
+	})
+
+	It("returns the error from writing the image", func() {
+		err := writeStemcell(func(w ImageWriter) error {
+			return errors.New("export failed")
+		})
+
+		Expect(err).To(MatchError("export failed"))
+	})
+
+	It("keeps the header of an image of 8GiB and over to one tar block", func() {
+		member, err := headerMember(Entries{}, "image", 40<<30)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(member).To(HaveLen(headerMemberSize))
+
+		gzr, err := gzip.NewReader(bytes.NewReader(member))
+		Expect(err).NotTo(HaveOccurred())
+		header, err := tar.NewReader(gzr).Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.Name).To(Equal("image"))
+		Expect(header.Size).To(Equal(int64(40 << 30)))
+	})
+})
+
+var _ = Describe("imageWriter", func() {
+	var stemcellPath string
+
+	BeforeEach(func() {
+		stemcellPath = filepath.Join(GinkgoT().TempDir(), "stemcell.tgz")
+	})
+
+	// writeImage writes a stemcell whose image holds files, and returns the
+	// image and the manifest of the stemcell.
+	writeImage := func(files func(w *imageWriter) error) ([]byte, string) {
+		f, err := os.Create(stemcellPath)
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close() //nolint:errcheck
+
+		options := StemcellOptions{Compression: Compression{Level: gzip.BestSpeed, Threads: 2}, Digests: digest.Default}
+		err = WriteStemcell(f, options, func(w ImageWriter) error {
+			image, err := newImageWriter(w, options.Compression, Entries{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files(image)).To(Succeed())
+			return image.Close()
+		}, func(image digest.Digests) (string, error) {
+			return "sha1: " + image.String() + "\n", nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = f.Seek(0, io.SeekStart)
+		Expect(err).NotTo(HaveOccurred())
+		gzr, err := gzip.NewReader(f)
+		Expect(err).NotTo(HaveOccurred())
+		tarReader := tar.NewReader(gzr)
+		entries := map[string][]byte{}
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			entries[header.Name], err = io.ReadAll(tarReader)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		return entries["image"], string(entries["stemcell.MF"])
+	}
+
+	readImage := func(image []byte) map[string]string {
+		gzr, err := gzip.NewReader(bytes.NewReader(image))
+		Expect(err).NotTo(HaveOccurred())
+		tarReader := tar.NewReader(gzr)
+		files := map[string]string{}
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			contents, err := io.ReadAll(tarReader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(header.Size).To(Equal(int64(len(contents))))
+			files[header.Name] = string(contents)
+		}
+		return files
+	}
+
+	It("writes files of known and unknown size into the image", func() {
+		image, manifest := writeImage(func(w *imageWriter) error {
+			err := w.WriteFile("known.vmdk", 5, strings.NewReader("known"))
+			if err != nil {
+				return err
+			}
+			return w.WriteFile("unknown.vmdk", -1, strings.NewReader("unknown"))
+		})
+
+		Expect(readImage(image)).To(Equal(map[string]string{"known.vmdk": "known", "unknown.vmdk": "unknown"}))
+		Expect(manifest).To(Equal(fmt.Sprintf("sha1: %x\n", sha1.Sum(image))))
+	})
+
+	It("streams a large disk of unknown size without storing it anywhere else", func() {
+		// Several compressed blocks, and not a whole number of tar blocks.
+		disk := strings.Repeat("streamOptimized disk ", 200001)
+
+		image, manifest := writeImage(func(w *imageWriter) error {
+			err := w.WriteFile("vm-disk1.vmdk", -1, iotest.OneByteReader(strings.NewReader(disk[:1000])))
+			if err != nil {
+				return err
+			}
+			err = w.WriteFile("vm-disk2.vmdk", -1, strings.NewReader(disk))
+			if err != nil {
+				return err
+			}
+			return w.WriteFile("vm.ovf", 7, strings.NewReader("<ovf/>\n"))
+		})
+
+		Expect(readImage(image)).To(Equal(map[string]string{
+			"vm-disk1.vmdk": disk[:1000],
+			"vm-disk2.vmdk": disk,
+			"vm.ovf":        "<ovf/>\n",
+		}))
+		Expect(manifest).To(Equal(fmt.Sprintf("sha1: %x\n", sha1.Sum(image))))
+		Expect(os.ReadDir(filepath.Dir(stemcellPath))).To(HaveLen(1))
+	})
+
+	It("returns an error when a disk of unknown size cannot be read", func() {
+		f, err := os.Create(stemcellPath)
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close() //nolint:errcheck
+
+		err = WriteStemcell(f, StemcellOptions{Compression: Compression{Level: gzip.BestSpeed}}, func(w ImageWriter) error {
+			image, err := newImageWriter(w, Compression{Level: gzip.BestSpeed}, Entries{})
+			Expect(err).NotTo(HaveOccurred())
+			defer image.Close() //nolint:errcheck
+			return image.WriteFile("vm-disk1.vmdk", -1, iotest.ErrReader(errors.New("connection reset")))
+		}, func(digest.Digests) (string, error) {
+			return "", nil
+		})
+
+		Expect(err).To(MatchError("unable to write vm-disk1.vmdk to image: connection reset"))
+	})
+})
@@ -1,15 +1,18 @@
 package packager
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"path"
 	"path/filepath"
 	"regexp"
+	"time"
 
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/digest"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/filesystem"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli/iaas_clients"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/config"
 )
 
@@ -18,66 +21,162 @@ type IaasClient interface {
 	ValidateUrl() error
 	ValidateCredentials() error
 	FindVM(vmInventoryPath string) error
-	ExportVM(vmInventoryPath string, destination string) error
 	ListDevices(vmInventoryPath string) ([]string, error)
 	RemoveDevice(vmInventoryPath string, deviceName string) error
 	EjectCDRom(vmInventoryPath string, deviceName string) error
 }
 
+//counterfeiter:generate . VMExporter
+type VMExporter interface {
+	StreamExportVM(vmInventoryPath string, w iaas_clients.ExportFileWriter) error
+}
+
 type VCenterPackager struct {
 	SourceConfig config.SourceConfig
 	OutputConfig config.OutputConfig
 	Client       IaasClient
+	Exporter     VMExporter
+	Entries      Entries
 	Logger       colorlogger.Logger
+	// Messenger is told about each step of packaging, if set.
+	Messenger StepMessenger
+	// Context stops the export between phases when cancelled, nil means never.
+	Context context.Context
+	// Stdout is where the path of the stemcell is written, os.Stdout if nil.
+	Stdout io.Writer
+}
+
+// interrupted returns an error naming phase if the packager's context has been
+// cancelled.
+func (v VCenterPackager) interrupted(phase string) error {
+	if v.Context == nil || v.Context.Err() == nil {
+		return nil
+	}
+
+	return fmt.Errorf("packaging was interrupted during %s: %w", phase, context.Cause(v.Context))
 }
 
 func (v VCenterPackager) Package() error {
 	err := v.executeOnMatchingDevice(v.Client.RemoveDevice, "^(floppy-|ethernet-)")
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to remove floppy and network devices: %w", err)
 	}
 	err = v.executeOnMatchingDevice(v.Client.EjectCDRom, "^(cdrom-)")
 	if err != nil {
+		return fmt.Errorf("failed to eject CD-ROMs: %w", err)
+	}
+	if err := v.interrupted("device removal"); err != nil {
 		return err
 	}
 
-	workingDir, err := os.MkdirTemp(os.TempDir(), "vcenter-packager-working-directory")
+	start := time.Now()
+	stemcellPath := filepath.Join(v.OutputConfig.OutputDir, StemcellFilename(v.OutputConfig.StemcellVersion, v.OutputConfig.Os))
+	v.Logger.Printf("exporting VM (%s) into stemcell: %s", v.SourceConfig.VmInventoryPath, stemcellPath)
 
+	err = v.writeStemcell(stemcellPath)
 	if err != nil {
-		return errors.New("failed to create working directory")
+		return err
 	}
 
-	stemcellDir, err := os.MkdirTemp(os.TempDir(), "vcenter-packager-stemcell-directory")
+	v.Logger.Printf("created stemcell (%s) in: %s", stemcellPath, time.Since(start))
+	stdout := v.Stdout
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	fmt.Fprintf(stdout, "created stemcell: %s\n", stemcellPath) //nolint:errcheck
+	return nil
+}
+
+// writeStemcell writes the stemcell into a temp directory in the output
+// directory and only moves it to stemcellPath once it is complete, so that a
+// failed or interrupted export never leaves a partial stemcell behind. The
+// temp directory is always removed.
+func (v VCenterPackager) writeStemcell(stemcellPath string) error {
+	tmpdir, err := os.MkdirTemp(v.OutputConfig.OutputDir, "stemcell-")
 	if err != nil {
-		return errors.New("failed to create stemcell directory")
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	v.Logger.Printf("created temp directory: %s", tmpdir)
+	defer func() {
+		v.Logger.Printf("deleting temp directory: %s", tmpdir)
+		os.RemoveAll(tmpdir) //nolint:errcheck
+	}()
+
+	tmpStemcellPath := filepath.Join(tmpdir, filepath.Base(stemcellPath))
+	// The stemcell is read as well as written, to compute the digests of an
+	// image with disks of unknown size.
+	stemcell, err := os.OpenFile(tmpStemcellPath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create stemcell: %w", err)
+	}
+	defer stemcell.Close() //nolint:errcheck
+
+	options := StemcellOptions{Compression: v.compression(), Digests: v.OutputConfig.Digests(), Entries: v.Entries}
+	err = runStep(v.Messenger, StepCompress, func() error {
+		return WriteStemcell(stemcell, options, func(w ImageWriter) error {
+			return runStep(v.Messenger, StepExport, func() error {
+				return v.exportImage(w)
+			})
+		}, func(image digest.Digests) (contents string, err error) {
+			v.Logger.Printf("digests of image: %s", image)
+			err = runStep(v.Messenger, StepManifest, func() error {
+				contents, err = manifestContents(CreateManifest(v.OutputConfig.Os, v.OutputConfig.StemcellVersion, image.String()), v.OutputConfig.CloudProperties)
+				return err
+			})
+			return contents, err
+		})
+	})
+	if interruptErr := v.interrupted("export"); interruptErr != nil {
+		return interruptErr
+	}
+	if err != nil {
+		return err
 	}
-	err = v.Client.ExportVM(v.SourceConfig.VmInventoryPath, workingDir)
 
+	// Flush before renaming, so that a crash cannot leave a stemcell with a
+	// complete name but missing data.
+	err = stemcell.Sync()
 	if err != nil {
-		return errors.New("failed to export the prepared VM")
+		return fmt.Errorf("failed to write stemcell: %w", err)
+	}
+	err = stemcell.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write stemcell: %w", err)
 	}
 
-	fmt.Println("Converting VMDK into stemcell")
-	vmName := path.Base(v.SourceConfig.VmInventoryPath)
-	shaSum, err := TarGenerator(filepath.Join(stemcellDir, "image"), filepath.Join(workingDir, vmName)) //nolint:ineffassign,staticcheck
-	manifestContents := CreateManifest(v.OutputConfig.Os, v.OutputConfig.StemcellVersion, shaSum)
-	err = WriteManifest(manifestContents, stemcellDir)
+	v.Logger.Printf("moving stemcell (%s) to: %s", tmpStemcellPath, stemcellPath)
+	err = os.Rename(tmpStemcellPath, stemcellPath)
+	if err != nil {
+		return fmt.Errorf("failed to move stemcell into the output directory: %w", err)
+	}
+
+	return nil
+}
 
+// exportImage streams the VM export into w as the stemcell image.
+func (v VCenterPackager) exportImage(w ImageWriter) error {
+	image, err := newImageWriter(w, v.compression(), v.Entries)
 	if err != nil {
-		return errors.New("failed to create stemcell.MF file")
+		return err
 	}
 
-	stemcellFilename := StemcellFilename(v.OutputConfig.StemcellVersion, v.OutputConfig.Os)
-	_, err = TarGenerator(filepath.Join(v.OutputConfig.OutputDir, stemcellFilename), stemcellDir) //nolint:ineffassign,staticcheck
+	err = v.Exporter.StreamExportVM(v.SourceConfig.VmInventoryPath, image)
+	if err != nil {
+		image.Close() //nolint:errcheck
+		return fmt.Errorf("failed to export the prepared VM (%s): %w", v.SourceConfig.VmInventoryPath, err)
+	}
 
-	fmt.Printf("Stemcell successfully created: %s\n", stemcellFilename)
-	return nil
+	return image.Close()
+}
+
+func (v VCenterPackager) compression() Compression {
+	return Compression{Level: v.OutputConfig.CompressionLevel, Threads: v.OutputConfig.CompressionThreads}
 }
 
 func (v VCenterPackager) executeOnMatchingDevice(action func(a, b string) error, devicePattern string) error {
 	deviceList, err := v.Client.ListDevices(v.SourceConfig.VmInventoryPath)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to list devices of %s: %w", v.SourceConfig.VmInventoryPath, err)
 	}
 
 	for _, deviceName := range deviceList {
@@ -85,7 +184,7 @@ func (v VCenterPackager) executeOnMatchingDevice(action func(a, b string) error,
 		if matched {
 			err = action(v.SourceConfig.VmInventoryPath, deviceName)
 			if err != nil {
-				return err
+				return fmt.Errorf("device %s: %w", deviceName, err)
 			}
 		}
 	}
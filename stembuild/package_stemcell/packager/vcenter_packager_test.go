@@ -4,15 +4,23 @@ import (
 	"archive/tar"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/sha1"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
+	"testing/iotest"
+	"time"
 
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/digest"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/filesystem"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/iaas_cli/iaas_clients"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/config"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/packager"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/packager/packagerfakes"
@@ -98,26 +106,73 @@ var _ = Describe("VcenterPackager", func() {
 
 	Describe("Package", func() {
 		var vcenterPackager *packager.VCenterPackager
-
-		AfterEach(func() {
-			os.RemoveAll("./valid-vm-name") //nolint:errcheck
-			os.RemoveAll("image")           //nolint:errcheck
-		})
+		var fakeExporter *packagerfakes.FakeVMExporter
+		var logOutput *bytes.Buffer
+		var stdout *bytes.Buffer
 
 		BeforeEach(func() {
-			vcenterPackager = &packager.VCenterPackager{SourceConfig: sourceConfig, OutputConfig: outputConfig, Client: fakeVcenterClient}
+			fakeExporter = &packagerfakes.FakeVMExporter{}
+			logOutput = &bytes.Buffer{}
+			logger := colorlogger.New(colorlogger.DEBUG, false, io.MultiWriter(logOutput, GinkgoWriter))
+			stdout = &bytes.Buffer{}
+			vcenterPackager = &packager.VCenterPackager{SourceConfig: sourceConfig, OutputConfig: outputConfig, Client: fakeVcenterClient, Exporter: fakeExporter, Logger: logger, Stdout: stdout}
 
-			fakeVcenterClient.ExportVMStub = func(vmInventoryPath string, destination string) error {
+			fakeExporter.StreamExportVMStub = func(vmInventoryPath string, w iaas_clients.ExportFileWriter) error {
 				vmName := path.Base(vmInventoryPath)
-				os.Mkdir(filepath.Join(destination, vmName), 0777) //nolint:errcheck
-
-				testOvfName := "valid-vm-name.content"
-				err := os.WriteFile(filepath.Join(filepath.Join(destination, vmName), testOvfName), []byte(""), 0777)
-				Expect(err).NotTo(HaveOccurred())
+				files := []struct {
+					name, contents string
+					size           int64
+				}{
+					{name: vmName + "-disk-0.vmdk", contents: "disk zero", size: 9},
+					// vCenter does not always report the size of a disk.
+					{name: vmName + "-disk-1.vmdk", contents: "disk one", size: -1},
+					{name: vmName + ".ovf", contents: "<Envelope/>", size: 11},
+					{name: vmName + ".mf", contents: "SHA1(...)= ...", size: 14},
+				}
+				for _, f := range files {
+					err := w.WriteFile(f.name, f.size, strings.NewReader(f.contents))
+					if err != nil {
+						return err
+					}
+				}
 				return nil
 			}
 		})
 
+		imageFiles := func() map[string]string {
+			stemcellFilename := packager.StemcellFilename(vcenterPackager.OutputConfig.StemcellVersion, vcenterPackager.OutputConfig.Os)
+			stemcell, err := os.Open(filepath.Join(vcenterPackager.OutputConfig.OutputDir, stemcellFilename))
+			Expect(err).NotTo(HaveOccurred())
+			defer stemcell.Close() //nolint:errcheck
+
+			gzr, err := gzip.NewReader(stemcell)
+			Expect(err).NotTo(HaveOccurred())
+			tarReader := tar.NewReader(gzr)
+			for {
+				header, err := tarReader.Next()
+				Expect(err).NotTo(HaveOccurred())
+				if header.Name == "image" {
+					break
+				}
+			}
+
+			imageReader, err := gzip.NewReader(tarReader)
+			Expect(err).NotTo(HaveOccurred())
+			files := map[string]string{}
+			imageTarReader := tar.NewReader(imageReader)
+			for {
+				header, err := imageTarReader.Next()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).NotTo(HaveOccurred())
+				contents, err := io.ReadAll(imageTarReader)
+				Expect(err).NotTo(HaveOccurred())
+				files[header.Name] = string(contents)
+			}
+			return files
+		}
+
 		It("creates a valid stemcell in the output directory", func() {
 			err := vcenterPackager.Package()
 
@@ -130,16 +185,16 @@ var _ = Describe("VcenterPackager", func() {
 			var actualStemcellManifestContent string
 			expectedManifestContent := `---
 name: bosh-vsphere-esxi-windows2012R2-go_agent
-version: '1200.2'
+version: "1200.2"
 api_version: 3
 sha1: %x
 operating_system: windows2012R2
 cloud_properties:
-  infrastructure: vsphere
   hypervisor: esxi
+  infrastructure: vsphere
 stemcell_formats:
-- vsphere-ovf
-- vsphere-ova
+  - vsphere-ovf
+  - vsphere-ova
 `
 			var fileReader, _ = os.OpenFile(stemcellFile, os.O_RDONLY, 0777) //nolint:errcheck
 			gzr, err := gzip.NewReader(fileReader)
@@ -181,6 +236,159 @@ stemcell_formats:
 			Expect(actualStemcellManifestContent).To(Equal(expectedManifestContent))
 		})
 
+		It("records a multi-digest of the image when several digest algorithms are given", func() {
+			vcenterPackager.OutputConfig.DigestAlgorithms = digest.Algorithms{digest.SHA1, digest.SHA256}
+
+			err := vcenterPackager.Package()
+			Expect(err).NotTo(HaveOccurred())
+
+			stemcellFilename := packager.StemcellFilename(outputConfig.StemcellVersion, outputConfig.Os)
+			stemcell, err := os.Open(filepath.Join(outputDir, stemcellFilename))
+			Expect(err).NotTo(HaveOccurred())
+			defer stemcell.Close() //nolint:errcheck
+			gzr, err := gzip.NewReader(stemcell)
+			Expect(err).NotTo(HaveOccurred())
+
+			var manifest string
+			var image []byte
+			tarReader := tar.NewReader(gzr)
+			for {
+				header, err := tarReader.Next()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).NotTo(HaveOccurred())
+				contents, err := io.ReadAll(tarReader)
+				Expect(err).NotTo(HaveOccurred())
+				switch header.Name {
+				case "stemcell.MF":
+					manifest = string(contents)
+				case "image":
+					image = contents
+				}
+			}
+
+			Expect(manifest).To(ContainSubstring(fmt.Sprintf("\nsha1: \"sha1:%x;sha256:%x\"\n", sha1.Sum(image), sha256.Sum256(image))))
+		})
+
+		It("streams the exported files into the image", func() {
+			err := vcenterPackager.Package()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeExporter.StreamExportVMCallCount()).To(Equal(1))
+			vmPath, _ := fakeExporter.StreamExportVMArgsForCall(0)
+			Expect(vmPath).To(Equal(sourceConfig.VmInventoryPath))
+
+			Expect(imageFiles()).To(Equal(map[string]string{
+				"valid-vm-name-disk-0.vmdk": "disk zero",
+				"valid-vm-name-disk-1.vmdk": "disk one",
+				"valid-vm-name.ovf":         "<Envelope/>",
+				"valid-vm-name.mf":          "SHA1(...)= ...",
+			}))
+		})
+
+		It("creates byte-identical stemcells from the same VM when reproducible", func() {
+			modTime := time.Unix(1700000000, 0)
+			vcenterPackager.Entries = packager.Entries{Reproducible: true, ModTime: modTime}
+			stemcellFilename := packager.StemcellFilename(outputConfig.StemcellVersion, outputConfig.Os)
+
+			packageDigest := func() [sha256.Size]byte {
+				vcenterPackager.OutputConfig.OutputDir = GinkgoT().TempDir()
+				Expect(vcenterPackager.Package()).To(Succeed())
+
+				contents, err := os.ReadFile(filepath.Join(vcenterPackager.OutputConfig.OutputDir, stemcellFilename))
+				Expect(err).NotTo(HaveOccurred())
+				return sha256.Sum256(contents)
+			}
+
+			first := packageDigest()
+			time.Sleep(time.Second)
+			Expect(packageDigest()).To(Equal(first))
+
+			stemcell, err := os.Open(filepath.Join(vcenterPackager.OutputConfig.OutputDir, stemcellFilename))
+			Expect(err).NotTo(HaveOccurred())
+			defer stemcell.Close() //nolint:errcheck
+			gzr, err := gzip.NewReader(stemcell)
+			Expect(err).NotTo(HaveOccurred())
+			tarReader := tar.NewReader(gzr)
+			for {
+				header, err := tarReader.Next()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).NotTo(HaveOccurred())
+				Expect(header.ModTime).To(BeTemporally("==", modTime), header.Name)
+			}
+		})
+
+		It("leaves nothing but the stemcell in the output directory", func() {
+			err := vcenterPackager.Package()
+			Expect(err).NotTo(HaveOccurred())
+
+			entries, err := os.ReadDir(outputDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].Name()).To(Equal(packager.StemcellFilename(outputConfig.StemcellVersion, outputConfig.Os)))
+		})
+
+		It("logs its progress through the logger", func() {
+			err := vcenterPackager.Package()
+			Expect(err).NotTo(HaveOccurred())
+
+			stemcellPath := filepath.Join(outputDir, packager.StemcellFilename(outputConfig.StemcellVersion, outputConfig.Os))
+			Expect(logOutput.String()).To(ContainSubstring("exporting VM (path/valid-vm-name) into stemcell: " + stemcellPath))
+			Expect(logOutput.String()).To(ContainSubstring("created stemcell (" + stemcellPath + ")"))
+		})
+
+		It("prints the stemcell it created whatever the log level", func() {
+			vcenterPackager.Logger = colorlogger.New(colorlogger.NONE, false, logOutput)
+
+			err := vcenterPackager.Package()
+			Expect(err).NotTo(HaveOccurred())
+
+			stemcellPath := filepath.Join(outputDir, packager.StemcellFilename(outputConfig.StemcellVersion, outputConfig.Os))
+			Expect(stdout.String()).To(Equal("created stemcell: " + stemcellPath + "\n"))
+			Expect(logOutput.String()).To(BeEmpty())
+		})
+
+		It("reports exporting the image and writing the manifest while compressing the stemcell", func() {
+			messenger := &packagerfakes.FakeStepMessenger{}
+			var steps []string
+			messenger.StepStartedCalls(func(step string) { steps = append(steps, step+" started") })
+			messenger.StepSucceededCalls(func(step string) { steps = append(steps, step+" succeeded") })
+			vcenterPackager.Messenger = messenger
+
+			err := vcenterPackager.Package()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(steps).To(Equal([]string{
+				"compress started",
+				"export started",
+				"export succeeded",
+				"manifest started",
+				"manifest succeeded",
+				"compress succeeded",
+			}))
+			Expect(messenger.StepFailedCallCount()).To(Equal(0))
+		})
+
+		It("reports the steps that fail", func() {
+			messenger := &packagerfakes.FakeStepMessenger{}
+			vcenterPackager.Messenger = messenger
+			fakeExporter.StreamExportVMReturns(errors.New("some client error"))
+
+			err := vcenterPackager.Package()
+			Expect(err).To(HaveOccurred())
+
+			Expect(messenger.StepFailedCallCount()).To(Equal(2))
+			step, stepErr := messenger.StepFailedArgsForCall(0)
+			Expect(step).To(Equal(packager.StepExport))
+			Expect(stepErr).To(MatchError(ContainSubstring("some client error")))
+			step, _ = messenger.StepFailedArgsForCall(1)
+			Expect(step).To(Equal(packager.StepCompress))
+			Expect(messenger.StepSucceededCallCount()).To(Equal(0))
+		})
+
 		It("removes all ethernet and floppy devices", func() {
 			fullDeviceList := []string{"video-674", "cdrom-12", "ps2-450", "ethernet-1", "floppy-8000", "floppy-9000", "video-500"}
 			expectedDeviceList := []string{"ethernet-1", "floppy-8000", "floppy-9000"}
@@ -214,29 +422,126 @@ stemcell_formats:
 		})
 
 		It("Throws an error if the VCenter client fails to list devices", func() {
-			fakeVcenterClient.ListDevicesReturns([]string{}, errors.New("some client error"))
+			clientErr := errors.New("some client error")
+			fakeVcenterClient.ListDevicesReturns([]string{}, clientErr)
 
 			err := vcenterPackager.Package()
-			Expect(err).To(MatchError("some client error"))
+			Expect(err).To(MatchError(clientErr))
+			Expect(err).To(MatchError("failed to remove floppy and network devices: failed to list devices of path/valid-vm-name: some client error"))
 		})
 
 		It("Throws an error if the VCenter client fails to remove a device", func() {
+			clientErr := errors.New("some client error")
 			fakeVcenterClient.ListDevicesReturns([]string{"floppy-8000"}, nil)
-			fakeVcenterClient.RemoveDeviceReturns(errors.New("some client error"))
+			fakeVcenterClient.RemoveDeviceReturns(clientErr)
+
+			err := vcenterPackager.Package()
+			Expect(err).To(MatchError(clientErr))
+			Expect(err).To(MatchError("failed to remove floppy and network devices: device floppy-8000: some client error"))
+		})
+
+		It("Throws an error if the VCenter client fails to eject a CD ROM", func() {
+			clientErr := errors.New("some client error")
+			fakeVcenterClient.ListDevicesReturns([]string{"cdrom-12"}, nil)
+			fakeVcenterClient.EjectCDRomReturns(clientErr)
 
 			err := vcenterPackager.Package()
-			Expect(err).To(MatchError("some client error"))
+			Expect(err).To(MatchError(clientErr))
+			Expect(err).To(MatchError("failed to eject CD-ROMs: device cdrom-12: some client error"))
 		})
 
 		It("Returns a error message if exporting the VM fails", func() {
-			packager := packager.VCenterPackager{SourceConfig: sourceConfig, OutputConfig: outputConfig, Client: fakeVcenterClient}
-			fakeVcenterClient.ExportVMReturns(errors.New("some client error"))
-			err := packager.Package()
+			clientErr := errors.New("some client error")
+			fakeExporter.StreamExportVMReturns(clientErr)
+			err := vcenterPackager.Package()
 
-			Expect(fakeVcenterClient.ExportVMCallCount()).To(Equal(1))
-			vmPath, _ := fakeVcenterClient.ExportVMArgsForCall(0)
-			Expect(vmPath).To(Equal(sourceConfig.VmInventoryPath))
-			Expect(err.Error()).To(Equal("failed to export the prepared VM"))
+			Expect(fakeExporter.StreamExportVMCallCount()).To(Equal(1))
+			Expect(err).To(MatchError(clientErr))
+			Expect(err).To(MatchError("failed to export the prepared VM (path/valid-vm-name): some client error"))
+			Expect(os.ReadDir(outputDir)).To(BeEmpty())
+		})
+
+		It("removes the partial stemcell when exporting a disk of unknown size fails part way", func() {
+			fakeExporter.StreamExportVMStub = func(vmInventoryPath string, w iaas_clients.ExportFileWriter) error {
+				err := w.WriteFile("disk-0.vmdk", -1, strings.NewReader("disk zero"))
+				Expect(err).NotTo(HaveOccurred())
+				return w.WriteFile("disk-1.vmdk", -1, iotest.ErrReader(errors.New("connection reset")))
+			}
+
+			err := vcenterPackager.Package()
+
+			Expect(err).To(MatchError(ContainSubstring("unable to write disk-1.vmdk to image: connection reset")))
+			Expect(os.ReadDir(outputDir)).To(BeEmpty())
+		})
+
+		It("leaves an existing stemcell alone when exporting the VM fails", func() {
+			stemcellPath := filepath.Join(outputDir, packager.StemcellFilename(outputConfig.StemcellVersion, outputConfig.Os))
+			Expect(os.WriteFile(stemcellPath, []byte("previous stemcell"), 0644)).To(Succeed())
+			fakeExporter.StreamExportVMReturns(errors.New("some client error"))
+
+			err := vcenterPackager.Package()
+
+			Expect(err).To(HaveOccurred())
+			Expect(os.ReadFile(stemcellPath)).To(Equal([]byte("previous stemcell")))
+			Expect(os.ReadDir(outputDir)).To(HaveLen(1))
+		})
+
+		It("returns an error if the output directory does not exist", func() {
+			vcenterPackager.OutputConfig.OutputDir = filepath.Join(outputDir, "missing")
+
+			err := vcenterPackager.Package()
+
+			Expect(err).To(MatchError(ContainSubstring("failed to create temp directory")))
+			Expect(fakeExporter.StreamExportVMCallCount()).To(Equal(0))
+		})
+
+		It("returns an error when the exported files are shorter than reported", func() {
+			fakeExporter.StreamExportVMStub = func(vmInventoryPath string, w iaas_clients.ExportFileWriter) error {
+				return w.WriteFile("disk.vmdk", 100, strings.NewReader("short"))
+			}
+
+			err := vcenterPackager.Package()
+
+			Expect(err).To(HaveOccurred())
+			Expect(os.ReadDir(outputDir)).To(BeEmpty())
+		})
+
+		Context("when the context is cancelled", func() {
+			var cancel context.CancelCauseFunc
+			var interrupt = errors.New("interrupted")
+
+			BeforeEach(func() {
+				var ctx context.Context
+				ctx, cancel = context.WithCancelCause(context.Background())
+				vcenterPackager.Context = ctx
+			})
+
+			It("does not export the VM when interrupted while removing devices", func() {
+				fakeVcenterClient.ListDevicesReturns([]string{"floppy-8000"}, nil)
+				fakeVcenterClient.RemoveDeviceStub = func(string, string) error {
+					cancel(interrupt)
+					return nil
+				}
+
+				err := vcenterPackager.Package()
+
+				Expect(err).To(MatchError(interrupt))
+				Expect(err).To(MatchError(ContainSubstring("interrupted during device removal")))
+				Expect(fakeExporter.StreamExportVMCallCount()).To(Equal(0))
+			})
+
+			It("reports the interruption instead of the export failure and writes no stemcell", func() {
+				fakeExporter.StreamExportVMStub = func(string, iaas_clients.ExportFileWriter) error {
+					cancel(interrupt)
+					return errors.New("context canceled")
+				}
+
+				err := vcenterPackager.Package()
+
+				Expect(err).To(MatchError(interrupt))
+				Expect(err).To(MatchError(ContainSubstring("interrupted during export")))
+				Expect(os.ReadDir(outputDir)).To(BeEmpty())
+			})
 		})
 	})
 })
@@ -3,35 +3,48 @@ package packager
 import (
 	"archive/tar"
 	"bytes"
-	"compress/gzip"
-	"crypto/sha1"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
-	"os/signal"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/digest"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/filesystem"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/oscatalog"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/config"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/ova"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/ovftool"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/vmdk"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/templates"
 )
 
 const Gigabyte = 1024 * 1024 * 1024
 
 type VmdkPackager struct {
-	Image        string
-	Stemcell     string
-	Manifest     string
-	Sha1sum      string
+	Image    string
+	Stemcell string
+	Manifest string
+	Sha1sum  string
+	// ImageDigests are the checksums of the image, for each of the
+	// algorithms in BuildOptions.
+	ImageDigests digest.Digests
 	tmpdir       string
 	Stop         chan struct{}
+	// Context stops the packager when cancelled, nil means never.
+	Context      context.Context
 	BuildOptions config.VmdkOptions
+	Entries      Entries
 	Logger       colorlogger.Logger
+	// Messenger is told about each step of packaging, if set.
+	Messenger StepMessenger
+	// Stdout is where the path of the stemcell is written, os.Stdout if nil.
+	Stdout io.Writer
 }
 
 var ErrInterrupt = errors.New("interrupt")
@@ -106,7 +119,7 @@ func (c *VmdkPackager) AddTarFile(tr *tar.Writer, name string) error {
 	if err != nil {
 		return err
 	}
-	if err := tr.WriteHeader(hdr); err != nil {
+	if err := tr.WriteHeader(c.Entries.normalize(hdr)); err != nil {
 		return err
 	}
 	if _, err := io.Copy(tr, c.Reader(f)); err != nil {
@@ -163,7 +176,10 @@ func (c *VmdkPackager) CreateStemcell() error {
 	}
 
 	t := time.Now()
-	w := gzip.NewWriter(c.Writer(stemcell))
+	w, err := c.compression().newWriter(c.Writer(stemcell))
+	if err != nil {
+		return errorf("creating stemcell: %s", err)
+	}
 	tr := tar.NewWriter(w)
 
 	c.Logger.Printf("adding image file to stemcell tarball: %s", c.Image)
@@ -234,8 +250,49 @@ func (c *VmdkPackager) ConvertVMX2OVA(vmx, ova string) error {
 	return nil
 }
 
+// buildOVA converts the vmx to an ova with the builder in BuildOptions.
+func (c *VmdkPackager) buildOVA(vmx, ovaPath string) error {
+	if c.BuildOptions.OVABuilder != config.OVABuilderNative {
+		return c.ConvertVMX2OVA(vmx, ovaPath)
+	}
+
+	ctx := c.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.Stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	options := ova.Options{
+		Digest:             c.BuildOptions.DigestAlgorithms.Strongest(),
+		CompressionLevel:   c.BuildOptions.CompressionLevel,
+		CompressionThreads: c.BuildOptions.CompressionThreads,
+	}
+	if c.Entries.Reproducible {
+		options.ModTime = c.Entries.ModTime
+	}
+
+	c.Logger.Printf("converting vmx (%s) to ova without ovftool: %s", vmx, ovaPath)
+	err := ova.Create(ctx, vmx, ovaPath, options)
+	if err != nil && ctx.Err() != nil {
+		return ErrInterrupt
+	}
+	return err
+}
+
+func (c *VmdkPackager) compression() Compression {
+	return Compression{Level: c.BuildOptions.CompressionLevel, Threads: c.BuildOptions.CompressionThreads}
+}
+
 // CreateImage converts a vmdk to a gzip compressed image file and records the
-// sha1 sum of the resulting image.
+// digests of the resulting image.
 func (c *VmdkPackager) CreateImage() error {
 	c.Logger.Printf("Creating [image] from [vmdk]: %s", c.BuildOptions.VMDKFile)
 
@@ -244,12 +301,9 @@ func (c *VmdkPackager) CreateImage() error {
 		return err
 	}
 
-	var hwVersion int
-	switch c.BuildOptions.OSVersion {
-	case "2012R2":
-		hwVersion = 9
-	case "2016", "1803", "2019":
-		hwVersion = 10
+	windows, ok := oscatalog.Lookup(c.BuildOptions.OSVersion)
+	if !ok {
+		return fmt.Errorf("unsupported OS version %q, supported versions are %s", c.BuildOptions.OSVersion, strings.Join(oscatalog.Names(), ", "))
 	}
 
 	vmxPath := filepath.Join(tmpdir, "image.vmx")
@@ -257,12 +311,15 @@ func (c *VmdkPackager) CreateImage() error {
 	if err != nil {
 		return err
 	}
-	if err := templates.WriteVMXTemplate(vmdkPath, hwVersion, vmxPath); err != nil {
+	if err := templates.WriteVMXTemplate(vmdkPath, windows.GuestOS, windows.MinHWVersion, vmxPath); err != nil {
 		return err
 	}
 
 	ovaPath := filepath.Join(tmpdir, "image.ova")
-	if err := c.ConvertVMX2OVA(vmxPath, ovaPath); err != nil {
+	err = runStep(c.Messenger, StepExport, func() error {
+		return c.buildOVA(vmxPath, ovaPath)
+	})
+	if err != nil {
 		return err
 	}
 
@@ -281,9 +338,16 @@ func (c *VmdkPackager) CreateImage() error {
 	}
 	defer f.Close() //nolint:errcheck
 
-	// calculate sha1 while writing image file
-	h := sha1.New()
-	w := gzip.NewWriter(io.MultiWriter(f, h))
+	// calculate the digests while writing image file
+	algorithms := c.BuildOptions.DigestAlgorithms
+	if len(algorithms) == 0 {
+		algorithms = digest.Default
+	}
+	h := digest.NewHash(algorithms)
+	w, err := c.compression().newWriter(io.MultiWriter(f, h))
+	if err != nil {
+		return err
+	}
 
 	if _, err := io.Copy(w, r); err != nil {
 		return err
@@ -292,27 +356,37 @@ func (c *VmdkPackager) CreateImage() error {
 		return err
 	}
 
-	c.Sha1sum = fmt.Sprintf("%x", h.Sum(nil))
-	c.Logger.Printf("Sha1 of image (%s): %s", c.Image, c.Sha1sum)
+	c.ImageDigests = h.Digests()
+	c.Sha1sum, _ = c.ImageDigests.Get(digest.SHA1)
+	c.Logger.Printf("Digests of image (%s): %s", c.Image, c.ImageDigests)
 	return nil
 }
 
 func (c *VmdkPackager) ConvertVMDK() (string, error) {
-	if err := c.CreateImage(); err != nil {
-		return "", err
-	}
-	_, err := c.TempDir()
+	err := runStep(c.Messenger, StepCompress, func() error {
+		if err := c.CreateImage(); err != nil {
+			return err
+		}
+		_, err := c.TempDir()
 
-	if err != nil {
-		return "", err
-	}
-	manifest := CreateManifest(c.BuildOptions.OSVersion, c.BuildOptions.Version, c.Sha1sum)
-	if err := WriteManifest(manifest, c.tmpdir); err != nil {
-		return "", err
-	}
-	c.Manifest = filepath.Join(c.tmpdir, "stemcell.MF")
+		if err != nil {
+			return err
+		}
+		err = runStep(c.Messenger, StepManifest, func() error {
+			manifest, err := manifestContents(CreateManifest(c.BuildOptions.OSVersion, c.BuildOptions.Version, c.ImageDigests.String()), c.BuildOptions.CloudProperties)
+			if err != nil {
+				return err
+			}
+			return WriteManifest(manifest, c.tmpdir)
+		})
+		if err != nil {
+			return err
+		}
+		c.Manifest = filepath.Join(c.tmpdir, "stemcell.MF")
 
-	if err := c.CreateStemcell(); err != nil {
+		return c.CreateStemcell()
+	})
+	if err != nil {
 		return "", err
 	}
 
@@ -325,26 +399,25 @@ func (c *VmdkPackager) ConvertVMDK() (string, error) {
 	return stemcellPath, nil
 }
 
-func (c *VmdkPackager) catchInterruptSignal() {
-	ch := make(chan os.Signal, 64)
-	signal.Notify(ch, os.Interrupt)
-	stopping := false
-	for sig := range ch {
-		c.Logger.Printf("received signal: %s", sig)
-		if stopping {
-			fmt.Fprintf(os.Stderr, "received second (%s) signal - exiting now\n", sig) //nolint:errcheck
-			c.Cleanup()                                                                // remove temp dir
-			os.Exit(1)
-		}
-		stopping = true
-		fmt.Fprintf(os.Stderr, "received (%s) signal cleaning up\n", sig) //nolint:errcheck
+// stopOnCancel stops the packager when its context is cancelled, until done is
+// closed.
+func (c *VmdkPackager) stopOnCancel(done <-chan struct{}) {
+	if c.Context == nil {
+		return
+	}
+
+	select {
+	case <-c.Context.Done():
+		c.Logger.Printf("stopping: %s", context.Cause(c.Context))
 		c.StopConfig()
+	case <-done:
 	}
 }
 
 func (c *VmdkPackager) Package() error {
-
-	go c.catchInterruptSignal()
+	done := make(chan struct{})
+	defer close(done)
+	go c.stopOnCancel(done)
 
 	start := time.Now()
 
@@ -356,17 +429,26 @@ func (c *VmdkPackager) Package() error {
 	}
 
 	c.Logger.Printf("created stemcell (%s) in: %s", stemcellPath, time.Since(start))
-	fmt.Printf("created stemcell: %s", stemcellPath)
+	stdout := c.Stdout
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	fmt.Fprintf(stdout, "created stemcell: %s", stemcellPath) //nolint:errcheck
 
 	c.Cleanup()
 	return nil
 }
 
 func (c *VmdkPackager) ValidateSourceParameters() error {
-	if validVMDK, err := IsValidVMDK(c.BuildOptions.VMDKFile); err != nil {
-		return err
-	} else if !validVMDK {
-		return errors.New("invalid VMDK file")
+	info, err := vmdk.Stat(c.BuildOptions.VMDKFile)
+	if err != nil {
+		return fmt.Errorf("invalid VMDK file: %w", err)
+	}
+	c.Logger.Printf("VMDK (%s) is %s with a capacity of %d bytes, grains of %d bytes and adapter type %q",
+		c.BuildOptions.VMDKFile, info.CreateType, info.Capacity, info.GrainSize, info.AdapterType)
+
+	if c.BuildOptions.OVABuilder == config.OVABuilderNative {
+		return nil
 	}
 
 	searchPaths, err := ovftool.SearchPaths()
@@ -380,23 +462,27 @@ func (c *VmdkPackager) ValidateSourceParameters() error {
 	return nil
 }
 
-func IsValidVMDK(vmdk string) (bool, error) {
-	fi, err := os.Stat(vmdk)
+// IsValidVMDK reports whether the file at path is a VMDK that can be packaged,
+// returning why when it is not.
+func IsValidVMDK(path string) (bool, error) {
+	_, err := vmdk.Stat(path)
 	if err != nil {
 		return false, err
 	}
-	if !fi.Mode().IsRegular() {
-		return false, nil
-	}
 	return true, nil
 }
 
 func (c *VmdkPackager) ValidateFreeSpaceForPackage(fs filesystem.FileSystem) error {
-	fi, err := os.Stat(c.BuildOptions.VMDKFile)
+	info, err := vmdk.Stat(c.BuildOptions.VMDKFile)
 	if err != nil {
 		return fmt.Errorf("could not get vmdk info: %s", err)
 	}
-	vmdkSize := fi.Size()
+	// a streamOptimized disk is already compressed, so converting it gives
+	// about its file size; any other disk may hold up to its capacity
+	vmdkSize := info.Capacity
+	if info.CreateType == "streamOptimized" {
+		vmdkSize = info.Size
+	}
 
 	// make sure there is enough space for ova + stemcell and some leftover
 	//	ova and stemcell will be the size of the vmdk in the worst case scenario
@@ -1,6 +1,7 @@
 package packager_test
 
 import (
+	"context"
 	"crypto/sha1"
 	"errors"
 	"fmt"
@@ -16,9 +17,60 @@ import (
 	mockfilesystem "github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/filesystem/mock"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/config"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/packager"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/vmdk"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/test/helpers"
 )
 
+// writeFlatVMDK writes a monolithicFlat VMDK of the given capacity, which is
+// all zeros.
+func writeFlatVMDK(capacity int64) string {
+	dir := GinkgoT().TempDir()
+	Expect(os.WriteFile(filepath.Join(dir, "disk-flat.vmdk"), make([]byte, capacity), 0644)).To(Succeed())
+	path := filepath.Join(dir, "disk.vmdk")
+	Expect(os.WriteFile(path, []byte(fmt.Sprintf(`# Disk DescriptorFile
+version=1
+CID=fffffffe
+parentCID=ffffffff
+createType="monolithicFlat"
+
+RW %d FLAT "disk-flat.vmdk" 0
+`, capacity/512)), 0644)).To(Succeed())
+	return path
+}
+
+// writeStreamOptimizedVMDK writes a streamOptimized VMDK of the given capacity
+// holding only a little data, so that its file is much smaller than its
+// capacity.
+func writeStreamOptimizedVMDK(capacity int64) string {
+	dir := GinkgoT().TempDir()
+	flat, err := os.Create(filepath.Join(dir, "disk-flat.vmdk"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(flat.Truncate(capacity)).To(Succeed())
+	_, err = flat.WriteAt([]byte("some data"), capacity/2)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(flat.Close()).To(Succeed())
+	Expect(os.WriteFile(filepath.Join(dir, "disk.vmdk"), []byte(fmt.Sprintf(`# Disk DescriptorFile
+version=1
+CID=fffffffe
+parentCID=ffffffff
+createType="monolithicFlat"
+
+RW %d FLAT "disk-flat.vmdk" 0
+`, capacity/512)), 0644)).To(Succeed())
+
+	disk, err := vmdk.Open(filepath.Join(dir, "disk.vmdk"))
+	Expect(err).NotTo(HaveOccurred())
+	defer disk.Close() //nolint:errcheck
+
+	streamDir := GinkgoT().TempDir()
+	path := filepath.Join(streamDir, "stream.vmdk")
+	stream, err := os.Create(path)
+	Expect(err).NotTo(HaveOccurred())
+	defer stream.Close() //nolint:errcheck
+	Expect(disk.WriteStreamOptimized(context.Background(), stream, vmdk.StreamOptions{FileName: "stream.vmdk", Level: 1})).To(Succeed())
+	return path
+}
+
 var _ = Describe("VmdkPackager", func() {
 	var stembuildConfig config.VmdkOptions
 	var vmdkPackager packager.VmdkPackager
@@ -39,16 +91,24 @@ var _ = Describe("VmdkPackager", func() {
 	Describe("vmdk", func() {
 		Context("valid vmdk file specified", func() {
 			It("should be valid", func() {
-				vmdk, err := os.CreateTemp("", "temp.vmdk")
-				Expect(err).ToNot(HaveOccurred())
-				defer os.Remove(vmdk.Name()) //nolint:errcheck
-
-				valid, err := packager.IsValidVMDK(vmdk.Name())
+				valid, err := packager.IsValidVMDK(writeFlatVMDK(1 << 20))
 				Expect(err).To(BeNil())
 				Expect(valid).To(BeTrue())
 			})
 		})
 
+		Context("file that is not a VMDK specified", func() {
+			It("should be invalid, saying why", func() {
+				notVMDK, err := os.CreateTemp("", "temp.vmdk")
+				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove(notVMDK.Name()) //nolint:errcheck
+
+				valid, err := packager.IsValidVMDK(notVMDK.Name())
+				Expect(err).To(MatchError(ContainSubstring("not a VMDK")))
+				Expect(valid).To(BeFalse())
+			})
+		})
+
 		Context("invalid vmdk file specified", func() {
 			It("should be invalid", func() {
 				valid, err := packager.IsValidVMDK(filepath.Join("..", "out", "invalid"))
@@ -109,6 +169,64 @@ var _ = Describe("VmdkPackager", func() {
 			Expect(err).NotTo(HaveOccurred())
 			Expect(ovfFile).NotTo(MatchRegexp(`(?i)ethernet`))
 		})
+		Context("with the native OVA builder", func() {
+			It("creates an image tarball without ovftool", func() {
+				GinkgoT().Setenv("PATH", "")
+				vmdkPackager.BuildOptions.VMDKFile = writeFlatVMDK(1 << 20)
+				vmdkPackager.BuildOptions.OVABuilder = config.OVABuilderNative
+				vmdkPackager.BuildOptions.CompressionLevel = config.DefaultCompressionLevel
+				Expect(vmdkPackager.ValidateSourceParameters()).To(Succeed())
+				Expect(vmdkPackager.CreateImage()).To(Succeed())
+
+				imageDir, err := helpers.ExtractGzipArchive(vmdkPackager.Image)
+				Expect(err).NotTo(HaveOccurred())
+				list, err := os.ReadDir(imageDir)
+				Expect(err).NotTo(HaveOccurred())
+				var names []string
+				for _, fi := range list {
+					names = append(names, fi.Name())
+				}
+				Expect(names).To(ConsistOf("image.ovf", "image.mf", "image-disk1.vmdk"))
+
+				ovfFile, err := helpers.ReadFile(filepath.Join(imageDir, "image.ovf"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ovfFile).To(ContainSubstring("<vssd:VirtualSystemType>vmx-09<"))
+				Expect(ovfFile).NotTo(MatchRegexp(`(?i)ethernet`))
+			})
+
+			It("uses the guest OS and hardware version of the OS", func() {
+				GinkgoT().Setenv("PATH", "")
+				vmdkPackager.BuildOptions.VMDKFile = writeFlatVMDK(1 << 20)
+				vmdkPackager.BuildOptions.OSVersion = "2022"
+				vmdkPackager.BuildOptions.OVABuilder = config.OVABuilderNative
+				vmdkPackager.BuildOptions.CompressionLevel = config.DefaultCompressionLevel
+				Expect(vmdkPackager.CreateImage()).To(Succeed())
+
+				imageDir, err := helpers.ExtractGzipArchive(vmdkPackager.Image)
+				Expect(err).NotTo(HaveOccurred())
+				ovfFile, err := helpers.ReadFile(filepath.Join(imageDir, "image.ovf"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ovfFile).To(ContainSubstring(`vmw:osType="windows2019srvNext_64Guest"`))
+				Expect(ovfFile).To(ContainSubstring("<vssd:VirtualSystemType>vmx-18<"))
+			})
+		})
+
+		It("returns an error for an OS that is not in the catalog", func() {
+			vmdkPackager.BuildOptions.OSVersion = "1709"
+
+			Expect(vmdkPackager.CreateImage()).To(MatchError(ContainSubstring(`unsupported OS version "1709"`)))
+		})
+	})
+
+	Describe("ValidateSourceParameters", func() {
+		It("returns why a corrupt VMDK is invalid", func() {
+			vmdkPackager.BuildOptions.VMDKFile = writeFlatVMDK(1 << 20)
+			Expect(os.Truncate(filepath.Join(filepath.Dir(vmdkPackager.BuildOptions.VMDKFile), "disk-flat.vmdk"), 4096)).To(Succeed())
+
+			err := vmdkPackager.ValidateSourceParameters()
+			Expect(err).To(MatchError(ContainSubstring(`invalid VMDK file: unable to read VMDK`)))
+			Expect(err).To(MatchError(ContainSubstring(`extent "disk-flat.vmdk"`)))
+		})
 	})
 
 	Describe("ValidateFreeSpaceForPackage", func() {
@@ -177,6 +295,51 @@ var _ = Describe("VmdkPackager", func() {
 			})
 		})
 
+		Context("When the VMDK is a flat disk, whose data is not in the VMDK file itself", func() {
+			It("needs free space for its capacity", func() {
+				vmdkPackager.BuildOptions.VMDKFile = writeFlatVMDK(1 << 20)
+
+				mockCtrl = gomock.NewController(GinkgoT())
+				mockFileSystem = mockfilesystem.NewMockFileSystem(mockCtrl)
+
+				directoryPath := filepath.Dir(vmdkPackager.BuildOptions.VMDKFile)
+				mockFileSystem.EXPECT().GetAvailableDiskSpace(directoryPath).Return(uint64(packager.Gigabyte/2+(1<<20)), nil).AnyTimes()
+
+				err := vmdkPackager.ValidateFreeSpaceForPackage(mockFileSystem)
+				Expect(err).To(MatchError(ContainSubstring("Not enough space to create stemcell")))
+			})
+		})
+
+		Context("When the VMDK is streamOptimized, with a capacity much larger than its file", func() {
+			var streamSize uint64
+
+			BeforeEach(func() {
+				vmdkPackager.BuildOptions.VMDKFile = writeStreamOptimizedVMDK(256 << 20)
+				mockCtrl = gomock.NewController(GinkgoT())
+				mockFileSystem = mockfilesystem.NewMockFileSystem(mockCtrl)
+
+				vmdkFile, err := os.Stat(vmdkPackager.BuildOptions.VMDKFile)
+				Expect(err).NotTo(HaveOccurred())
+				streamSize = uint64(vmdkFile.Size())
+				Expect(streamSize).To(BeNumerically("<", 1<<20))
+			})
+
+			It("needs free space for its file rather than its capacity", func() {
+				directoryPath := filepath.Dir(vmdkPackager.BuildOptions.VMDKFile)
+				mockFileSystem.EXPECT().GetAvailableDiskSpace(directoryPath).Return(streamSize*2+packager.Gigabyte/2, nil).AnyTimes()
+
+				Expect(vmdkPackager.ValidateFreeSpaceForPackage(mockFileSystem)).To(Succeed())
+			})
+
+			It("returns an error when there is not enough free space for its file", func() {
+				directoryPath := filepath.Dir(vmdkPackager.BuildOptions.VMDKFile)
+				mockFileSystem.EXPECT().GetAvailableDiskSpace(directoryPath).Return(streamSize*2+packager.Gigabyte/2-1, nil).AnyTimes()
+
+				err := vmdkPackager.ValidateFreeSpaceForPackage(mockFileSystem)
+				Expect(err).To(MatchError(ContainSubstring("Not enough space to create stemcell")))
+			})
+		})
+
 		Context("When filesystem fails to provide free space", func() {
 			It("returns error specifying that given disk could not provide free space", func() {
 				vmdkPackager.BuildOptions.VMDKFile = filepath.Join("..", "..", "test", "data", "expected.vmdk")
@@ -0,0 +1,13 @@
+package pgzip_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestPgzip(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Pgzip Suite")
+}
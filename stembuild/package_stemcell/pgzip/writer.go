@@ -0,0 +1,231 @@
+// Package pgzip implements a gzip writer that compresses its input in blocks
+// on several goroutines at once. The output is a single standard gzip member,
+// readable by compress/gzip, gzip and tar.
+package pgzip
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"runtime"
+	"sync"
+)
+
+const (
+	// blockSize is the amount of input compressed by each goroutine.
+	blockSize = 1 << 20
+	// dictSize is how far back deflate can refer. Each block is compressed
+	// with the end of the previous one as its dictionary, so that splitting
+	// the input costs almost nothing in compression ratio.
+	dictSize = 32 << 10
+)
+
+// block is one piece of the input, compressed into a run of deflate blocks
+// that ends on a byte boundary so that the runs can be concatenated.
+type block struct {
+	data []byte
+	dict []byte
+	last bool
+	out  bytes.Buffer
+	err  error
+	done chan struct{}
+}
+
+func (b *block) compress(level int) {
+	defer close(b.done)
+
+	fw, err := flate.NewWriterDict(&b.out, level, b.dict)
+	if err != nil {
+		b.err = err
+		return
+	}
+
+	_, err = fw.Write(b.data)
+	if err != nil {
+		b.err = err
+		return
+	}
+
+	if b.last {
+		b.err = fw.Close()
+	} else {
+		b.err = fw.Flush()
+	}
+}
+
+// Writer is an io.WriteCloser that gzips what is written to it. Blocks are
+// compressed in parallel and written out in order; Close must be called to
+// flush the final block and the gzip trailer.
+type Writer struct {
+	w     io.Writer
+	level int
+
+	crc  uint32
+	size uint32
+	buf  []byte
+	dict []byte
+
+	// running limits the number of blocks being compressed, and queue the
+	// number waiting to be written, so that memory use stays bounded.
+	running chan struct{}
+	queue   chan *block
+	written chan struct{}
+
+	mutex  sync.Mutex
+	err    error
+	closed bool
+}
+
+// NewWriter returns a Writer compressing at level, one of the compress/gzip
+// levels, with up to threads blocks compressed at once. threads of 0 or less
+// uses one per CPU.
+func NewWriter(w io.Writer, level, threads int) (*Writer, error) {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return nil, fmt.Errorf("pgzip: invalid compression level: %d", level)
+	}
+	if threads <= 0 {
+		threads = runtime.GOMAXPROCS(0)
+	}
+
+	z := &Writer{
+		w:       w,
+		level:   level,
+		running: make(chan struct{}, threads),
+		queue:   make(chan *block, threads),
+		written: make(chan struct{}),
+	}
+	go z.writeBlocks()
+
+	return z, nil
+}
+
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.closed {
+		return 0, errors.New("pgzip: write to closed writer")
+	}
+	if err := z.error(); err != nil {
+		return 0, err
+	}
+
+	z.crc = crc32.Update(z.crc, crc32.IEEETable, p)
+	z.size += uint32(len(p))
+
+	n := 0
+	for len(p) > 0 {
+		if z.buf == nil {
+			z.buf = make([]byte, 0, blockSize)
+		}
+
+		copied := copy(z.buf[len(z.buf):cap(z.buf)], p)
+		z.buf = z.buf[:len(z.buf)+copied]
+		p = p[copied:]
+		n += copied
+
+		if len(z.buf) == cap(z.buf) {
+			z.dispatch(false)
+			if err := z.error(); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// Close compresses the remaining input and writes the gzip trailer. It does
+// not close the underlying writer.
+func (z *Writer) Close() error {
+	if z.closed {
+		return z.error()
+	}
+	z.closed = true
+
+	z.dispatch(true)
+	close(z.queue)
+	<-z.written
+
+	if err := z.error(); err != nil {
+		return err
+	}
+
+	trailer := binary.LittleEndian.AppendUint32(nil, z.crc)
+	trailer = binary.LittleEndian.AppendUint32(trailer, z.size)
+	_, err := z.w.Write(trailer)
+	return err
+}
+
+// dispatch starts compressing the buffered input and queues it to be written.
+func (z *Writer) dispatch(last bool) {
+	b := &block{data: z.buf, dict: z.dict, last: last, done: make(chan struct{})}
+
+	if len(z.buf) >= dictSize {
+		z.dict = z.buf[len(z.buf)-dictSize:]
+	}
+	z.buf = nil
+
+	z.running <- struct{}{}
+	go func() {
+		defer func() { <-z.running }()
+		b.compress(z.level)
+	}()
+
+	z.queue <- b
+}
+
+// writeBlocks writes the gzip header and then each block in the order it was
+// queued. After an error it keeps draining the queue so that Write and Close
+// never block.
+func (z *Writer) writeBlocks() {
+	defer close(z.written)
+
+	var xfl byte
+	switch z.level {
+	case gzip.BestCompression:
+		xfl = 2
+	case gzip.BestSpeed:
+		xfl = 4
+	}
+	// No name, comment or modification time; unknown operating system.
+	_, err := z.w.Write([]byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, xfl, 255})
+	z.setError(err)
+
+	for b := range z.queue {
+		<-b.done
+		if z.error() != nil {
+			continue
+		}
+
+		if b.err != nil {
+			z.setError(b.err)
+			continue
+		}
+
+		_, err := z.w.Write(b.out.Bytes())
+		z.setError(err)
+	}
+}
+
+func (z *Writer) error() error {
+	z.mutex.Lock()
+	defer z.mutex.Unlock()
+
+	return z.err
+}
+
+func (z *Writer) setError(err error) {
+	if err == nil {
+		return
+	}
+
+	z.mutex.Lock()
+	defer z.mutex.Unlock()
+
+	if z.err == nil {
+		z.err = err
+	}
+}
@@ -0,0 +1,141 @@
+package pgzip_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/pgzip"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+var _ = Describe("Writer", func() {
+	var input []byte
+
+	BeforeEach(func() {
+		// Several blocks of partly compressible data, ending mid-block.
+		random := rand.New(rand.NewSource(1))
+		input = make([]byte, 3<<20+12345)
+		for i := range input {
+			input[i] = "abcdefgh"[random.Intn(8)]
+		}
+	})
+
+	compress := func(data []byte, level, threads int) []byte {
+		var out bytes.Buffer
+		w, err := pgzip.NewWriter(&out, level, threads)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = w.Write(data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Close()).To(Succeed())
+
+		return out.Bytes()
+	}
+
+	decompress := func(compressed []byte) []byte {
+		r, err := gzip.NewReader(bytes.NewReader(compressed))
+		Expect(err).NotTo(HaveOccurred())
+		// A single member, as written by compress/gzip.
+		r.Multistream(false)
+
+		out, err := io.ReadAll(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Reset(bytes.NewReader(nil))).To(MatchError(io.EOF))
+		return out
+	}
+
+	DescribeTable("writes a gzip stream of the input",
+		func(level, threads int) {
+			Expect(decompress(compress(input, level, threads))).To(Equal(input))
+		},
+		Entry("default level, one thread", gzip.DefaultCompression, 1),
+		Entry("default level, one thread per CPU", gzip.DefaultCompression, 0),
+		Entry("best speed", gzip.BestSpeed, 4),
+		Entry("best compression", gzip.BestCompression, 4),
+		Entry("no compression", gzip.NoCompression, 4),
+		Entry("huffman only", gzip.HuffmanOnly, 4),
+	)
+
+	It("compresses about as well as compress/gzip", func() {
+		var expected bytes.Buffer
+		w := gzip.NewWriter(&expected)
+		_, err := w.Write(input)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Close()).To(Succeed())
+
+		Expect(len(compress(input, gzip.DefaultCompression, 4))).To(BeNumerically("<", expected.Len()*101/100))
+	})
+
+	It("writes the same stream regardless of the number of threads", func() {
+		Expect(compress(input, gzip.DefaultCompression, 1)).To(Equal(compress(input, gzip.DefaultCompression, 8)))
+	})
+
+	It("handles empty input", func() {
+		Expect(decompress(compress(nil, gzip.DefaultCompression, 2))).To(BeEmpty())
+	})
+
+	It("handles many small writes", func() {
+		var out bytes.Buffer
+		w, err := pgzip.NewWriter(&out, gzip.BestSpeed, 3)
+		Expect(err).NotTo(HaveOccurred())
+		for i := 0; i < len(input); i += 1000 {
+			_, err = w.Write(input[i:min(i+1000, len(input))])
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(w.Close()).To(Succeed())
+
+		Expect(decompress(out.Bytes())).To(Equal(input))
+	})
+
+	It("writes a file that gzip can test", func() {
+		gzipPath, err := exec.LookPath("gzip")
+		if err != nil {
+			Skip("gzip is not installed")
+		}
+
+		file := filepath.Join(GinkgoT().TempDir(), "input.gz")
+		Expect(os.WriteFile(file, compress(input, gzip.DefaultCompression, 0), 0644)).To(Succeed())
+
+		out, err := exec.Command(gzipPath, "-t", file).CombinedOutput()
+		Expect(err).NotTo(HaveOccurred(), string(out))
+	})
+
+	It("rejects an invalid compression level", func() {
+		_, err := pgzip.NewWriter(io.Discard, 10, 1)
+		Expect(err).To(MatchError("pgzip: invalid compression level: 10"))
+	})
+
+	It("returns the error from the underlying writer", func() {
+		w, err := pgzip.NewWriter(failingWriter{}, gzip.DefaultCompression, 2)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() error {
+			_, err := w.Write(input)
+			return err
+		}).Should(MatchError("disk full"))
+		Expect(w.Close()).To(MatchError("disk full"))
+	})
+
+	It("does not accept writes after Close", func() {
+		w, err := pgzip.NewWriter(io.Discard, gzip.DefaultCompression, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Close()).To(Succeed())
+
+		_, err = w.Write([]byte("late"))
+		Expect(err).To(HaveOccurred())
+	})
+})
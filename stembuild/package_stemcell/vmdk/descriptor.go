@@ -0,0 +1,164 @@
+// Package vmdk reads VMware virtual disks and writes them in the
+// streamOptimized format that OVF packages and vCenter imports expect,
+// following the VMware Virtual Disk Format 5.0 specification.
+package vmdk
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NoParent is the parentCID of a disk that is not a delta of another disk.
+const NoParent = 0xffffffff
+
+// Descriptor is the text describing a virtual disk: the extents holding its
+// data and the disk database, which records its geometry and adapter.
+type Descriptor struct {
+	Version    int
+	Encoding   string
+	CID        uint32
+	ParentCID  uint32
+	CreateType string
+	Extents    []Extent
+	// DDB is the disk database, without the "ddb." prefix of its keys.
+	DDB map[string]string
+}
+
+// Extent is a run of sectors of a disk stored in one file.
+type Extent struct {
+	// Access is RW, RDONLY or NOACCESS.
+	Access  string
+	Sectors int64
+	// Type is how the sectors are stored, such as SPARSE, FLAT or ZERO.
+	Type string
+	// File is relative to the descriptor, and empty for ZERO extents.
+	File string
+	// Offset is the sector of a FLAT extent's file that its data starts at.
+	Offset int64
+}
+
+var extentLine = regexp.MustCompile(`^(RW|RDONLY|NOACCESS)\s+(\d+)\s+(\w+)(?:\s+"([^"]*)"(?:\s+(\d+))?)?\s*$`)
+
+// ParseDescriptor reads a descriptor, either a descriptor file or the one
+// embedded in a sparse extent.
+func ParseDescriptor(r io.Reader) (*Descriptor, error) {
+	d := &Descriptor{ParentCID: NoParent, DDB: map[string]string{}}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// Embedded descriptors are padded with NULs to a whole sector.
+		line := strings.TrimSpace(strings.TrimRight(scanner.Text(), "\x00"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if match := extentLine.FindStringSubmatch(line); match != nil {
+			extent := Extent{Access: match[1], Type: match[3], File: match[4]}
+			extent.Sectors, _ = strconv.ParseInt(match[2], 10, 64) //nolint:errcheck
+			if match[5] != "" {
+				extent.Offset, _ = strconv.ParseInt(match[5], 10, 64) //nolint:errcheck
+			}
+			d.Extents = append(d.Extents, extent)
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("vmdk descriptor: unexpected line %q", line)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+
+		if name, isDDB := strings.CutPrefix(key, "ddb."); isDDB {
+			d.DDB[name] = value
+			continue
+		}
+
+		var err error
+		switch strings.ToLower(key) {
+		case "version":
+			d.Version, err = strconv.Atoi(value)
+		case "encoding":
+			d.Encoding = value
+		case "cid":
+			d.CID, err = parseCID(value)
+		case "parentcid":
+			d.ParentCID, err = parseCID(value)
+		case "createtype":
+			d.CreateType = value
+		}
+		if err != nil {
+			return nil, fmt.Errorf("vmdk descriptor: invalid %s %q", key, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("vmdk descriptor: %w", err)
+	}
+
+	if d.CreateType == "" {
+		return nil, fmt.Errorf("vmdk descriptor: no createType")
+	}
+	if len(d.Extents) == 0 {
+		return nil, fmt.Errorf("vmdk descriptor: no extents")
+	}
+
+	return d, nil
+}
+
+func parseCID(value string) (uint32, error) {
+	cid, err := strconv.ParseUint(value, 16, 32)
+	return uint32(cid), err
+}
+
+// Sectors is the capacity of the disk, the total size of its extents.
+func (d *Descriptor) Sectors() int64 {
+	var sectors int64
+	for _, extent := range d.Extents {
+		sectors += extent.Sectors
+	}
+
+	return sectors
+}
+
+// String formats the descriptor as it is written to a descriptor file, with
+// the disk database sorted so that the same disk always gives the same text.
+func (d *Descriptor) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Disk DescriptorFile\n")
+	fmt.Fprintf(&b, "version=%d\n", d.Version)
+	if d.Encoding != "" {
+		fmt.Fprintf(&b, "encoding=\"%s\"\n", d.Encoding)
+	}
+	fmt.Fprintf(&b, "CID=%08x\n", d.CID)
+	fmt.Fprintf(&b, "parentCID=%08x\n", d.ParentCID)
+	fmt.Fprintf(&b, "createType=\"%s\"\n", d.CreateType)
+
+	fmt.Fprintf(&b, "\n# Extent description\n")
+	for _, extent := range d.Extents {
+		fmt.Fprintf(&b, "%s %d %s", extent.Access, extent.Sectors, extent.Type)
+		if extent.Type != "ZERO" {
+			fmt.Fprintf(&b, " \"%s\"", extent.File)
+		}
+		if extent.Offset != 0 {
+			fmt.Fprintf(&b, " %d", extent.Offset)
+		}
+		fmt.Fprintf(&b, "\n")
+	}
+
+	fmt.Fprintf(&b, "\n# The Disk Data Base\n#DDB\n\n")
+	keys := make([]string, 0, len(d.DDB))
+	for key := range d.DDB {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "ddb.%s = \"%s\"\n", key, d.DDB[key])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,212 @@
+package vmdk
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// maxDescriptorFileSize is the largest file that is read as a descriptor
+// file; anything bigger is disk data.
+const maxDescriptorFileSize = 1 << 20
+
+type extentReader interface {
+	io.ReaderAt
+	Size() int64
+}
+
+// Disk is a virtual disk opened for reading, whichever files its data is
+// spread over. It reads the extents of the disk as one run of bytes, and is
+// not safe for concurrent use.
+type Disk struct {
+	Path       string
+	Descriptor *Descriptor
+
+	extents []extentReader
+	files   []*os.File
+}
+
+// Open opens a monolithic sparse or streamOptimized VMDK, or a descriptor
+// file and the SPARSE, FLAT and ZERO extents it lists.
+func Open(path string) (*Disk, error) {
+	d := &Disk{Path: path}
+	err := d.open()
+	if err != nil {
+		d.Close() //nolint:errcheck
+		return nil, fmt.Errorf("unable to read VMDK %s: %w", path, err)
+	}
+
+	return d, nil
+}
+
+func (d *Disk) open() error {
+	file, err := d.openFile(d.Path)
+	if err != nil {
+		return err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	var magic [4]byte
+	_, err = file.ReadAt(magic[:], 0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	if bytes.Equal(magic[:], []byte("KDMV")) {
+		d.Descriptor, err = embeddedDescriptor(file)
+		if err != nil {
+			return err
+		}
+		if len(d.Descriptor.Extents) != 1 || d.Descriptor.Extents[0].Type != "SPARSE" {
+			return fmt.Errorf("embedded descriptor must describe the one SPARSE extent of the file")
+		}
+
+		extent, err := openSparseExtent(file, fi.Size())
+		if err != nil {
+			return err
+		}
+		d.extents = append(d.extents, extent)
+	} else {
+		if fi.Size() > maxDescriptorFileSize {
+			return fmt.Errorf("not a VMDK: neither a sparse extent nor a descriptor file")
+		}
+		d.Descriptor, err = ParseDescriptor(io.NewSectionReader(file, 0, fi.Size()))
+		if err != nil {
+			return fmt.Errorf("not a VMDK: %w", err)
+		}
+
+		for _, extent := range d.Descriptor.Extents {
+			reader, err := d.openExtent(extent)
+			if err != nil {
+				return fmt.Errorf("extent %q: %w", extent.File, err)
+			}
+			d.extents = append(d.extents, reader)
+		}
+	}
+
+	if d.Descriptor.ParentCID != NoParent {
+		return fmt.Errorf("delta disks of a parent disk are not supported")
+	}
+
+	for i, extent := range d.Descriptor.Extents {
+		if d.extents[i].Size() != extent.Sectors*SectorSize {
+			return fmt.Errorf("extent %q holds %d bytes, the descriptor gives %d sectors", extent.File, d.extents[i].Size(), extent.Sectors)
+		}
+	}
+
+	return nil
+}
+
+func (d *Disk) openFile(path string) (*os.File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	d.files = append(d.files, file)
+
+	return file, nil
+}
+
+func (d *Disk) openExtent(extent Extent) (extentReader, error) {
+	if extent.Type == "ZERO" {
+		return zeroExtent(extent.Sectors * SectorSize), nil
+	}
+
+	file, err := d.openFile(filepath.Join(filepath.Dir(d.Path), extent.File))
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	switch extent.Type {
+	case "SPARSE":
+		return openSparseExtent(file, fi.Size())
+	case "FLAT", "VMFS":
+		size := extent.Sectors * SectorSize
+		if fi.Size() < extent.Offset*SectorSize+size {
+			return nil, fmt.Errorf("file holds %d bytes, the descriptor gives %d sectors from sector %d", fi.Size(), extent.Sectors, extent.Offset)
+		}
+		return io.NewSectionReader(file, extent.Offset*SectorSize, size), nil
+	default:
+		return nil, fmt.Errorf("unsupported extent type %s", extent.Type)
+	}
+}
+
+// Capacity is the size of the virtual disk in bytes.
+func (d *Disk) Capacity() int64 {
+	var capacity int64
+	for _, extent := range d.extents {
+		capacity += extent.Size()
+	}
+
+	return capacity
+}
+
+// ReadAt reads the virtual disk, with unallocated sectors read as zeros.
+func (d *Disk) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for _, extent := range d.extents {
+		if len(p) == 0 {
+			break
+		}
+		if off >= extent.Size() {
+			off -= extent.Size()
+			continue
+		}
+
+		length := min(int64(len(p)), extent.Size()-off)
+		read, err := extent.ReadAt(p[:length], off)
+		n += read
+		if err != nil && !(err == io.EOF && int64(read) == length) {
+			return n, err
+		}
+
+		p = p[length:]
+		off = 0
+	}
+
+	if len(p) > 0 {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (d *Disk) Close() error {
+	var firstErr error
+	for _, file := range d.files {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	d.files = nil
+
+	return firstErr
+}
+
+// zeroExtent is a ZERO extent, which has no file and reads as zeros.
+type zeroExtent int64
+
+func (z zeroExtent) Size() int64 {
+	return int64(z)
+}
+
+func (z zeroExtent) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(z) {
+		return 0, io.EOF
+	}
+
+	length := min(int64(len(p)), int64(z)-off)
+	clear(p[:length])
+	if length < int64(len(p)) {
+		return int(length), io.EOF
+	}
+	return int(length), nil
+}
@@ -0,0 +1,140 @@
+package vmdk_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/gomega"
+)
+
+// testDiskData returns a disk of the given number of 64KiB grains, with every
+// third grain holding partly compressible data and the rest zeros.
+func testDiskData(grains int) []byte {
+	random := rand.New(rand.NewSource(1))
+	data := make([]byte, grains*64<<10)
+	for grain := 0; grain < grains; grain += 3 {
+		chunk := data[grain*64<<10 : (grain+1)*64<<10]
+		for i := range chunk {
+			if i%3 == 0 {
+				chunk[i] = byte(random.Intn(256))
+			} else {
+				chunk[i] = byte(i)
+			}
+		}
+	}
+	return data
+}
+
+const testDDB = `ddb.adapterType = "lsilogic"
+ddb.geometry.cylinders = "16"
+ddb.geometry.heads = "16"
+ddb.geometry.sectors = "63"
+ddb.virtualHWVersion = "10"
+`
+
+// writeFlatDisk writes data as a monolithicFlat VMDK: a descriptor file and
+// a -flat.vmdk file holding the data.
+func writeFlatDisk(dir string, data []byte) string {
+	descriptor := fmt.Sprintf(`# Disk DescriptorFile
+version=1
+encoding="UTF-8"
+CID=1a2b3c4d
+parentCID=ffffffff
+createType="monolithicFlat"
+
+# Extent description
+RW %d FLAT "disk-flat.vmdk" 0
+
+# The Disk Data Base
+#DDB
+
+%s`, len(data)/512, testDDB)
+
+	path := filepath.Join(dir, "disk.vmdk")
+	Expect(os.WriteFile(path, []byte(descriptor), 0644)).To(Succeed())
+	Expect(os.WriteFile(filepath.Join(dir, "disk-flat.vmdk"), data, 0644)).To(Succeed())
+	return path
+}
+
+// writeSparseDisk writes data as a monolithicSparse VMDK, as VMware
+// Workstation creates, with 8KiB grains and no grains of zeros.
+func writeSparseDisk(dir string, data []byte) string {
+	const (
+		grainSize = 16 // sectors
+		gtes      = 512
+	)
+	sectors := len(data) / 512
+	grains := (sectors + grainSize - 1) / grainSize
+	grainTables := (grains + gtes - 1) / gtes
+
+	descriptor := fmt.Sprintf(`# Disk DescriptorFile
+version=1
+encoding="UTF-8"
+CID=1a2b3c4d
+parentCID=ffffffff
+createType="monolithicSparse"
+
+# Extent description
+RW %d SPARSE "disk.vmdk"
+
+# The Disk Data Base
+#DDB
+
+%s`, sectors, testDDB)
+	Expect(len(descriptor)).To(BeNumerically("<=", 2*512))
+
+	gdOffset := 3
+	gtOffset := gdOffset + (grainTables*4+511)/512
+	grainOffset := gtOffset + grainTables*4
+
+	gd := make([]uint32, grainTables)
+	for i := range gd {
+		gd[i] = uint32(gtOffset + i*4)
+	}
+	gt := make([]uint32, grainTables*gtes)
+	var grainData bytes.Buffer
+	for grain := 0; grain < grains; grain++ {
+		chunk := data[grain*grainSize*512 : (grain+1)*grainSize*512]
+		if bytes.Count(chunk, []byte{0}) == len(chunk) {
+			continue
+		}
+		gt[grain] = uint32(grainOffset + grainData.Len()/512)
+		grainData.Write(chunk)
+	}
+
+	var file bytes.Buffer
+	header := struct {
+		MagicNumber, Version, Flags                         uint32
+		Capacity, GrainSize, DescriptorOffset, DescriptorSz uint64
+		NumGTEsPerGT                                        uint32
+		RGDOffset, GDOffset, OverHead                       uint64
+		UncleanShutdown                                     uint8
+		EndLineChars                                        [4]byte
+		CompressAlgorithm                                   uint16
+	}{
+		MagicNumber: 0x564d444b, Version: 1, Flags: 1,
+		Capacity: uint64(sectors), GrainSize: grainSize, DescriptorOffset: 1, DescriptorSz: 2,
+		NumGTEsPerGT: gtes, GDOffset: uint64(gdOffset), OverHead: uint64(grainOffset),
+		EndLineChars: [4]byte{'\n', ' ', '\r', '\n'},
+	}
+	Expect(binary.Write(&file, binary.LittleEndian, header)).To(Succeed())
+	pad := func(sector int) {
+		file.Write(make([]byte, sector*512-file.Len()))
+	}
+	pad(1)
+	file.WriteString(descriptor)
+	pad(gdOffset)
+	Expect(binary.Write(&file, binary.LittleEndian, gd)).To(Succeed())
+	pad(gtOffset)
+	Expect(binary.Write(&file, binary.LittleEndian, gt)).To(Succeed())
+	pad(grainOffset)
+	file.Write(grainData.Bytes())
+
+	path := filepath.Join(dir, "disk.vmdk")
+	Expect(os.WriteFile(path, file.Bytes(), 0644)).To(Succeed())
+	return path
+}
@@ -0,0 +1,122 @@
+package vmdk
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// createTypes are the kinds of disk that Open can read.
+var createTypes = map[string]bool{
+	"monolithicSparse":     true,
+	"monolithicFlat":       true,
+	"streamOptimized":      true,
+	"twoGbMaxExtentSparse": true,
+	"twoGbMaxExtentFlat":   true,
+	"vmfs":                 true,
+	"vmfsThin":             true,
+}
+
+// Info describes a virtual disk.
+type Info struct {
+	CreateType string
+	// Capacity is the size of the virtual disk in bytes.
+	Capacity int64
+	// Size is the number of bytes of the files holding the disk.
+	Size int64
+	// GrainSize is the size in bytes of the grains of its sparse extents, 0
+	// if it has none.
+	GrainSize   int64
+	AdapterType string
+}
+
+// Stat reads the VMDK at path and checks that it is a disk that can be
+// packaged: a supported createType whose extents are all present and, for
+// sparse extents, whose grains all lie within their files, which catches
+// truncated copies.
+func Stat(path string) (Info, error) {
+	disk, err := Open(path)
+	if err != nil {
+		return Info{}, err
+	}
+	defer disk.Close() //nolint:errcheck
+
+	info := Info{
+		CreateType:  disk.Descriptor.CreateType,
+		Capacity:    disk.Capacity(),
+		AdapterType: disk.Descriptor.DDB["adapterType"],
+	}
+
+	err = disk.check(&info)
+	if err != nil {
+		return Info{}, fmt.Errorf("unable to read VMDK %s: %w", path, err)
+	}
+
+	return info, nil
+}
+
+func (d *Disk) check(info *Info) error {
+	if !createTypes[info.CreateType] {
+		return fmt.Errorf("unsupported createType %q", info.CreateType)
+	}
+	if info.Capacity == 0 {
+		return fmt.Errorf("disk has no capacity")
+	}
+
+	for _, file := range d.files {
+		fi, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		info.Size += fi.Size()
+	}
+
+	for i, extent := range d.extents {
+		sparse, ok := extent.(*sparseExtent)
+		if !ok {
+			continue
+		}
+		info.GrainSize = sparse.header.grainBytes()
+
+		err := sparse.check()
+		if err != nil {
+			name := d.Descriptor.Extents[i].File
+			if name == "" {
+				name = filepath.Base(d.Path)
+			}
+			return fmt.Errorf("extent %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// check reads every grain table of the extent and checks that the grains they
+// point to start within the file.
+func (e *sparseExtent) check() error {
+	size := e.fileSize
+	gtes := int64(e.header.NumGTEsPerGT)
+	for gtIndex, gtOffset := range e.gd {
+		if gtOffset == 0 {
+			continue
+		}
+		if int64(gtOffset)*SectorSize+gtes*4 > size {
+			return fmt.Errorf("grain table %d is past the end of the file, which may be truncated", gtIndex)
+		}
+
+		gt, err := readTable(e.file, int64(gtOffset)*SectorSize, gtes)
+		if err != nil {
+			return fmt.Errorf("unable to read grain table %d: %w", gtIndex, err)
+		}
+		for i, entry := range gt {
+			if entry == 0 || entry == grainTableEntryZero {
+				continue
+			}
+			if int64(entry)*SectorSize >= size {
+				grain := int64(gtIndex)*gtes + int64(i)
+				return fmt.Errorf("grain %d is past the end of the file, which may be truncated", grain)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,269 @@
+package vmdk
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// SectorSize is the size of the sectors that VMDK offsets and sizes count.
+const SectorSize = 512
+
+const (
+	sparseMagic = 0x564d444b // "KDMV"
+	// gdAtEnd is the gdOffset of a streamOptimized header whose grain
+	// directory is given by the footer at the end of the file.
+	gdAtEnd = 0xffffffffffffffff
+
+	flagValidNewLineTest = 1 << 0
+	flagCompressed       = 1 << 16
+	flagMarkers          = 1 << 17
+
+	compressionNone    = 0
+	compressionDeflate = 1
+
+	// grainTableEntryZero marks a grain that reads as zeros, as does 0.
+	grainTableEntryZero = 1
+)
+
+// sparseHeader is the header of a hosted sparse extent, in the first sector
+// of the file and, for streamOptimized extents, again in the footer.
+type sparseHeader struct {
+	MagicNumber        uint32
+	Version            uint32
+	Flags              uint32
+	Capacity           uint64
+	GrainSize          uint64
+	DescriptorOffset   uint64
+	DescriptorSize     uint64
+	NumGTEsPerGT       uint32
+	RGDOffset          uint64
+	GDOffset           uint64
+	OverHead           uint64
+	UncleanShutdown    uint8
+	SingleEndLineChar  byte
+	NonEndLineChar     byte
+	DoubleEndLineChar1 byte
+	DoubleEndLineChar2 byte
+	CompressAlgorithm  uint16
+	Pad                [433]byte
+}
+
+func readSparseHeader(r io.ReaderAt, offset int64) (sparseHeader, error) {
+	var header sparseHeader
+	err := binary.Read(io.NewSectionReader(r, offset, SectorSize), binary.LittleEndian, &header)
+	if err != nil {
+		return header, err
+	}
+	if header.MagicNumber != sparseMagic {
+		return header, fmt.Errorf("no sparse extent header")
+	}
+
+	return header, nil
+}
+
+// validate checks that the header describes an extent that can be read.
+func (h sparseHeader) validate() error {
+	if h.Version < 1 || h.Version > 3 {
+		return fmt.Errorf("unsupported sparse extent version %d", h.Version)
+	}
+	if h.GrainSize == 0 || h.GrainSize&(h.GrainSize-1) != 0 {
+		return fmt.Errorf("invalid grain size of %d sectors", h.GrainSize)
+	}
+	if h.NumGTEsPerGT == 0 {
+		return fmt.Errorf("invalid grain table size of %d entries", h.NumGTEsPerGT)
+	}
+	if h.Flags&flagCompressed != 0 && h.CompressAlgorithm != compressionDeflate {
+		return fmt.Errorf("unsupported compression algorithm %d", h.CompressAlgorithm)
+	}
+
+	return nil
+}
+
+func (h sparseHeader) grainBytes() int64 {
+	return int64(h.GrainSize) * SectorSize
+}
+
+func (h sparseHeader) grainTables() int64 {
+	grains := (int64(h.Capacity) + int64(h.GrainSize) - 1) / int64(h.GrainSize)
+	return (grains + int64(h.NumGTEsPerGT) - 1) / int64(h.NumGTEsPerGT)
+}
+
+// sparseExtent reads a hosted sparse extent, including compressed
+// streamOptimized ones. It caches the last grain table and grain it read, so
+// it is not safe for concurrent use.
+type sparseExtent struct {
+	file     io.ReaderAt
+	fileSize int64
+	header   sparseHeader
+	gd       []uint32
+
+	gtIndex int64
+	gt      []uint32
+
+	grainIndex int64
+	grain      []byte
+}
+
+func openSparseExtent(file io.ReaderAt, size int64) (*sparseExtent, error) {
+	header, err := readSparseHeader(file, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if header.GDOffset == gdAtEnd {
+		// The footer is followed by the end-of-stream marker.
+		if size < 3*SectorSize {
+			return nil, fmt.Errorf("streamOptimized extent has no footer")
+		}
+		header, err = readSparseHeader(file, size-2*SectorSize)
+		if err != nil {
+			return nil, fmt.Errorf("streamOptimized extent has no footer, so may be truncated: %w", err)
+		}
+	}
+	if err := header.validate(); err != nil {
+		return nil, err
+	}
+
+	gd, err := readTable(file, int64(header.GDOffset)*SectorSize, header.grainTables())
+	if err != nil {
+		return nil, fmt.Errorf("unable to read grain directory: %w", err)
+	}
+
+	return &sparseExtent{file: file, fileSize: size, header: header, gd: gd, gtIndex: -1, grainIndex: -1}, nil
+}
+
+func readTable(r io.ReaderAt, offset int64, entries int64) ([]uint32, error) {
+	table := make([]uint32, entries)
+	err := binary.Read(io.NewSectionReader(r, offset, entries*4), binary.LittleEndian, table)
+	return table, err
+}
+
+func (e *sparseExtent) Size() int64 {
+	return int64(e.header.Capacity) * SectorSize
+}
+
+func (e *sparseExtent) ReadAt(p []byte, off int64) (int, error) {
+	grainBytes := e.header.grainBytes()
+
+	n := 0
+	for len(p) > 0 {
+		if off >= e.Size() {
+			return n, io.EOF
+		}
+
+		grain, err := e.readGrain(off / grainBytes)
+		if err != nil {
+			return n, err
+		}
+
+		start := off % grainBytes
+		length := min(int64(len(p)), grainBytes-start, e.Size()-off)
+		if grain == nil {
+			clear(p[:length])
+		} else {
+			copy(p[:length], grain[start:])
+		}
+
+		p = p[length:]
+		off += length
+		n += int(length)
+	}
+
+	return n, nil
+}
+
+// readGrain returns the contents of a grain, or nil if it reads as zeros.
+func (e *sparseExtent) readGrain(index int64) ([]byte, error) {
+	if index == e.grainIndex {
+		return e.grain, nil
+	}
+
+	gtes := int64(e.header.NumGTEsPerGT)
+	gtIndex := index / gtes
+	if e.gd[gtIndex] == 0 {
+		return nil, nil
+	}
+	if gtIndex != e.gtIndex {
+		gt, err := readTable(e.file, int64(e.gd[gtIndex])*SectorSize, gtes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read grain table %d: %w", gtIndex, err)
+		}
+		e.gt, e.gtIndex = gt, gtIndex
+	}
+
+	entry := e.gt[index%gtes]
+	if entry == 0 || entry == grainTableEntryZero {
+		return nil, nil
+	}
+
+	if e.grain == nil {
+		e.grain = make([]byte, e.header.grainBytes())
+	}
+	e.grainIndex = -1
+
+	offset := int64(entry) * SectorSize
+	var err error
+	if e.header.Flags&flagCompressed != 0 {
+		err = e.readCompressedGrain(offset)
+	} else {
+		_, err = e.file.ReadAt(e.grain, offset)
+		if err == io.EOF {
+			// The last grain of the file may stop at the end of the disk.
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read grain %d: %w", index, err)
+	}
+
+	e.grainIndex = index
+	return e.grain, nil
+}
+
+// readCompressedGrain reads a grain marker, the sector of the grain and the
+// size of its deflated data, followed by the data.
+func (e *sparseExtent) readCompressedGrain(offset int64) error {
+	var marker [12]byte
+	_, err := e.file.ReadAt(marker[:], offset)
+	if err != nil {
+		return err
+	}
+
+	size := int64(binary.LittleEndian.Uint32(marker[8:]))
+	compressed := make([]byte, size)
+	_, err = e.file.ReadAt(compressed, offset+int64(len(marker)))
+	if err != nil {
+		return err
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return err
+	}
+	n, err := io.ReadFull(zr, e.grain)
+	if err == io.ErrUnexpectedEOF {
+		// Only the part of the last grain within the disk may be stored.
+		clear(e.grain[n:])
+		err = nil
+	}
+	return err
+}
+
+// embeddedDescriptor reads the descriptor stored in a monolithic sparse file.
+func embeddedDescriptor(file *os.File) (*Descriptor, error) {
+	header, err := readSparseHeader(file, 0)
+	if err != nil {
+		return nil, err
+	}
+	if header.DescriptorOffset == 0 || header.DescriptorSize == 0 {
+		return nil, fmt.Errorf("sparse extent has no embedded descriptor")
+	}
+
+	offset := int64(header.DescriptorOffset) * SectorSize
+	size := int64(header.DescriptorSize) * SectorSize
+	return ParseDescriptor(io.NewSectionReader(file, offset, size))
+}
@@ -0,0 +1,325 @@
+package vmdk
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"sync"
+)
+
+const (
+	// StreamOptimizedFormat is the OVF disk format of streamOptimized VMDKs.
+	StreamOptimizedFormat = "http://www.vmware.com/interfaces/specifications/vmdk.html#streamOptimized"
+
+	streamGrainSize    = 128 // sectors, 64KiB
+	streamGTEsPerGT    = 512
+	streamGrainBytes   = streamGrainSize * SectorSize
+	streamGTBytes      = streamGTEsPerGT * 4
+	grainMarkerSize    = 12
+	markerEndOfStream  = 0
+	markerGrainTable   = 1
+	markerGrainDir     = 2
+	markerFooter       = 3
+	defaultAdapterType = "lsilogic"
+)
+
+// StreamOptions are the settings for WriteStreamOptimized.
+type StreamOptions struct {
+	// FileName is the name the descriptor gives the extent, which is the
+	// name of the VMDK in the OVF package.
+	FileName string
+	// Level is the compress/zlib level of the grains.
+	Level int
+	// Threads is the number of grains compressed at once; 0 or less uses
+	// one per CPU.
+	Threads int
+}
+
+// WriteStreamOptimized writes the disk to w as a streamOptimized VMDK: its
+// allocated grains deflated one by one, followed by the grain tables, the
+// grain directory and a footer. Grains of zeros are left out.
+func (d *Disk) WriteStreamOptimized(ctx context.Context, w io.Writer, options StreamOptions) error {
+	if options.Level < zlib.HuffmanOnly || options.Level > zlib.BestCompression {
+		return fmt.Errorf("invalid compression level %d", options.Level)
+	}
+	threads := options.Threads
+	if threads <= 0 {
+		threads = runtime.GOMAXPROCS(0)
+	}
+
+	sectors := (d.Capacity() + SectorSize - 1) / SectorSize
+	grains := (sectors + streamGrainSize - 1) / streamGrainSize
+	grainTables := (grains + streamGTEsPerGT - 1) / streamGTEsPerGT
+
+	out := &sectorWriter{w: w}
+
+	descriptor := d.streamDescriptor(sectors, options.FileName).String()
+	descriptorSectors := (int64(len(descriptor)) + SectorSize - 1) / SectorSize
+	header := sparseHeader{
+		MagicNumber:        sparseMagic,
+		Version:            3,
+		Flags:              flagValidNewLineTest | flagCompressed | flagMarkers,
+		Capacity:           uint64(sectors),
+		GrainSize:          streamGrainSize,
+		DescriptorOffset:   1,
+		DescriptorSize:     uint64(descriptorSectors),
+		NumGTEsPerGT:       streamGTEsPerGT,
+		GDOffset:           gdAtEnd,
+		OverHead:           uint64(1 + descriptorSectors),
+		SingleEndLineChar:  '\n',
+		NonEndLineChar:     ' ',
+		DoubleEndLineChar1: '\r',
+		DoubleEndLineChar2: '\n',
+		CompressAlgorithm:  compressionDeflate,
+	}
+	if err := out.writeStruct(header); err != nil {
+		return err
+	}
+	if err := out.writeSectors([]byte(descriptor)); err != nil {
+		return err
+	}
+
+	gt := make([]uint32, grainTables*streamGTEsPerGT)
+	err := d.writeGrains(ctx, out, grains, threads, options.Level, gt)
+	if err != nil {
+		return err
+	}
+
+	gd := make([]uint32, grainTables)
+	for i := range gd {
+		gd[i] = uint32(out.sector() + 1)
+		err := out.writeMarker(streamGTBytes/SectorSize, markerGrainTable)
+		if err == nil {
+			err = out.writeStruct(gt[int64(i)*streamGTEsPerGT : int64(i+1)*streamGTEsPerGT])
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	gdSectors := (int64(len(gd))*4 + SectorSize - 1) / SectorSize
+	header.GDOffset = uint64(out.sector() + 1)
+	if err := out.writeMarker(gdSectors, markerGrainDir); err != nil {
+		return err
+	}
+	if err := out.writeStruct(gd); err != nil {
+		return err
+	}
+
+	if err := out.writeMarker(1, markerFooter); err != nil {
+		return err
+	}
+	if err := out.writeStruct(header); err != nil {
+		return err
+	}
+
+	return out.writeMarker(0, markerEndOfStream)
+}
+
+// streamDescriptor returns the descriptor of the disk written as a single
+// streamOptimized extent.
+func (d *Disk) streamDescriptor(sectors int64, fileName string) *Descriptor {
+	descriptor := &Descriptor{
+		Version:    1,
+		Encoding:   "UTF-8",
+		CID:        d.Descriptor.CID,
+		ParentCID:  NoParent,
+		CreateType: "streamOptimized",
+		Extents:    []Extent{{Access: "RW", Sectors: sectors, Type: "SPARSE", File: fileName}},
+		DDB:        map[string]string{},
+	}
+	for key, value := range d.Descriptor.DDB {
+		descriptor.DDB[key] = value
+	}
+
+	if descriptor.DDB["adapterType"] == "" {
+		descriptor.DDB["adapterType"] = defaultAdapterType
+	}
+	if descriptor.DDB["geometry.cylinders"] == "" {
+		// The geometry BIOSes expect of a large disk: 255 heads of 63
+		// sectors, and at most 65535 cylinders.
+		cylinders := min(sectors/(255*63), 65535)
+		descriptor.DDB["geometry.cylinders"] = fmt.Sprint(cylinders)
+		descriptor.DDB["geometry.heads"] = "255"
+		descriptor.DDB["geometry.sectors"] = "63"
+	}
+
+	return descriptor
+}
+
+// grain is a grain being compressed, to be written once the grains before it
+// have been.
+type grain struct {
+	index int64
+	data  []byte
+	out   bytes.Buffer
+	err   error
+	done  chan struct{}
+}
+
+func (g *grain) compress(level int) {
+	defer close(g.done)
+
+	zw, err := zlib.NewWriterLevel(&g.out, level)
+	if err != nil {
+		g.err = err
+		return
+	}
+	_, err = zw.Write(g.data)
+	if err == nil {
+		err = zw.Close()
+	}
+	g.err = err
+}
+
+// writeGrains compresses the grains of the disk that are not all zeros on
+// up to threads goroutines and writes them in order, recording the sector of
+// each in gt.
+func (d *Disk) writeGrains(ctx context.Context, out *sectorWriter, grains int64, threads, level int, gt []uint32) error {
+	queue := make(chan *grain, threads)
+	running := make(chan struct{}, threads)
+	written := make(chan struct{})
+
+	var mutex sync.Mutex
+	var writeErr error
+	failed := func() error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return writeErr
+	}
+
+	go func() {
+		defer close(written)
+		for g := range queue {
+			<-g.done
+			if failed() != nil {
+				continue
+			}
+
+			err := g.err
+			if err == nil && out.sector() > math.MaxUint32 {
+				err = fmt.Errorf("disk is too large for a streamOptimized VMDK")
+			}
+			if err == nil {
+				gt[g.index] = uint32(out.sector())
+				err = out.writeGrain(g)
+			}
+			if err != nil {
+				mutex.Lock()
+				writeErr = err
+				mutex.Unlock()
+			}
+		}
+	}()
+
+	var err error
+	capacity := d.Capacity()
+	for index := int64(0); index < grains; index++ {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		if err = failed(); err != nil {
+			break
+		}
+
+		// The last grain is padded with zeros past the end of the disk.
+		offset := index * streamGrainBytes
+		data := make([]byte, streamGrainBytes)
+		_, err = d.ReadAt(data[:min(streamGrainBytes, capacity-offset)], offset)
+		if err != nil {
+			err = fmt.Errorf("unable to read %s: %w", d.Path, err)
+			break
+		}
+		if isZero(data) {
+			continue
+		}
+
+		g := &grain{index: index, data: data, done: make(chan struct{})}
+		running <- struct{}{}
+		go func() {
+			defer func() { <-running }()
+			g.compress(level)
+		}()
+		queue <- g
+	}
+
+	close(queue)
+	<-written
+	if err != nil {
+		return err
+	}
+	return failed()
+}
+
+func isZero(data []byte) bool {
+	for len(data) >= 8 {
+		if binary.LittleEndian.Uint64(data) != 0 {
+			return false
+		}
+		data = data[8:]
+	}
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sectorWriter writes whole sectors, keeping track of how many it has
+// written.
+type sectorWriter struct {
+	w       io.Writer
+	written int64
+}
+
+func (s *sectorWriter) sector() int64 {
+	return s.written / SectorSize
+}
+
+// writeSectors writes p padded with zeros to a whole number of sectors.
+func (s *sectorWriter) writeSectors(p []byte) error {
+	padded := (int64(len(p)) + SectorSize - 1) / SectorSize * SectorSize
+	buf := make([]byte, padded)
+	copy(buf, p)
+
+	n, err := s.w.Write(buf)
+	s.written += int64(n)
+	return err
+}
+
+func (s *sectorWriter) writeStruct(data any) error {
+	var buf bytes.Buffer
+	err := binary.Write(&buf, binary.LittleEndian, data)
+	if err != nil {
+		return err
+	}
+
+	return s.writeSectors(buf.Bytes())
+}
+
+// writeMarker writes a metadata marker, announcing sectors of the given type.
+func (s *sectorWriter) writeMarker(sectors int64, markerType uint32) error {
+	marker := make([]byte, SectorSize)
+	binary.LittleEndian.PutUint64(marker, uint64(sectors))
+	binary.LittleEndian.PutUint32(marker[12:], markerType)
+
+	return s.writeSectors(marker)
+}
+
+// writeGrain writes a grain marker, the first sector of the grain and the
+// size of its compressed data, followed by the data.
+func (s *sectorWriter) writeGrain(g *grain) error {
+	buf := make([]byte, grainMarkerSize+g.out.Len())
+	binary.LittleEndian.PutUint64(buf, uint64(g.index*streamGrainSize))
+	binary.LittleEndian.PutUint32(buf[8:], uint32(g.out.Len()))
+	copy(buf[grainMarkerSize:], g.out.Bytes())
+
+	return s.writeSectors(buf)
+}
@@ -0,0 +1,13 @@
+package vmdk_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestVmdk(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "VMDK Suite")
+}
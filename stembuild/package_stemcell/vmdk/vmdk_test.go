@@ -0,0 +1,282 @@
+package vmdk_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	govmomivmdk "github.com/vmware/govmomi/vmdk"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/package_stemcell/vmdk"
+)
+
+var _ = Describe("VMDK", func() {
+	var dir string
+	var data []byte
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		// 40 grains of 64KiB, ending part way through a grain.
+		data = testDiskData(40)[:40*64<<10-8<<10]
+	})
+
+	readAll := func(disk *vmdk.Disk) []byte {
+		contents := make([]byte, disk.Capacity())
+		_, err := disk.ReadAt(contents, 0)
+		Expect(err).NotTo(HaveOccurred())
+		return contents
+	}
+
+	Describe("ParseDescriptor", func() {
+		It("reads the header, extents and disk database", func() {
+			descriptor, err := vmdk.ParseDescriptor(strings.NewReader(`# Disk DescriptorFile
+version=1
+encoding="UTF-8"
+CID=fffffffe
+parentCID=ffffffff
+createType="twoGbMaxExtentFlat"
+
+# Extent description
+RW 4192256 FLAT "disk-f001.vmdk" 0
+RW 2048 FLAT "disk with spaces-f002.vmdk" 128
+RDONLY 1024 ZERO
+
+# The Disk Data Base
+#DDB
+
+ddb.adapterType = "lsilogic"
+ddb.virtualHWVersion = "10"
+`))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(descriptor.Version).To(Equal(1))
+			Expect(descriptor.CID).To(Equal(uint32(0xfffffffe)))
+			Expect(descriptor.ParentCID).To(Equal(uint32(vmdk.NoParent)))
+			Expect(descriptor.CreateType).To(Equal("twoGbMaxExtentFlat"))
+			Expect(descriptor.Extents).To(Equal([]vmdk.Extent{
+				{Access: "RW", Sectors: 4192256, Type: "FLAT", File: "disk-f001.vmdk"},
+				{Access: "RW", Sectors: 2048, Type: "FLAT", File: "disk with spaces-f002.vmdk", Offset: 128},
+				{Access: "RDONLY", Sectors: 1024, Type: "ZERO"},
+			}))
+			Expect(descriptor.Sectors()).To(Equal(int64(4192256 + 2048 + 1024)))
+			Expect(descriptor.DDB).To(Equal(map[string]string{"adapterType": "lsilogic", "virtualHWVersion": "10"}))
+		})
+
+		It("formats a descriptor that parses back the same", func() {
+			descriptor := &vmdk.Descriptor{
+				Version: 1, Encoding: "UTF-8", CID: 0x1234, ParentCID: vmdk.NoParent, CreateType: "monolithicFlat",
+				Extents: []vmdk.Extent{{Access: "RW", Sectors: 2048, Type: "FLAT", File: "disk-flat.vmdk", Offset: 1}},
+				DDB:     map[string]string{"geometry.heads": "16", "adapterType": "lsilogic"},
+			}
+
+			text := descriptor.String()
+			Expect(text).To(ContainSubstring("CID=00001234\n"))
+			Expect(text).To(ContainSubstring("RW 2048 FLAT \"disk-flat.vmdk\" 1\n"))
+			Expect(text).To(HaveSuffix("ddb.adapterType = \"lsilogic\"\nddb.geometry.heads = \"16\"\n"))
+
+			parsed, err := vmdk.ParseDescriptor(strings.NewReader(text))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed).To(Equal(descriptor))
+		})
+
+		It("returns an error when there are no extents", func() {
+			_, err := vmdk.ParseDescriptor(strings.NewReader("version=1\ncreateType=\"monolithicSparse\"\n"))
+			Expect(err).To(MatchError(ContainSubstring("no extents")))
+		})
+	})
+
+	Describe("Open", func() {
+		It("reads a monolithic flat disk", func() {
+			disk, err := vmdk.Open(writeFlatDisk(dir, data))
+			Expect(err).NotTo(HaveOccurred())
+			defer disk.Close() //nolint:errcheck
+
+			Expect(disk.Descriptor.CreateType).To(Equal("monolithicFlat"))
+			Expect(disk.Capacity()).To(Equal(int64(len(data))))
+			Expect(readAll(disk)).To(Equal(data))
+		})
+
+		It("reads a monolithic sparse disk, with unallocated grains as zeros", func() {
+			disk, err := vmdk.Open(writeSparseDisk(dir, data))
+			Expect(err).NotTo(HaveOccurred())
+			defer disk.Close() //nolint:errcheck
+
+			Expect(disk.Descriptor.CreateType).To(Equal("monolithicSparse"))
+			Expect(disk.Capacity()).To(Equal(int64(len(data))))
+			Expect(readAll(disk)).To(Equal(data))
+
+			part := make([]byte, 100)
+			_, err = disk.ReadAt(part, 64<<10-50)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(part).To(Equal(data[64<<10-50 : 64<<10+50]))
+		})
+
+		It("returns an error for a delta disk", func() {
+			path := writeFlatDisk(dir, data)
+			descriptor, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			descriptor = bytes.Replace(descriptor, []byte("parentCID=ffffffff"), []byte("parentCID=12345678"), 1)
+			Expect(os.WriteFile(path, descriptor, 0644)).To(Succeed())
+
+			_, err = vmdk.Open(path)
+			Expect(err).To(MatchError(ContainSubstring("delta disks of a parent disk are not supported")))
+		})
+
+		It("returns an error when an extent is smaller than the descriptor says", func() {
+			path := writeFlatDisk(dir, data)
+			Expect(os.Truncate(filepath.Join(dir, "disk-flat.vmdk"), 512)).To(Succeed())
+
+			_, err := vmdk.Open(path)
+			Expect(err).To(MatchError(ContainSubstring(`extent "disk-flat.vmdk"`)))
+		})
+
+		It("returns an error for a file that is not a VMDK", func() {
+			path := filepath.Join(dir, "disk.vmdk")
+			Expect(os.WriteFile(path, []byte("not a disk"), 0644)).To(Succeed())
+
+			_, err := vmdk.Open(path)
+			Expect(err).To(MatchError(ContainSubstring("not a VMDK")))
+		})
+	})
+
+	Describe("Stat", func() {
+		It("describes a monolithic sparse disk", func() {
+			path := writeSparseDisk(dir, data)
+			fi, err := os.Stat(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			info, err := vmdk.Stat(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info).To(Equal(vmdk.Info{
+				CreateType:  "monolithicSparse",
+				Capacity:    int64(len(data)),
+				Size:        fi.Size(),
+				GrainSize:   8 << 10,
+				AdapterType: "lsilogic",
+			}))
+		})
+
+		It("describes a flat disk, which has no grains", func() {
+			info, err := vmdk.Stat(writeFlatDisk(dir, data))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(info.CreateType).To(Equal("monolithicFlat"))
+			Expect(info.Capacity).To(Equal(int64(len(data))))
+			Expect(info.Size).To(BeNumerically(">", len(data)))
+			Expect(info.GrainSize).To(BeZero())
+		})
+
+		It("returns an error for an unsupported createType", func() {
+			path := writeFlatDisk(dir, data)
+			descriptor, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			descriptor = bytes.Replace(descriptor, []byte(`"monolithicFlat"`), []byte(`"fullDevice"`), 1)
+			Expect(os.WriteFile(path, descriptor, 0644)).To(Succeed())
+
+			_, err = vmdk.Stat(path)
+			Expect(err).To(MatchError(ContainSubstring(`unsupported createType "fullDevice"`)))
+		})
+
+		It("returns an error for a truncated sparse disk", func() {
+			path := writeSparseDisk(dir, data)
+			fi, err := os.Stat(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.Truncate(path, fi.Size()-64<<10)).To(Succeed())
+
+			_, err = vmdk.Stat(path)
+			Expect(err).To(MatchError(MatchRegexp(`extent "disk.vmdk": grain \d+ is past the end of the file, which may be truncated`)))
+		})
+
+		It("returns an error for a truncated streamOptimized disk", func() {
+			disk, err := vmdk.Open(writeSparseDisk(dir, data))
+			Expect(err).NotTo(HaveOccurred())
+			defer disk.Close() //nolint:errcheck
+			var stream bytes.Buffer
+			Expect(disk.WriteStreamOptimized(context.Background(), &stream, vmdk.StreamOptions{Level: 6})).To(Succeed())
+
+			path := filepath.Join(dir, "stream.vmdk")
+			Expect(os.WriteFile(path, stream.Bytes()[:stream.Len()/2], 0644)).To(Succeed())
+
+			_, err = vmdk.Stat(path)
+			Expect(err).To(MatchError(ContainSubstring("streamOptimized extent has no footer, so may be truncated")))
+		})
+	})
+
+	Describe("WriteStreamOptimized", func() {
+		var disk *vmdk.Disk
+
+		BeforeEach(func() {
+			var err error
+			disk, err = vmdk.Open(writeSparseDisk(dir, data))
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(disk.Close)
+		})
+
+		writeStream := func(options vmdk.StreamOptions) string {
+			path := filepath.Join(GinkgoT().TempDir(), "stream.vmdk")
+			file, err := os.Create(path)
+			Expect(err).NotTo(HaveOccurred())
+			defer file.Close() //nolint:errcheck
+
+			Expect(disk.WriteStreamOptimized(context.Background(), file, options)).To(Succeed())
+			return path
+		}
+
+		It("writes a streamOptimized disk with the same contents", func() {
+			path := writeStream(vmdk.StreamOptions{FileName: "image-disk1.vmdk", Level: 6})
+
+			stream, err := vmdk.Open(path)
+			Expect(err).NotTo(HaveOccurred())
+			defer stream.Close() //nolint:errcheck
+
+			Expect(stream.Descriptor.CreateType).To(Equal("streamOptimized"))
+			Expect(stream.Descriptor.Extents).To(Equal([]vmdk.Extent{{Access: "RW", Sectors: int64(len(data) / 512), Type: "SPARSE", File: "image-disk1.vmdk"}}))
+			Expect(stream.Descriptor.CID).To(Equal(uint32(0x1a2b3c4d)))
+			Expect(stream.Descriptor.DDB).To(HaveKeyWithValue("adapterType", "lsilogic"))
+			Expect(stream.Descriptor.DDB).To(HaveKeyWithValue("geometry.cylinders", "16"))
+			Expect(readAll(stream)).To(Equal(data))
+		})
+
+		It("writes a disk that govmomi accepts as streamOptimized", func() {
+			info, err := govmomivmdk.Stat(writeStream(vmdk.StreamOptions{Level: 6}))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Capacity).To(Equal(uint64(len(data))))
+		})
+
+		It("leaves out grains of zeros", func() {
+			fi, err := os.Stat(writeStream(vmdk.StreamOptions{Level: 0}))
+			Expect(err).NotTo(HaveOccurred())
+
+			// 14 of the 40 grains hold data, stored without compression.
+			Expect(fi.Size()).To(BeNumerically("<", 15*64<<10))
+		})
+
+		It("writes the same disk whatever the number of threads", func() {
+			oneThread, err := os.ReadFile(writeStream(vmdk.StreamOptions{Level: 6, Threads: 1}))
+			Expect(err).NotTo(HaveOccurred())
+			manyThreads, err := os.ReadFile(writeStream(vmdk.StreamOptions{Level: 6, Threads: 8}))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(manyThreads).To(Equal(oneThread))
+		})
+
+		It("stops when the context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			err := disk.WriteStreamOptimized(ctx, io.Discard, vmdk.StreamOptions{Level: 6})
+			Expect(err).To(MatchError(context.Canceled))
+		})
+
+		It("returns an error for an invalid compression level", func() {
+			err := disk.WriteStreamOptimized(context.Background(), io.Discard, vmdk.StreamOptions{Level: 10})
+			Expect(err).To(MatchError("invalid compression level 10"))
+		})
+	})
+})
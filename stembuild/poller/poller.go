@@ -1,20 +1,135 @@
 package poller
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
 	"time"
 )
 
+// Options controls how often Poll calls its function and for how long.
+type Options struct {
+	// Interval is the wait before the first call.
+	Interval time.Duration
+	// MaxInterval caps the wait between calls. The wait grows by Multiplier
+	// after every call until it reaches MaxInterval; when MaxInterval is not
+	// above Interval, every wait is Interval.
+	MaxInterval time.Duration
+	// Multiplier defaults to 2.
+	Multiplier float64
+	// Jitter randomizes each wait by up to this fraction of it, e.g. 0.2
+	// for +/-20%.
+	Jitter float64
+	// Timeout bounds the whole poll. Zero means Poll only stops when the
+	// function returns true or an error, or the context is done.
+	Timeout time.Duration
+}
+
+// TimeoutError is returned by Poll when its deadline passes before the
+// function returned true.
+type TimeoutError struct {
+	Timeout  time.Duration
+	Attempts int
+	LastErr  error
+}
+
+func (e *TimeoutError) Error() string {
+	message := fmt.Sprintf("timed out after %s and %d attempts", e.Timeout, e.Attempts)
+	if e.LastErr != nil {
+		message = fmt.Sprintf("%s, last error: %s", message, e.LastErr)
+	}
+	return message
+}
+
+func (e *TimeoutError) Unwrap() []error {
+	if e.LastErr == nil {
+		return []error{context.DeadlineExceeded}
+	}
+	return []error{context.DeadlineExceeded, e.LastErr}
+}
+
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+
+func (e *retryableError) Unwrap() error { return e.err }
+
+// Retryable marks an error returned by the polled function as transient: Poll
+// keeps polling and reports the error in its TimeoutError if it never
+// succeeds. Any other error stops Poll straight away.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &retryableError{err}
+}
+
 type Poller struct{}
 
-func (p *Poller) Poll(duration time.Duration, loopFunc func() (bool, error)) error {
-	poll := true
-	for poll {
-		time.Sleep(duration)
-		out, err := loopFunc()
-		if err != nil {
+// Poll waits, then calls loopFunc, until loopFunc returns true or a
+// non-retryable error, the timeout passes or ctx is done.
+func (p *Poller) Poll(ctx context.Context, options Options, loopFunc func() (bool, error)) error {
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+
+	interval := options.Interval
+	attempts := 0
+	var lastErr error
+	for {
+		timer := time.NewTimer(jitter(interval, options.Jitter))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return &TimeoutError{Timeout: options.Timeout, Attempts: attempts, LastErr: lastErr}
+			}
+			return fmt.Errorf("polling stopped after %d attempts: %w", attempts, ctx.Err())
+		case <-timer.C:
+		}
+
+		attempts++
+		done, err := loopFunc()
+		var retryable *retryableError
+		if errors.As(err, &retryable) {
+			lastErr = retryable.err
+		} else if err != nil {
 			return err
+		} else if done {
+			return nil
 		}
-		poll = !out
+
+		interval = nextInterval(interval, options)
+	}
+}
+
+func nextInterval(interval time.Duration, options Options) time.Duration {
+	if options.MaxInterval <= options.Interval {
+		return options.Interval
 	}
-	return nil
+
+	multiplier := options.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+
+	next := time.Duration(float64(interval) * multiplier)
+	if next > options.MaxInterval || next <= 0 {
+		return options.MaxInterval
+	}
+	return next
+}
+
+func jitter(interval time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 || interval <= 0 {
+		return interval
+	}
+
+	delta := (rand.Float64()*2 - 1) * fraction * float64(interval)
+	return interval + time.Duration(delta)
 }
@@ -1,12 +1,12 @@
 package poller
 
 import (
-	"time"
+	"context"
 )
 
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 -generate
 
 //counterfeiter:generate . PollerI
 type PollerI interface {
-	Poll(duration time.Duration, loopFunc func() (bool, error)) error
+	Poll(ctx context.Context, options Options, loopFunc func() (bool, error)) error
 }
@@ -1,6 +1,7 @@
 package poller_test
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -13,11 +14,11 @@ import (
 var _ = Describe("Poller", func() {
 	Describe("Poll", func() {
 		It("calls the polling function once per duration until the function returns true", func() {
-			poller := poller.Poller{}
+			p := poller.Poller{}
 			callCount := 0
 			startTime := time.Now()
 			period := 500 * time.Millisecond
-			Expect(poller.Poll(period, func() (bool, error) {
+			Expect(p.Poll(context.Background(), poller.Options{Interval: period}, func() (bool, error) {
 				callCount++
 				Expect(startTime.Add(time.Duration(callCount) * period)).To(BeTemporally("~", time.Now(), 200*time.Millisecond))
 				return callCount == 3, nil
@@ -26,10 +27,99 @@ var _ = Describe("Poller", func() {
 			Expect(callCount).To(Equal(3))
 		})
 		It("returns an error when polling fails", func() {
-			poller := poller.Poller{}
-			Expect(poller.Poll(0*time.Second, func() (bool, error) {
+			p := poller.Poller{}
+			Expect(p.Poll(context.Background(), poller.Options{}, func() (bool, error) {
 				return true, errors.New("polling is hard :(")
 			})).To(MatchError("polling is hard :("))
 		})
+
+		It("backs off exponentially up to the max interval", func() {
+			p := poller.Poller{}
+			var calls []time.Time
+			start := time.Now()
+			Expect(p.Poll(context.Background(), poller.Options{
+				Interval:    100 * time.Millisecond,
+				MaxInterval: 400 * time.Millisecond,
+			}, func() (bool, error) {
+				calls = append(calls, time.Now())
+				return len(calls) == 4, nil
+			})).To(Succeed())
+
+			Expect(calls[0]).To(BeTemporally("~", start.Add(100*time.Millisecond), 80*time.Millisecond))
+			Expect(calls[1]).To(BeTemporally("~", calls[0].Add(200*time.Millisecond), 80*time.Millisecond))
+			Expect(calls[2]).To(BeTemporally("~", calls[1].Add(400*time.Millisecond), 80*time.Millisecond))
+			Expect(calls[3]).To(BeTemporally("~", calls[2].Add(400*time.Millisecond), 80*time.Millisecond))
+		})
+
+		It("keeps each wait within the jitter of the interval", func() {
+			p := poller.Poller{}
+			var calls []time.Time
+			start := time.Now()
+			Expect(p.Poll(context.Background(), poller.Options{
+				Interval: 200 * time.Millisecond,
+				Jitter:   0.25,
+			}, func() (bool, error) {
+				calls = append(calls, time.Now())
+				return len(calls) == 3, nil
+			})).To(Succeed())
+
+			previous := start
+			for _, call := range calls {
+				Expect(call.Sub(previous)).To(BeNumerically(">=", 150*time.Millisecond))
+				Expect(call.Sub(previous)).To(BeNumerically("<", 330*time.Millisecond))
+				previous = call
+			}
+		})
+
+		It("keeps polling after a retryable error", func() {
+			p := poller.Poller{}
+			callCount := 0
+			Expect(p.Poll(context.Background(), poller.Options{Interval: time.Millisecond}, func() (bool, error) {
+				callCount++
+				if callCount < 3 {
+					return false, poller.Retryable(errors.New("not yet"))
+				}
+				return true, nil
+			})).To(Succeed())
+
+			Expect(callCount).To(Equal(3))
+		})
+
+		It("returns a timeout error with the attempts and the last error when the timeout passes", func() {
+			p := poller.Poller{}
+			lastErr := errors.New("connection refused")
+			err := p.Poll(context.Background(), poller.Options{
+				Interval: 20 * time.Millisecond,
+				Timeout:  110 * time.Millisecond,
+			}, func() (bool, error) {
+				return false, poller.Retryable(lastErr)
+			})
+
+			var timeoutErr *poller.TimeoutError
+			Expect(errors.As(err, &timeoutErr)).To(BeTrue())
+			Expect(timeoutErr.Timeout).To(Equal(110 * time.Millisecond))
+			Expect(timeoutErr.Attempts).To(BeNumerically(">=", 3))
+			Expect(timeoutErr.LastErr).To(Equal(lastErr))
+			Expect(err).To(MatchError(MatchRegexp(`^timed out after 110ms and \d+ attempts, last error: connection refused$`)))
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+			Expect(errors.Is(err, lastErr)).To(BeTrue())
+		})
+
+		It("stops when the context is cancelled", func() {
+			p := poller.Poller{}
+			ctx, cancel := context.WithCancel(context.Background())
+			callCount := 0
+			err := p.Poll(ctx, poller.Options{Interval: 10 * time.Millisecond}, func() (bool, error) {
+				callCount++
+				if callCount == 2 {
+					cancel()
+				}
+				return false, nil
+			})
+
+			Expect(err).To(MatchError(context.Canceled))
+			Expect(err).To(MatchError("polling stopped after 2 attempts: context canceled"))
+			Expect(callCount).To(Equal(2))
+		})
 	})
 })
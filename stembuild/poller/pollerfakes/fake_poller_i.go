@@ -2,18 +2,19 @@
 package pollerfakes
 
 import (
+	"context"
 	"sync"
-	"time"
 
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/poller"
 )
 
 type FakePollerI struct {
-	PollStub        func(time.Duration, func() (bool, error)) error
+	PollStub        func(context.Context, poller.Options, func() (bool, error)) error
 	pollMutex       sync.RWMutex
 	pollArgsForCall []struct {
-		arg1 time.Duration
-		arg2 func() (bool, error)
+		arg1 context.Context
+		arg2 poller.Options
+		arg3 func() (bool, error)
 	}
 	pollReturns struct {
 		result1 error
@@ -25,19 +26,20 @@ type FakePollerI struct {
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakePollerI) Poll(arg1 time.Duration, arg2 func() (bool, error)) error {
+func (fake *FakePollerI) Poll(arg1 context.Context, arg2 poller.Options, arg3 func() (bool, error)) error {
 	fake.pollMutex.Lock()
 	ret, specificReturn := fake.pollReturnsOnCall[len(fake.pollArgsForCall)]
 	fake.pollArgsForCall = append(fake.pollArgsForCall, struct {
-		arg1 time.Duration
-		arg2 func() (bool, error)
-	}{arg1, arg2})
+		arg1 context.Context
+		arg2 poller.Options
+		arg3 func() (bool, error)
+	}{arg1, arg2, arg3})
 	stub := fake.PollStub
 	fakeReturns := fake.pollReturns
-	fake.recordInvocation("Poll", []interface{}{arg1, arg2})
+	fake.recordInvocation("Poll", []interface{}{arg1, arg2, arg3})
 	fake.pollMutex.Unlock()
 	if stub != nil {
-		return stub(arg1, arg2)
+		return stub(arg1, arg2, arg3)
 	}
 	if specificReturn {
 		return ret.result1
@@ -51,17 +53,17 @@ func (fake *FakePollerI) PollCallCount() int {
 	return len(fake.pollArgsForCall)
 }
 
-func (fake *FakePollerI) PollCalls(stub func(time.Duration, func() (bool, error)) error) {
+func (fake *FakePollerI) PollCalls(stub func(context.Context, poller.Options, func() (bool, error)) error) {
 	fake.pollMutex.Lock()
 	defer fake.pollMutex.Unlock()
 	fake.PollStub = stub
 }
 
-func (fake *FakePollerI) PollArgsForCall(i int) (time.Duration, func() (bool, error)) {
+func (fake *FakePollerI) PollArgsForCall(i int) (context.Context, poller.Options, func() (bool, error)) {
 	fake.pollMutex.RLock()
 	defer fake.pollMutex.RUnlock()
 	argsForCall := fake.pollArgsForCall[i]
-	return argsForCall.arg1, argsForCall.arg2
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
 }
 
 func (fake *FakePollerI) PollReturns(result1 error) {
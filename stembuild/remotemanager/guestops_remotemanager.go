@@ -0,0 +1,173 @@
+package remotemanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
+)
+
+const (
+	guestOpsShell   = `C:\Windows\System32\cmd.exe`
+	guestOpsTempDir = `C:\Windows\Temp\`
+)
+
+//counterfeiter:generate . GuestManager
+type GuestManager interface {
+	StartProgramInGuest(ctx context.Context, command, args string) (int64, error)
+	ExitCodeForProgramInGuest(ctx context.Context, pid int64) (int32, error)
+	DownloadFileInGuest(ctx context.Context, path string) (io.Reader, int64, error)
+	UploadFileInGuest(ctx context.Context, path string, r io.Reader, size int64) error
+	DeleteFileInGuest(ctx context.Context, path string) error
+}
+
+// GuestOps is a RemoteManager that runs commands and copies files with the
+// guest operations of VMware Tools, through vCenter, so that the VM does not
+// have to be reachable over the network. The output of a command is
+// redirected to temporary files on the VM, and printed once it exits.
+type GuestOps struct {
+	ctx          context.Context
+	guestManager GuestManager
+}
+
+// NewGuestOps returns a RemoteManager whose commands are stopped when ctx is
+// done.
+func NewGuestOps(ctx context.Context, guestManager GuestManager) RemoteManager {
+	return &GuestOps{ctx, guestManager}
+}
+
+// CanReachVM succeeds straight away, as guest operations go through vCenter
+// rather than to the VM itself.
+func (g *GuestOps) CanReachVM() error {
+	return nil
+}
+
+func (g *GuestOps) CanLoginVM() error {
+	_, err := g.ExecuteCommandWithTimeout("exit 0", WinRmTimeout, CommandOutput{})
+	if err != nil {
+		return fmt.Errorf("failed to run a command with guest operations: %w", err)
+	}
+
+	return nil
+}
+
+func (g *GuestOps) UploadArtifact(sourceFilePath, destinationFilePath string) error {
+	file, err := os.Open(sourceFilePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close() //nolint:errcheck
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	return g.guestManager.UploadFileInGuest(g.ctx, destinationFilePath, file, info.Size())
+}
+
+func (g *GuestOps) DownloadFile(source string, w io.Writer) error {
+	r, _, err := g.guestManager.DownloadFileInGuest(g.ctx, source)
+	if err != nil {
+		return err
+	}
+	if closer, ok := r.(io.Closer); ok {
+		defer closer.Close() //nolint:errcheck
+	}
+
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func (g *GuestOps) ExtractArchive(source, destination string, output CommandOutput) error {
+	_, err := g.ExecuteCommand(extractArchiveCommand(source, destination), output)
+	return err
+}
+
+// ExecuteCommandWithTimeout gives up on the command if it has not exited
+// after timeout. Unlike over WinRM, where only each request is bounded, this
+// bounds the whole command, as nothing else would notice a VM that stops
+// responding while its tools still list the command as running.
+func (g *GuestOps) ExecuteCommandWithTimeout(command string, timeout time.Duration, output CommandOutput) (int, error) {
+	ctx, cancel := context.WithTimeout(g.ctx, timeout)
+	defer cancel()
+
+	return g.execute(ctx, ctx, command, output)
+}
+
+// ExecuteCommand gives up on starting the command after WinRmTimeout, but
+// waits for it to exit until the context of g is done, as scripts such as
+// Setup.ps1 run for much longer.
+func (g *GuestOps) ExecuteCommand(command string, output CommandOutput) (int, error) {
+	startCtx, cancel := context.WithTimeout(g.ctx, WinRmTimeout)
+	defer cancel()
+
+	exitCode, err := g.execute(startCtx, g.ctx, command, output)
+	if err != nil {
+		return exitCode, colorlogger.Errorf("error executing '%s': %w", command, err)
+	}
+
+	return exitCode, nil
+}
+
+// execute runs command, giving up on starting it when startCtx is done and on
+// waiting for it to exit when exitCtx is done. Its output is copied even if
+// it exits nonzero, and the files holding it are deleted however it ends.
+func (g *GuestOps) execute(startCtx, exitCtx context.Context, command string, output CommandOutput) (int, error) {
+	outputPath := guestOpsTempDir + "stembuild-" + uuid.NewString()
+	stdoutPath, stderrPath := outputPath+".stdout", outputPath+".stderr"
+	// With /s, cmd removes only the outer quotes, keeping those of command
+	// and the paths.
+	args := fmt.Sprintf(`/s /c "%s 1> "%s" 2> "%s""`, command, stdoutPath, stderrPath)
+
+	pid, err := g.guestManager.StartProgramInGuest(startCtx, guestOpsShell, args)
+	if err != nil {
+		return -1, err
+	}
+	defer func() {
+		g.deleteFile(stdoutPath)
+		g.deleteFile(stderrPath)
+	}()
+
+	exitCode, err := g.guestManager.ExitCodeForProgramInGuest(exitCtx, pid)
+	if err != nil {
+		return -1, err
+	}
+
+	stderrTail := newTailWriter(StderrTailLines)
+	stdoutErr := g.copyOutput(stdoutPath, output.stdout())
+	stderrErr := g.copyOutput(stderrPath, io.MultiWriter(stderrTail, output.stderr()))
+
+	var commandErr error
+	if exitCode != 0 {
+		commandErr = colorlogger.Errorf("%s: %s", PowershellExecutionErrorMessage, stderrTail.String())
+	}
+	return int(exitCode), errors.Join(commandErr, stdoutErr, stderrErr)
+}
+
+// copyOutput copies the file with the output of a command from the guest to
+// w.
+func (g *GuestOps) copyOutput(path string, w io.Writer) error {
+	err := g.DownloadFile(path, w)
+	if err != nil {
+		return fmt.Errorf("unable to read output of command: %w", err)
+	}
+
+	return nil
+}
+
+// deleteFile deletes a file the output of a command went to, if it can. It
+// does so even once the context of g is done, so that an interrupted
+// construct does not leave it behind.
+func (g *GuestOps) deleteFile(path string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(g.ctx), WinRmTimeout)
+	defer cancel()
+
+	g.guestManager.DeleteFileInGuest(ctx, path) //nolint:errcheck
+}
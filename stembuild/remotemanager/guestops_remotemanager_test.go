@@ -0,0 +1,290 @@
+package remotemanager_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/remotemanager"
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/remotemanager/remotemanagerfakes"
+)
+
+var _ = Describe("GuestOps RemoteManager", func() {
+	var (
+		guestManager  *remotemanagerfakes.FakeGuestManager
+		remoteManager remotemanager.RemoteManager
+		outputs       map[string]string
+		stdout        *bytes.Buffer
+		stderr        *bytes.Buffer
+		output        remotemanager.CommandOutput
+	)
+
+	BeforeEach(func() {
+		guestManager = &remotemanagerfakes.FakeGuestManager{}
+		guestManager.StartProgramInGuestReturns(42, nil)
+		outputs = map[string]string{".stdout": "some output", ".stderr": ""}
+		guestManager.DownloadFileInGuestCalls(func(_ context.Context, path string) (io.Reader, int64, error) {
+			output := outputs[filepath.Ext(path)]
+			return strings.NewReader(output), int64(len(output)), nil
+		})
+		remoteManager = remotemanager.NewGuestOps(context.Background(), guestManager)
+		stdout, stderr = new(bytes.Buffer), new(bytes.Buffer)
+		output = remotemanager.CommandOutput{Stdout: stdout, Stderr: stderr}
+	})
+
+	Describe("ExecuteCommand", func() {
+		It("runs the command with its output redirected to temporary files", func() {
+			exitCode, err := remoteManager.ExecuteCommand("powershell.exe C:\\provision\\Setup.ps1", output)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exitCode).To(Equal(0))
+
+			_, program, args := guestManager.StartProgramInGuestArgsForCall(0)
+			Expect(program).To(Equal(`C:\Windows\System32\cmd.exe`))
+			Expect(args).To(MatchRegexp(`^/s /c "powershell\.exe C:\\provision\\Setup\.ps1 1> "(C:\\Windows\\Temp\\stembuild-[0-9a-f-]+)\.stdout" 2> "C:\\Windows\\Temp\\stembuild-[0-9a-f-]+\.stderr""$`))
+
+			_, pid := guestManager.ExitCodeForProgramInGuestArgsForCall(0)
+			Expect(pid).To(Equal(int64(42)))
+		})
+
+		It("downloads and deletes the output files once the command exits", func() {
+			_, err := remoteManager.ExecuteCommand("whoami", output)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(guestManager.DownloadFileInGuestCallCount()).To(Equal(2))
+			Expect(guestManager.DeleteFileInGuestCallCount()).To(Equal(2))
+			_, stdoutPath := guestManager.DownloadFileInGuestArgsForCall(0)
+			_, deletedPath := guestManager.DeleteFileInGuestArgsForCall(0)
+			Expect(stdoutPath).To(HaveSuffix(".stdout"))
+			Expect(deletedPath).To(Equal(stdoutPath))
+			_, stderrPath := guestManager.DownloadFileInGuestArgsForCall(1)
+			Expect(stderrPath).To(Equal(strings.TrimSuffix(stdoutPath, ".stdout") + ".stderr"))
+		})
+
+		It("writes the output of the command to the output", func() {
+			outputs[".stderr"] = "a warning"
+
+			_, err := remoteManager.ExecuteCommand("whoami", output)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(stdout.String()).To(Equal("some output"))
+			Expect(stderr.String()).To(Equal("a warning"))
+		})
+
+		It("returns only the last lines of the error output when the command fails", func() {
+			guestManager.ExitCodeForProgramInGuestReturns(1, nil)
+			var lines []string
+			for i := 1; i <= 30; i++ {
+				lines = append(lines, fmt.Sprintf("error line %d", i))
+			}
+			outputs[".stderr"] = strings.Join(lines, "\r\n")
+
+			_, err := remoteManager.ExecuteCommand("whoami", output)
+			Expect(err).To(MatchError(HaveSuffix(": ...\n" + strings.Join(lines[10:], "\r\n"))))
+			Expect(stderr.String()).To(Equal(outputs[".stderr"]))
+		})
+
+		It("returns the exit code and the error output when the command fails", func() {
+			guestManager.ExitCodeForProgramInGuestReturns(3, nil)
+			outputs[".stderr"] = "Setup.ps1 failed"
+
+			exitCode, err := remoteManager.ExecuteCommand("powershell.exe C:\\provision\\Setup.ps1", output)
+			Expect(exitCode).To(Equal(3))
+			Expect(err).To(MatchError(ContainSubstring(remotemanager.PowershellExecutionErrorMessage + ": Setup.ps1 failed")))
+			Expect(err).To(MatchError(HavePrefix("error executing 'powershell.exe C:\\provision\\Setup.ps1'")))
+		})
+
+		It("returns an error when the command cannot be started", func() {
+			guestManager.StartProgramInGuestReturns(-1, errors.New("tools not running"))
+
+			exitCode, err := remoteManager.ExecuteCommand("whoami", output)
+			Expect(exitCode).To(Equal(-1))
+			Expect(err).To(MatchError(ContainSubstring("tools not running")))
+			Expect(guestManager.ExitCodeForProgramInGuestCallCount()).To(Equal(0))
+		})
+
+		It("returns an error when the exit of the command cannot be observed", func() {
+			guestManager.ExitCodeForProgramInGuestReturns(-1, errors.New("could not observe program exiting"))
+
+			_, err := remoteManager.ExecuteCommand("whoami", output)
+			Expect(err).To(MatchError(ContainSubstring("could not observe program exiting")))
+			Expect(guestManager.DownloadFileInGuestCallCount()).To(Equal(0))
+			Expect(guestManager.DeleteFileInGuestCallCount()).To(Equal(2))
+		})
+
+		It("returns an error when the output cannot be downloaded", func() {
+			guestManager.DownloadFileInGuestReturns(nil, 0, errors.New("file not found"))
+			guestManager.DownloadFileInGuestCalls(nil)
+
+			_, err := remoteManager.ExecuteCommand("whoami", output)
+			Expect(err).To(MatchError(ContainSubstring("unable to read output of command: file not found")))
+			Expect(guestManager.DeleteFileInGuestCallCount()).To(Equal(2))
+		})
+
+		It("copies the error output and returns the exit code when the output cannot be downloaded", func() {
+			guestManager.ExitCodeForProgramInGuestReturns(3, nil)
+			outputs[".stderr"] = "Setup.ps1 failed"
+			guestManager.DownloadFileInGuestCalls(func(_ context.Context, path string) (io.Reader, int64, error) {
+				if strings.HasSuffix(path, ".stdout") {
+					return nil, 0, errors.New("file not found")
+				}
+				return strings.NewReader(outputs[".stderr"]), int64(len(outputs[".stderr"])), nil
+			})
+
+			exitCode, err := remoteManager.ExecuteCommand("powershell.exe C:\\provision\\Setup.ps1", output)
+			Expect(exitCode).To(Equal(3))
+			Expect(err).To(MatchError(ContainSubstring(remotemanager.PowershellExecutionErrorMessage + ": Setup.ps1 failed")))
+			Expect(err).To(MatchError(ContainSubstring("unable to read output of command: file not found")))
+			Expect(stderr.String()).To(Equal("Setup.ps1 failed"))
+		})
+
+		It("keeps the error output and the exit code when the output files cannot be deleted", func() {
+			guestManager.ExitCodeForProgramInGuestReturns(3, nil)
+			guestManager.DeleteFileInGuestReturns(errors.New("file in use"))
+			outputs[".stderr"] = "Setup.ps1 failed"
+
+			exitCode, err := remoteManager.ExecuteCommand("powershell.exe C:\\provision\\Setup.ps1", output)
+			Expect(exitCode).To(Equal(3))
+			Expect(err).To(MatchError(ContainSubstring(remotemanager.PowershellExecutionErrorMessage + ": Setup.ps1 failed")))
+			Expect(err).NotTo(MatchError(ContainSubstring("file in use")))
+			Expect(stderr.String()).To(Equal("Setup.ps1 failed"))
+			Expect(guestManager.DeleteFileInGuestCallCount()).To(Equal(2))
+		})
+
+		It("gives up on starting the command after the timeout", func() {
+			guestManager.StartProgramInGuestCalls(func(ctx context.Context, _, _ string) (int64, error) {
+				<-ctx.Done()
+				return -1, ctx.Err()
+			})
+
+			_, err := remoteManager.ExecuteCommandWithTimeout("whoami", time.Millisecond, output)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+
+		It("gives up waiting for the command to exit after the timeout", func() {
+			guestManager.ExitCodeForProgramInGuestCalls(func(ctx context.Context, _ int64) (int32, error) {
+				<-ctx.Done()
+				return -1, ctx.Err()
+			})
+
+			_, err := remoteManager.ExecuteCommandWithTimeout("shutdown /a", time.Millisecond, output)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+			Expect(guestManager.DeleteFileInGuestCallCount()).To(Equal(2))
+		})
+
+		It("waits for a command that runs for longer than the timeout of starting it", func() {
+			_, err := remoteManager.ExecuteCommand("powershell.exe C:\\provision\\Setup.ps1", output)
+			Expect(err).NotTo(HaveOccurred())
+
+			startCtx, _, _ := guestManager.StartProgramInGuestArgsForCall(0)
+			_, hasDeadline := startCtx.Deadline()
+			Expect(hasDeadline).To(BeTrue())
+			exitCtx, _ := guestManager.ExitCodeForProgramInGuestArgsForCall(0)
+			_, hasDeadline = exitCtx.Deadline()
+			Expect(hasDeadline).To(BeFalse())
+		})
+
+		It("stops waiting for the command when the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			remoteManager = remotemanager.NewGuestOps(ctx, guestManager)
+			guestManager.ExitCodeForProgramInGuestCalls(func(ctx context.Context, _ int64) (int32, error) {
+				cancel()
+				<-ctx.Done()
+				return -1, ctx.Err()
+			})
+			var deleteErrs []error
+			guestManager.DeleteFileInGuestCalls(func(ctx context.Context, _ string) error {
+				deleteErrs = append(deleteErrs, ctx.Err())
+				return nil
+			})
+
+			_, err := remoteManager.ExecuteCommand("whoami", output)
+			Expect(err).To(MatchError(context.Canceled))
+			Expect(deleteErrs).To(Equal([]error{nil, nil}))
+		})
+	})
+
+	Describe("UploadArtifact", func() {
+		It("uploads the file to the destination", func() {
+			source := filepath.Join(GinkgoT().TempDir(), "LGPO.zip")
+			Expect(os.WriteFile(source, []byte("some zip"), 0644)).To(Succeed())
+			guestManager.UploadFileInGuestCalls(func(_ context.Context, _ string, r io.Reader, _ int64) error {
+				content, err := io.ReadAll(r)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(content)).To(Equal("some zip"))
+				return nil
+			})
+
+			Expect(remoteManager.UploadArtifact(source, "C:\\provision\\LGPO.zip")).To(Succeed())
+
+			_, destination, _, size := guestManager.UploadFileInGuestArgsForCall(0)
+			Expect(destination).To(Equal("C:\\provision\\LGPO.zip"))
+			Expect(size).To(Equal(int64(8)))
+		})
+
+		It("returns an error when the file cannot be opened", func() {
+			err := remoteManager.UploadArtifact("/does/not/exist.zip", "C:\\provision\\LGPO.zip")
+			Expect(err).To(MatchError(os.ErrNotExist))
+			Expect(guestManager.UploadFileInGuestCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("ExtractArchive", func() {
+		It("expands the archive with powershell", func() {
+			Expect(remoteManager.ExtractArchive("C:\\provision\\StemcellAutomation.zip", "C:\\provision\\", output)).To(Succeed())
+
+			_, _, args := guestManager.StartProgramInGuestArgsForCall(0)
+			Expect(args).To(HavePrefix(`/s /c "powershell.exe Expand-Archive C:\provision\StemcellAutomation.zip C:\provision\ -Force 1> `))
+		})
+	})
+
+	Describe("DownloadFile", func() {
+		It("copies the file from the VM", func() {
+			guestManager.DownloadFileInGuestCalls(nil)
+			guestManager.DownloadFileInGuestReturns(strings.NewReader("setup log"), 9, nil)
+			var file bytes.Buffer
+
+			Expect(remoteManager.DownloadFile("C:\\provision\\log.log", &file)).To(Succeed())
+
+			_, path := guestManager.DownloadFileInGuestArgsForCall(0)
+			Expect(path).To(Equal("C:\\provision\\log.log"))
+			Expect(file.String()).To(Equal("setup log"))
+			Expect(guestManager.DeleteFileInGuestCallCount()).To(Equal(0))
+		})
+
+		It("returns an error when the file cannot be downloaded", func() {
+			guestManager.DownloadFileInGuestCalls(nil)
+			guestManager.DownloadFileInGuestReturns(nil, 0, errors.New("file not found"))
+
+			Expect(remoteManager.DownloadFile("C:\\provision\\log.log", io.Discard)).To(MatchError("file not found"))
+		})
+	})
+
+	Describe("CanReachVM", func() {
+		It("does not need to connect to the VM", func() {
+			Expect(remoteManager.CanReachVM()).To(Succeed())
+			Expect(guestManager.Invocations()).To(BeEmpty())
+		})
+	})
+
+	Describe("CanLoginVM", func() {
+		It("runs a command on the VM", func() {
+			Expect(remoteManager.CanLoginVM()).To(Succeed())
+			Expect(guestManager.StartProgramInGuestCallCount()).To(Equal(1))
+		})
+
+		It("returns an error when the command cannot be run", func() {
+			guestManager.StartProgramInGuestReturns(-1, errors.New("invalid guest login"))
+
+			Expect(remoteManager.CanLoginVM()).To(MatchError(ContainSubstring("failed to run a command with guest operations: invalid guest login")))
+		})
+	})
+})
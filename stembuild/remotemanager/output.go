@@ -0,0 +1,89 @@
+package remotemanager
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
+)
+
+// StderrTailLines is how many of the last lines of stderr the error of a
+// failed command holds.
+const StderrTailLines = 20
+
+// CommandOutput is where the output of a command run on the VM goes. A nil
+// Stdout or Stderr is os.Stdout or os.Stderr. Registered secrets are masked
+// before either is written to.
+type CommandOutput struct {
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+func (o CommandOutput) stdout() io.Writer {
+	if o.Stdout == nil {
+		return colorlogger.NewRedactingWriter(os.Stdout)
+	}
+
+	return colorlogger.NewRedactingWriter(o.Stdout)
+}
+
+func (o CommandOutput) stderr() io.Writer {
+	if o.Stderr == nil {
+		return colorlogger.NewRedactingWriter(os.Stderr)
+	}
+
+	return colorlogger.NewRedactingWriter(o.Stderr)
+}
+
+// tailWriter keeps the last lines written to it, so that the stderr of a long
+// running command can go in its error.
+type tailWriter struct {
+	max     int
+	lines   []string
+	partial []byte
+	dropped bool
+}
+
+func newTailWriter(max int) *tailWriter {
+	return &tailWriter{max: max}
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	t.partial = append(t.partial, p...)
+	for {
+		i := bytes.IndexByte(t.partial, '\n')
+		if i < 0 {
+			break
+		}
+		t.lines = append(t.lines, string(t.partial[:i+1]))
+		t.partial = t.partial[i+1:]
+	}
+	if len(t.lines) > t.max {
+		t.lines = t.lines[len(t.lines)-t.max:]
+		t.dropped = true
+	}
+
+	return len(p), nil
+}
+
+// String returns the lines kept, starting with "..." if earlier ones were
+// dropped.
+func (t *tailWriter) String() string {
+	lines, dropped := t.lines, t.dropped
+	if len(t.partial) > 0 && len(lines) == t.max {
+		lines, dropped = lines[1:], true
+	}
+
+	var b strings.Builder
+	if dropped {
+		b.WriteString("...\n")
+	}
+	for _, line := range lines {
+		b.WriteString(line)
+	}
+	b.Write(t.partial)
+
+	return b.String()
+}
@@ -1,6 +1,8 @@
 package remotemanager
 
 import (
+	"fmt"
+	"io"
 	"time"
 )
 
@@ -10,11 +12,35 @@ import (
 
 const PowershellExecutionErrorMessage = "powershell encountered an issue"
 
+// The transports construct can use to run commands on the VM: WinRM over the
+// network, or the guest operations of VMware Tools through vCenter.
+const (
+	TransportWinRM    = "winrm"
+	TransportGuestOps = "guestops"
+)
+
+// Transports are the values -transport accepts.
+var Transports = []string{TransportWinRM, TransportGuestOps}
+
+// RemoteManager runs commands on the VM, writing their output to the given
+// CommandOutput. The error of a command that exits nonzero holds the last
+// StderrTailLines lines of its stderr.
 type RemoteManager interface {
 	UploadArtifact(source, destination string) error
-	ExtractArchive(source, destination string) error
-	ExecuteCommand(command string) (int, error)
-	ExecuteCommandWithTimeout(command string, timeout time.Duration) (int, error)
+	DownloadFile(source string, w io.Writer) error
+	ExtractArchive(source, destination string, output CommandOutput) error
+	// ExecuteCommand waits for the command to exit for as long as it runs,
+	// until the context of the RemoteManager is done.
+	ExecuteCommand(command string, output CommandOutput) (int, error)
+	// ExecuteCommandWithTimeout gives up if the VM does not respond within
+	// timeout. Over WinRM this bounds each request, so the command may run
+	// for longer while the VM responds; with guest operations it bounds the
+	// whole command, so it is only for commands that exit quickly.
+	ExecuteCommandWithTimeout(command string, timeout time.Duration, output CommandOutput) (int, error)
 	CanReachVM() error
 	CanLoginVM() error
 }
+
+func extractArchiveCommand(source, destination string) string {
+	return fmt.Sprintf("powershell.exe Expand-Archive %s %s -Force", source, destination)
+}
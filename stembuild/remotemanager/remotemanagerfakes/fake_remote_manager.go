@@ -2,6 +2,7 @@
 package remotemanagerfakes
 
 import (
+	"io"
 	"sync"
 	"time"
 
@@ -29,10 +30,23 @@ type FakeRemoteManager struct {
 	canReachVMReturnsOnCall map[int]struct {
 		result1 error
 	}
-	ExecuteCommandStub        func(string) (int, error)
+	DownloadFileStub        func(string, io.Writer) error
+	downloadFileMutex       sync.RWMutex
+	downloadFileArgsForCall []struct {
+		arg1 string
+		arg2 io.Writer
+	}
+	downloadFileReturns struct {
+		result1 error
+	}
+	downloadFileReturnsOnCall map[int]struct {
+		result1 error
+	}
+	ExecuteCommandStub        func(string, remotemanager.CommandOutput) (int, error)
 	executeCommandMutex       sync.RWMutex
 	executeCommandArgsForCall []struct {
 		arg1 string
+		arg2 remotemanager.CommandOutput
 	}
 	executeCommandReturns struct {
 		result1 int
@@ -42,11 +56,12 @@ type FakeRemoteManager struct {
 		result1 int
 		result2 error
 	}
-	ExecuteCommandWithTimeoutStub        func(string, time.Duration) (int, error)
+	ExecuteCommandWithTimeoutStub        func(string, time.Duration, remotemanager.CommandOutput) (int, error)
 	executeCommandWithTimeoutMutex       sync.RWMutex
 	executeCommandWithTimeoutArgsForCall []struct {
 		arg1 string
 		arg2 time.Duration
+		arg3 remotemanager.CommandOutput
 	}
 	executeCommandWithTimeoutReturns struct {
 		result1 int
@@ -56,11 +71,12 @@ type FakeRemoteManager struct {
 		result1 int
 		result2 error
 	}
-	ExtractArchiveStub        func(string, string) error
+	ExtractArchiveStub        func(string, string, remotemanager.CommandOutput) error
 	extractArchiveMutex       sync.RWMutex
 	extractArchiveArgsForCall []struct {
 		arg1 string
 		arg2 string
+		arg3 remotemanager.CommandOutput
 	}
 	extractArchiveReturns struct {
 		result1 error
@@ -190,18 +206,81 @@ func (fake *FakeRemoteManager) CanReachVMReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
-func (fake *FakeRemoteManager) ExecuteCommand(arg1 string) (int, error) {
+func (fake *FakeRemoteManager) DownloadFile(arg1 string, arg2 io.Writer) error {
+	fake.downloadFileMutex.Lock()
+	ret, specificReturn := fake.downloadFileReturnsOnCall[len(fake.downloadFileArgsForCall)]
+	fake.downloadFileArgsForCall = append(fake.downloadFileArgsForCall, struct {
+		arg1 string
+		arg2 io.Writer
+	}{arg1, arg2})
+	stub := fake.DownloadFileStub
+	fakeReturns := fake.downloadFileReturns
+	fake.recordInvocation("DownloadFile", []interface{}{arg1, arg2})
+	fake.downloadFileMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeRemoteManager) DownloadFileCallCount() int {
+	fake.downloadFileMutex.RLock()
+	defer fake.downloadFileMutex.RUnlock()
+	return len(fake.downloadFileArgsForCall)
+}
+
+func (fake *FakeRemoteManager) DownloadFileCalls(stub func(string, io.Writer) error) {
+	fake.downloadFileMutex.Lock()
+	defer fake.downloadFileMutex.Unlock()
+	fake.DownloadFileStub = stub
+}
+
+func (fake *FakeRemoteManager) DownloadFileArgsForCall(i int) (string, io.Writer) {
+	fake.downloadFileMutex.RLock()
+	defer fake.downloadFileMutex.RUnlock()
+	argsForCall := fake.downloadFileArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeRemoteManager) DownloadFileReturns(result1 error) {
+	fake.downloadFileMutex.Lock()
+	defer fake.downloadFileMutex.Unlock()
+	fake.DownloadFileStub = nil
+	fake.downloadFileReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRemoteManager) DownloadFileReturnsOnCall(i int, result1 error) {
+	fake.downloadFileMutex.Lock()
+	defer fake.downloadFileMutex.Unlock()
+	fake.DownloadFileStub = nil
+	if fake.downloadFileReturnsOnCall == nil {
+		fake.downloadFileReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.downloadFileReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRemoteManager) ExecuteCommand(arg1 string, arg2 remotemanager.CommandOutput) (int, error) {
 	fake.executeCommandMutex.Lock()
 	ret, specificReturn := fake.executeCommandReturnsOnCall[len(fake.executeCommandArgsForCall)]
 	fake.executeCommandArgsForCall = append(fake.executeCommandArgsForCall, struct {
 		arg1 string
-	}{arg1})
+		arg2 remotemanager.CommandOutput
+	}{arg1, arg2})
 	stub := fake.ExecuteCommandStub
 	fakeReturns := fake.executeCommandReturns
-	fake.recordInvocation("ExecuteCommand", []interface{}{arg1})
+	fake.recordInvocation("ExecuteCommand", []interface{}{arg1, arg2})
 	fake.executeCommandMutex.Unlock()
 	if stub != nil {
-		return stub(arg1)
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
@@ -215,17 +294,17 @@ func (fake *FakeRemoteManager) ExecuteCommandCallCount() int {
 	return len(fake.executeCommandArgsForCall)
 }
 
-func (fake *FakeRemoteManager) ExecuteCommandCalls(stub func(string) (int, error)) {
+func (fake *FakeRemoteManager) ExecuteCommandCalls(stub func(string, remotemanager.CommandOutput) (int, error)) {
 	fake.executeCommandMutex.Lock()
 	defer fake.executeCommandMutex.Unlock()
 	fake.ExecuteCommandStub = stub
 }
 
-func (fake *FakeRemoteManager) ExecuteCommandArgsForCall(i int) string {
+func (fake *FakeRemoteManager) ExecuteCommandArgsForCall(i int) (string, remotemanager.CommandOutput) {
 	fake.executeCommandMutex.RLock()
 	defer fake.executeCommandMutex.RUnlock()
 	argsForCall := fake.executeCommandArgsForCall[i]
-	return argsForCall.arg1
+	return argsForCall.arg1, argsForCall.arg2
 }
 
 func (fake *FakeRemoteManager) ExecuteCommandReturns(result1 int, result2 error) {
@@ -254,19 +333,20 @@ func (fake *FakeRemoteManager) ExecuteCommandReturnsOnCall(i int, result1 int, r
 	}{result1, result2}
 }
 
-func (fake *FakeRemoteManager) ExecuteCommandWithTimeout(arg1 string, arg2 time.Duration) (int, error) {
+func (fake *FakeRemoteManager) ExecuteCommandWithTimeout(arg1 string, arg2 time.Duration, arg3 remotemanager.CommandOutput) (int, error) {
 	fake.executeCommandWithTimeoutMutex.Lock()
 	ret, specificReturn := fake.executeCommandWithTimeoutReturnsOnCall[len(fake.executeCommandWithTimeoutArgsForCall)]
 	fake.executeCommandWithTimeoutArgsForCall = append(fake.executeCommandWithTimeoutArgsForCall, struct {
 		arg1 string
 		arg2 time.Duration
-	}{arg1, arg2})
+		arg3 remotemanager.CommandOutput
+	}{arg1, arg2, arg3})
 	stub := fake.ExecuteCommandWithTimeoutStub
 	fakeReturns := fake.executeCommandWithTimeoutReturns
-	fake.recordInvocation("ExecuteCommandWithTimeout", []interface{}{arg1, arg2})
+	fake.recordInvocation("ExecuteCommandWithTimeout", []interface{}{arg1, arg2, arg3})
 	fake.executeCommandWithTimeoutMutex.Unlock()
 	if stub != nil {
-		return stub(arg1, arg2)
+		return stub(arg1, arg2, arg3)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
@@ -280,17 +360,17 @@ func (fake *FakeRemoteManager) ExecuteCommandWithTimeoutCallCount() int {
 	return len(fake.executeCommandWithTimeoutArgsForCall)
 }
 
-func (fake *FakeRemoteManager) ExecuteCommandWithTimeoutCalls(stub func(string, time.Duration) (int, error)) {
+func (fake *FakeRemoteManager) ExecuteCommandWithTimeoutCalls(stub func(string, time.Duration, remotemanager.CommandOutput) (int, error)) {
 	fake.executeCommandWithTimeoutMutex.Lock()
 	defer fake.executeCommandWithTimeoutMutex.Unlock()
 	fake.ExecuteCommandWithTimeoutStub = stub
 }
 
-func (fake *FakeRemoteManager) ExecuteCommandWithTimeoutArgsForCall(i int) (string, time.Duration) {
+func (fake *FakeRemoteManager) ExecuteCommandWithTimeoutArgsForCall(i int) (string, time.Duration, remotemanager.CommandOutput) {
 	fake.executeCommandWithTimeoutMutex.RLock()
 	defer fake.executeCommandWithTimeoutMutex.RUnlock()
 	argsForCall := fake.executeCommandWithTimeoutArgsForCall[i]
-	return argsForCall.arg1, argsForCall.arg2
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
 }
 
 func (fake *FakeRemoteManager) ExecuteCommandWithTimeoutReturns(result1 int, result2 error) {
@@ -319,19 +399,20 @@ func (fake *FakeRemoteManager) ExecuteCommandWithTimeoutReturnsOnCall(i int, res
 	}{result1, result2}
 }
 
-func (fake *FakeRemoteManager) ExtractArchive(arg1 string, arg2 string) error {
+func (fake *FakeRemoteManager) ExtractArchive(arg1 string, arg2 string, arg3 remotemanager.CommandOutput) error {
 	fake.extractArchiveMutex.Lock()
 	ret, specificReturn := fake.extractArchiveReturnsOnCall[len(fake.extractArchiveArgsForCall)]
 	fake.extractArchiveArgsForCall = append(fake.extractArchiveArgsForCall, struct {
 		arg1 string
 		arg2 string
-	}{arg1, arg2})
+		arg3 remotemanager.CommandOutput
+	}{arg1, arg2, arg3})
 	stub := fake.ExtractArchiveStub
 	fakeReturns := fake.extractArchiveReturns
-	fake.recordInvocation("ExtractArchive", []interface{}{arg1, arg2})
+	fake.recordInvocation("ExtractArchive", []interface{}{arg1, arg2, arg3})
 	fake.extractArchiveMutex.Unlock()
 	if stub != nil {
-		return stub(arg1, arg2)
+		return stub(arg1, arg2, arg3)
 	}
 	if specificReturn {
 		return ret.result1
@@ -345,17 +426,17 @@ func (fake *FakeRemoteManager) ExtractArchiveCallCount() int {
 	return len(fake.extractArchiveArgsForCall)
 }
 
-func (fake *FakeRemoteManager) ExtractArchiveCalls(stub func(string, string) error) {
+func (fake *FakeRemoteManager) ExtractArchiveCalls(stub func(string, string, remotemanager.CommandOutput) error) {
 	fake.extractArchiveMutex.Lock()
 	defer fake.extractArchiveMutex.Unlock()
 	fake.ExtractArchiveStub = stub
 }
 
-func (fake *FakeRemoteManager) ExtractArchiveArgsForCall(i int) (string, string) {
+func (fake *FakeRemoteManager) ExtractArchiveArgsForCall(i int) (string, string, remotemanager.CommandOutput) {
 	fake.extractArchiveMutex.RLock()
 	defer fake.extractArchiveMutex.RUnlock()
 	argsForCall := fake.extractArchiveArgsForCall[i]
-	return argsForCall.arg1, argsForCall.arg2
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
 }
 
 func (fake *FakeRemoteManager) ExtractArchiveReturns(result1 error) {
@@ -450,6 +531,8 @@ func (fake *FakeRemoteManager) Invocations() map[string][][]interface{} {
 	defer fake.canLoginVMMutex.RUnlock()
 	fake.canReachVMMutex.RLock()
 	defer fake.canReachVMMutex.RUnlock()
+	fake.downloadFileMutex.RLock()
+	defer fake.downloadFileMutex.RUnlock()
 	fake.executeCommandMutex.RLock()
 	defer fake.executeCommandMutex.RUnlock()
 	fake.executeCommandWithTimeoutMutex.RLock()
@@ -0,0 +1,194 @@
+package remotemanager
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	krb5config "github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/masterzen/winrm"
+	"github.com/masterzen/winrm/soap"
+)
+
+// The ways of authenticating to WinRM. Basic sends the password with every
+// request, so the VM must allow it. None of them encrypt the WinRM messages,
+// so over HTTP the VM must also allow unencrypted traffic; only HTTPS avoids
+// that.
+const (
+	WinRMAuthBasic    = "basic"
+	WinRMAuthNTLM     = "ntlm"
+	WinRMAuthKerberos = "kerberos"
+)
+
+// WinRMAuths are the values -winrm-auth accepts.
+var WinRMAuths = []string{WinRMAuthBasic, WinRMAuthNTLM, WinRMAuthKerberos}
+
+// DefaultKerberosConfig is the krb5.conf read if no other is given.
+const DefaultKerberosConfig = "/etc/krb5.conf"
+
+// ErrAuthentication is wrapped by the error of CanLoginVM when WinRM on the VM
+// is reachable but does not accept the credentials.
+var ErrAuthentication = errors.New("winrm authentication failed")
+
+// unauthorized matches the errors of the winrm transporters for a 401
+// response.
+var unauthorized = regexp.MustCompile(`http (response )?error:? 401\b`)
+
+func isAuthenticationFailure(err error) bool {
+	return errors.Is(err, ErrAuthentication) || unauthorized.MatchString(err.Error())
+}
+
+// KerberosOptions are where the Kerberos credentials of the user come from.
+// The realm is taken from a user@REALM username, or else is the default realm
+// of the krb5.conf. Without a keytab or credential cache, the password is
+// used.
+type KerberosOptions struct {
+	// Config is the path of the krb5.conf, DefaultKerberosConfig if empty.
+	Config string
+	Keytab string
+	CCache string
+	// SPN is the service principal name of WinRM on the VM, such as
+	// HTTP/vm.example.com. If empty it is HTTP/ and the host connected to,
+	// which is only right if the VM is registered in Kerberos under its IP.
+	SPN string
+}
+
+func (k KerberosOptions) config() string {
+	if k.Config == "" {
+		return DefaultKerberosConfig
+	}
+
+	return k.Config
+}
+
+// transportDecorator returns the winrm transporter for the authentication of
+// the options, or nil for the basic authentication winrm uses by default.
+// Kerberos requests are cancelled with ctx.
+func (o WinRMOptions) transportDecorator(ctx context.Context, username, password string) func() winrm.Transporter {
+	switch o.Auth {
+	case WinRMAuthNTLM:
+		return func() winrm.Transporter { return &winrm.ClientNTLM{} }
+	case WinRMAuthKerberos:
+		return func() winrm.Transporter {
+			return &kerberosTransporter{ctx: ctx, username: username, password: password, options: o.Kerberos}
+		}
+	}
+
+	return nil
+}
+
+func (o WinRMOptions) auth() string {
+	if o.Auth == "" {
+		return WinRMAuthBasic
+	}
+
+	return o.Auth
+}
+
+// kerberosTransporter authenticates WinRM requests with SPNEGO. Unlike the
+// Kerberos transporter of winrm, it logs in with a keytab too.
+type kerberosTransporter struct {
+	ctx      context.Context
+	username string
+	password string
+	options  KerberosOptions
+
+	url        string
+	httpClient *http.Client
+	krb5Client *client.Client
+}
+
+func (k *kerberosTransporter) Transport(endpoint *winrm.Endpoint) error {
+	krb5Config, err := krb5config.Load(k.options.config())
+	if err != nil {
+		return fmt.Errorf("unable to read kerberos config %s: %w", k.options.config(), err)
+	}
+
+	username, realm := k.username, krb5Config.LibDefaults.DefaultRealm
+	if name, userRealm, found := strings.Cut(k.username, "@"); found {
+		username, realm = name, userRealm
+	}
+
+	switch {
+	case k.options.Keytab != "":
+		kt, err := keytab.Load(k.options.Keytab)
+		if err != nil {
+			return fmt.Errorf("unable to read kerberos keytab %s: %w", k.options.Keytab, err)
+		}
+		k.krb5Client = client.NewWithKeytab(username, realm, kt, krb5Config, client.DisablePAFXFAST(true))
+	case k.options.CCache != "":
+		ccache, err := credentials.LoadCCache(k.options.CCache)
+		if err != nil {
+			return fmt.Errorf("unable to read kerberos credential cache %s: %w", k.options.CCache, err)
+		}
+		k.krb5Client, err = client.NewFromCCache(ccache, krb5Config, client.DisablePAFXFAST(true))
+		if err != nil {
+			return fmt.Errorf("unable to use kerberos credential cache %s: %w", k.options.CCache, err)
+		}
+	default:
+		k.krb5Client = client.NewWithPassword(username, realm, k.password, krb5Config, client.DisablePAFXFAST(true), client.AssumePreAuthentication(true))
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: endpoint.Insecure, ServerName: endpoint.TLSServerName} //nolint:gosec
+	if len(endpoint.CACert) > 0 {
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(endpoint.CACert) {
+			return fmt.Errorf("unable to parse WinRM CA certificate")
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	k.httpClient = &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		TLSClientConfig:       tlsConfig,
+		ResponseHeaderTimeout: endpoint.Timeout,
+	}}
+
+	scheme := "http"
+	if endpoint.HTTPS {
+		scheme = "https"
+	}
+	k.url = fmt.Sprintf("%s://%s/wsman", scheme, net.JoinHostPort(endpoint.Host, strconv.Itoa(endpoint.Port)))
+
+	return nil
+}
+
+func (k *kerberosTransporter) Post(_ *winrm.Client, request *soap.SoapMessage) (string, error) {
+	req, err := http.NewRequestWithContext(k.ctx, http.MethodPost, k.url, strings.NewReader(request.String()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/soap+xml;charset=UTF-8")
+
+	err = spnego.SetSPNEGOHeader(k.krb5Client, req, k.options.SPN)
+	if err != nil {
+		return "", fmt.Errorf("%w: unable to get a kerberos service ticket: %w", ErrAuthentication, err)
+	}
+
+	resp, err := k.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("http error %d: %s", resp.StatusCode, body)
+	}
+
+	return string(body), nil
+}
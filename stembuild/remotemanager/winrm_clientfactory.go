@@ -1,29 +1,33 @@
 package remotemanager
 
 import (
+	"context"
 	"time"
 
 	"github.com/masterzen/winrm"
 )
 
 type WinRMClientFactory struct {
+	ctx      context.Context
 	host     string
 	username string
 	password string
+	options  WinRMOptions
 }
 
-func NewWinRmClientFactory(host, username, password string) *WinRMClientFactory {
-	return &WinRMClientFactory{host: host, username: username, password: password}
+func NewWinRmClientFactory(ctx context.Context, host, username, password string, options WinRMOptions) *WinRMClientFactory {
+	return &WinRMClientFactory{ctx: ctx, host: host, username: username, password: password, options: options}
 }
 
 func (f *WinRMClientFactory) Build(timeout time.Duration) (WinRMClient, error) {
-	endpoint := winrm.NewEndpoint(f.host, WinRmPort, false, true, nil, nil, nil, timeout)
+	endpoint := winrm.NewEndpoint(f.host, f.options.port(), f.options.HTTPS, f.options.InsecureSkipVerify, f.options.CACert, nil, nil, timeout)
 	params := winrm.NewParameters(
 		winrm.DefaultParameters.Timeout,
 		winrm.DefaultParameters.Locale,
 		winrm.DefaultParameters.EnvelopeSize,
 	)
 	params.AllowTimeout = true
+	params.TransportDecorator = f.options.transportDecorator(f.ctx, f.username, f.password)
 	client, err := winrm.NewClientWithParameters(endpoint, f.username, f.password, params)
 	return client, err
 }
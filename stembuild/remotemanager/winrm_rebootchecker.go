@@ -1,6 +1,7 @@
 package remotemanager
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -14,20 +15,29 @@ var abortReboot = `shutdown /a`
 type RebootWaiter struct {
 	poller        poller.PollerI
 	rebootChecker RebootCheckerI
+	timeout       time.Duration
 }
 
-func NewRebootWaiter(poller poller.PollerI, rebootChecker RebootCheckerI) *RebootWaiter {
+// NewRebootWaiter returns a RebootWaiter that gives up after timeout, or
+// waits for as long as it takes when timeout is zero.
+func NewRebootWaiter(poller poller.PollerI, rebootChecker RebootCheckerI, timeout time.Duration) *RebootWaiter {
 	return &RebootWaiter{
 		poller,
 		rebootChecker,
+		timeout,
 	}
 }
 
-func (rw *RebootWaiter) WaitForRebootFinished() error {
-	err := rw.poller.Poll(10*time.Second, rw.rebootChecker.RebootHasFinished)
+func (rw *RebootWaiter) WaitForRebootFinished(ctx context.Context) error {
+	err := rw.poller.Poll(ctx, poller.Options{
+		Interval:    10 * time.Second,
+		MaxInterval: time.Minute,
+		Jitter:      0.2,
+		Timeout:     rw.timeout,
+	}, rw.rebootChecker.RebootHasFinished)
 
 	if err != nil {
-		return fmt.Errorf("error polling for reboot: %s", err)
+		return fmt.Errorf("error polling for reboot: %w", err)
 	}
 	return nil
 }
@@ -39,24 +49,30 @@ type RebootCheckerI interface {
 
 type RebootChecker struct {
 	remoteManager RemoteManager
+	// Output is where the output of the shutdown commands goes.
+	Output CommandOutput
 }
 
 func NewRebootChecker(winrmRemoteManager RemoteManager) *RebootChecker {
-	return &RebootChecker{winrmRemoteManager}
+	return &RebootChecker{remoteManager: winrmRemoteManager}
 }
 
-// RebootHasFinished inspired by Hashicorp Packer waitForRestart
+// RebootHasFinished inspired by Hashicorp Packer waitForRestart. The shutdown
+// commands exit straight away, so each is given WinRmTimeout, which with guest
+// operations keeps a VM that stops responding mid-reboot from hanging the
+// check.
 func (rc *RebootChecker) RebootHasFinished() (bool, error) {
 
-	exitCode, err := rc.remoteManager.ExecuteCommand(tryCheckReboot)
+	exitCode, err := rc.remoteManager.ExecuteCommandWithTimeout(tryCheckReboot, WinRmTimeout, rc.Output)
 	if err != nil {
-		return false, nil
+		// WinRM is expected to be unreachable while the VM reboots.
+		return false, poller.Retryable(err)
 	}
 	if exitCode == 0 {
 		var abortExitCode int
 		var abortErr error
 		for i := 0; i < 5; i++ {
-			abortExitCode, abortErr = rc.remoteManager.ExecuteCommand(abortReboot)
+			abortExitCode, abortErr = rc.remoteManager.ExecuteCommandWithTimeout(abortReboot, WinRmTimeout, rc.Output)
 
 			if abortErr == nil {
 				break
@@ -1,6 +1,7 @@
 package remotemanager_test
 
 import (
+	"context"
 	_ "reflect"
 	"time"
 
@@ -8,6 +9,7 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/pkg/errors"
 
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/poller"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/poller/pollerfakes"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/remotemanager"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/remotemanager/remotemanagerfakes"
@@ -34,7 +36,7 @@ var _ = Describe("WinRM RebootChecker", func() {
 	Describe("WaitForRebootFinished", func() {
 		It("calls the hasFinished func using the Poller", func() {
 			numberOfPollCalls := 8
-			fakePoller.PollStub = func(duration time.Duration, pollFunc func() (bool, error)) error {
+			fakePoller.PollStub = func(ctx context.Context, options poller.Options, pollFunc func() (bool, error)) error {
 				for call := 0; call < numberOfPollCalls; call++ {
 					pollFunc() //nolint:errcheck
 				}
@@ -43,25 +45,25 @@ var _ = Describe("WinRM RebootChecker", func() {
 
 			rc := &remotemanagerfakes.FakeRebootCheckerI{}
 			rc.RebootHasFinishedReturns(false, nil)
-			waiter := remotemanager.NewRebootWaiter(fakePoller, rc)
+			waiter := remotemanager.NewRebootWaiter(fakePoller, rc, time.Hour)
 
-			waiter.WaitForRebootFinished() //nolint:errcheck
+			waiter.WaitForRebootFinished(context.Background()) //nolint:errcheck
 
 			Expect(fakePoller.PollCallCount()).To(Equal(1))
 			Expect(rc.RebootHasFinishedCallCount()).To(Equal(numberOfPollCalls))
 		})
 
 		It("returns nil if a reboot has finished successfully", func() {
-			fakePoller.PollStub = func(duration time.Duration, pollFunc func() (bool, error)) error {
+			fakePoller.PollStub = func(ctx context.Context, options poller.Options, pollFunc func() (bool, error)) error {
 				pollFunc() //nolint:errcheck
 				return nil
 			}
 
 			rc := &remotemanagerfakes.FakeRebootCheckerI{}
 			rc.RebootHasFinishedReturns(false, nil)
-			waiter := remotemanager.NewRebootWaiter(fakePoller, rc)
+			waiter := remotemanager.NewRebootWaiter(fakePoller, rc, time.Hour)
 
-			err := waiter.WaitForRebootFinished()
+			err := waiter.WaitForRebootFinished(context.Background())
 			Expect(err).ToNot(HaveOccurred())
 		})
 
@@ -69,17 +71,43 @@ var _ = Describe("WinRM RebootChecker", func() {
 			errorMessage := "unable to abort reboot."
 			fakePoller.PollReturns(errors.New(errorMessage))
 
-			waiter := remotemanager.NewRebootWaiter(fakePoller, rc)
+			waiter := remotemanager.NewRebootWaiter(fakePoller, rc, time.Hour)
 
-			err := waiter.WaitForRebootFinished()
+			err := waiter.WaitForRebootFinished(context.Background())
 			Expect(err.Error()).To(ContainSubstring(errorMessage))
 		})
+
+		It("polls with backoff and gives up after the timeout", func() {
+			ctx := context.WithValue(context.Background(), struct{}{}, "reboot")
+			waiter := remotemanager.NewRebootWaiter(fakePoller, rc, 45*time.Minute)
+
+			err := waiter.WaitForRebootFinished(ctx)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakePoller.PollCallCount()).To(Equal(1))
+			pollCtx, options, _ := fakePoller.PollArgsForCall(0)
+			Expect(pollCtx).To(Equal(ctx))
+			Expect(options.Interval).To(Equal(10 * time.Second))
+			Expect(options.MaxInterval).To(Equal(time.Minute))
+			Expect(options.Timeout).To(Equal(45 * time.Minute))
+		})
+
+		It("keeps the poller's timeout error in the chain", func() {
+			fakePoller.PollReturns(&poller.TimeoutError{Timeout: time.Minute, Attempts: 3, LastErr: errors.New("connection refused")})
+			waiter := remotemanager.NewRebootWaiter(fakePoller, rc, time.Minute)
+
+			err := waiter.WaitForRebootFinished(context.Background())
+
+			var timeoutErr *poller.TimeoutError
+			Expect(errors.As(err, &timeoutErr)).To(BeTrue())
+			Expect(err).To(MatchError("error polling for reboot: timed out after 1m0s and 3 attempts, last error: connection refused"))
+		})
 	})
 
 	Describe("RebootHasFinished", func() {
 		It("returns false when reboot is in progress", func() {
 			someNonzeroExitCode := 1
-			fakeRemoteManager.ExecuteCommandReturns(someNonzeroExitCode, nil)
+			fakeRemoteManager.ExecuteCommandWithTimeoutReturns(someNonzeroExitCode, nil)
 
 			hasFinished, err := rc.RebootHasFinished()
 
@@ -87,40 +115,43 @@ var _ = Describe("WinRM RebootChecker", func() {
 			Expect(hasFinished).To(BeFalse())
 		})
 
-		It("returns false when it could not issue test-reboot command", func() {
-			fakeRemoteManager.ExecuteCommandReturns(0, errors.New(""))
+		It("returns false and a retryable error when it could not issue test-reboot command", func() {
+			commandErr := errors.New("connection refused")
+			fakeRemoteManager.ExecuteCommandWithTimeoutReturns(0, commandErr)
 
 			hasFinished, err := rc.RebootHasFinished()
 
 			Expect(hasFinished).To(BeFalse())
-			Expect(err).ToNot(HaveOccurred())
+			Expect(err).To(MatchError(commandErr))
+			Expect(err).To(Equal(poller.Retryable(commandErr)))
 		})
 
 		Context("after a reboot has been successfully scheduled", func() {
 
 			BeforeEach(func() {
-				fakeRemoteManager.ExecuteCommandReturnsOnCall(0, 0, nil)
+				fakeRemoteManager.ExecuteCommandWithTimeoutReturnsOnCall(0, 0, nil)
 			})
 
 			It("aborts reboot when test-reboot succeeds", func() {
 				_, err := rc.RebootHasFinished()
 
 				Expect(err).NotTo(HaveOccurred())
-				Expect(fakeRemoteManager.ExecuteCommandArgsForCall(1)).
-					To(Equal(expectedAbortRebootCommand))
+				command, timeout, _ := fakeRemoteManager.ExecuteCommandWithTimeoutArgsForCall(1)
+				Expect(command).To(Equal(expectedAbortRebootCommand))
+				Expect(timeout).To(Equal(remotemanager.WinRmTimeout))
 			})
 
 			It("returns an error when abort command could not be issued", func() {
 				ErrorExitCode := 0
-				fakeRemoteManager.ExecuteCommandReturnsOnCall(1, ErrorExitCode, errors.New("unable to issue abort command"))
-				fakeRemoteManager.ExecuteCommandReturnsOnCall(2, ErrorExitCode, errors.New("unable to issue abort command"))
-				fakeRemoteManager.ExecuteCommandReturnsOnCall(3, ErrorExitCode, errors.New("unable to issue abort command"))
-				fakeRemoteManager.ExecuteCommandReturnsOnCall(4, ErrorExitCode, errors.New("unable to issue abort command"))
-				fakeRemoteManager.ExecuteCommandReturnsOnCall(5, ErrorExitCode, errors.New("unable to issue abort command"))
+				fakeRemoteManager.ExecuteCommandWithTimeoutReturnsOnCall(1, ErrorExitCode, errors.New("unable to issue abort command"))
+				fakeRemoteManager.ExecuteCommandWithTimeoutReturnsOnCall(2, ErrorExitCode, errors.New("unable to issue abort command"))
+				fakeRemoteManager.ExecuteCommandWithTimeoutReturnsOnCall(3, ErrorExitCode, errors.New("unable to issue abort command"))
+				fakeRemoteManager.ExecuteCommandWithTimeoutReturnsOnCall(4, ErrorExitCode, errors.New("unable to issue abort command"))
+				fakeRemoteManager.ExecuteCommandWithTimeoutReturnsOnCall(5, ErrorExitCode, errors.New("unable to issue abort command"))
 
 				hasFinished, err := rc.RebootHasFinished()
 
-				Expect(fakeRemoteManager.ExecuteCommandCallCount()).To(Equal(6))
+				Expect(fakeRemoteManager.ExecuteCommandWithTimeoutCallCount()).To(Equal(6))
 
 				Expect(hasFinished).To(BeFalse())
 				Expect(err).To(MatchError(ContainSubstring("unable to issue abort command")))
@@ -128,7 +159,7 @@ var _ = Describe("WinRM RebootChecker", func() {
 
 			It("returns an error when abort command failed", func() {
 				nonZeroExitCode := 1
-				fakeRemoteManager.ExecuteCommandReturnsOnCall(1, nonZeroExitCode, nil)
+				fakeRemoteManager.ExecuteCommandWithTimeoutReturnsOnCall(1, nonZeroExitCode, nil)
 
 				hasFinished, err := rc.RebootHasFinished()
 
@@ -137,16 +168,17 @@ var _ = Describe("WinRM RebootChecker", func() {
 			})
 
 			It("returns true when reboot has finished and when abort succeeds", func() {
-				fakeRemoteManager.ExecuteCommandReturnsOnCall(1, 0, nil)
+				fakeRemoteManager.ExecuteCommandWithTimeoutReturnsOnCall(1, 0, nil)
 
 				hasFinished, err := rc.RebootHasFinished()
 
 				Expect(err).NotTo(HaveOccurred())
 				Expect(hasFinished).To(Equal(true))
-				Expect(fakeRemoteManager.ExecuteCommandCallCount()).
+				Expect(fakeRemoteManager.ExecuteCommandWithTimeoutCallCount()).
 					To(BeNumerically(">=", 1))
-				Expect(fakeRemoteManager.ExecuteCommandArgsForCall(0)).
-					To(Equal(expectedTryCheckRebootCommand))
+				command, timeout, _ := fakeRemoteManager.ExecuteCommandWithTimeoutArgsForCall(0)
+				Expect(command).To(Equal(expectedTryCheckRebootCommand))
+				Expect(timeout).To(Equal(remotemanager.WinRmTimeout))
 			})
 		})
 	})
@@ -1,30 +1,65 @@
 package remotemanager
 
 import (
-	"bytes"
+	"context"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/masterzen/winrm"
 	"github.com/packer-community/winrmcp/winrmcp"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
 )
 
 const WinRmPort = 5985
+const WinRmHTTPSPort = 5986
 const WinRmTimeout = 120 * time.Second
 
+// WinRMOptions are how stembuild connects to WinRM on the VM. By default it
+// uses HTTP on WinRmPort; with HTTPS it uses WinRmHTTPSPort and verifies the
+// certificate of the VM against CACert, or the system roots if that is empty.
+type WinRMOptions struct {
+	HTTPS bool
+	// Port overrides the default port of the protocol if not zero.
+	Port int
+	// CACert holds PEM encoded certificates that the certificate of the VM
+	// must be signed by.
+	CACert             []byte
+	InsecureSkipVerify bool
+	// Auth is one of WinRMAuths, basic if empty.
+	Auth     string
+	Kerberos KerberosOptions
+}
+
+func (o WinRMOptions) port() int {
+	if o.Port != 0 {
+		return o.Port
+	}
+	if o.HTTPS {
+		return WinRmHTTPSPort
+	}
+
+	return WinRmPort
+}
+
 type WinRM struct {
+	ctx           context.Context
 	host          string
 	username      string
 	password      string
+	options       WinRMOptions
 	clientFactory WinRMClientFactoryI
 }
 
 //counterfeiter:generate . WinRMClient
 type WinRMClient interface {
-	Run(command string, stdout io.Writer, stderr io.Writer) (int, error)
+	RunWithContext(ctx context.Context, command string, stdout io.Writer, stderr io.Writer) (int, error)
 	CreateShell() (*winrm.Shell, error)
 }
 
@@ -33,12 +68,15 @@ type WinRMClientFactoryI interface {
 	Build(timeout time.Duration) (WinRMClient, error)
 }
 
-func NewWinRM(host string, username string, password string, clientFactory WinRMClientFactoryI) RemoteManager {
-	return &WinRM{host, username, password, clientFactory}
+// NewWinRM returns a RemoteManager whose commands are stopped when ctx is
+// done.
+func NewWinRM(ctx context.Context, host string, username string, password string, options WinRMOptions, clientFactory WinRMClientFactoryI) RemoteManager {
+	return &WinRM{ctx, host, username, password, options, clientFactory}
 }
 
 func (w *WinRM) CanReachVM() error {
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", w.host, WinRmPort), time.Second*60)
+	dialer := net.Dialer{Timeout: time.Second * 60}
+	conn, err := dialer.DialContext(w.ctx, "tcp", net.JoinHostPort(w.host, strconv.Itoa(w.options.port())))
 	if err != nil {
 		return fmt.Errorf("host %s is unreachable; lease ensure WinRM is enabled and the IP is correct: %w", w.host, err)
 	}
@@ -59,6 +97,9 @@ func (w *WinRM) CanLoginVM() error {
 	}
 
 	s, err := winrmClient.CreateShell()
+	if err != nil && isAuthenticationFailure(err) {
+		return fmt.Errorf("%w for user %s with %s authentication: %w", ErrAuthentication, w.username, w.options.auth(), err)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create winrm shell: %w", err)
 	}
@@ -72,13 +113,15 @@ func (w *WinRM) CanLoginVM() error {
 }
 
 func (w *WinRM) UploadArtifact(sourceFilePath, destinationFilePath string) error {
-	client, err := winrmcp.New(w.host, &winrmcp.Config{
+	client, err := winrmcp.New(net.JoinHostPort(w.host, strconv.Itoa(w.options.port())), &winrmcp.Config{
 		Auth:                  winrmcp.Auth{User: w.username, Password: w.password},
-		Https:                 false,
-		Insecure:              true,
+		Https:                 w.options.HTTPS,
+		Insecure:              w.options.InsecureSkipVerify,
+		CACertBytes:           w.options.CACert,
 		ConnectTimeout:        WinRmTimeout,
 		OperationTimeout:      WinRmTimeout,
 		MaxOperationsPerShell: 15,
+		TransportDecorator:    w.options.transportDecorator(w.ctx, w.username, w.password),
 		AllowTimeout:          true,
 	})
 
@@ -102,29 +145,71 @@ func (w *WinRM) UploadArtifact(sourceFilePath, destinationFilePath string) error
 	return client.Copy(sourceFilePath, destinationFilePath)
 }
 
-func (w *WinRM) ExtractArchive(source, destination string) error {
-	command := fmt.Sprintf("powershell.exe Expand-Archive %s %s -Force", source, destination)
-	_, err := w.ExecuteCommand(command)
+// downloadFileScript writes the base64 of a file to stdout, opening it so
+// that files other processes still write to, such as logs, can be read. The
+// file is encoded a chunk at a time rather than read into memory whole; each
+// chunk but the last is filled and a multiple of 3 bytes long, so that the
+// chunks decode as one base64 stream.
+const downloadFileScript = `$ErrorActionPreference = 'Stop'; $f = [IO.File]::Open('%s', 'Open', 'Read', 'ReadWrite'); try { $b = New-Object byte[] 58368; do { $n = 0; do { $r = $f.Read($b, $n, $b.Length - $n); $n += $r } while ($r -gt 0 -and $n -lt $b.Length); if ($n -gt 0) { [Convert]::ToBase64String($b, 0, $n, 'InsertLineBreaks') } } while ($n -eq $b.Length) } finally { $f.Close() }`
+
+// DownloadFile copies the file at source on the VM to dst. WinRM cannot
+// transfer files itself, so the file is sent base64 encoded on the stdout of
+// powershell.
+func (w *WinRM) DownloadFile(source string, dst io.Writer) error {
+	client, err := w.clientFactory.Build(WinRmTimeout)
+	if err != nil {
+		return err
+	}
+
+	r, stdout := io.Pipe()
+	decoded := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(dst, base64.NewDecoder(base64.StdEncoding, r))
+		// Keep reading, as winrm waits for stdout to be read.
+		io.Copy(io.Discard, r) //nolint:errcheck
+		decoded <- err
+	}()
+
+	stderrTail := newTailWriter(StderrTailLines)
+	command := winrm.Powershell(fmt.Sprintf(downloadFileScript, strings.ReplaceAll(source, "'", "''")))
+	exitCode, err := client.RunWithContext(w.ctx, command, stdout, stderrTail)
+	stdout.Close() //nolint:errcheck
+	decodeErr := <-decoded
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return colorlogger.Errorf("unable to read %s: %s", source, stderrTail.String())
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("unable to decode %s: %w", source, decodeErr)
+	}
+
+	return nil
+}
+
+func (w *WinRM) ExtractArchive(source, destination string, output CommandOutput) error {
+	_, err := w.ExecuteCommand(extractArchiveCommand(source, destination), output)
 	return err
 }
 
-func (w *WinRM) ExecuteCommandWithTimeout(command string, timeout time.Duration) (int, error) {
+func (w *WinRM) ExecuteCommandWithTimeout(command string, timeout time.Duration, output CommandOutput) (int, error) {
 	client, err := w.clientFactory.Build(timeout)
 	if err != nil {
 		return -1, err
 	}
-	errBuffer := new(bytes.Buffer)
-	exitCode, err := client.Run(command, os.Stdout, io.MultiWriter(errBuffer, os.Stderr))
+	stderrTail := newTailWriter(StderrTailLines)
+	exitCode, err := client.RunWithContext(w.ctx, command, output.stdout(), io.MultiWriter(stderrTail, output.stderr()))
 	if err == nil && exitCode != 0 {
-		err = fmt.Errorf("%s: %s", PowershellExecutionErrorMessage, errBuffer.String())
+		err = colorlogger.Errorf("%s: %s", PowershellExecutionErrorMessage, stderrTail.String())
 	}
 	return exitCode, err
 }
 
-func (w *WinRM) ExecuteCommand(command string) (int, error) {
-	exitCode, err := w.ExecuteCommandWithTimeout(command, WinRmTimeout)
+func (w *WinRM) ExecuteCommand(command string, output CommandOutput) (int, error) {
+	exitCode, err := w.ExecuteCommandWithTimeout(command, WinRmTimeout, output)
 	if err != nil {
-		return exitCode, fmt.Errorf("error executing '%s': %w", command, err)
+		return exitCode, colorlogger.Errorf("error executing '%s': %w", command, err)
 	}
 
 	return exitCode, nil
@@ -1,25 +1,39 @@
 package remotemanager_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
-
+	"strings"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
 	"github.com/masterzen/winrm"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	. "github.com/onsi/gomega/ghttp"
 
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/colorlogger"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/remotemanager"
 	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/remotemanager/remotemanagerfakes"
 )
 
-func setupTestServer() *Server {
-	server := NewServer()
-
+func setupTestServer(server *Server) *Server {
 	// winRMClient expects: `//w:Selector[@Name='ShellId']`
 	createShellResponse := `<s:Envelope xmlns:s="https://www.w3.org/2003/05/soap-envelope"
 	           xmlns:a="https://schemas.xmlsoap.org/ws/2004/08/addressing"
@@ -79,19 +93,35 @@ var _ = Describe("WinRM RemoteManager", func() {
 		Context("when a command runs successfully", func() {
 			BeforeEach(func() {
 				fakeClient = &remotemanagerfakes.FakeWinRMClient{}
-				fakeClient.RunReturns(0, nil)
+				fakeClient.RunWithContextReturns(0, nil)
 				fakeClientFactory = &remotemanagerfakes.FakeWinRMClientFactoryI{}
 				fakeClientFactory.BuildReturns(fakeClient, nil)
 			})
 
 			It("returns an exit code of 0 and no error", func() {
-				remoteManager := remotemanager.NewWinRM("foo", "bar", "baz", fakeClientFactory)
-				exitCode, err := remoteManager.ExecuteCommand("foobar")
+				remoteManager := remotemanager.NewWinRM(context.Background(), "foo", "bar", "baz", remotemanager.WinRMOptions{}, fakeClientFactory)
+				exitCode, err := remoteManager.ExecuteCommand("foobar", remotemanager.CommandOutput{})
 
 				Expect(err).NotTo(HaveOccurred())
 				Expect(exitCode).To(Equal(0))
 			})
 
+			It("writes the output of the command to the output with secrets redacted", func() {
+				colorlogger.RegisterSecret("winrm-output-secret")
+				fakeClient.RunWithContextCalls(func(_ context.Context, _ string, stdout io.Writer, stderr io.Writer) (int, error) {
+					fmt.Fprint(stdout, "product key winrm-output-secret") //nolint:errcheck
+					fmt.Fprint(stderr, "a warning")                       //nolint:errcheck
+					return 0, nil
+				})
+				stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+
+				remoteManager := remotemanager.NewWinRM(context.Background(), "foo", "bar", "baz", remotemanager.WinRMOptions{}, fakeClientFactory)
+				_, err := remoteManager.ExecuteCommand("foobar", remotemanager.CommandOutput{Stdout: stdout, Stderr: stderr})
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stdout.String()).To(Equal("product key [REDACTED]"))
+				Expect(stderr.String()).To(Equal("a warning"))
+			})
 		})
 
 		Context("when a command does not run successfully", func() {
@@ -103,12 +133,12 @@ var _ = Describe("WinRM RemoteManager", func() {
 
 			Context("when a command returns a nonzero exit code and an error", func() {
 				BeforeEach(func() {
-					fakeClient.RunReturns(2, errors.New("command error"))
+					fakeClient.RunWithContextReturns(2, errors.New("command error"))
 				})
 
 				It("returns the command's nonzero exit code and errors", func() {
-					remoteManager := remotemanager.NewWinRM("foo", "bar", "baz", fakeClientFactory)
-					exitCode, err := remoteManager.ExecuteCommand("foobar")
+					remoteManager := remotemanager.NewWinRM(context.Background(), "foo", "bar", "baz", remotemanager.WinRMOptions{}, fakeClientFactory)
+					exitCode, err := remoteManager.ExecuteCommand("foobar", remotemanager.CommandOutput{})
 
 					Expect(err).To(HaveOccurred())
 					Expect(exitCode).To(Equal(2))
@@ -117,26 +147,42 @@ var _ = Describe("WinRM RemoteManager", func() {
 
 			Context("when a command returns a nonzero exit code but does not error", func() {
 				BeforeEach(func() {
-					fakeClient.RunReturns(2, nil)
+					fakeClient.RunWithContextReturns(2, nil)
 				})
 
 				It("returns the command's nonzero exit code and errors", func() {
-					remoteManager := remotemanager.NewWinRM("foo", "bar", "baz", fakeClientFactory)
-					exitCode, err := remoteManager.ExecuteCommand("foobar")
+					remoteManager := remotemanager.NewWinRM(context.Background(), "foo", "bar", "baz", remotemanager.WinRMOptions{}, fakeClientFactory)
+					exitCode, err := remoteManager.ExecuteCommand("foobar", remotemanager.CommandOutput{})
 
 					Expect(err).To(HaveOccurred())
 					Expect(exitCode).To(Equal(2))
 				})
 			})
 
+			Context("when the command contains a registered secret", func() {
+				BeforeEach(func() {
+					fakeClient.RunWithContextReturns(1, errors.New("command error"))
+				})
+
+				It("redacts the secret from the returned error", func() {
+					colorlogger.RegisterSecret("winrm-setup-secret")
+					remoteManager := remotemanager.NewWinRM(context.Background(), "foo", "bar", "baz", remotemanager.WinRMOptions{}, fakeClientFactory)
+					_, err := remoteManager.ExecuteCommand("setup.ps1 -ProductKey winrm-setup-secret", remotemanager.CommandOutput{})
+
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring("-ProductKey [REDACTED]"))
+					Expect(err.Error()).NotTo(ContainSubstring("winrm-setup-secret"))
+				})
+			})
+
 			Context("when a command exits 0 but errors", func() {
 				BeforeEach(func() {
-					fakeClient.RunReturns(0, errors.New("command error"))
+					fakeClient.RunWithContextReturns(0, errors.New("command error"))
 				})
 
 				It("returns the command's exit code and errors", func() {
-					remoteManager := remotemanager.NewWinRM("foo", "bar", "baz", fakeClientFactory)
-					exitCode, err := remoteManager.ExecuteCommand("foobar")
+					remoteManager := remotemanager.NewWinRM(context.Background(), "foo", "bar", "baz", remotemanager.WinRMOptions{}, fakeClientFactory)
+					exitCode, err := remoteManager.ExecuteCommand("foobar", remotemanager.CommandOutput{})
 
 					Expect(err).To(HaveOccurred())
 					Expect(exitCode).To(Equal(0))
@@ -145,6 +191,84 @@ var _ = Describe("WinRM RemoteManager", func() {
 		})
 	})
 
+	Describe("DownloadFile", func() {
+		var (
+			fakeClientFactory *remotemanagerfakes.FakeWinRMClientFactoryI
+			fakeClient        *remotemanagerfakes.FakeWinRMClient
+			remoteManager     remotemanager.RemoteManager
+		)
+
+		BeforeEach(func() {
+			fakeClient = &remotemanagerfakes.FakeWinRMClient{}
+			fakeClientFactory = &remotemanagerfakes.FakeWinRMClientFactoryI{}
+			fakeClientFactory.BuildReturns(fakeClient, nil)
+			remoteManager = remotemanager.NewWinRM(context.Background(), "foo", "bar", "baz", remotemanager.WinRMOptions{}, fakeClientFactory)
+		})
+
+		It("decodes the file that powershell writes as base64", func() {
+			fakeClient.RunWithContextCalls(func(_ context.Context, _ string, stdout io.Writer, _ io.Writer) (int, error) {
+				fmt.Fprint(stdout, "c2V0dXAg\r\nbG9n\r\n") //nolint:errcheck
+				return 0, nil
+			})
+			var file bytes.Buffer
+
+			Expect(remoteManager.DownloadFile(`C:\Users\O'Brien\log.log`, &file)).To(Succeed())
+			Expect(file.String()).To(Equal("setup log"))
+
+			_, command, _, _ := fakeClient.RunWithContextArgsForCall(0)
+			encoded, found := strings.CutPrefix(command, "powershell.exe -EncodedCommand ")
+			Expect(found).To(BeTrue())
+			script, err := base64.StdEncoding.DecodeString(encoded)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.ReplaceAll(string(script), "\x00", "")).To(ContainSubstring(`[IO.File]::Open('C:\Users\O''Brien\log.log'`))
+		})
+
+		It("decodes a file that powershell encodes a chunk at a time", func() {
+			fakeClient.RunWithContextCalls(func(_ context.Context, _ string, stdout io.Writer, _ io.Writer) (int, error) {
+				fmt.Fprint(stdout, "c2V0\r\n")     //nolint:errcheck
+				fmt.Fprint(stdout, "dXAgbG9n\r\n") //nolint:errcheck
+				return 0, nil
+			})
+			var file bytes.Buffer
+
+			Expect(remoteManager.DownloadFile(`C:\provision\log.log`, &file)).To(Succeed())
+			Expect(file.String()).To(Equal("setup log"))
+
+			_, command, _, _ := fakeClient.RunWithContextArgsForCall(0)
+			script, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(command, "powershell.exe -EncodedCommand "))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.ReplaceAll(string(script), "\x00", "")).To(ContainSubstring(`$f.Read($b, $n, $b.Length - $n)`))
+			Expect(strings.ReplaceAll(string(script), "\x00", "")).NotTo(ContainSubstring("MemoryStream"))
+		})
+
+		It("returns the error output when the file cannot be read", func() {
+			fakeClient.RunWithContextCalls(func(_ context.Context, _ string, _ io.Writer, stderr io.Writer) (int, error) {
+				fmt.Fprint(stderr, "Could not find file") //nolint:errcheck
+				return 1, nil
+			})
+
+			err := remoteManager.DownloadFile(`C:\provision\log.log`, io.Discard)
+			Expect(err).To(MatchError(`unable to read C:\provision\log.log: Could not find file`))
+		})
+
+		It("returns an error when the output is not base64", func() {
+			fakeClient.RunWithContextCalls(func(_ context.Context, _ string, stdout io.Writer, _ io.Writer) (int, error) {
+				fmt.Fprint(stdout, "not base64!") //nolint:errcheck
+				return 0, nil
+			})
+
+			err := remoteManager.DownloadFile(`C:\provision\log.log`, io.Discard)
+			Expect(err).To(MatchError(ContainSubstring(`unable to decode C:\provision\log.log`)))
+		})
+
+		It("returns an error when WinRM cannot be reached", func() {
+			fakeClient.RunWithContextReturns(1, errors.New("connection refused"))
+
+			err := remoteManager.DownloadFile(`C:\provision\log.log`, io.Discard)
+			Expect(err).To(MatchError("connection refused"))
+		})
+	})
+
 	Describe("CanLoginVM", func() {
 		var (
 			testServer  *Server
@@ -152,7 +276,7 @@ var _ = Describe("WinRM RemoteManager", func() {
 		)
 
 		BeforeEach(func() {
-			testServer = setupTestServer()
+			testServer = setupTestServer(NewServer())
 
 			testServerURL, err := url.Parse(testServer.URL())
 			Expect(err).NotTo(HaveOccurred())
@@ -175,7 +299,7 @@ var _ = Describe("WinRM RemoteManager", func() {
 			winRMClientFactory := &remotemanagerfakes.FakeWinRMClientFactoryI{}
 			winRMClientFactory.BuildReturns(winRMClient, nil)
 
-			remotemanager := remotemanager.NewWinRM("some-host", "some-user", "some-pass", winRMClientFactory)
+			remotemanager := remotemanager.NewWinRM(context.Background(), "some-host", "some-user", "some-pass", remotemanager.WinRMOptions{}, winRMClientFactory)
 
 			err := remotemanager.CanLoginVM()
 			Expect(err).NotTo(HaveOccurred())
@@ -186,7 +310,7 @@ var _ = Describe("WinRM RemoteManager", func() {
 			buildErr := errors.New("unable to build a client")
 			winRMClientFactory.BuildReturns(nil, buildErr)
 
-			remotemanager := remotemanager.NewWinRM("some-host", "some-user", "some-pass", winRMClientFactory)
+			remotemanager := remotemanager.NewWinRM(context.Background(), "some-host", "some-user", "some-pass", remotemanager.WinRMOptions{}, winRMClientFactory)
 
 			err := remotemanager.CanLoginVM()
 			Expect(err).To(HaveOccurred())
@@ -201,11 +325,285 @@ var _ = Describe("WinRM RemoteManager", func() {
 			shellErr := errors.New("some shell creation error")
 			winRMClient.CreateShellReturns(nil, shellErr)
 
-			remotemanager := remotemanager.NewWinRM("some-host", "some-user", "some-pass", winRMClientFactory)
+			remotemanager := remotemanager.NewWinRM(context.Background(), "some-host", "some-user", "some-pass", remotemanager.WinRMOptions{}, winRMClientFactory)
 
 			err := remotemanager.CanLoginVM()
 			Expect(err).To(HaveOccurred())
 			Expect(err).To(MatchError(fmt.Errorf("failed to create winrm shell: %w", shellErr)))
 		})
 	})
+
+	Describe("over HTTPS", func() {
+		var (
+			testServer *Server
+			host       string
+			port       int
+			caCert     []byte
+		)
+
+		BeforeEach(func() {
+			testServer = setupTestServer(NewTLSServer())
+			// The handshake errors of the specs with untrusted certificates
+			// are expected.
+			testServer.HTTPTestServer.Config.ErrorLog = log.New(GinkgoWriter, "", 0)
+
+			testServerURL, err := url.Parse(testServer.URL())
+			Expect(err).NotTo(HaveOccurred())
+			host = testServerURL.Hostname()
+			port, err = strconv.Atoi(testServerURL.Port())
+			Expect(err).NotTo(HaveOccurred())
+
+			caCert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: testServer.HTTPTestServer.Certificate().Raw})
+		})
+
+		AfterEach(func() {
+			testServer.Close()
+		})
+
+		newRemoteManager := func(options remotemanager.WinRMOptions) remotemanager.RemoteManager {
+			clientFactory := remotemanager.NewWinRmClientFactory(context.Background(), host, "some-user", "some-pass", options)
+			return remotemanager.NewWinRM(context.Background(), host, "some-user", "some-pass", options, clientFactory)
+		}
+
+		It("logs in when the certificate of the VM is signed by the given CA", func() {
+			remoteManager := newRemoteManager(remotemanager.WinRMOptions{HTTPS: true, Port: port, CACert: caCert})
+
+			Expect(remoteManager.CanLoginVM()).To(Succeed())
+			Expect(testServer.ReceivedRequests()).To(HaveLen(2))
+		})
+
+		It("does not log in when the certificate of the VM is not trusted", func() {
+			remoteManager := newRemoteManager(remotemanager.WinRMOptions{HTTPS: true, Port: port})
+
+			Expect(remoteManager.CanLoginVM()).To(MatchError(ContainSubstring("certificate")))
+			Expect(testServer.ReceivedRequests()).To(BeEmpty())
+		})
+
+		It("logs in without verifying the certificate when asked to", func() {
+			remoteManager := newRemoteManager(remotemanager.WinRMOptions{HTTPS: true, Port: port, InsecureSkipVerify: true})
+
+			Expect(remoteManager.CanLoginVM()).To(Succeed())
+		})
+
+		It("does not log in over HTTP", func() {
+			remoteManager := newRemoteManager(remotemanager.WinRMOptions{Port: port})
+
+			Expect(remoteManager.CanLoginVM()).NotTo(Succeed())
+			Expect(testServer.ReceivedRequests()).To(BeEmpty())
+		})
+
+		It("reaches the VM on the given port", func() {
+			remoteManager := newRemoteManager(remotemanager.WinRMOptions{HTTPS: true, Port: port})
+
+			Expect(remoteManager.CanReachVM()).To(Succeed())
+		})
+	})
+
+	Describe("authentication", func() {
+		var (
+			testServer     *Server
+			host           string
+			port           int
+			authorizations []string
+		)
+
+		BeforeEach(func() {
+			authorizations = nil
+			testServer = NewServer()
+			testServer.RouteToHandler("POST", "/wsman", func(w http.ResponseWriter, req *http.Request) {
+				authorizations = append(authorizations, req.Header.Get("Authorization"))
+				w.Header().Set("WWW-Authenticate", "NTLM")
+				w.WriteHeader(http.StatusUnauthorized)
+			})
+
+			testServerURL, err := url.Parse(testServer.URL())
+			Expect(err).NotTo(HaveOccurred())
+			host = testServerURL.Hostname()
+			port, err = strconv.Atoi(testServerURL.Port())
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			testServer.Close()
+		})
+
+		newRemoteManager := func(options remotemanager.WinRMOptions) remotemanager.RemoteManager {
+			options.Port = port
+			clientFactory := remotemanager.NewWinRmClientFactory(context.Background(), host, "some-user", "some-pass", options)
+			return remotemanager.NewWinRM(context.Background(), host, "some-user", "some-pass", options, clientFactory)
+		}
+
+		It("uses basic authentication by default", func() {
+			err := newRemoteManager(remotemanager.WinRMOptions{}).CanLoginVM()
+
+			Expect(err).To(MatchError(remotemanager.ErrAuthentication))
+			Expect(err).To(MatchError(ContainSubstring("for user some-user with basic authentication")))
+			Expect(authorizations).To(ConsistOf(HavePrefix("Basic ")))
+		})
+
+		It("negotiates NTLM authentication", func() {
+			err := newRemoteManager(remotemanager.WinRMOptions{Auth: remotemanager.WinRMAuthNTLM}).CanLoginVM()
+
+			Expect(err).To(MatchError(remotemanager.ErrAuthentication))
+			Expect(err).To(MatchError(ContainSubstring("with ntlm authentication")))
+			// An anonymous request, then the NTLM negotiate message.
+			Expect(authorizations).To(HaveLen(2))
+			Expect(authorizations[0]).To(BeEmpty())
+			Expect(authorizations[1]).To(HavePrefix("NTLM TlRMTVNTUAAB"))
+		})
+
+		It("reports other failures as failures to create a shell", func() {
+			testServer.RouteToHandler("POST", "/wsman", RespondWith(http.StatusInternalServerError, ""))
+
+			err := newRemoteManager(remotemanager.WinRMOptions{}).CanLoginVM()
+
+			Expect(err).NotTo(MatchError(remotemanager.ErrAuthentication))
+			Expect(err).To(MatchError(ContainSubstring("failed to create winrm shell")))
+		})
+
+		Describe("with kerberos", func() {
+			var options remotemanager.WinRMOptions
+
+			BeforeEach(func() {
+				krb5Config := filepath.Join(GinkgoT().TempDir(), "krb5.conf")
+				Expect(os.WriteFile(krb5Config, []byte("[libdefaults]\n  default_realm = EXAMPLE.COM\n"), 0600)).To(Succeed())
+				options = remotemanager.WinRMOptions{
+					Auth:     remotemanager.WinRMAuthKerberos,
+					Kerberos: remotemanager.KerberosOptions{Config: krb5Config},
+				}
+			})
+
+			It("fails to create a client when the keytab cannot be read", func() {
+				options.Kerberos.Keytab = "/does/not/exist.keytab"
+
+				err := newRemoteManager(options).CanLoginVM()
+
+				Expect(err).To(MatchError(HavePrefix("failed to create winrm client")))
+				Expect(err).To(MatchError(ContainSubstring("unable to read kerberos keytab /does/not/exist.keytab")))
+				Expect(authorizations).To(BeEmpty())
+			})
+
+			It("fails to create a client when the credential cache cannot be read", func() {
+				options.Kerberos.CCache = "/does/not/exist.ccache"
+
+				err := newRemoteManager(options).CanLoginVM()
+
+				Expect(err).To(MatchError(ContainSubstring("unable to read kerberos credential cache /does/not/exist.ccache")))
+			})
+
+			It("fails to create a client when the kerberos config cannot be read", func() {
+				options.Kerberos.Config = "/does/not/exist.conf"
+
+				err := newRemoteManager(options).CanLoginVM()
+
+				Expect(err).To(MatchError(ContainSubstring("unable to read kerberos config /does/not/exist.conf")))
+			})
+
+			Describe("with a service ticket in the credential cache", func() {
+				// sentSPNs are the service principal names of the tickets
+				// sent to WinRM.
+				var sentSPNs []string
+
+				BeforeEach(func() {
+					sentSPNs = nil
+					testServer.RouteToHandler("POST", "/wsman", func(w http.ResponseWriter, req *http.Request) {
+						sentSPNs = append(sentSPNs, ticketSPN(req.Header.Get("Authorization")))
+						w.WriteHeader(http.StatusUnauthorized)
+					})
+				})
+
+				It("asks for the ticket of the given service principal name", func() {
+					options.Kerberos.CCache = writeCCache("EXAMPLE.COM", "HTTP/vm.example.com")
+					options.Kerberos.SPN = "HTTP/vm.example.com"
+
+					err := newRemoteManager(options).CanLoginVM()
+
+					Expect(err).To(MatchError(remotemanager.ErrAuthentication))
+					Expect(sentSPNs).NotTo(BeEmpty())
+					Expect(sentSPNs).To(HaveEach("HTTP/vm.example.com"))
+				})
+
+				It("asks for the ticket of HTTP/<vm-ip> by default", func() {
+					options.Kerberos.CCache = writeCCache("EXAMPLE.COM", "HTTP/vm.example.com", "HTTP/"+host)
+
+					err := newRemoteManager(options).CanLoginVM()
+
+					Expect(err).To(MatchError(remotemanager.ErrAuthentication))
+					Expect(sentSPNs).NotTo(BeEmpty())
+					Expect(sentSPNs).To(HaveEach("HTTP/" + host))
+				})
+			})
+		})
+	})
 })
+
+// writeCCache writes a Kerberos credential cache for some-user with a ticket
+// granting ticket and a service ticket for each of the given service principal
+// names, so that a client using it needs no KDC. The tickets cannot be
+// decrypted, which does not matter as they are only sent to a test server.
+func writeCCache(realm string, spns ...string) string {
+	var b bytes.Buffer
+	write := func(v any) { Expect(binary.Write(&b, binary.BigEndian, v)).To(Succeed()) }
+	writeData := func(data []byte) {
+		write(uint32(len(data)))
+		b.Write(data)
+	}
+	writePrincipal := func(name types.PrincipalName) {
+		write(name.NameType)
+		write(uint32(len(name.NameString)))
+		writeData([]byte(realm))
+		for _, component := range name.NameString {
+			writeData([]byte(component))
+		}
+	}
+
+	user := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "some-user")
+	write(uint16(0x0504)) // version 4
+	write(uint16(0))      // no header fields
+	writePrincipal(user)
+
+	now := time.Now()
+	for _, spn := range append([]string{"krbtgt/" + realm}, spns...) {
+		sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, spn)
+		ticket, err := (&messages.Ticket{
+			TktVNO:  5,
+			Realm:   realm,
+			SName:   sname,
+			EncPart: types.EncryptedData{EType: etypeID.AES256_CTS_HMAC_SHA1_96, Cipher: []byte("not a real ticket")},
+		}).Marshal()
+		Expect(err).NotTo(HaveOccurred())
+
+		writePrincipal(user)
+		writePrincipal(sname)
+		write(uint16(etypeID.AES256_CTS_HMAC_SHA1_96))
+		writeData(make([]byte, 32))                 // session key
+		write(uint32(now.Add(-time.Minute).Unix())) // auth time
+		write(uint32(now.Add(-time.Minute).Unix())) // start time
+		write(uint32(now.Add(time.Hour).Unix()))    // end time
+		write(uint32(0))                            // renew till
+		write(uint8(0))                             // not a user to user ticket
+		write(uint32(0))                            // flags
+		write(uint32(0))                            // addresses
+		write(uint32(0))                            // authorization data
+		writeData(ticket)
+		writeData(nil) // second ticket
+	}
+
+	path := filepath.Join(GinkgoT().TempDir(), "krb5cc")
+	Expect(os.WriteFile(path, b.Bytes(), 0600)).To(Succeed())
+	return path
+}
+
+// ticketSPN returns the service principal name of the ticket in a Negotiate
+// Authorization header.
+func ticketSPN(authorization string) string {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authorization, "Negotiate "))
+	Expect(err).NotTo(HaveOccurred())
+
+	var token spnego.SPNEGOToken
+	Expect(token.Unmarshal(data)).To(Succeed())
+	var krb5Token spnego.KRB5Token
+	Expect(krb5Token.Unmarshal(token.NegTokenInit.MechTokenBytes)).To(Succeed())
+
+	return krb5Token.APReq.Ticket.SName.PrincipalNameString()
+}
@@ -18,7 +18,7 @@ ehci:0.deviceType = "video"
 ehci:0.parent = "-1"
 ehci:0.port = "0"
 floppy0.present = "FALSE"
-guestOS = "windows8srv-64"
+guestOS = "{{.GuestOS}}"
 hgfs.linkRootShare = "true"
 hgfs.mapRootShare = "true"
 hpet0.present = "TRUE"
@@ -78,15 +78,19 @@ vmci0.pciSlotNumber = "35"
 vmci0.present = "TRUE"
 `
 
-func VMXTemplate(vmdkPath string, virtualHWVersion int, w io.Writer) error {
+func VMXTemplate(vmdkPath, guestOS string, virtualHWVersion int, w io.Writer) error {
 	if vmdkPath == "" {
 		return errors.New("vmx template: empty vmdk filename")
 	}
+	if guestOS == "" {
+		return errors.New("vmx template: empty guest OS")
+	}
 	type context struct {
 		VMDKFile  string
+		GuestOS   string
 		HWVersion int
 	}
-	ctxt := context{VMDKFile: vmdkPath, HWVersion: virtualHWVersion}
+	ctxt := context{VMDKFile: vmdkPath, GuestOS: guestOS, HWVersion: virtualHWVersion}
 	t, err := template.New("vmx template").Parse(vmxTemplate)
 	if err != nil {
 		return err
@@ -95,12 +99,12 @@ func VMXTemplate(vmdkPath string, virtualHWVersion int, w io.Writer) error {
 }
 
 // WriteVMXTemplate writes the VMX template for VMDK vmdk to file filename.
-func WriteVMXTemplate(vmdkPath string, virtualHWVersion int, vmxPath string) error {
+func WriteVMXTemplate(vmdkPath, guestOS string, virtualHWVersion int, vmxPath string) error {
 	f, err := os.OpenFile(vmxPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
 	if err != nil {
 		return err
 	}
-	err = VMXTemplate(vmdkPath, virtualHWVersion, f)
+	err = VMXTemplate(vmdkPath, guestOS, virtualHWVersion, f)
 	f.Close() //nolint:errcheck
 	if err != nil {
 		os.Remove(vmxPath) //nolint:errcheck
@@ -17,6 +17,7 @@ import (
 
 const (
 	vmdkPath         = "FooBarBaz.vmdk"
+	guestOS          = "windows2019srvnext-64"
 	virtualHWVersion = 60
 )
 
@@ -30,7 +31,7 @@ var _ = Describe("VMX test", func() {
 
 		It("should render a VMX template", func() {
 			var buf bytes.Buffer
-			err := templates.VMXTemplate(vmdkPath, virtualHWVersion, &buf)
+			err := templates.VMXTemplate(vmdkPath, guestOS, virtualHWVersion, &buf)
 			Expect(err).ToNot(HaveOccurred())
 
 			err = checkVMXTemplate(virtualHWVersion, vmdkPath, buf.String())
@@ -38,9 +39,14 @@ var _ = Describe("VMX test", func() {
 		})
 
 		It("should error when VMX filename is unspecified", func() {
-			err := templates.VMXTemplate("", 0, &buf)
+			err := templates.VMXTemplate("", guestOS, 0, &buf)
 			Expect(err).To(HaveOccurred())
 		})
+
+		It("should error when the guest OS is unspecified", func() {
+			err := templates.VMXTemplate(vmdkPath, "", virtualHWVersion, &buf)
+			Expect(err).To(MatchError("vmx template: empty guest OS"))
+		})
 	})
 
 	Context("VMX template write", func() {
@@ -59,7 +65,7 @@ var _ = Describe("VMX test", func() {
 		It("should write VMX template to file", func() {
 			vmxPath := filepath.Join(tmpDir, "FooBarBaz.vmx")
 
-			err := templates.WriteVMXTemplate(vmdkPath, virtualHWVersion, vmxPath)
+			err := templates.WriteVMXTemplate(vmdkPath, guestOS, virtualHWVersion, vmxPath)
 			Expect(err).ToNot(HaveOccurred())
 
 			b, err := os.ReadFile(vmxPath)
@@ -72,7 +78,7 @@ var _ = Describe("VMX test", func() {
 			Expect(err).ToNot(HaveOccurred())
 
 			// vmx file is deleted if there is an error
-			err = templates.WriteVMXTemplate("", 0, vmxPath)
+			err = templates.WriteVMXTemplate("", guestOS, 0, vmxPath)
 			Expect(err).To(HaveOccurred())
 
 			_, err = os.Stat(vmxPath)
@@ -110,6 +116,7 @@ func parseVMX(vmx string) (map[string]string, error) {
 
 func checkVMXTemplate(hwVersion int, vmdkPath, vmxContent string) error {
 	vmdkPathKeyName := "scsi0:0.fileName"
+	guestOSKeyName := "guestOS"
 	hwVersionKeyName := "virtualHW.version"
 
 	m, err := parseVMX(vmxContent)
@@ -119,6 +126,9 @@ func checkVMXTemplate(hwVersion int, vmdkPath, vmxContent string) error {
 	if s := m[vmdkPathKeyName]; s != vmdkPath {
 		return fmt.Errorf("VMXTemplate: key: %q want: %q got: %q", vmdkPathKeyName, vmdkPath, s)
 	}
+	if s := m[guestOSKeyName]; s != guestOS {
+		return fmt.Errorf("VMXTemplate: key: %q want: %q got: %q", guestOSKeyName, guestOS, s)
+	}
 
 	expectedHWVersion := strconv.Itoa(hwVersion)
 	if s := m[hwVersionKeyName]; s != expectedHWVersion {
@@ -49,6 +49,13 @@ var _ = Describe("Version Utilities", func() {
 			Expect(os).To(Equal("2019"))
 		})
 
+		It("should return 2022 as OS if given version is 2022", func() {
+			versionGetter := version.NewVersionGetter(&VModifier{"2022.1.2"})
+
+			os := versionGetter.GetOs()
+			Expect(os).To(Equal("2022"))
+		})
+
 		It("should return 2012R2 as OS if given version is 1200", func() {
 			versionGetter := version.NewVersionGetter(&VModifier{"1200.5.13"})
 
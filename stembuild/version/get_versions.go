@@ -3,6 +3,8 @@ package version
 import (
 	"fmt"
 	"strings"
+
+	"github.com/cloudfoundry/bosh-windows-stemcell-builder/stembuild/oscatalog"
 )
 
 type VersionGetterModifier interface {
@@ -38,13 +40,13 @@ func (v *VersionGetter) GetVersionWithPatchNumber(patchNumber string) string {
 
 func (v *VersionGetter) GetOs() string {
 	stringArr := strings.Split(v.Version, ".")
-	os := stringArr[0]
+	code := stringArr[0]
 
-	if os == "1200" {
-		return "2012R2"
+	if os, ok := oscatalog.ByVersionCode(code); ok {
+		return os.Name
 	}
 
-	return os
+	return code
 }
 
 var Version = "dev"